@@ -45,15 +45,12 @@ func (acl *WAC) allow(mode string, path string) (int, error) {
 			return 500, err
 		}
 
-		if !p.Exists {
-			continue
-		}
-
 		acl.srv.debug.Println("Checking " + accessType + " <" + mode + "> to " + p.URI + " for WebID: " + acl.user)
 		acl.srv.debug.Println("Looking for policies in " + p.AclFile)
 
 		aclGraph := NewGraph(p.AclURI)
-		aclGraph.ReadFile(p.AclFile)
+		aclGraph.readStorage(acl.srv.Storage, p.AclFile)
+		acl.entail(aclGraph)
 		if aclGraph.Len() > 0 {
 			acl.srv.debug.Println("Found policies in " + p.AclFile)
 			// TODO make it more elegant instead of duplicating code
@@ -78,6 +75,7 @@ func (acl *WAC) allow(mode string, path string) (int, error) {
 						groupURI := debrack(t.Object.String())
 						groupGraph := NewGraph(groupURI)
 						groupGraph.LoadURI(groupURI)
+						acl.entail(groupGraph)
 						if groupGraph.Len() > 0 && groupGraph.One(t.Object, ns.rdf.Get("type"), ns.foaf.Get("Group")) != nil {
 							for range groupGraph.All(t.Object, ns.foaf.Get("member"), NewResource(acl.user)) {
 								acl.srv.debug.Println(acl.user + " listed as a member of the group " + groupURI)
@@ -124,6 +122,7 @@ func (acl *WAC) allow(mode string, path string) (int, error) {
 						groupURI := debrack(t.Object.String())
 						groupGraph := NewGraph(groupURI)
 						groupGraph.LoadURI(groupURI)
+						acl.entail(groupGraph)
 						if groupGraph.Len() > 0 && groupGraph.One(t.Object, ns.rdf.Get("type"), ns.foaf.Get("Group")) != nil {
 							for range groupGraph.All(t.Object, ns.foaf.Get("member"), NewResource(acl.user)) {
 								acl.srv.debug.Println(acl.user + " listed as a member of the group " + groupURI)
@@ -181,6 +180,14 @@ func (acl *WAC) allow(mode string, path string) (int, error) {
 	return 200, nil
 }
 
+// entail adds the inferred triples to a policy or group document, when the
+// server is configured to do so
+func (acl *WAC) entail(g *Graph) {
+	if acl.srv.Config.Inference {
+		g.Infer(OWLEntailment)
+	}
+}
+
 // AllowRead checks if Read access is allowed
 func (acl *WAC) AllowRead(path string) (int, error) {
 	return acl.allow("Read", path)
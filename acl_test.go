@@ -731,6 +731,76 @@ func TestACLGroup(t *testing.T) {
 	assert.Equal(t, 200, response.StatusCode)
 }
 
+func TestACLGroupSubclass(t *testing.T) {
+	request, err := http.NewRequest("HEAD", testServer.URL+aclDir+"abc", nil)
+	assert.NoError(t, err)
+	response, err := user1h.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, 200, response.StatusCode)
+
+	acl := ParseLinkHeader(response.Header.Get("Link")).MatchRel("acl")
+
+	// the group is only a foaf:Group through rdfs:subClassOf
+	groupTriples := "<#Team> <http://www.w3.org/2000/01/rdf-schema#subClassOf> <http://xmlns.com/foaf/0.1/Group> ." +
+		"<#> a <#Team>;" +
+		"	<http://xmlns.com/foaf/0.1/member> <" + user2 + ">."
+
+	request, err = http.NewRequest("PUT", testServer.URL+aclDir+"group", strings.NewReader(groupTriples))
+	assert.NoError(t, err)
+	request.Header.Add("Content-Type", "text/turtle")
+	response, err = user1h.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, 201, response.StatusCode)
+
+	body := "<#Owner>" +
+		"	<http://www.w3.org/ns/auth/acl#accessTo> <" + aclDir + "abc>, <" + acl + ">;" +
+		"	<http://www.w3.org/ns/auth/acl#agent> <" + user1 + ">;" +
+		"	<http://www.w3.org/ns/auth/acl#mode> <http://www.w3.org/ns/auth/acl#Read>, <http://www.w3.org/ns/auth/acl#Write> ." +
+		"<#Group>" +
+		"	<http://www.w3.org/ns/auth/acl#accessTo> <" + aclDir + "abc>;" +
+		"	<http://www.w3.org/ns/auth/acl#agentClass> <" + testServer.URL + aclDir + "group#>;" +
+		"	<http://www.w3.org/ns/auth/acl#mode> <http://www.w3.org/ns/auth/acl#Read> ."
+	request, err = http.NewRequest("PUT", acl, strings.NewReader(body))
+	assert.NoError(t, err)
+	request.Header.Add("Content-Type", "text/turtle")
+	response, err = user1h.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, 201, response.StatusCode)
+
+	request, err = http.NewRequest("HEAD", testServer.URL+aclDir+"abc", nil)
+	assert.NoError(t, err)
+	response, err = user2h.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, 403, response.StatusCode)
+
+	handler.Config.Inference = true
+	request, err = http.NewRequest("HEAD", testServer.URL+aclDir+"abc", nil)
+	assert.NoError(t, err)
+	response, err = user2h.Do(request)
+	handler.Config.Inference = false
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, 200, response.StatusCode)
+
+	request, err = http.NewRequest("DELETE", testServer.URL+aclDir+"group", nil)
+	assert.NoError(t, err)
+	response, err = user1h.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, 200, response.StatusCode)
+
+	request, err = http.NewRequest("DELETE", acl, nil)
+	assert.NoError(t, err)
+	response, err = user1h.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, 200, response.StatusCode)
+}
+
 func TestACLDefaultForNew(t *testing.T) {
 	request, err := http.NewRequest("HEAD", testServer.URL+aclDir, nil)
 	assert.NoError(t, err)
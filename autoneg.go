@@ -83,6 +83,16 @@ func (al AcceptList) Negotiate(alternatives ...string) (contentType string, err
 	return
 }
 
+// Params returns the parameters of the first clause naming contentType exactly.
+func (al AcceptList) Params(contentType string) map[string]string {
+	for _, clause := range al {
+		if clause.Type+"/"+clause.SubType == contentType {
+			return clause.Params
+		}
+	}
+	return nil
+}
+
 // Parse an Accept Header string returning a sorted list of clauses.
 func parseAccept(header string) (accept []Accept, err error) {
 	header = strings.Trim(header, " ")
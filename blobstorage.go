@@ -0,0 +1,273 @@
+package gold
+
+import (
+	"encoding/binary"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// KeyValueStore is a flat store of blobs, such as an object store bucket or
+// an embedded database
+type KeyValueStore interface {
+	// Get returns the value of a key, or os.ErrNotExist if there is none
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	// Delete removes a key; removing a missing key is not an error
+	Delete(key string) error
+	// Keys lists the keys starting with prefix
+	Keys(prefix string) ([]string, error)
+}
+
+// BlobStorage keeps each file as a blob of a KeyValueStore, under its
+// cleaned name. Directories are kept as empty blobs under their name and a
+// trailing slash. Every blob starts with the modification time of the file,
+// as nanoseconds since the epoch in 8 big-endian bytes.
+type BlobStorage struct {
+	kv KeyValueStore
+}
+
+// blobHeader is the length of the modification time stored with each blob
+const blobHeader = 8
+
+// NewBlobStorage returns a storage that keeps its files in kv
+func NewBlobStorage(kv KeyValueStore) *BlobStorage {
+	return &BlobStorage{kv: kv}
+}
+
+func dirKey(key string) string {
+	if key == "/" {
+		return key
+	}
+	return key + "/"
+}
+
+func blobValue(data []byte) []byte {
+	value := make([]byte, blobHeader+len(data))
+	binary.BigEndian.PutUint64(value, uint64(time.Now().UnixNano()))
+	copy(value[blobHeader:], data)
+	return value
+}
+
+func blobTime(value []byte) time.Time {
+	if len(value) < blobHeader {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+}
+
+// stat returns the value of the blob behind a key and whether it is a
+// directory
+func (b *BlobStorage) stat(key string) ([]byte, bool, error) {
+	if key == "/" {
+		return nil, true, nil
+	}
+	value, err := b.kv.Get(key)
+	if err == nil {
+		return value, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, false, err
+	}
+	value, err = b.kv.Get(dirKey(key))
+	if os.IsNotExist(err) {
+		err = os.ErrNotExist
+	}
+	return value, true, err
+}
+
+func (b *BlobStorage) info(key string, value []byte, dir bool) os.FileInfo {
+	if dir {
+		return &fileInfo{name: path.Base(key), mode: os.ModeDir | 0755, modTime: blobTime(value)}
+	}
+	size := int64(len(value) - blobHeader)
+	if size < 0 {
+		size = 0
+	}
+	return &fileInfo{name: path.Base(key), size: size, mode: 0644, modTime: blobTime(value)}
+}
+
+// Stat describes a file or directory
+func (b *BlobStorage) Stat(name string) (os.FileInfo, error) {
+	key := cleanName(name)
+	value, dir, err := b.stat(key)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return b.info(key, value, dir), nil
+}
+
+// OpenFile opens a file with the flags of os.OpenFile. What is written to a
+// file is stored when the file is closed.
+func (b *BlobStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	key := cleanName(name)
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	value, dir, err := b.stat(key)
+	exists := err == nil
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	case exists && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case exists && dir:
+		if writable {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		return &dirFile{info: b.info(key, value, true), list: func() ([]os.FileInfo, error) { return b.ReadDir(key) }}, nil
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !exists:
+		if _, dir, err := b.stat(path.Dir(key)); err != nil || !dir {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		value = blobValue(nil)
+		if err = b.kv.Put(key, value); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	var data []byte
+	if len(value) > blobHeader && !(writable && flag&os.O_TRUNC != 0) {
+		data = append(data, value[blobHeader:]...)
+	}
+	modTime := blobTime(value)
+	written := writable && flag&os.O_TRUNC != 0
+	return &contentFile{
+		data: data,
+		flag: flag,
+		info: func(size int64) os.FileInfo {
+			return &fileInfo{name: path.Base(key), size: size, mode: 0644, modTime: modTime}
+		},
+		onWrite: func([]byte) {
+			written = true
+		},
+		onClose: func(data []byte) error {
+			if !written {
+				return nil
+			}
+			return b.kv.Put(key, blobValue(data))
+		},
+	}, nil
+}
+
+// ReadDir lists a directory, sorted by name
+func (b *BlobStorage) ReadDir(name string) ([]os.FileInfo, error) {
+	key := cleanName(name)
+	if _, dir, err := b.stat(key); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	} else if !dir {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	prefix := dirKey(key)
+	keys, err := b.kv.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var infos []os.FileInfo
+	for _, k := range keys {
+		rest := k[len(prefix):]
+		// the directory itself, or something in a subdirectory
+		if len(rest) == 0 || strings.Contains(strings.TrimSuffix(rest, "/"), "/") {
+			continue
+		}
+		value, err := b.kv.Get(k)
+		if err != nil {
+			continue
+		}
+		dir := strings.HasSuffix(rest, "/")
+		infos = append(infos, b.info(prefix+strings.TrimSuffix(rest, "/"), value, dir))
+	}
+	return sortInfos(infos), nil
+}
+
+// Remove deletes a file or an empty directory
+func (b *BlobStorage) Remove(name string) error {
+	key := cleanName(name)
+	_, dir, err := b.stat(key)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if !dir {
+		return b.kv.Delete(key)
+	}
+	if key == "/" {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrInvalid}
+	}
+	keys, err := b.kv.Keys(dirKey(key))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if k != dirKey(key) {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	return b.kv.Delete(dirKey(key))
+}
+
+// Rename moves a file or a directory and everything under it. A file in
+// the way is replaced, a directory in the way is an error.
+func (b *BlobStorage) Rename(oldname, newname string) error {
+	from, to := cleanName(oldname), cleanName(newname)
+	value, dir, err := b.stat(from)
+	if err != nil || from == "/" {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if from == to {
+		return nil
+	}
+	if _, parent, err := b.stat(path.Dir(to)); err != nil || !parent || hasPathPrefix(to, from) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrInvalid}
+	}
+	if _, target, err := b.stat(to); err == nil && target {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	if !dir {
+		if err = b.kv.Put(to, value); err != nil {
+			return err
+		}
+		return b.kv.Delete(from)
+	}
+	keys, err := b.kv.Keys(dirKey(from))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		value, err := b.kv.Get(k)
+		if err != nil {
+			return err
+		}
+		if err = b.kv.Put(to+k[len(from):], value); err != nil {
+			return err
+		}
+		if err = b.kv.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MkdirAll creates a directory and any missing parents
+func (b *BlobStorage) MkdirAll(name string, perm os.FileMode) error {
+	var missing []string
+	for key := cleanName(name); ; key = path.Dir(key) {
+		_, dir, err := b.stat(key)
+		if err == nil {
+			if !dir {
+				return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		missing = append(missing, key)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := b.kv.Put(dirKey(missing[i]), blobValue(nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
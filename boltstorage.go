@@ -0,0 +1,650 @@
+package gold
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// GraphStorage is a Storage that keeps RDF documents as graphs rather than
+// as text, and can change one in place
+type GraphStorage interface {
+	Storage
+	// UpdateGraph loads the document stored under name into a graph with
+	// the given base, calls fn with it and stores the result. Nothing is
+	// stored when fn returns an error, which UpdateGraph then returns.
+	UpdateGraph(name string, base string, fn func(g *Graph) error) error
+}
+
+// BoltStorage keeps RDF documents as triples in a bolt database, indexed
+// three ways per document, and everything else, including the directories,
+// in another storage. Turtle and N-Triples files are moved into the
+// database when they are closed after writing, provided that they parse and
+// are no larger than MaxDocumentSize; reading one returns it as Turtle with
+// one statement per line.
+//
+// IRIs on the same host as a document are stored relative to it, so that a
+// document reads the same wherever it is moved.
+type BoltStorage struct {
+	// MaxDocumentSize is the size above which RDF files stay on disk
+	MaxDocumentSize int64
+
+	db   *bolt.DB
+	disk Storage
+}
+
+var (
+	boltDocs    = []byte("docs")
+	boltTriples = []byte("triples")
+	boltSPO     = []byte("spo")
+	boltPOS     = []byte("pos")
+	boltOSP     = []byte("osp")
+)
+
+// boltBase is the base RDF files are parsed with before being stored, which
+// only matters for the IRIs that end up relative
+const boltBase = "http://gold.invalid"
+
+// boltHeader starts every document read from the database. It makes the
+// text Turtle, which it has to be for the relative IRIs.
+var boltHeader = "@prefix rdf: <" + string(ns.rdf) + "> .\n\n"
+
+// NewBoltStorage opens or creates the bolt database in file, and keeps what
+// does not go into it in disk
+func NewBoltStorage(file string, disk Storage) (*BoltStorage, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltDocs); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(boltTriples)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStorage{MaxDocumentSize: 1 << 20, db: db, disk: disk}, nil
+}
+
+// Close closes the database
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
+
+// key returns the key a file is stored under, which does not depend on the
+// working directory
+func (b *BoltStorage) key(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	return cleanName(name)
+}
+
+// boltMeta is what the docs bucket holds for each document: the modification
+// time in nanoseconds and the size of the document as read, in 8 big-endian
+// bytes each
+func boltMeta(modTime time.Time, size int64) []byte {
+	meta := make([]byte, 16)
+	binary.BigEndian.PutUint64(meta, uint64(modTime.UnixNano()))
+	binary.BigEndian.PutUint64(meta[8:], uint64(size))
+	return meta
+}
+
+func (b *BoltStorage) info(key string, meta []byte) os.FileInfo {
+	return &fileInfo{
+		name:    path.Base(key),
+		size:    int64(binary.BigEndian.Uint64(meta[8:])),
+		mode:    0644,
+		modTime: time.Unix(0, int64(binary.BigEndian.Uint64(meta))),
+	}
+}
+
+// meta returns the metadata of a document, or nil if it is not in the
+// database
+func (b *BoltStorage) meta(key string) (meta []byte) {
+	b.db.View(func(tx *bolt.Tx) error {
+		if m := tx.Bucket(boltDocs).Get([]byte(key)); m != nil {
+			meta = append(meta, m...)
+		}
+		return nil
+	})
+	return
+}
+
+// render returns the text of a document
+func (b *BoltStorage) render(key string) (data []byte, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		doc := tx.Bucket(boltTriples).Bucket([]byte(key))
+		if doc == nil {
+			return os.ErrNotExist
+		}
+		buf := bytes.NewBufferString(boltHeader)
+		doc.Bucket(boltSPO).ForEach(func(k, v []byte) error {
+			buf.Write(k)
+			buf.WriteString(" .\n")
+			return nil
+		})
+		data = buf.Bytes()
+		return nil
+	})
+	return
+}
+
+// Stat describes a file or directory
+func (b *BoltStorage) Stat(name string) (os.FileInfo, error) {
+	if meta := b.meta(b.key(name)); meta != nil {
+		return b.info(b.key(name), meta), nil
+	}
+	return b.disk.Stat(name)
+}
+
+// OpenFile opens a file with the flags of os.OpenFile. Documents of the
+// database that are opened for writing go back to disk, until they are
+// closed.
+func (b *BoltStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	key := b.key(name)
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if meta := b.meta(key); meta != nil {
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+		if !writable {
+			data, err := b.render(key)
+			if err != nil {
+				return nil, &os.PathError{Op: "open", Path: name, Err: err}
+			}
+			return &contentFile{
+				data: data,
+				flag: flag,
+				info: func(int64) os.FileInfo { return b.info(key, meta) },
+			}, nil
+		}
+		var data []byte
+		if flag&os.O_TRUNC == 0 {
+			var err error
+			if data, err = b.render(key); err != nil {
+				return nil, &os.PathError{Op: "open", Path: name, Err: err}
+			}
+		}
+		if err := writeStorageFile(b.disk, name, data, perm); err != nil {
+			return nil, err
+		}
+		if err := b.delete(key); err != nil {
+			return nil, err
+		}
+	}
+	f, err := b.disk.OpenFile(name, flag, perm)
+	if err != nil || !writable {
+		return f, err
+	}
+	return &boltFile{File: f, b: b, name: name}, nil
+}
+
+// boltFile is a file of the disk storage that has been opened for writing,
+// which may move into the database once it is closed
+type boltFile struct {
+	File
+	b    *BoltStorage
+	name string
+}
+
+func (f *boltFile) Sync() error {
+	if sf, ok := f.File.(syncer); ok {
+		return sf.Sync()
+	}
+	return nil
+}
+
+func (f *boltFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return f.b.absorb(f.name)
+}
+
+// absorb moves an RDF file from disk into the database. Files that are not
+// Turtle or N-Triples, do not parse or are too large stay where they are.
+func (b *BoltStorage) absorb(name string) error {
+	info, err := b.disk.Stat(name)
+	if err != nil || info.IsDir() || info.Size() == 0 || info.Size() > b.MaxDocumentSize {
+		return nil
+	}
+	data, err := readStorageFile(b.disk, name)
+	if err != nil {
+		return nil
+	}
+	switch sniffType(data) {
+	case "text/turtle", "application/n-triples":
+	default:
+		return nil
+	}
+	key := b.key(name)
+	base := boltBase + (&url.URL{Path: key}).EscapedPath()
+	g := NewGraph(base)
+	if err = g.parse(bytes.NewReader(data), "text/turtle", base); err != nil {
+		return nil
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		return b.store(tx, key, base, g, info.ModTime())
+	})
+	if err != nil {
+		return err
+	}
+	return b.disk.Remove(name)
+}
+
+// store replaces the triples of a document with those of g, updating only
+// the index entries that change
+func (b *BoltStorage) store(tx *bolt.Tx, key string, base string, g *Graph, modTime time.Time) error {
+	triples := tx.Bucket(boltTriples)
+	doc, err := triples.CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return err
+	}
+	spo, err := doc.CreateBucketIfNotExists(boltSPO)
+	if err != nil {
+		return err
+	}
+	pos, err := doc.CreateBucketIfNotExists(boltPOS)
+	if err != nil {
+		return err
+	}
+	osp, err := doc.CreateBucketIfNotExists(boltOSP)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{}
+	for triple := range g.IterTriples() {
+		s := encodeTerm(triple.Subject, base)
+		p := encodeTerm(triple.Predicate, base)
+		o := encodeTerm(triple.Object, base)
+		k := s + " " + p + " " + o
+		keep[k] = true
+		if spo.Get([]byte(k)) != nil {
+			continue
+		}
+		if err = spo.Put([]byte(k), []byte{}); err != nil {
+			return err
+		}
+		if err = pos.Put([]byte(p+" "+o+" "+s), []byte(k)); err != nil {
+			return err
+		}
+		if err = osp.Put([]byte(o+" "+s+" "+p), []byte(k)); err != nil {
+			return err
+		}
+	}
+
+	size := int64(len(boltHeader))
+	var gone [][]byte
+	spo.ForEach(func(k, v []byte) error {
+		if keep[string(k)] {
+			size += int64(len(k) + 3)
+		} else {
+			gone = append(gone, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	for _, k := range gone {
+		s, p, o, err := b.split(k, base)
+		if err != nil {
+			return err
+		}
+		if err = spo.Delete(k); err != nil {
+			return err
+		}
+		if err = pos.Delete([]byte(p + " " + o + " " + s)); err != nil {
+			return err
+		}
+		if err = osp.Delete([]byte(o + " " + s + " " + p)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(boltDocs).Put([]byte(key), boltMeta(modTime, size))
+}
+
+// split returns the encoded terms of a key of the spo index
+func (b *BoltStorage) split(k []byte, base string) (s, p, o string, err error) {
+	triple, err := decodeTriple(k, base)
+	if err != nil {
+		return
+	}
+	return encodeTerm(triple.Subject, base), encodeTerm(triple.Predicate, base), encodeTerm(triple.Object, base), nil
+}
+
+// delete removes a document from the database
+func (b *BoltStorage) delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltDocs).Delete([]byte(key)); err != nil {
+			return err
+		}
+		if tx.Bucket(boltTriples).Bucket([]byte(key)) == nil {
+			return nil
+		}
+		return tx.Bucket(boltTriples).DeleteBucket([]byte(key))
+	})
+}
+
+// load adds the triples of a document to g
+func (b *BoltStorage) load(tx *bolt.Tx, key string, g *Graph) error {
+	doc := tx.Bucket(boltTriples).Bucket([]byte(key))
+	if doc == nil {
+		return nil
+	}
+	var src bytes.Buffer
+	doc.Bucket(boltSPO).ForEach(func(k, v []byte) error {
+		src.Write(k)
+		src.WriteString(" .\n")
+		return nil
+	})
+	return newTurtleParser(src.String(), g.uri, g.AddTriple).parse()
+}
+
+// UpdateGraph changes a document in a single transaction. A document that is
+// still on disk is moved into the database.
+func (b *BoltStorage) UpdateGraph(name string, base string, fn func(g *Graph) error) error {
+	key := b.key(name)
+	onDisk := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		g := NewGraph(base)
+		if tx.Bucket(boltDocs).Get([]byte(key)) != nil {
+			if err := b.load(tx, key, g); err != nil {
+				return err
+			}
+		} else if info, err := b.disk.Stat(name); err == nil {
+			if info.IsDir() {
+				return &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+			}
+			g.appendStorage(b.disk, name, base)
+			onDisk = true
+		} else if info, err := b.disk.Stat(filepath.Dir(name)); err != nil || !info.IsDir() {
+			return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		if err := fn(g); err != nil {
+			return err
+		}
+		return b.store(tx, key, base, g, time.Now())
+	})
+	if err == nil && onDisk {
+		err = b.disk.Remove(name)
+	}
+	return err
+}
+
+// Match returns the triples of a document that match a pattern, in which
+// nil terms match anything. It reads a single index.
+func (b *BoltStorage) Match(name string, base string, s, p, o Term) (triples []*Triple, err error) {
+	key := b.key(name)
+	var index []byte
+	var prefix string
+	exact := s != nil && p != nil && o != nil
+	switch {
+	case s != nil:
+		index, prefix = boltSPO, encodeTerm(s, base)+" "
+		if p != nil {
+			prefix += encodeTerm(p, base) + " "
+			if o != nil {
+				prefix += encodeTerm(o, base)
+			}
+		} else if o != nil {
+			index, prefix = boltOSP, encodeTerm(o, base)+" "+prefix
+		}
+	case p != nil:
+		index, prefix = boltPOS, encodeTerm(p, base)+" "
+		if o != nil {
+			prefix += encodeTerm(o, base) + " "
+		}
+	case o != nil:
+		index, prefix = boltOSP, encodeTerm(o, base)+" "
+	default:
+		index = boltSPO
+	}
+	err = b.db.View(func(tx *bolt.Tx) error {
+		doc := tx.Bucket(boltTriples).Bucket([]byte(key))
+		if doc == nil {
+			return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		c := doc.Bucket(index).Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			if exact && len(k) != len(prefix) {
+				continue
+			}
+			if len(v) > 0 {
+				k = v
+			}
+			triple, err := decodeTriple(k, base)
+			if err != nil {
+				return err
+			}
+			triples = append(triples, triple)
+		}
+		return nil
+	})
+	return
+}
+
+// ReadDir lists a directory on disk together with the documents in it that
+// are in the database
+func (b *BoltStorage) ReadDir(name string) ([]os.FileInfo, error) {
+	infos, err := b.disk.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	prefix := dirKey(b.key(name))
+	b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltDocs).Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			if !strings.Contains(string(k[len(prefix):]), "/") {
+				infos = append(infos, b.info(string(k), v))
+			}
+		}
+		return nil
+	})
+	return sortInfos(infos), nil
+}
+
+// children reports whether the database has documents under a directory
+func (b *BoltStorage) children(key string) (found bool) {
+	prefix := []byte(dirKey(key))
+	b.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(boltDocs).Cursor().Seek(prefix)
+		found = k != nil && bytes.HasPrefix(k, prefix)
+		return nil
+	})
+	return
+}
+
+// Remove deletes a file or an empty directory
+func (b *BoltStorage) Remove(name string) error {
+	key := b.key(name)
+	if b.meta(key) != nil {
+		return b.delete(key)
+	}
+	if info, err := b.disk.Stat(name); err == nil && info.IsDir() && b.children(key) {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	return b.disk.Remove(name)
+}
+
+// Rename moves a file or a directory and everything under it, on disk and in
+// the database
+func (b *BoltStorage) Rename(oldname, newname string) error {
+	from, to := b.key(oldname), b.key(newname)
+	if from == to {
+		return nil
+	}
+	if b.meta(from) == nil {
+		if err := b.disk.Rename(oldname, newname); err != nil {
+			return err
+		}
+		return b.move(from, to)
+	}
+	if info, err := b.disk.Stat(newname); err == nil {
+		if info.IsDir() {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrExist}
+		}
+		if err = b.disk.Remove(newname); err != nil {
+			return err
+		}
+	} else if info, err := b.disk.Stat(filepath.Dir(newname)); err != nil || !info.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrInvalid}
+	}
+	return b.move(from, to)
+}
+
+// move renames the documents of the database that are at or under from. A
+// document at to is replaced.
+func (b *BoltStorage) move(from, to string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		docs, triples := tx.Bucket(boltDocs), tx.Bucket(boltTriples)
+		if docs.Get([]byte(to)) != nil {
+			docs.Delete([]byte(to))
+			if err := triples.DeleteBucket([]byte(to)); err != nil {
+				return err
+			}
+		}
+		var keys []string
+		c := docs.Cursor()
+		for k, _ := c.Seek([]byte(from)); k != nil && bytes.HasPrefix(k, []byte(from)); k, _ = c.Next() {
+			if hasPathPrefix(string(k), from) {
+				keys = append(keys, string(k))
+			}
+		}
+		for _, k := range keys {
+			moved := to + k[len(from):]
+			if err := docs.Put([]byte(moved), docs.Get([]byte(k))); err != nil {
+				return err
+			}
+			if err := docs.Delete([]byte(k)); err != nil {
+				return err
+			}
+			dst, err := triples.CreateBucket([]byte(moved))
+			if err != nil {
+				return err
+			}
+			if err = copyBucket(dst, triples.Bucket([]byte(k))); err != nil {
+				return err
+			}
+			if err := triples.DeleteBucket([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// copyBucket copies the contents of src, nested buckets included, to dst
+func copyBucket(dst, src *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		child, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(child, src.Bucket(k))
+	})
+}
+
+// MkdirAll creates a directory and any missing parents on disk. A document
+// in the way is an error, as a file would be.
+func (b *BoltStorage) MkdirAll(name string, perm os.FileMode) error {
+	for key := b.key(name); key != "/"; key = path.Dir(key) {
+		if b.meta(key) != nil {
+			return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+	}
+	return b.disk.MkdirAll(name, perm)
+}
+
+// encodeTerm writes a term as in Turtle, with the IRIs on the host of base
+// relative to it
+func encodeTerm(t Term, base string) string {
+	switch t := t.(type) {
+	case *Resource:
+		return "<" + escapeIRI(relativeRef(base, t.URI)) + ">"
+	case *BlankNode:
+		return "_:" + blankLabel(t.ID)
+	case *Literal:
+		str := quoteLiteral(t.Value)
+		if len(t.Language) > 0 {
+			str += "@" + t.Language
+		} else if t.Datatype != nil {
+			str += "^^" + encodeTerm(t.Datatype, base)
+		}
+		return str
+	}
+	return ""
+}
+
+// decodeTriple parses a key of the spo index
+func decodeTriple(k []byte, base string) (triple *Triple, err error) {
+	p := newTurtleParser(string(k)+" .", base, func(s, p, o Term) {
+		triple = NewTriple(s, p, o)
+	})
+	if err = p.parse(); err == nil && triple == nil {
+		err = errors.New("no triple in index key " + string(k))
+	}
+	return
+}
+
+// relativeRef returns a reference to target that resolves against base,
+// relative to it if both are on the same host
+func relativeRef(base, target string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return target
+	}
+	t, err := url.Parse(target)
+	if err != nil || t.Scheme != b.Scheme || t.User.String() != b.User.String() || t.Host != b.Host || t.Opaque != "" {
+		return target
+	}
+	bpath, tpath := b.EscapedPath(), t.EscapedPath()
+	if len(bpath) == 0 {
+		bpath = "/"
+	}
+	if len(tpath) == 0 {
+		tpath = "/"
+	}
+	ref := ""
+	if tpath != bpath {
+		dirs := strings.Split(bpath[1:strings.LastIndex(bpath, "/")+1], "/")
+		dirs = dirs[:len(dirs)-1]
+		segs := strings.Split(tpath[1:], "/")
+		i := 0
+		for i < len(dirs) && i < len(segs)-1 && dirs[i] == segs[i] {
+			i++
+		}
+		ref = strings.Repeat("../", len(dirs)-i) + strings.Join(segs[i:], "/")
+		if len(ref) == 0 {
+			ref = "./"
+		} else if j := strings.IndexAny(ref, ":/"); j >= 0 && ref[j] == ':' {
+			ref = "./" + ref
+		}
+	}
+	if len(t.RawQuery) > 0 {
+		ref += "?" + t.RawQuery
+	}
+	if t.Fragment != "" || strings.HasSuffix(target, "#") {
+		ref += "#" + t.EscapedFragment()
+	}
+	// empty segments, as in a//b, do not survive being made relative
+	if resolveIRI(base, ref) != target {
+		return target
+	}
+	return ref
+}
@@ -0,0 +1,197 @@
+package gold
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drewolson/testflight"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBoltStorage(t *testing.T) (*BoltStorage, string) {
+	root, err := ioutil.TempDir("", "gold")
+	assert.NoError(t, err)
+	st, err := NewBoltStorage(filepath.Join(root, "gold.db"), FileStorage{})
+	assert.NoError(t, err)
+	data := filepath.Join(root, "data")
+	assert.NoError(t, st.MkdirAll(data, 0755))
+	return st, data
+}
+
+func TestBoltStorage(t *testing.T) {
+	st, root := newTestBoltStorage(t)
+	defer os.RemoveAll(filepath.Dir(root))
+	defer st.Close()
+	testStorage(t, st, root)
+}
+
+func TestBoltStorageDocument(t *testing.T) {
+	st, root := newTestBoltStorage(t)
+	defer os.RemoveAll(filepath.Dir(root))
+	defer st.Close()
+
+	dir := filepath.Join(root, "dir")
+	assert.NoError(t, st.MkdirAll(dir, 0755))
+	file := filepath.Join(dir, "doc")
+	turtle := "@prefix foaf: <http://xmlns.com/foaf/0.1/> .\n<#me> a foaf:Person ; foaf:knows <../other#you>, <http://example.org/#x> ; foaf:name \"Me\" ."
+	assert.NoError(t, writeStorageFile(st, file, []byte(turtle), 0644))
+
+	// the document moved into the database
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	info, err := st.Stat(file)
+	assert.NoError(t, err)
+	data, err := readStorageFile(st, file)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), int64(len(data)))
+	assert.Contains(t, string(data), " <../other#you> .\n")
+	infos, err := st.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, "doc", infos[0].Name())
+	}
+
+	base := "https://example.net/dir/doc"
+	g := NewGraph(base)
+	g.appendStorage(st, file, base)
+	assert.Equal(t, 4, g.Len())
+	assert.NotNil(t, g.One(NewResource(base+"#me"), ns.foaf.Get("knows"), NewResource("https://example.net/other#you")))
+
+	triples, err := st.Match(file, base, NewResource(base+"#me"), ns.foaf.Get("knows"), nil)
+	assert.NoError(t, err)
+	assert.Len(t, triples, 2)
+	triples, err = st.Match(file, base, nil, nil, NewLiteral("Me"))
+	assert.NoError(t, err)
+	if assert.Len(t, triples, 1) {
+		assert.Equal(t, ns.foaf.Get("name").String(), triples[0].Predicate.String())
+	}
+	triples, err = st.Match(file, base, nil, ns.rdf.Get("type"), nil)
+	assert.NoError(t, err)
+	assert.Len(t, triples, 1)
+
+	// a failed update leaves the document alone
+	err = st.UpdateGraph(file, base, func(g *Graph) error {
+		g.Remove(g.One(nil, ns.foaf.Get("name"), nil))
+		return errors.New("no")
+	})
+	assert.EqualError(t, err, "no")
+	triples, _ = st.Match(file, base, nil, ns.foaf.Get("name"), nil)
+	assert.Len(t, triples, 1)
+
+	err = st.UpdateGraph(file, base, func(g *Graph) error {
+		g.Remove(g.One(nil, ns.foaf.Get("name"), nil))
+		g.AddTriple(NewResource(base+"#me"), ns.foaf.Get("nick"), NewLiteral("me"))
+		return nil
+	})
+	assert.NoError(t, err)
+	triples, _ = st.Match(file, base, nil, ns.foaf.Get("name"), nil)
+	assert.Empty(t, triples)
+	triples, _ = st.Match(file, base, nil, ns.foaf.Get("nick"), nil)
+	assert.Len(t, triples, 1)
+
+	// moving keeps the relative IRIs relative
+	moved := filepath.Join(root, "moved")
+	assert.NoError(t, st.Rename(dir, moved))
+	g = NewGraph("https://example.net/moved/doc")
+	g.appendStorage(st, filepath.Join(moved, "doc"), g.URI())
+	assert.NotNil(t, g.One(NewResource("https://example.net/moved/doc#me"), ns.foaf.Get("knows"), NewResource("https://example.net/other#you")))
+	assert.Error(t, st.Remove(moved))
+
+	// opening a document to append to it takes it back to disk
+	f, err := st.OpenFile(filepath.Join(moved, "doc"), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	f.Write([]byte("<#me> <#p> \"appended\" .\n"))
+	_, err = os.Stat(filepath.Join(moved, "doc"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	triples, err = st.Match(filepath.Join(moved, "doc"), base, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, triples, 5)
+
+	assert.NoError(t, removeStorageAll(st, moved))
+	_, err = st.Stat(moved)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRelativeRef(t *testing.T) {
+	base := "http://gold.invalid/a/b/doc"
+	for target, ref := range map[string]string{
+		"http://gold.invalid/a/b/doc":        "",
+		"http://gold.invalid/a/b/doc#x":      "#x",
+		"http://gold.invalid/a/b/other":      "other",
+		"http://gold.invalid/a/b/":           "./",
+		"http://gold.invalid/a/b":            "../b",
+		"http://gold.invalid/a/c/d?q=1":      "../c/d?q=1",
+		"http://gold.invalid/x":              "../../x",
+		"http://gold.invalid/a/b/c:d":        "./c:d",
+		"http://gold.invalid/a/b//c":         "http://gold.invalid/a/b//c",
+		"http://gold.invalid/a/b/doc#":       "#",
+		"https://gold.invalid/a/b/other":     "https://gold.invalid/a/b/other",
+		"http://example.org/a/b/other#x":     "http://example.org/a/b/other#x",
+		"urn:uuid:f81d4fae-7dec-11d0-a765-0": "urn:uuid:f81d4fae-7dec-11d0-a765-0",
+	} {
+		assert.Equal(t, ref, relativeRef(base, target), target)
+	}
+}
+
+func TestServerBoltStorage(t *testing.T) {
+	st, root := newTestBoltStorage(t)
+	defer os.RemoveAll(filepath.Dir(root))
+	defer st.Close()
+	config := NewServerConfig()
+	config.DataRoot = root + "/"
+	s := NewServer(config)
+	s.Storage = st
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		request, _ := http.NewRequest("PUT", "/doc", strings.NewReader("<#a> <#b> <#c> ."))
+		request.Header.Add("Content-Type", "text/turtle")
+		response := r.Do(request)
+		assert.Equal(t, 201, response.StatusCode)
+		_, err := os.Stat(filepath.Join(root, "doc"))
+		assert.True(t, os.IsNotExist(err))
+
+		request, _ = http.NewRequest("PATCH", "/doc", strings.NewReader("INSERT DATA { <#a> <#b> <#d> . }; DELETE DATA { <#a> <#b> <#c> . }"))
+		request.Header.Add("Content-Type", "application/sparql-update")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "1", response.RawResponse.Header.Get("Triples"))
+
+		request, _ = http.NewRequest("PATCH", "/doc", strings.NewReader("INSERT DATA { <#a> <#b> "))
+		request.Header.Add("Content-Type", "application/sparql-update")
+		response = r.Do(request)
+		assert.Equal(t, 400, response.StatusCode)
+
+		request, _ = http.NewRequest("GET", "/doc", nil)
+		request.Header.Add("Accept", "application/n-triples")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, response.Body, "/doc#d> .")
+		assert.NotContains(t, response.Body, "/doc#c> .")
+
+		request, _ = http.NewRequest("PUT", "/image.png", strings.NewReader("\x89PNG\r\n\x1a\n"))
+		request.Header.Add("Content-Type", "image/png")
+		response = r.Do(request)
+		assert.Equal(t, 201, response.StatusCode)
+		_, err = os.Stat(filepath.Join(root, "image.png"))
+		assert.NoError(t, err)
+
+		request, _ = http.NewRequest("GET", "/", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, response.Body, "<doc>")
+		assert.Contains(t, response.Body, "<image.png>")
+
+		request, _ = http.NewRequest("DELETE", "/doc", nil)
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		_, err = st.Stat(filepath.Join(root, "doc"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,424 @@
+package gold
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// canonicalLimit caps the number of n-degree hashes computed for one
+// dataset, since graphs built to be hard to label take exponential time
+const canonicalLimit = 100000
+
+var errCanonicalLimit = errors.New("the dataset is too complex to canonicalize")
+
+// quad is a triple with the name of the graph it belongs to, or nil for the
+// default graph
+type quad struct {
+	*Triple
+	graph Term
+}
+
+// Canonicalize returns the dataset as canonical N-Quads: blank nodes are
+// relabelled following RDF Dataset Canonicalization (RDFC-1.0, also known as
+// URDNA2015) and the statements sorted, so that isomorphic datasets give the
+// same document.
+func (ds *Dataset) Canonicalize() (string, error) {
+	return canonicalNQuads(ds.quads())
+}
+
+// Canonicalize returns the graph as canonical N-Triples, see
+// Dataset.Canonicalize
+func (g *Graph) Canonicalize() (string, error) {
+	return canonicalNQuads(graphQuads(g, nil))
+}
+
+func (ds *Dataset) quads() []quad {
+	quads := graphQuads(ds.def, nil)
+	for _, g := range ds.graphsInOrder() {
+		quads = append(quads, graphQuads(g, g.term)...)
+	}
+	return quads
+}
+
+func graphQuads(g *Graph, name Term) []quad {
+	quads := make([]quad, 0, g.Len())
+	for triple := range g.IterTriples() {
+		quads = append(quads, quad{triple, name})
+	}
+	return quads
+}
+
+func canonicalNQuads(quads []quad) (string, error) {
+	labels, err := newCanonicalizer(quads).labels()
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, len(quads))
+	for i, q := range quads {
+		lines[i] = q.nquad(func(id string) string { return labels[id] })
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, ""), nil
+}
+
+// Isomorphic reports whether two graphs are the same up to the labels of
+// their blank nodes
+func Isomorphic(a, b *Graph) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	ca, err := a.Canonicalize()
+	if err != nil {
+		return false
+	}
+	cb, err := b.Canonicalize()
+	return err == nil && ca == cb
+}
+
+// Diff returns the triples of to that are not in from, and the triples of
+// from that are not in to. Blank nodes are compared by their canonical
+// labels, so a change next to a blank node can show it as both deleted and
+// inserted.
+func Diff(from, to *Graph) (inserted, deleted []*Triple) {
+	a, b := canonicalTriples(from), canonicalTriples(to)
+	for _, key := range sortedStrings(b) {
+		if _, ok := a[key]; !ok {
+			inserted = append(inserted, b[key])
+		}
+	}
+	for _, key := range sortedStrings(a) {
+		if _, ok := b[key]; !ok {
+			deleted = append(deleted, a[key])
+		}
+	}
+	return
+}
+
+// canonicalTriples maps the canonical form of each triple of the graph to the
+// triple; graphs that cannot be canonicalized keep their own labels
+func canonicalTriples(g *Graph) map[string]*Triple {
+	quads := graphQuads(g, nil)
+	labels, err := newCanonicalizer(quads).labels()
+	label := func(id string) string { return labels[id] }
+	if err != nil {
+		label = func(id string) string { return id }
+	}
+	triples := make(map[string]*Triple, len(quads))
+	for _, q := range quads {
+		triples[q.nquad(label)] = q.Triple
+	}
+	return triples
+}
+
+func sortedStrings(m map[string]*Triple) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// nquad writes the quad in canonical N-Quads, with blank node labels
+// replaced by label
+func (q quad) nquad(label func(id string) string) string {
+	buf := make([]byte, 0, 128)
+	for _, t := range [4]Term{q.Subject, q.Predicate, q.Object, q.graph} {
+		if t == nil {
+			continue
+		}
+		buf = append(buf, canonicalTerm(t, label)...)
+		buf = append(buf, ' ')
+	}
+	return string(append(buf, ".\n"...))
+}
+
+func canonicalTerm(t Term, label func(id string) string) string {
+	switch t := t.(type) {
+	case *BlankNode:
+		return "_:" + label(t.ID)
+	case *Literal:
+		s := t.Value
+		s = strings.Replace(s, "\\", "\\\\", -1)
+		s = strings.Replace(s, "\"", "\\\"", -1)
+		s = strings.Replace(s, "\n", "\\n", -1)
+		s = strings.Replace(s, "\r", "\\r", -1)
+		s = "\"" + s + "\""
+		if len(t.Language) > 0 {
+			return s + "@" + t.Language
+		}
+		if dt := termValue(t.Datatype); len(dt) > 0 && dt != xsdStringIRI {
+			return s + "^^<" + dt + ">"
+		}
+		return s
+	}
+	return t.String()
+}
+
+// identifierIssuer hands out labels with a prefix and a counter, remembering
+// the order in which the original labels were seen
+type identifierIssuer struct {
+	prefix  string
+	counter int
+	issued  map[string]string
+	order   []string
+}
+
+func newIdentifierIssuer(prefix string) *identifierIssuer {
+	return &identifierIssuer{prefix: prefix, issued: map[string]string{}}
+}
+
+func (ii *identifierIssuer) issue(id string) string {
+	if label, ok := ii.issued[id]; ok {
+		return label
+	}
+	label := ii.prefix + strconv.Itoa(ii.counter)
+	ii.counter++
+	ii.issued[id] = label
+	ii.order = append(ii.order, id)
+	return label
+}
+
+func (ii *identifierIssuer) has(id string) bool {
+	_, ok := ii.issued[id]
+	return ok
+}
+
+func (ii *identifierIssuer) copy() *identifierIssuer {
+	c := &identifierIssuer{prefix: ii.prefix, counter: ii.counter, issued: make(map[string]string, len(ii.issued))}
+	for k, v := range ii.issued {
+		c.issued[k] = v
+	}
+	c.order = append(c.order, ii.order...)
+	return c
+}
+
+// canonicalizer holds the state of the RDFC-1.0 algorithm
+type canonicalizer struct {
+	quads     map[string][]quad
+	hashes    map[string]string
+	canonical *identifierIssuer
+	calls     int
+}
+
+func newCanonicalizer(quads []quad) *canonicalizer {
+	c := &canonicalizer{
+		quads:     map[string][]quad{},
+		hashes:    map[string]string{},
+		canonical: newIdentifierIssuer("c14n"),
+	}
+	for _, q := range quads {
+		seen := map[string]bool{}
+		for _, t := range [3]Term{q.Subject, q.Object, q.graph} {
+			if bn, ok := t.(*BlankNode); ok && !seen[bn.ID] {
+				seen[bn.ID] = true
+				c.quads[bn.ID] = append(c.quads[bn.ID], q)
+			}
+		}
+	}
+	return c
+}
+
+// labels returns the canonical label of every blank node, by original label
+func (c *canonicalizer) labels() (map[string]string, error) {
+	byHash := map[string][]string{}
+	for id := range c.quads {
+		h := c.firstDegreeHash(id)
+		byHash[h] = append(byHash[h], id)
+	}
+	hashes := make([]string, 0, len(byHash))
+	for h := range byHash {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+
+	// nodes with a unique first degree hash are labelled in hash order
+	for _, h := range hashes {
+		if ids := byHash[h]; len(ids) == 1 {
+			c.canonical.issue(ids[0])
+		}
+	}
+
+	for _, h := range hashes {
+		ids := byHash[h]
+		if len(ids) == 1 {
+			continue
+		}
+		sort.Strings(ids)
+		var results hashResults
+		for _, id := range ids {
+			if c.canonical.has(id) {
+				continue
+			}
+			issuer := newIdentifierIssuer("b")
+			issuer.issue(id)
+			hash, issuer, err := c.nDegreeHash(id, issuer)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, hashResult{hash, issuer})
+		}
+		sort.Stable(results)
+		for _, r := range results {
+			for _, id := range r.issuer.order {
+				c.canonical.issue(id)
+			}
+		}
+	}
+	return c.canonical.issued, nil
+}
+
+type hashResult struct {
+	hash   string
+	issuer *identifierIssuer
+}
+
+type hashResults []hashResult
+
+func (r hashResults) Len() int           { return len(r) }
+func (r hashResults) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r hashResults) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *canonicalizer) firstDegreeHash(id string) string {
+	if h, ok := c.hashes[id]; ok {
+		return h
+	}
+	quads := c.quads[id]
+	lines := make([]string, len(quads))
+	for i, q := range quads {
+		lines[i] = q.nquad(func(other string) string {
+			if other == id {
+				return "a"
+			}
+			return "z"
+		})
+	}
+	sort.Strings(lines)
+	h := hashString(strings.Join(lines, ""))
+	c.hashes[id] = h
+	return h
+}
+
+func (c *canonicalizer) relatedHash(related string, q quad, issuer *identifierIssuer, position string) string {
+	var label string
+	switch {
+	case c.canonical.has(related):
+		label = "_:" + c.canonical.issued[related]
+	case issuer.has(related):
+		label = "_:" + issuer.issued[related]
+	default:
+		label = c.firstDegreeHash(related)
+	}
+	input := position
+	if position != "g" {
+		input += q.Predicate.String()
+	}
+	return hashString(input + label)
+}
+
+func (c *canonicalizer) nDegreeHash(id string, issuer *identifierIssuer) (string, *identifierIssuer, error) {
+	if c.calls++; c.calls > canonicalLimit {
+		return "", nil, errCanonicalLimit
+	}
+
+	related := map[string][]string{}
+	for _, q := range c.quads[id] {
+		for i, t := range [3]Term{q.Subject, q.Object, q.graph} {
+			bn, ok := t.(*BlankNode)
+			if !ok || bn.ID == id {
+				continue
+			}
+			h := c.relatedHash(bn.ID, q, issuer, [3]string{"s", "o", "g"}[i])
+			related[h] = append(related[h], bn.ID)
+		}
+	}
+	hashes := make([]string, 0, len(related))
+	for h := range related {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+
+	data := ""
+	for _, h := range hashes {
+		data += h
+		var (
+			chosenPath   string
+			chosenIssuer *identifierIssuer
+		)
+		err := permute(related[h], func(perm []string) error {
+			issuerCopy := issuer.copy()
+			path := ""
+			var recursion []string
+			for _, node := range perm {
+				if c.canonical.has(node) {
+					path += "_:" + c.canonical.issued[node]
+				} else {
+					if !issuerCopy.has(node) {
+						recursion = append(recursion, node)
+					}
+					path += "_:" + issuerCopy.issue(node)
+				}
+				if len(chosenPath) > 0 && len(path) >= len(chosenPath) && path > chosenPath {
+					return nil
+				}
+			}
+			for _, node := range recursion {
+				hash, result, err := c.nDegreeHash(node, issuerCopy)
+				if err != nil {
+					return err
+				}
+				path += "_:" + issuerCopy.issue(node) + "<" + hash + ">"
+				issuerCopy = result
+				if len(chosenPath) > 0 && len(path) >= len(chosenPath) && path > chosenPath {
+					return nil
+				}
+			}
+			if len(chosenPath) == 0 || path < chosenPath {
+				chosenPath, chosenIssuer = path, issuerCopy
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		data += chosenPath
+		issuer = chosenIssuer
+	}
+	return hashString(data), issuer, nil
+}
+
+// permute calls f with every permutation of ids, in lexicographic order
+func permute(ids []string, f func([]string) error) error {
+	perm := append([]string(nil), ids...)
+	sort.Strings(perm)
+	for {
+		if err := f(perm); err != nil {
+			return err
+		}
+		// next lexicographic permutation
+		i := len(perm) - 2
+		for i >= 0 && perm[i] >= perm[i+1] {
+			i--
+		}
+		if i < 0 {
+			return nil
+		}
+		j := len(perm) - 1
+		for perm[j] <= perm[i] {
+			j--
+		}
+		perm[i], perm[j] = perm[j], perm[i]
+		for l, r := i+1, len(perm)-1; l < r; l, r = l+1, r-1 {
+			perm[l], perm[r] = perm[r], perm[l]
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package gold
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseTestGraph(src string) *Graph {
+	g := NewGraph("https://test.org/doc")
+	g.Parse(strings.NewReader(src), "text/turtle")
+	return g
+}
+
+func TestCanonicalize(t *testing.T) {
+	g := parseTestGraph(`@prefix ex: <http://example.org/vocab#> .
+_:e0 ex:next _:e1 ; ex:prev _:e1 .
+_:e1 ex:next _:e0 ; ex:prev _:e0 .
+`)
+	out, err := g.Canonicalize()
+	assert.NoError(t, err)
+	assert.Equal(t, `_:c14n0 <http://example.org/vocab#next> _:c14n1 .
+_:c14n0 <http://example.org/vocab#prev> _:c14n1 .
+_:c14n1 <http://example.org/vocab#next> _:c14n0 .
+_:c14n1 <http://example.org/vocab#prev> _:c14n0 .
+`, out)
+
+	g = parseTestGraph(`<#a> <#p> "x\ty", "x"^^<http://www.w3.org/2001/XMLSchema#string>, "x"@en .`)
+	out, err = g.Canonicalize()
+	assert.NoError(t, err)
+	assert.Equal(t, "<https://test.org/doc#a> <https://test.org/doc#p> \"x\ty\" .\n"+
+		"<https://test.org/doc#a> <https://test.org/doc#p> \"x\" .\n"+
+		"<https://test.org/doc#a> <https://test.org/doc#p> \"x\"@en .\n", out)
+}
+
+func TestIsomorphic(t *testing.T) {
+	a := parseTestGraph(`<#s> <#p> [ <#q> "1" ; <#r> [ <#q> "2" ] ] .`)
+	b := parseTestGraph(`_:y <#q> "2" . _:x <#r> _:y . <#s> <#p> _:x . _:x <#q> "1" .`)
+	assert.True(t, Isomorphic(a, b))
+
+	// a round trip through Turtle relabels the blank nodes
+	out, err := a.Serialize("text/turtle")
+	assert.NoError(t, err)
+	assert.True(t, Isomorphic(a, parseTestGraph(out)))
+
+	c := parseTestGraph(`_:y <#q> "1" . _:x <#r> _:y . <#s> <#p> _:x . _:x <#q> "2" .`)
+	assert.False(t, Isomorphic(a, c))
+
+	// two triangles and a hexagon look the same to first degree hashes
+	triangles := parseTestGraph(`_:a <#p> _:b . _:b <#p> _:c . _:c <#p> _:a .
+_:d <#p> _:e . _:e <#p> _:f . _:f <#p> _:d .`)
+	hexagon := parseTestGraph(`_:a <#p> _:b . _:b <#p> _:c . _:c <#p> _:d .
+_:d <#p> _:e . _:e <#p> _:f . _:f <#p> _:a .`)
+	assert.False(t, Isomorphic(triangles, hexagon))
+	assert.True(t, Isomorphic(hexagon, parseTestGraph(`_:f <#p> _:a . _:e <#p> _:f . _:d <#p> _:e .
+_:c <#p> _:d . _:b <#p> _:c . _:a <#p> _:b .`)))
+}
+
+func TestCanonicalizeDataset(t *testing.T) {
+	a := NewDataset("https://test.org/")
+	assert.NoError(t, a.Parse(strings.NewReader(`_:g { _:s <http://example.org/p> "x" } <http://example.org/g> { _:t <http://example.org/p> "y" }`), "application/trig"))
+	b := NewDataset("https://test.org/")
+	assert.NoError(t, b.Parse(strings.NewReader(`_:t <http://example.org/p> "y" <http://example.org/g> .
+_:s <http://example.org/p> "x" _:h .
+`), "application/n-quads"))
+	ca, err := a.Canonicalize()
+	assert.NoError(t, err)
+	cb, err := b.Canonicalize()
+	assert.NoError(t, err)
+	assert.Equal(t, ca, cb)
+}
+
+func TestDiff(t *testing.T) {
+	from := parseTestGraph(`<#a> <#p> "1" ; <#q> [ <#r> "x" ] .`)
+	to := parseTestGraph(`<#a> <#p> "2" ; <#q> [ <#r> "x" ] .`)
+	inserted, deleted := Diff(from, to)
+	assert.Equal(t, 1, len(inserted))
+	assert.Equal(t, 1, len(deleted))
+	assert.Equal(t, NewLiteral("2"), inserted[0].Object)
+	assert.Equal(t, NewLiteral("1"), deleted[0].Object)
+
+	inserted, deleted = Diff(from, parseTestGraph(`<#a> <#q> [ <#r> "x" ] ; <#p> "1" .`))
+	assert.Empty(t, inserted)
+	assert.Empty(t, deleted)
+}
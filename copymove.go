@@ -0,0 +1,446 @@
+package gold
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	_path "path"
+	"path/filepath"
+	"strings"
+)
+
+// resetACLHeader asks COPY and MOVE, with the value T, to leave the ACLs
+// of the resources behind, so that at the destination they inherit the ACL
+// of their new container. By default the ,acl files go with the resources.
+const resetACLHeader = "Reset-ACL"
+
+// handleCopyMove answers COPY and MOVE requests natively. The user must be
+// able to read the resource and everything it holds, and write the
+// destination; a MOVE also needs Write on the resource, and the same
+// Control as DELETE does for a container that is not empty. Carrying ACLs
+// to the destination needs Control there.
+//
+// The resource goes with its ,acl, ,meta and ,type files, and with its
+// contents if it is a container. Everything is put together in a staging
+// directory first, where the IRIs of the RDF documents are rewritten for
+// their new place, and only then renamed into place.
+func (s *Server) handleCopyMove(w http.ResponseWriter, req *httpRequest, acl *WAC, resource *pathInfo) *response {
+	r := new(response)
+	move := req.Method == "MOVE"
+
+	stat, err := s.Storage.Stat(resource.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r.respond(404, Skins["404"])
+		}
+		return r.respond(500, err)
+	}
+	isDir := stat.IsDir()
+	depth := req.Header.Get("Depth")
+	if len(depth) > 0 && depth != "infinity" && (move || depth != "0") {
+		return r.respond(400, "400 - Bad Request: invalid Depth: "+depth)
+	}
+	shallow := isDir && depth == "0"
+
+	header := req.Header.Get("Destination")
+	target, err := url.Parse(header)
+	if len(header) == 0 || err != nil {
+		return r.respond(400, "400 - Bad Request: invalid Destination: "+header)
+	}
+	if len(target.Host) > 0 && target.Host != resource.Obj.Host {
+		return r.respond(502, "502 - Bad Gateway: the Destination is on another server")
+	}
+	base, err := url.Parse(resource.URI)
+	if err != nil {
+		return r.respond(500, err)
+	}
+	dest, err := s.pathInfo(base.ResolveReference(&url.URL{Path: target.Path}).String())
+	if err != nil {
+		return r.respond(400, "400 - Bad Request: invalid Destination: "+header)
+	}
+
+	// the resource keeps its kind at the destination, whatever it replaces
+	from, to := strings.TrimSuffix(resource.File, "/"), strings.TrimSuffix(dest.File, "/")
+	fromURI, toURI := strings.TrimSuffix(resource.URI, "/"), strings.TrimSuffix(dest.URI, "/")
+	movedURI := toURI
+	if isDir {
+		movedURI += "/"
+	}
+	switch {
+	case from == to, len(dest.Path) == 0, move && len(resource.Path) == 0,
+		isReservedPath(resource.Path), isReservedPath(dest.Path):
+		return r.respond(403, "403 - Forbidden: cannot "+req.Method+" "+resource.URI+" to "+dest.URI)
+	case strings.HasPrefix(to, from+"/") || strings.HasPrefix(from, to+"/"):
+		return r.respond(409, "409 - Conflict! The Destination is inside the resource, or the other way round.")
+	}
+	if info, err := s.Storage.Stat(_path.Dir(to)); err != nil || !info.IsDir() {
+		return r.respond(409, "409 - Conflict! The container of the Destination does not exist.")
+	}
+
+	locked := []*pathInfo{dest}
+	if move {
+		locked = append(locked, resource)
+	}
+	release, status, err := s.confirmLocks(req, true, locked...)
+	if err != nil {
+		return r.respond(status, err.Error())
+	}
+	defer release()
+	unlock := lockFiles(resource.File, dest.File)
+	defer unlock()
+
+	uris, acls, err := s.treeResources(resource, shallow)
+	if err != nil {
+		return r.respond(500, err)
+	}
+	resetACL := req.Header.Get(resetACLHeader) == "T"
+	for _, uri := range uris {
+		aclRead, err := acl.AllowRead(uri)
+		if aclRead > 200 || err != nil {
+			return r.respond(aclRead, handleStatusText(aclRead, err))
+		}
+	}
+	if move {
+		aclWrite, err := acl.AllowWrite(resource.URI)
+		if aclWrite > 200 || err != nil {
+			return r.respond(aclWrite, handleStatusText(aclWrite, err))
+		}
+		if len(uris) > 1 {
+			aclControl, err := acl.AllowControl(resource.URI)
+			if aclControl > 200 || err != nil {
+				return r.respond(aclControl, handleStatusText(aclControl, err))
+			}
+		}
+	}
+	aclWrite, err := acl.AllowWrite(dest.URI)
+	if aclWrite > 200 || err != nil {
+		return r.respond(aclWrite, handleStatusText(aclWrite, err))
+	}
+	if acls && !resetACL {
+		aclControl, err := acl.AllowControl(dest.URI)
+		if aclControl > 200 || err != nil {
+			return r.respond(aclControl, handleStatusText(aclControl, err))
+		}
+	}
+
+	// what is at the destination is deleted first, as by DELETE
+	existing, err := s.Storage.Stat(to)
+	overwrite := err == nil
+	if overwrite {
+		if req.Header.Get("Overwrite") == "F" {
+			return r.respond(412, "412 - Precondition Failed: the Destination exists")
+		}
+		if existing.IsDir() {
+			empty, err := isEmptyContainer(s.Storage, to)
+			if err != nil {
+				return r.respond(500, err)
+			}
+			if !empty {
+				aclControl, err := acl.AllowControl(dest.URI)
+				if aclControl > 200 || err != nil {
+					return r.respond(aclControl, handleStatusText(aclControl, err))
+				}
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return r.respond(500, err)
+	}
+
+	moved, err := s.pathInfo(movedURI)
+	if err != nil {
+		return r.respond(500, err)
+	}
+	destMembership := s.membership(moved)
+	destMembers := s.members(destMembership, dest)
+	var membership *ldpMembership
+	var members []Term
+	if move {
+		membership = s.membership(resource)
+		members = s.members(membership, resource)
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return r.respond(500, err)
+	}
+	stage := resource.Root + tempPrefix + id
+	staged := stage + "/" + _path.Base(from)
+	if err = s.Storage.MkdirAll(stage, 0755); err != nil {
+		return r.respond(500, err)
+	}
+	defer removeStorageAll(s.Storage, stage)
+	if move {
+		err = s.renameResource(from, staged, isDir, false)
+	} else {
+		err = s.copyResource(from, staged, isDir, shallow)
+	}
+	if err != nil {
+		s.debug.Println(req.Method + " staging err: " + err.Error())
+		return r.respond(500, err)
+	}
+	// a MOVE that fails from here on puts the resource back
+	restore := func() {
+		if move {
+			if err := s.renameResource(staged, from, isDir, true); err != nil {
+				s.debug.Println(req.Method + " restore err: " + err.Error())
+			}
+		}
+	}
+	if resetACL {
+		if err = s.removeACLs(stage); err != nil {
+			restore()
+			return r.respond(500, err)
+		}
+	}
+	if err = s.rewriteTree(stage, staged, fromURI, toURI, resource.Base); err != nil {
+		s.debug.Println(req.Method + " rewriteTree err: " + err.Error())
+		restore()
+		return r.respond(500, err)
+	}
+
+	if overwrite {
+		if err = s.snapshot(dest); err != nil {
+			s.debug.Println(req.Method + " snapshot err: " + err.Error())
+			restore()
+			return r.respond(500, err)
+		}
+		if err = s.deleteResource(dest); err != nil {
+			s.debug.Println(req.Method + " deleteResource err: " + err.Error())
+			restore()
+			return r.respond(500, err)
+		}
+	}
+	if err = s.renameResource(staged, to, isDir, true); err != nil {
+		s.debug.Println(req.Method + " renameResource err: " + err.Error())
+		restore()
+		return r.respond(500, err)
+	}
+
+	moved, err = s.pathInfo(movedURI)
+	if err != nil {
+		return r.respond(500, err)
+	}
+	if err = s.updateMembership(destMembership, moved, destMembers); err != nil {
+		s.debug.Println(req.Method + " updateMembership err: " + err.Error())
+	}
+	if move {
+		if err = s.updateMembership(membership, resource, members); err != nil {
+			s.debug.Println(req.Method + " updateMembership err: " + err.Error())
+		}
+		onDeleteURI(resource.URI)
+	}
+	onUpdateURI(moved.URI)
+
+	if overwrite {
+		return r.respond(204)
+	}
+	w.Header().Set("Location", moved.URI)
+	return r.respond(201)
+}
+
+// isReservedPath reports whether a path is in one of the areas that the
+// server keeps for itself, or names a sidecar rather than a resource
+func isReservedPath(path string) bool {
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if isHiddenFile(segment) || segment == SystemPrefix || isSidecar(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// treeResources returns the URIs of a resource and, unless shallow, of
+// everything in it, and whether any of them has an ACL of its own
+func (s *Server) treeResources(resource *pathInfo, shallow bool) ([]string, bool, error) {
+	file := strings.TrimSuffix(resource.File, "/")
+	uri := strings.TrimSuffix(resource.URI, "/")
+	if !strings.HasSuffix(resource.File, "/") {
+		_, err := s.Storage.Stat(file + ACLSuffix)
+		return []string{resource.URI}, err == nil, nil
+	}
+	var uris []string
+	acls := false
+	err := walkStorage(s.Storage, file, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(name, file))
+		leaf := info.Name()
+		switch {
+		case isHiddenFile(leaf) || (shallow && len(rel) > 0 && leaf != ACLSuffix && leaf != METASuffix && leaf != TYPESuffix):
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		case strings.HasSuffix(leaf, ACLSuffix):
+			acls = true
+		case isSidecar(leaf):
+		case info.IsDir():
+			uris = append(uris, uri+rel+"/")
+		default:
+			uris = append(uris, uri+rel)
+		}
+		return nil
+	})
+	return uris, acls, err
+}
+
+// renameResource renames a document with its ,acl, ,meta and ,type files,
+// or a container, which holds its own. The resource goes last when it
+// enters the tree and first when it leaves it, so that it is never seen
+// without its ACL.
+func (s *Server) renameResource(from, to string, isDir bool, entering bool) error {
+	if !entering {
+		if err := s.Storage.Rename(from, to); err != nil {
+			return err
+		}
+	}
+	if !isDir {
+		for _, suffix := range sidecarSuffixes {
+			err := s.Storage.Rename(from+suffix, to+suffix)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if entering {
+		return s.Storage.Rename(from, to)
+	}
+	return nil
+}
+
+// copyResource copies a document with its ,acl, ,meta and ,type files, or
+// a container with its own and, unless shallow, everything in it but the
+// hidden files
+func (s *Server) copyResource(from, to string, isDir bool, shallow bool) error {
+	if !isDir {
+		for _, suffix := range append([]string{""}, sidecarSuffixes...) {
+			err := s.copyFile(from+suffix, to+suffix)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := s.Storage.MkdirAll(to, 0755); err != nil {
+		return err
+	}
+	infos, err := s.Storage.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := info.Name()
+		own := name == ACLSuffix || name == METASuffix || name == TYPESuffix
+		if isHiddenFile(name) || (shallow && !own) {
+			continue
+		}
+		if info.IsDir() {
+			err = s.copyResource(from+"/"+name, to+"/"+name, true, false)
+		} else {
+			err = s.copyFile(from+"/"+name, to+"/"+name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeACLs removes the ,acl files under a directory
+func (s *Server) removeACLs(dir string) error {
+	return walkStorage(s.Storage, dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(name, ACLSuffix) {
+			return err
+		}
+		return s.Storage.Remove(name)
+	})
+}
+
+// rewriteTree rewrites the RDF documents, and the ,acl and ,meta files,
+// that were copied or moved from the URI from to the staging directory
+// stage, for them to be served at the URI to: the IRIs of the resource and
+// of what it holds are made to point to the new place. staged is where the
+// resource itself was put in stage. Documents that say nothing of this host
+// are left untouched.
+func (s *Server) rewriteTree(stage, staged, from, to, host string) error {
+	return walkStorage(s.Storage, stage, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		leaf := info.Name()
+		if info.IsDir() || isTempFile(leaf) || strings.HasSuffix(leaf, TYPESuffix) {
+			return nil
+		}
+		// RDF is stored as Turtle whatever type it was sent in
+		if !strings.HasSuffix(leaf, ACLSuffix) && !strings.HasSuffix(leaf, METASuffix) {
+			mime := s.readTypeFile(name + TYPESuffix)
+			if len(mime) == 0 {
+				mime, _ = s.TypeDetector.TypeByFile(name)
+			}
+			if !isStoredRDF(mime) {
+				return nil
+			}
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(name, staged))
+		return s.rewriteIRIs(name, from+rel, to+rel, from, to, host)
+	})
+}
+
+// rewriteIRIs rewrites one stored document read at the URI base, for it to
+// be served at newBase, with the IRIs that start with from made to start
+// with to. The other IRIs of the host are written anew too, since they may
+// have been relative to the old place. A document that does not parse would
+// be left pointing to the old place, so it fails the rewrite.
+func (s *Server) rewriteIRIs(file, base, newBase, from, to, host string) error {
+	data, err := readStorageFile(s.Storage, file)
+	if err != nil {
+		return err
+	}
+	g := NewGraph(base)
+	if err = g.parse(bytes.NewReader(data), "text/turtle", base); err != nil {
+		return fmt.Errorf("cannot rewrite the IRIs of %s: %s", base, err)
+	}
+	changed := false
+	rewrite := func(term Term) Term {
+		resource, ok := term.(*Resource)
+		if !ok || !strings.HasPrefix(resource.URI, host+"/") {
+			return term
+		}
+		changed = true
+		if iri, ok := rewriteIRI(resource.URI, from, to); ok {
+			return NewResource(iri)
+		}
+		return term
+	}
+	rewritten := NewGraph(newBase)
+	for triple := range g.IterTriples() {
+		rewritten.AddTriple(rewrite(triple.Subject), rewrite(triple.Predicate), rewrite(triple.Object))
+	}
+	if !changed {
+		return nil
+	}
+	for prefix, uri := range g.Prefixes() {
+		if iri, ok := rewriteIRI(uri, from, to); ok {
+			uri = iri
+		}
+		rewritten.SetPrefix(prefix, uri)
+	}
+	return writeStorageGraph(s.Storage, file, rewritten, "text/turtle")
+}
+
+// rewriteIRI returns the IRI that iri becomes once what is at from is at
+// to, and whether iri is from or something in it
+func rewriteIRI(iri, from, to string) (string, bool) {
+	if iri == from {
+		return to, true
+	}
+	if strings.HasPrefix(iri, from) {
+		switch iri[len(from)] {
+		case '/', '#', ',', '?':
+			return to + iri[len(from):], true
+		}
+	}
+	return iri, false
+}
@@ -0,0 +1,133 @@
+package gold
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/drewolson/testflight"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteIRI(t *testing.T) {
+	for iri, expected := range map[string]string{
+		"http://h/dir/doc":       "http://h/new",
+		"http://h/dir/doc#me":    "http://h/new#me",
+		"http://h/dir/doc,acl":   "http://h/new,acl",
+		"http://h/dir/doc/x":     "http://h/new/x",
+		"http://h/dir/document":  "",
+		"http://h/dir/other#you": "",
+	} {
+		rewritten, ok := rewriteIRI(iri, "http://h/dir/doc", "http://h/new")
+		if len(expected) == 0 {
+			assert.False(t, ok, iri)
+			assert.Equal(t, iri, rewritten)
+		} else {
+			assert.True(t, ok, iri)
+			assert.Equal(t, expected, rewritten)
+		}
+	}
+}
+
+func TestCopyMove(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll("/pod/dir", 0755)
+	s.Storage.MkdirAll("/pod/ro", 0755)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		base := "http://" + r.Url("")
+		writeStorageFile(s.Storage, "/pod/dir/doc", []byte("<"+base+"/dir/doc#me> <http://xmlns.com/foaf/0.1/knows> <"+base+"/dir/other#you>, <http://example.org/#them> ."), 0644)
+		writeStorageFile(s.Storage, "/pod/dir/doc,type", []byte("text/turtle"), 0644)
+		writeStorageFile(s.Storage, "/pod/dir/doc,meta", []byte("<doc> <http://purl.org/dc/terms/title> \"Doc\" ."), 0644)
+		writeStorageFile(s.Storage, "/pod/dir/doc,acl", []byte(`@prefix acl: <http://www.w3.org/ns/auth/acl#> .
+<#all> acl:accessTo <doc> ; acl:agentClass <http://xmlns.com/foaf/0.1/Agent> ; acl:mode acl:Read, acl:Write, acl:Control .`), 0644)
+		writeStorageFile(s.Storage, "/pod/dir/notes.txt", []byte("<"+base+"/dir/doc> is left alone"), 0644)
+		writeStorageFile(s.Storage, "/pod/ro/doc", []byte("<#a> <#b> <#c> ."), 0644)
+		writeStorageFile(s.Storage, "/pod/ro/,acl", []byte(`@prefix acl: <http://www.w3.org/ns/auth/acl#> .
+<#read> acl:accessTo <./> ; acl:defaultForNew <./> ; acl:agentClass <http://xmlns.com/foaf/0.1/Agent> ; acl:mode acl:Read .`), 0644)
+
+		request := func(method, path, destination string, headers ...string) *testflight.Response {
+			req, _ := http.NewRequest(method, path, nil)
+			req.Header.Add("Destination", destination)
+			for i := 0; i+1 < len(headers); i += 2 {
+				req.Header.Add(headers[i], headers[i+1])
+			}
+			return r.Do(req)
+		}
+		read := func(name string) string {
+			data, err := readStorageFile(s.Storage, name)
+			assert.NoError(t, err, name)
+			return string(data)
+		}
+
+		response := request("COPY", "/dir/doc", base+"/dir/copy")
+		assert.Equal(t, 201, response.StatusCode)
+		assert.Equal(t, base+"/dir/copy", response.RawResponse.Header.Get("Location"))
+		assert.Contains(t, read("/pod/dir/doc"), "/dir/doc#me>")
+		data := read("/pod/dir/copy")
+		assert.Contains(t, data, "<#me>")
+		assert.Contains(t, data, "<other#you>")
+		assert.Contains(t, data, "<http://example.org/#them>")
+		assert.NotContains(t, data, "dir/doc")
+		assert.Contains(t, read("/pod/dir/copy,meta"), "<copy>")
+		assert.Contains(t, read("/pod/dir/copy,acl"), "<copy>")
+		assert.Equal(t, "text/turtle", s.readTypeFile("/pod/dir/copy,type"))
+
+		assert.Equal(t, 412, request("COPY", "/dir/doc", "/dir/copy", "Overwrite", "F").StatusCode)
+		assert.Equal(t, 204, request("COPY", "/dir/doc", "/dir/copy").StatusCode)
+		assert.Equal(t, 409, request("COPY", "/dir/doc", "/missing/copy").StatusCode)
+		assert.Equal(t, 409, request("COPY", "/dir/", "/dir/sub/").StatusCode)
+		assert.Equal(t, 403, request("COPY", "/dir/doc", "/dir/doc").StatusCode)
+		assert.Equal(t, 403, request("COPY", "/dir/doc", "/"+TrashPrefix+"/doc").StatusCode)
+		assert.Equal(t, 403, request("COPY", "/dir/doc", "/dir/copy"+ACLSuffix).StatusCode)
+		assert.Equal(t, 502, request("COPY", "/dir/doc", "http://example.org/doc").StatusCode)
+
+		// RDF is stored as Turtle, whatever type it was sent in
+		response = r.Put("/dir/xml", "application/rdf+xml", `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:ex="http://example.org/">
+<rdf:Description rdf:about="sub/x"><ex:p>v</ex:p></rdf:Description></rdf:RDF>`)
+		assert.Equal(t, 201, response.StatusCode)
+		assert.Equal(t, 201, request("COPY", "/dir/xml", "/xmlcopy").StatusCode)
+		assert.Contains(t, read("/pod/xmlcopy"), "<dir/sub/x>")
+
+		// and what does not parse is not left pointing to the old place
+		writeStorageFile(s.Storage, "/pod/dir/bad", []byte("<a> <b> "), 0644)
+		writeStorageFile(s.Storage, "/pod/dir/bad,type", []byte("text/turtle"), 0644)
+		assert.Equal(t, 500, request("COPY", "/dir/bad", "/badcopy").StatusCode)
+		assert.Equal(t, 404, r.Get("/badcopy").StatusCode)
+		assert.Equal(t, 200, r.Delete("/dir/bad", "", "").StatusCode)
+
+		// a container moves with everything in it
+		assert.Equal(t, 400, request("MOVE", "/dir/", "/moved/", "Depth", "0").StatusCode)
+		response = request("MOVE", "/dir/", base+"/moved")
+		assert.Equal(t, 201, response.StatusCode)
+		assert.Equal(t, base+"/moved/", response.RawResponse.Header.Get("Location"))
+		assert.Equal(t, 404, r.Get("/dir/").StatusCode)
+		assert.Equal(t, 200, r.Get("/moved/doc").StatusCode)
+		data = read("/pod/moved/doc")
+		assert.Contains(t, data, "<#me>")
+		assert.Contains(t, data, "<other#you>")
+		assert.NotContains(t, data, "/dir/")
+		assert.Contains(t, read("/pod/moved/doc,acl"), "<doc>")
+		assert.Equal(t, "<"+base+"/dir/doc> is left alone", read("/pod/moved/notes.txt"))
+
+		// copies may leave the ACLs behind
+		assert.Equal(t, 201, request("COPY", "/moved/doc", "/plain", resetACLHeader, "T").StatusCode)
+		_, err := s.Storage.Stat("/pod/plain" + ACLSuffix)
+		assert.True(t, err != nil)
+		assert.Contains(t, read("/pod/plain,meta"), "<plain>")
+
+		// only an empty container is copied without Depth: infinity
+		assert.Equal(t, 201, request("COPY", "/moved/", "/empty/", "Depth", "0").StatusCode)
+		infos, err := s.Storage.ReadDir("/pod/empty")
+		assert.NoError(t, err)
+		assert.Empty(t, infos)
+
+		// the destination must be writable, and a moved resource too
+		assert.Equal(t, 401, request("COPY", "/moved/doc", "/ro/doc").StatusCode)
+		assert.Equal(t, 401, request("MOVE", "/ro/doc", "/fromro").StatusCode)
+		assert.Equal(t, 201, request("COPY", "/ro/doc", "/fromro").StatusCode)
+		assert.Equal(t, 200, r.Get("/ro/doc").StatusCode)
+	})
+}
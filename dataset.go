@@ -0,0 +1,367 @@
+package gold
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Dataset is an RDF dataset: a default graph plus any number of graphs
+// named by a resource or a blank node
+type Dataset struct {
+	uri string
+
+	def    *Graph
+	graphs map[string]*Graph
+	names  map[string]Term
+}
+
+// NewDataset creates a Dataset object with an empty default graph
+func NewDataset(uri string) *Dataset {
+	return &Dataset{
+		uri: uri,
+
+		def:    NewGraph(uri),
+		graphs: map[string]*Graph{},
+		names:  map[string]Term{},
+	}
+}
+
+// URI returns the base URI of the dataset
+func (ds *Dataset) URI() string {
+	return ds.uri
+}
+
+// Default returns the default graph of the dataset
+func (ds *Dataset) Default() *Graph {
+	return ds.def
+}
+
+// Graph returns the graph with the given name, creating it if needed; a nil
+// name stands for the default graph
+func (ds *Dataset) Graph(name Term) *Graph {
+	if name == nil {
+		return ds.def
+	}
+	key := termKey(name)
+	if g, ok := ds.graphs[key]; ok {
+		return g
+	}
+	uri := ds.uri
+	if r, ok := name.(*Resource); ok && (strings.HasPrefix(r.URI, "http:") || strings.HasPrefix(r.URI, "https:")) {
+		uri = r.URI
+	}
+	g := NewGraph(uri)
+	g.term = name
+	ds.graphs[key] = g
+	ds.names[key] = name
+	return g
+}
+
+// Names returns the names of the named graphs, in term order
+func (ds *Dataset) Names() []Term {
+	keys := sortedKeys(ds.names)
+	names := make([]Term, len(keys))
+	for i, key := range keys {
+		names[i] = ds.names[key]
+	}
+	return names
+}
+
+// Len returns the number of triples in all the graphs of the dataset
+func (ds *Dataset) Len() int {
+	n := ds.def.Len()
+	for _, g := range ds.graphs {
+		n += g.Len()
+	}
+	return n
+}
+
+// Union returns a graph holding the triples of every graph in the dataset
+func (ds *Dataset) Union() *Graph {
+	u := NewGraph(ds.uri)
+	for _, g := range append([]*Graph{ds.def}, ds.graphsInOrder()...) {
+		for triple := range g.IterTriples() {
+			u.Add(triple)
+		}
+	}
+	return u
+}
+
+func (ds *Dataset) graphsInOrder() []*Graph {
+	names := ds.Names()
+	graphs := make([]*Graph, len(names))
+	for i, name := range names {
+		graphs[i] = ds.graphs[termKey(name)]
+	}
+	return graphs
+}
+
+// Parse is used to parse an RDF dataset from a reader, using the provided
+// mime type. Formats without named graphs are read into the default graph.
+func (ds *Dataset) Parse(reader io.Reader, mime string) error {
+	mime = strings.TrimSpace(strings.Split(mime, ";")[0])
+	parserName := mimeParser[mime]
+	if len(parserName) == 0 {
+		parserName = "turtle"
+	}
+	if parser, ok := datasetParsers[parserName]; ok {
+		return parser(ds, reader, ds.uri)
+	}
+	return ds.def.parse(reader, mime, ds.uri)
+}
+
+// Serialize is used to serialize a dataset based on a given mime type.
+// Formats without named graphs get the default graph only.
+func (ds *Dataset) Serialize(mime string) (string, error) {
+	buf := new(bytes.Buffer)
+	err := ds.serialize(buf, mime)
+	return buf.String(), err
+}
+
+func (ds *Dataset) serialize(w io.Writer, mime string) error {
+	if mime == "application/ld+json" {
+		b, err := ds.serializeJSONLD()
+		if err == nil {
+			_, err = w.Write(b)
+		}
+		return err
+	}
+	if serializer, ok := datasetSerializers[mimeSerializer[mime]]; ok {
+		return serializer(w, ds)
+	}
+	return ds.def.serialize(w, mime)
+}
+
+// datasetParsers holds the parsers of the formats that can name graphs
+var datasetParsers = map[string]func(*Dataset, io.Reader, string) error{
+	"trig":   parseTriGDataset,
+	"nquads": parseNQuadsDataset,
+	"jsonld": parseJSONLDDataset,
+}
+
+// datasetSerializers holds the serializers of the formats that can name graphs
+var datasetSerializers = map[string]func(io.Writer, *Dataset) error{
+	"trig":   serializeTriG,
+	"nquads": serializeNQuads,
+}
+
+// isDatasetMime reports whether the mime type is one only used for datasets;
+// JSON-LD is also used for plain graphs and does not count
+func isDatasetMime(mime string) bool {
+	_, ok := datasetSerializers[mimeSerializer[mime]]
+	return ok
+}
+
+func parseNQuadsDataset(ds *Dataset, r io.Reader, base string) error {
+	nr := newNTriplesReader(r, true)
+	for {
+		triple, graph, err := nr.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ds.Graph(graph).Add(triple)
+	}
+}
+
+func serializeNQuads(w io.Writer, ds *Dataset) error {
+	bw := bufio.NewWriter(w)
+	for _, g := range append([]*Graph{ds.def}, ds.graphsInOrder()...) {
+		label := ""
+		if g != ds.def {
+			label = " " + g.term.String()
+		}
+		lines := make([]string, 0, g.Len())
+		for triple := range g.IterTriples() {
+			line := triple.String()
+			lines = append(lines, line[:len(line)-2]+label+" .")
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(bw, line); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func parseJSONLDDataset(ds *Dataset, r io.Reader, base string) error {
+	dataSet, err := readJSONLD(r)
+	if err != nil {
+		return err
+	}
+	for name, triples := range dataSet.Graphs {
+		var g *Graph
+		switch {
+		case name == "@default":
+			g = ds.def
+		case strings.HasPrefix(name, "_:"):
+			g = ds.Graph(NewBlankNode(name[2:]))
+		default:
+			g = ds.Graph(NewResource(name))
+		}
+		for _, t := range triples {
+			g.AddTriple(jterm2term(t.Subject), jterm2term(t.Predicate), jterm2term(t.Object))
+		}
+	}
+	return nil
+}
+
+// serializeJSONLD writes the default graph as top level nodes, followed by
+// one node with an @graph for each named graph
+func (ds *Dataset) serializeJSONLD() ([]byte, error) {
+	r := []map[string]interface{}{}
+	r = append(r, jsonldNodes(ds.def)...)
+	for _, g := range ds.graphsInOrder() {
+		r = append(r, map[string]interface{}{
+			"@id":    jsonldID(g.term),
+			"@graph": jsonldNodes(g),
+		})
+	}
+	return json.Marshal(r)
+}
+
+// trigParser reads TriG: Turtle where triples can be wrapped in named graphs
+type trigParser struct {
+	*turtleParser
+	ds    *Dataset
+	graph *Graph
+}
+
+func parseTriG(g *Graph, r io.Reader, base string) error {
+	ds := NewDataset(g.uri)
+	if err := parseTriGDataset(ds, r, base); err != nil {
+		return err
+	}
+	for triple := range ds.Union().IterTriples() {
+		g.Add(triple)
+	}
+	for prefix, uri := range ds.def.prefixes {
+		g.SetPrefix(prefix, uri)
+	}
+	return nil
+}
+
+func parseTriGDataset(ds *Dataset, r io.Reader, base string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	p := &trigParser{ds: ds, graph: ds.def}
+	p.turtleParser = newTurtleParser(string(b), base, func(s, pr, o Term) {
+		p.graph.AddTriple(s, pr, o)
+	})
+	p.syntax = "trig"
+	for {
+		p.skipWS()
+		if p.eof() {
+			break
+		}
+		if err := p.block(); err != nil {
+			return err
+		}
+	}
+	for prefix, uri := range p.prefixes {
+		ds.def.SetPrefix(prefix, uri)
+	}
+	return nil
+}
+
+func (p *trigParser) block() error {
+	p.graph = p.ds.def
+	switch {
+	case p.peek() == '{':
+		return p.wrappedGraph()
+	case p.hasKeyword("GRAPH"):
+		p.pos += len("GRAPH")
+		name, err := p.label()
+		if err != nil {
+			return err
+		}
+		p.graph = p.ds.Graph(name)
+		return p.wrappedGraph()
+	case p.peek() == '@', p.peek() == '(', p.hasKeyword("PREFIX"), p.hasKeyword("BASE"):
+		return p.statement()
+	}
+
+	// a label followed by '{' names a graph, anything else is a triple
+	pos, line := p.pos, p.line
+	if name, err := p.label(); err == nil {
+		p.skipWS()
+		if p.peek() == '{' {
+			p.graph = p.ds.Graph(name)
+			return p.wrappedGraph()
+		}
+	}
+	p.pos, p.line = pos, line
+	return p.statement()
+}
+
+// label reads a graph name: an IRI, a blank node label or []
+func (p *trigParser) label() (Term, error) {
+	p.skipWS()
+	switch {
+	case p.hasPrefix("_:"):
+		return p.blankNodeLabel()
+	case p.peek() == '[':
+		p.pos++
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+		return NewAnonNode(), nil
+	}
+	return p.iri()
+}
+
+func (p *trigParser) wrappedGraph() error {
+	if err := p.expect('{'); err != nil {
+		return err
+	}
+	for {
+		p.skipWS()
+		switch p.peek() {
+		case 0:
+			return p.errorf("expected '}', found end of input")
+		case '}':
+			p.pos++
+			return nil
+		}
+		if err := p.triples(); err != nil {
+			return err
+		}
+		p.skipWS()
+		switch c := p.peek(); c {
+		case '.':
+			p.pos++
+		case '}':
+		default:
+			return p.errorf("expected '.' or '}', found '%c'", c)
+		}
+	}
+}
+
+// serializeTriG writes the default graph as plain triples and each named
+// graph as a block, all relative to the dataset URI
+func serializeTriG(w io.Writer, ds *Dataset) error {
+	tw := newTurtleWriter(w, ds.uri)
+	tw.usePrefixes(ds.def)
+	tw.label(ds.quads())
+	tw.graph(ds.def)
+	for _, g := range ds.graphsInOrder() {
+		tw.w.WriteString(tw.term(tw.relabel(g.term)) + " {\n")
+		tw.indent = "    "
+		tw.graph(g)
+		tw.indent = ""
+		tw.w.WriteString("}\n\n")
+	}
+	return tw.flush()
+}
@@ -0,0 +1,110 @@
+package gold
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const trigDoc = `@prefix ex: <http://example.org/> .
+ex:a ex:p ex:b .
+{ ex:a ex:p ex:c }
+GRAPH ex:g1 { ex:a ex:p "one" . ex:a ex:q 1 }
+ex:g2 { [ ex:p ex:d ] . }
+_:g3 { ex:a ex:p ex:e }
+[] ex:p ex:f .
+`
+
+func TestParseTriG(t *testing.T) {
+	ds := NewDataset("https://test.org/")
+	assert.NoError(t, ds.Parse(strings.NewReader(trigDoc), "application/trig"))
+	assert.Equal(t, 7, ds.Len())
+	assert.Equal(t, 3, ds.Default().Len())
+	assert.Equal(t, 3, len(ds.Names()))
+
+	g1 := ds.Graph(NewResource("http://example.org/g1"))
+	assert.Equal(t, 2, g1.Len())
+	assert.NotNil(t, g1.One(NewResource("http://example.org/a"), NewResource("http://example.org/p"), NewLiteral("one")))
+	assert.Equal(t, "http://example.org/g1", g1.URI())
+	assert.Equal(t, 1, ds.Graph(NewResource("http://example.org/g2")).Len())
+	assert.Equal(t, 1, ds.Graph(NewBlankNode("g3")).Len())
+
+	g := NewGraph("https://test.org/")
+	g.Parse(strings.NewReader(trigDoc), "application/trig")
+	assert.Equal(t, 7, g.Len())
+}
+
+func TestParseTriGError(t *testing.T) {
+	for _, src := range []string{
+		`<a> { <b> <c> <d> `,
+		`GRAPH <a> <b> <c> .`,
+		`{ @prefix ex: <http://example.org/> . }`,
+		`<a> <b> { <c> <d> <e> }`,
+	} {
+		ds := NewDataset("https://test.org/")
+		assert.Error(t, ds.Parse(strings.NewReader(src), "application/trig"), src)
+	}
+}
+
+func TestNQuadsDataset(t *testing.T) {
+	src := `<http://example.org/a> <http://example.org/p> "x" .
+<http://example.org/a> <http://example.org/p> "y" <http://example.org/g> .
+_:b <http://example.org/p> <http://example.org/c> _:g .
+`
+	ds := NewDataset("https://test.org/")
+	assert.NoError(t, ds.Parse(strings.NewReader(src), "application/n-quads"))
+	assert.Equal(t, 1, ds.Default().Len())
+	assert.Equal(t, 2, len(ds.Names()))
+
+	out, err := ds.Serialize("application/n-quads")
+	assert.NoError(t, err)
+	assert.Equal(t, src, out)
+
+	// formats without named graphs only get the default graph
+	out, err = ds.Serialize("application/n-triples")
+	assert.NoError(t, err)
+	assert.Equal(t, "<http://example.org/a> <http://example.org/p> \"x\" .\n", out)
+}
+
+func TestSerializeTriG(t *testing.T) {
+	ds := NewDataset("https://test.org/doc")
+	ds.Default().AddTriple(NewResource("https://test.org/doc#a"), NewResource("https://test.org/doc#p"), NewLiteral("x"))
+	ds.Graph(NewResource("https://test.org/other")).AddTriple(NewResource("https://test.org/other#a"), ns.rdf.Get("type"), NewResource("https://test.org/doc#T"))
+
+	out, err := ds.Serialize("application/trig")
+	assert.NoError(t, err)
+	assert.Equal(t, `@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .
+
+<#a>
+    <#p> "x" .
+
+<other> {
+    <other#a>
+        a <#T> .
+
+}
+
+`, out)
+
+	back := NewDataset("https://test.org/doc")
+	assert.NoError(t, back.Parse(strings.NewReader(out), "application/trig"))
+	assert.Equal(t, 2, back.Len())
+	assert.Equal(t, 1, back.Graph(NewResource("https://test.org/other")).Len())
+}
+
+func TestJSONLDDataset(t *testing.T) {
+	src := `[{"@id": "http://example.org/a", "http://example.org/p": "x"},
+{"@id": "http://example.org/g", "@graph": [{"@id": "http://example.org/a", "http://example.org/p": "y"}]}]`
+	ds := NewDataset("https://test.org/")
+	assert.NoError(t, ds.Parse(strings.NewReader(src), "application/ld+json"))
+	assert.Equal(t, 1, ds.Default().Len())
+	assert.Equal(t, 1, ds.Graph(NewResource("http://example.org/g")).Len())
+
+	ds = NewDataset("https://test.org/")
+	ds.Default().AddTriple(NewResource("a"), NewResource("b"), NewResource("c"))
+	ds.Graph(NewResource("g")).AddTriple(NewBlankNode("n"), NewResource("b"), NewResource("c"))
+	out, err := ds.Serialize("application/ld+json")
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"@id":"a","b":[{"@id":"c"}]},{"@graph":[{"@id":"_:n","b":[{"@id":"c"}]}],"@id":"g"}]`, out)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,9 +12,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 
 	jsonld "github.com/linkeddata/gojsonld"
-	crdf "github.com/presbrey/goraptor"
 )
 
 // AnyGraph defines methods common to Graph types
@@ -28,7 +29,7 @@ type AnyGraph interface {
 	IterTriples() chan *Triple
 
 	ReadFile(string)
-	WriteFile(*os.File, string) error
+	WriteFile(io.Writer, string) error
 }
 
 var (
@@ -43,10 +44,15 @@ var (
 
 // Graph structure
 type Graph struct {
-	triples map[*Triple]bool
+	triples *tripleIndex
 
 	uri  string
 	term Term
+
+	// prefixes holds the namespace prefixes declared by the documents read
+	// into the graph, wellKnown those the Turtle serializer may add
+	prefixes  map[string]string
+	wellKnown map[string]string
 }
 
 // NewGraph creates a Graph object
@@ -55,7 +61,7 @@ func NewGraph(uri string) *Graph {
 		panic(uri)
 	}
 	return &Graph{
-		triples: make(map[*Triple]bool),
+		triples: newTripleIndex(),
 
 		uri:  uri,
 		term: NewResource(uri),
@@ -64,7 +70,7 @@ func NewGraph(uri string) *Graph {
 
 // Len returns the length of the graph as number of triples in the graph
 func (g *Graph) Len() int {
-	return len(g.triples)
+	return g.triples.size
 }
 
 // Term returns a Graph Term object
@@ -77,19 +83,28 @@ func (g *Graph) URI() string {
 	return g.uri
 }
 
-func term2term(term crdf.Term) Term {
-	switch term := term.(type) {
-	case *crdf.Blank:
-		return NewBlankNode(term.String())
-	case *crdf.Literal:
-		if len(term.Datatype) > 0 {
-			return NewLiteralWithLanguageAndDatatype(term.Value, term.Lang, NewResource(term.Datatype))
-		}
-		return NewLiteral(term.Value)
-	case *crdf.Uri:
-		return NewResource(term.String())
+// SetPrefix declares a namespace prefix, which is kept when the graph is
+// written as Turtle
+func (g *Graph) SetPrefix(prefix string, uri string) {
+	if g.prefixes == nil {
+		g.prefixes = map[string]string{}
 	}
-	return nil
+	g.prefixes[prefix] = uri
+}
+
+// Prefixes returns the namespace prefixes declared for the graph
+func (g *Graph) Prefixes() map[string]string {
+	prefixes := make(map[string]string, len(g.prefixes))
+	for prefix, uri := range g.prefixes {
+		prefixes[prefix] = uri
+	}
+	return prefixes
+}
+
+// UsePrefixes sets well-known prefixes that the Turtle serializer uses to
+// abbreviate IRIs; unlike declared prefixes they are only written when used
+func (g *Graph) UsePrefixes(prefixes map[string]string) {
+	g.wellKnown = prefixes
 }
 
 func jterm2term(term jsonld.Term) Term {
@@ -107,51 +122,73 @@ func jterm2term(term jsonld.Term) Term {
 	return nil
 }
 
-// One returns one triple based on a triple pattern of S, P, O objects
-func (g *Graph) One(s Term, p Term, o Term) *Triple {
+// wellFormedLists finds the well formed collections of a graph: chains of blank
+// nodes that only have one rdf:first and one rdf:rest, are used once and end
+// in rdf:nil. It returns the items of each list by head node, and the set of
+// nodes that make up the lists.
+func wellFormedLists(g *Graph) (lists map[string][]Term, members map[string]bool) {
+	first, rest := ns.rdf.Get("first"), ns.rdf.Get("rest")
+	refs := map[string]int{}
 	for triple := range g.IterTriples() {
-		if s != nil {
-			if p != nil {
-				if o != nil {
-					if triple.Subject.Equal(s) && triple.Predicate.Equal(p) && triple.Object.Equal(o) {
-						return triple
-					}
-				} else {
-					if triple.Subject.Equal(s) && triple.Predicate.Equal(p) {
-						return triple
-					}
-				}
-			} else {
-				if triple.Subject.Equal(s) {
-					return triple
-				}
-			}
-		} else if p != nil {
-			if o != nil {
-				if triple.Predicate.Equal(p) && triple.Object.Equal(o) {
-					return triple
-				}
-			} else {
-				if triple.Predicate.Equal(p) {
-					return triple
-				}
-			}
-		} else if o != nil {
-			if triple.Object.Equal(o) {
-				return triple
-			}
-		} else {
-			return triple
+		if _, ok := triple.Object.(*BlankNode); ok {
+			refs[termKey(triple.Object)]++
 		}
 	}
-	return nil
+	isListNode := func(n Term) bool {
+		if _, ok := n.(*BlankNode); !ok || refs[termKey(n)] != 1 {
+			return false
+		}
+		return len(g.All(n, nil, nil)) == 2 && len(g.All(n, first, nil)) == 1 && len(g.All(n, rest, nil)) == 1
+	}
+
+	lists, members = map[string][]Term{}, map[string]bool{}
+	for triple := range g.IterTriples() {
+		if !isListNode(triple.Object) || triple.Predicate.Equal(rest) && isListNode(triple.Subject) {
+			continue
+		}
+		var (
+			items []Term
+			chain []string
+		)
+		seen := map[string]bool{}
+		n := triple.Object
+		for isListNode(n) && !seen[termKey(n)] {
+			seen[termKey(n)] = true
+			chain = append(chain, termKey(n))
+			items = append(items, g.One(n, first, nil).Object)
+			n = g.One(n, rest, nil).Object
+		}
+		if !n.Equal(ns.rdf.Get("nil")) {
+			continue
+		}
+		lists[termKey(triple.Object)] = items
+		for _, key := range chain {
+			members[key] = true
+		}
+	}
+	return
+}
+
+// One returns one triple based on a triple pattern of S, P, O objects
+func (g *Graph) One(s Term, p Term, o Term) *Triple {
+	var triple *Triple
+	g.triples.match(s, p, o, func(t *Triple) bool {
+		triple = t
+		return false
+	})
+	return triple
 }
 
 // IterTriples iterates through all the triples in a graph
 func (g *Graph) IterTriples() (ch chan *Triple) {
+	triples := make([]*Triple, 0, g.triples.size)
+	g.triples.match(nil, nil, nil, func(t *Triple) bool {
+		triples = append(triples, t)
+		return true
+	})
 	ch = make(chan *Triple)
 	go func() {
-		for triple := range g.triples {
+		for _, triple := range triples {
 			ch <- triple
 		}
 		close(ch)
@@ -159,101 +196,39 @@ func (g *Graph) IterTriples() (ch chan *Triple) {
 	return ch
 }
 
-// Add is used to add a Triple object to the graph
+// Add is used to add a Triple object to the graph, unless an equal triple is already present
 func (g *Graph) Add(t *Triple) {
-	g.triples[t] = true
+	g.triples.add(t)
 }
 
 // AddTriple is used to add a triple made of individual S, P, O objects
 func (g *Graph) AddTriple(s Term, p Term, o Term) {
-	g.triples[NewTriple(s, p, o)] = true
+	g.triples.add(NewTriple(s, p, o))
 }
 
-// Remove is used to remove a Triple object
+// Remove is used to remove the triple equal to the given Triple object
 func (g *Graph) Remove(t *Triple) {
-	delete(g.triples, t)
+	g.triples.remove(t)
 }
 
 // All is used to return all triples that match a given pattern of S, P, O objects
 func (g *Graph) All(s Term, p Term, o Term) []*Triple {
 	var triples []*Triple
-	for triple := range g.IterTriples() {
-		if s != nil {
-			if p != nil {
-				if o != nil {
-					if triple.Subject.Equal(s) && triple.Predicate.Equal(p) && triple.Object.Equal(o) {
-						triples = append(triples, triple)
-					}
-				} else {
-					if triple.Subject.Equal(s) && triple.Predicate.Equal(p) {
-						triples = append(triples, triple)
-					}
-				}
-			} else {
-				if triple.Subject.Equal(s) {
-					triples = append(triples, triple)
-				}
-			}
-		} else if p != nil {
-			if o != nil {
-				if triple.Predicate.Equal(p) && triple.Object.Equal(o) {
-					triples = append(triples, triple)
-				}
-			} else {
-				if triple.Predicate.Equal(p) {
-					triples = append(triples, triple)
-				}
-			}
-		} else if o != nil {
-			if triple.Object.Equal(o) {
-				triples = append(triples, triple)
-			}
-		}
+	if s == nil && p == nil && o == nil {
+		return triples
 	}
+	g.triples.match(s, p, o, func(t *Triple) bool {
+		triples = append(triples, t)
+		return true
+	})
 	return triples
 }
 
-// AddStatement adds a Statement object
-func (g *Graph) AddStatement(st *crdf.Statement) {
-	s, p, o := term2term(st.Subject), term2term(st.Predicate), term2term(st.Object)
-	for range g.All(s, p, o) {
-		return
-	}
-	g.AddTriple(s, p, o)
-}
-
 // Parse is used to parse RDF data from a reader, using the provided mime type
 func (g *Graph) Parse(reader io.Reader, mime string) {
-	parserName := mimeParser[mime]
-	if len(parserName) == 0 {
-		parserName = "guess"
-	}
-	if parserName == "jsonld" {
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(reader)
-		jsonData, err := jsonld.ReadJSON(buf.Bytes())
-		options := &jsonld.Options{}
-		options.Base = ""
-		options.ProduceGeneralizedRdf = false
-		dataSet, err := jsonld.ToRDF(jsonData, options)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		for t := range dataSet.IterTriples() {
-			g.AddTriple(jterm2term(t.Subject), jterm2term(t.Predicate), jterm2term(t.Object))
-		}
-
-	} else {
-		parser := crdf.NewParser(parserName)
-		parser.SetLogHandler(func(level int, message string) {
-			log.Println(message)
-		})
-		defer parser.Free()
-		out := parser.Parse(reader, g.uri)
-		for s := range out {
-			g.AddStatement(s)
-		}
+	err := g.parse(reader, mime, g.uri)
+	if err != nil {
+		log.Println(err)
 	}
 }
 
@@ -262,53 +237,86 @@ func (g *Graph) ParseBase(reader io.Reader, mime string, baseURI string) {
 	if len(baseURI) < 1 {
 		baseURI = g.uri
 	}
+	err := g.parse(reader, mime, baseURI)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (g *Graph) parse(reader io.Reader, mime string, baseURI string) error {
+	mime = strings.TrimSpace(strings.Split(mime, ";")[0])
 	parserName := mimeParser[mime]
 	if len(parserName) == 0 {
-		parserName = "guess"
+		parserName = "turtle"
 	}
-	parser := crdf.NewParser(parserName)
-	defer parser.Free()
-	out := parser.Parse(reader, baseURI)
-	for s := range out {
-		g.AddStatement(s)
+	if parserName == "jsonld" {
+		return g.parseJSONLD(reader)
+	}
+	parser, ok := rdfParsers[parserName]
+	if !ok {
+		return errors.New("no RDF parser available for " + mime)
 	}
+	return parser(g, reader, baseURI)
 }
 
-// ReadFile is used to read RDF data from a file into the graph
-func (g *Graph) ReadFile(filename string) {
-	stat, err := os.Stat(filename)
-	if os.IsNotExist(err) {
-		return
-	} else if stat.IsDir() {
-		return
-	} else if !stat.IsDir() && err != nil {
-		log.Println(err)
-		return
+func (g *Graph) parseJSONLD(reader io.Reader) error {
+	dataSet, err := readJSONLD(reader)
+	if err != nil {
+		return err
 	}
-	f, err := os.OpenFile(filename, os.O_RDONLY, 0)
-	defer f.Close()
+	for t := range dataSet.IterTriples() {
+		g.AddTriple(jterm2term(t.Subject), jterm2term(t.Predicate), jterm2term(t.Object))
+	}
+	return nil
+}
+
+// readJSONLD expands a JSON-LD document into its RDF dataset
+func readJSONLD(reader io.Reader) (*jsonld.Dataset, error) {
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+	jsonData, err := jsonld.ReadJSON(buf.Bytes())
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, err
 	}
-	g.Parse(f, "text/turtle")
+	options := &jsonld.Options{}
+	options.Base = ""
+	options.ProduceGeneralizedRdf = false
+	return jsonld.ToRDF(jsonData, options)
+}
+
+// ReadFile is used to read RDF data from a file into the graph
+func (g *Graph) ReadFile(filename string) {
+	g.readStorage(FileStorage{}, filename)
 }
 
 // AppendFile is used to append RDF from a file, using a base URI
 func (g *Graph) AppendFile(filename string, baseURI string) {
-	_, err := os.Stat(filename)
+	g.appendStorage(FileStorage{}, filename, baseURI)
+}
+
+// readStorage reads RDF data from a stored file into the graph
+func (g *Graph) readStorage(st Storage, name string) {
+	g.appendStorage(st, name, g.uri)
+}
+
+// appendStorage reads RDF data from a stored file into the graph, resolving
+// relative IRIs against baseURI. Missing files and directories add nothing.
+func (g *Graph) appendStorage(st Storage, name string, baseURI string) {
+	stat, err := st.Stat(name)
 	if os.IsNotExist(err) {
 		return
 	} else if err != nil {
 		log.Println(err)
 		return
+	} else if stat.IsDir() {
+		return
 	}
-	f, err := os.OpenFile(filename, os.O_RDONLY, 0)
-	defer f.Close()
+	f, err := st.OpenFile(name, os.O_RDONLY, 0)
 	if err != nil {
 		log.Println(err)
 		return
 	}
+	defer f.Close()
 	g.ParseBase(f, "text/turtle", baseURI)
 }
 
@@ -335,60 +343,6 @@ func (g *Graph) LoadURI(uri string) (err error) {
 	return
 }
 
-func term2C(t Term) crdf.Term {
-	switch t := t.(type) {
-	case *BlankNode:
-		node := crdf.Blank(t.ID)
-		return &node
-	case *Resource:
-		node := crdf.Uri(t.URI)
-		return &node
-	case *Literal:
-		dt := ""
-		if t.Datatype != nil {
-			dt = t.Datatype.(*Resource).URI
-		}
-		node := crdf.Literal{
-			Value:    t.Value,
-			Datatype: dt,
-			Lang:     t.Language,
-		}
-		return &node
-	}
-	return nil
-}
-
-func (g *Graph) serializeJSONLd() ([]byte, error) {
-	r := []map[string]interface{}{}
-	for elt := range g.IterTriples() {
-		one := map[string]interface{}{
-			"@id": elt.Subject.(*Resource).URI,
-		}
-		switch t := elt.Object.(type) {
-		case *Resource:
-			one[elt.Predicate.(*Resource).URI] = []map[string]string{
-				{
-					"@id": t.URI,
-				},
-			}
-			break
-		case *Literal:
-			v := map[string]string{
-				"@value": t.Value,
-			}
-			if t.Datatype != nil && len(t.Datatype.String()) > 0 {
-				v["@type"] = t.Datatype.String()
-			}
-			if len(t.Language) > 0 {
-				v["@language"] = t.Language
-			}
-			one[elt.Predicate.(*Resource).URI] = []map[string]string{v}
-		}
-		r = append(r, one)
-	}
-	return json.Marshal(r)
-}
-
 // Serialize is used to serialize a graph based on a given mime type
 func (g *Graph) Serialize(mime string) (string, error) {
 	if mime == "application/ld+json" {
@@ -396,52 +350,33 @@ func (g *Graph) Serialize(mime string) (string, error) {
 		return string(b), err
 	}
 
-	serializerName := mimeSerializer[mime]
-	if len(serializerName) == 0 {
-		serializerName = "turtle"
-	}
-	serializer := crdf.NewSerializer(serializerName)
-	defer serializer.Free()
-
-	ch := make(chan *crdf.Statement, 1024)
-	go func() {
-		for triple := range g.IterTriples() {
-			ch <- &crdf.Statement{
-				Subject:   term2C(triple.Subject),
-				Predicate: term2C(triple.Predicate),
-				Object:    term2C(triple.Object),
-			}
-		}
-		close(ch)
-	}()
-	return serializer.Serialize(ch, g.uri)
+	buf := new(bytes.Buffer)
+	err := g.serialize(buf, mime)
+	return buf.String(), err
 }
 
 // WriteFile is used to dump RDF from a Graph into a file
-func (g *Graph) WriteFile(file *os.File, mime string) error {
+func (g *Graph) WriteFile(file io.Writer, mime string) error {
+	return g.serialize(file, mime)
+}
+
+func (g *Graph) serialize(w io.Writer, mime string) error {
+	if mime == "application/ld+json" {
+		b, err := g.serializeJSONLd()
+		if err == nil {
+			_, err = w.Write(b)
+		}
+		return err
+	}
 	serializerName := mimeSerializer[mime]
 	if len(serializerName) == 0 {
 		serializerName = "turtle"
 	}
-	serializer := crdf.NewSerializer(serializerName)
-	defer serializer.Free()
-	err := serializer.SetFile(file, g.uri)
-	if err != nil {
-		return err
+	serializer, ok := rdfSerializers[serializerName]
+	if !ok {
+		return errors.New("no RDF serializer available for " + mime)
 	}
-	ch := make(chan *crdf.Statement, 1024)
-	go func() {
-		for triple := range g.IterTriples() {
-			ch <- &crdf.Statement{
-				Subject:   term2C(triple.Subject),
-				Predicate: term2C(triple.Predicate),
-				Object:    term2C(triple.Object),
-			}
-		}
-		close(ch)
-	}()
-	serializer.AddN(ch)
-	return nil
+	return serializer(w, g)
 }
 
 type jsonPatch map[string]map[string][]struct {
@@ -0,0 +1,191 @@
+package gold
+
+type termID uint32
+
+type termIndex map[termID]map[termID]map[termID]*Triple
+
+// tripleIndex is an in-memory triple store with SPO, POS and OSP indexes
+// keyed on interned terms
+type tripleIndex struct {
+	ids   map[string]termID
+	terms []Term
+
+	spo termIndex
+	pos termIndex
+	osp termIndex
+
+	size int
+}
+
+func newTripleIndex() *tripleIndex {
+	return &tripleIndex{
+		ids: make(map[string]termID),
+
+		spo: make(termIndex),
+		pos: make(termIndex),
+		osp: make(termIndex),
+	}
+}
+
+// termKey returns a string that uniquely identifies a term. Literals are
+// identified by their lexical form, so that a graph keeps "1" and "01" apart
+// even where they are equal by value.
+func termKey(t Term) string {
+	if l, ok := t.(*Literal); ok && len(l.Language) > 0 && l.Datatype != nil {
+		return l.String() + "^^" + l.Datatype.String()
+	}
+	return t.String()
+}
+
+// intern returns the ID of a term, allocating a new one if needed
+func (idx *tripleIndex) intern(t Term) termID {
+	key := termKey(t)
+	if id, ok := idx.ids[key]; ok {
+		return id
+	}
+	id := termID(len(idx.terms))
+	idx.ids[key] = id
+	idx.terms = append(idx.terms, t)
+	return id
+}
+
+// lookup returns the ID of an already interned term
+func (idx *tripleIndex) lookup(t Term) (termID, bool) {
+	id, ok := idx.ids[termKey(t)]
+	return id, ok
+}
+
+func (ti termIndex) add(a, b, c termID, t *Triple) {
+	l1, ok := ti[a]
+	if !ok {
+		l1 = make(map[termID]map[termID]*Triple)
+		ti[a] = l1
+	}
+	l2, ok := l1[b]
+	if !ok {
+		l2 = make(map[termID]*Triple)
+		l1[b] = l2
+	}
+	l2[c] = t
+}
+
+func (ti termIndex) remove(a, b, c termID) {
+	l1 := ti[a]
+	l2 := l1[b]
+	delete(l2, c)
+	if len(l2) == 0 {
+		delete(l1, b)
+	}
+	if len(l1) == 0 {
+		delete(ti, a)
+	}
+}
+
+// get returns the triple stored for the given key, if any
+func (idx *tripleIndex) get(s, p, o termID) *Triple {
+	return idx.spo[s][p][o]
+}
+
+// add stores a triple unless an equal triple is already present
+func (idx *tripleIndex) add(t *Triple) bool {
+	s, p, o := idx.intern(t.Subject), idx.intern(t.Predicate), idx.intern(t.Object)
+	if idx.get(s, p, o) != nil {
+		return false
+	}
+	idx.spo.add(s, p, o, t)
+	idx.pos.add(p, o, s, t)
+	idx.osp.add(o, s, p, t)
+	idx.size++
+	return true
+}
+
+// remove deletes the stored triple equal to t
+func (idx *tripleIndex) remove(t *Triple) bool {
+	s, ok := idx.lookup(t.Subject)
+	if !ok {
+		return false
+	}
+	p, ok := idx.lookup(t.Predicate)
+	if !ok {
+		return false
+	}
+	o, ok := idx.lookup(t.Object)
+	if !ok {
+		return false
+	}
+	if idx.get(s, p, o) == nil {
+		return false
+	}
+	idx.spo.remove(s, p, o)
+	idx.pos.remove(p, o, s)
+	idx.osp.remove(o, s, p)
+	idx.size--
+	return true
+}
+
+// match calls fn for each triple matching the pattern, where nil terms act
+// as wildcards. Iteration stops as soon as fn returns false.
+func (idx *tripleIndex) match(s, p, o Term, fn func(*Triple) bool) {
+	var (
+		sid, pid, oid termID
+		ok            bool
+	)
+	if s != nil {
+		if sid, ok = idx.lookup(s); !ok {
+			return
+		}
+	}
+	if p != nil {
+		if pid, ok = idx.lookup(p); !ok {
+			return
+		}
+	}
+	if o != nil {
+		if oid, ok = idx.lookup(o); !ok {
+			return
+		}
+	}
+
+	switch {
+	case s != nil && p != nil && o != nil:
+		if t := idx.get(sid, pid, oid); t != nil {
+			fn(t)
+		}
+	case s != nil && p != nil:
+		eachLeaf(idx.spo[sid][pid], fn)
+	case s != nil && o != nil:
+		eachLeaf(idx.osp[oid][sid], fn)
+	case p != nil && o != nil:
+		eachLeaf(idx.pos[pid][oid], fn)
+	case s != nil:
+		eachBranch(idx.spo[sid], fn)
+	case p != nil:
+		eachBranch(idx.pos[pid], fn)
+	case o != nil:
+		eachBranch(idx.osp[oid], fn)
+	default:
+		for _, l1 := range idx.spo {
+			if !eachBranch(l1, fn) {
+				return
+			}
+		}
+	}
+}
+
+func eachLeaf(l map[termID]*Triple, fn func(*Triple) bool) bool {
+	for _, t := range l {
+		if !fn(t) {
+			return false
+		}
+	}
+	return true
+}
+
+func eachBranch(l map[termID]map[termID]*Triple, fn func(*Triple) bool) bool {
+	for _, l2 := range l {
+		if !eachLeaf(l2, fn) {
+			return false
+		}
+	}
+	return true
+}
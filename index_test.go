@@ -0,0 +1,143 @@
+package gold
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphAddSet(t *testing.T) {
+	g := NewGraph("http://test/")
+	g.AddTriple(NewResource("a"), NewResource("b"), NewResource("c"))
+	g.AddTriple(NewResource("a"), NewResource("b"), NewResource("c"))
+	g.Add(NewTriple(NewResource("a"), NewResource("b"), NewResource("c")))
+	assert.Equal(t, 1, g.Len())
+
+	g.AddTriple(NewResource("a"), NewResource("b"), NewLiteral("c"))
+	g.AddTriple(NewResource("a"), NewResource("b"), NewBlankNode("c"))
+	g.AddTriple(NewResource("a"), NewResource("b"), NewLiteralWithLanguage("c", "en"))
+	g.AddTriple(NewResource("a"), NewResource("b"), NewLiteralWithDatatype("c", NewResource("d")))
+	assert.Equal(t, 5, g.Len())
+}
+
+func TestGraphRemoveByValue(t *testing.T) {
+	g := NewGraph("http://test/")
+	g.AddTriple(NewResource("a"), NewResource("b"), NewResource("c"))
+	g.AddTriple(NewResource("a"), NewResource("b"), NewResource("d"))
+	g.Remove(NewTriple(NewResource("a"), NewResource("b"), NewResource("c")))
+	assert.Equal(t, 1, g.Len())
+	assert.Nil(t, g.One(nil, nil, NewResource("c")))
+	assert.NotNil(t, g.One(nil, nil, NewResource("d")))
+
+	g.Remove(NewTriple(NewResource("x"), NewResource("b"), NewResource("d")))
+	assert.Equal(t, 1, g.Len())
+	g.Remove(NewTriple(NewResource("a"), NewResource("b"), NewResource("d")))
+	assert.Equal(t, 0, g.Len())
+	assert.Nil(t, g.One(nil, nil, nil))
+}
+
+func TestGraphAllBoundPositions(t *testing.T) {
+	g := NewGraph("http://test/")
+	g.AddTriple(NewResource("a"), NewResource("b"), NewResource("c"))
+	g.AddTriple(NewResource("a"), NewResource("b"), NewResource("d"))
+	g.AddTriple(NewResource("a"), NewResource("e"), NewResource("c"))
+	g.AddTriple(NewResource("f"), NewResource("b"), NewResource("c"))
+
+	assert.Equal(t, 1, len(g.All(NewResource("a"), NewResource("b"), NewResource("c"))))
+	assert.Equal(t, 2, len(g.All(NewResource("a"), NewResource("b"), nil)))
+	assert.Equal(t, 2, len(g.All(NewResource("a"), nil, NewResource("c"))))
+	assert.Equal(t, 2, len(g.All(nil, NewResource("b"), NewResource("c"))))
+	assert.Equal(t, 0, len(g.All(NewResource("f"), NewResource("e"), nil)))
+	assert.Equal(t, 0, len(g.All(NewResource("x"), nil, nil)))
+}
+
+// scanGraph is the flat triple set Graph used before it was indexed, kept
+// here as a baseline for the benchmarks below
+type scanGraph map[*Triple]bool
+
+func (g scanGraph) All(s Term, p Term, o Term) []*Triple {
+	var triples []*Triple
+	for triple := range g {
+		if s != nil && !triple.Subject.Equal(s) {
+			continue
+		}
+		if p != nil && !triple.Predicate.Equal(p) {
+			continue
+		}
+		if o != nil && !triple.Object.Equal(o) {
+			continue
+		}
+		triples = append(triples, triple)
+	}
+	return triples
+}
+
+func benchmarkTriples(n int) []*Triple {
+	triples := make([]*Triple, 0, n)
+	for i := 0; i < n; i++ {
+		s := NewResource(fmt.Sprintf("http://test/s%d", i/10))
+		p := NewResource(fmt.Sprintf("http://test/p%d", i%10))
+		triples = append(triples, NewTriple(s, p, NewLiteral(fmt.Sprintf("%d", i))))
+	}
+	return triples
+}
+
+func BenchmarkGraphAdd(b *testing.B) {
+	triples := benchmarkTriples(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g := NewGraph("http://test/")
+		for _, t := range triples {
+			g.Add(t)
+		}
+	}
+}
+
+func BenchmarkGraphAllSubject(b *testing.B) {
+	g := NewGraph("http://test/")
+	for _, t := range benchmarkTriples(10000) {
+		g.Add(t)
+	}
+	s := NewResource("http://test/s500")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.All(s, nil, nil)
+	}
+}
+
+func BenchmarkScanAllSubject(b *testing.B) {
+	g := scanGraph{}
+	for _, t := range benchmarkTriples(10000) {
+		g[t] = true
+	}
+	s := NewResource("http://test/s500")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.All(s, nil, nil)
+	}
+}
+
+func BenchmarkGraphAllPredicateObject(b *testing.B) {
+	g := NewGraph("http://test/")
+	for _, t := range benchmarkTriples(10000) {
+		g.Add(t)
+	}
+	p, o := NewResource("http://test/p5"), NewLiteral("5005")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.All(nil, p, o)
+	}
+}
+
+func BenchmarkScanAllPredicateObject(b *testing.B) {
+	g := scanGraph{}
+	for _, t := range benchmarkTriples(10000) {
+		g[t] = true
+	}
+	p, o := NewResource("http://test/p5"), NewLiteral("5005")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.All(nil, p, o)
+	}
+}
@@ -0,0 +1,151 @@
+package gold
+
+// Entailment regimes, named by the IRIs the W3C assigned to them. Clients
+// ask for one by including its IRI in a Prefer: return=representation header.
+const (
+	// RDFSEntailment follows rdfs:subClassOf, rdfs:subPropertyOf,
+	// rdfs:domain and rdfs:range
+	RDFSEntailment = "http://www.w3.org/ns/entailment/RDFS"
+	// OWLEntailment adds owl:sameAs, owl:inverseOf, owl:equivalentClass,
+	// owl:equivalentProperty and symmetric and transitive properties
+	OWLEntailment = "http://www.w3.org/ns/entailment/OWL-RDF-Based"
+)
+
+// vocabulary is the part of a graph that drives inference, indexed by the
+// key of the class, property or resource it applies to
+type vocabulary struct {
+	superClasses    map[string][]Term
+	superProperties map[string][]Term
+	domains         map[string][]Term
+	ranges          map[string][]Term
+	inverses        map[string][]Term
+	sameAs          map[string][]Term
+	symmetric       map[string]bool
+	transitive      map[string]bool
+}
+
+// Infer materializes the triples entailed by the graph under the given
+// regime, adding them to the graph, and returns how many were added. The
+// axiomatic triples of RDFS (everything is an rdfs:Resource and so on) are
+// left out. Unknown regimes add nothing.
+func (g *Graph) Infer(regime string) int {
+	if regime != RDFSEntailment && regime != OWLEntailment {
+		return 0
+	}
+	added := 0
+	for {
+		v := g.vocabulary(regime == OWLEntailment)
+		var inferred []*Triple
+		for triple := range g.IterTriples() {
+			inferred = v.apply(g, triple, inferred)
+		}
+		n := 0
+		for _, triple := range inferred {
+			if g.triples.add(triple) {
+				n++
+			}
+		}
+		if n == 0 {
+			return added
+		}
+		added += n
+	}
+}
+
+func (g *Graph) vocabulary(owl bool) *vocabulary {
+	v := &vocabulary{
+		superClasses:    map[string][]Term{},
+		superProperties: map[string][]Term{},
+		domains:         map[string][]Term{},
+		ranges:          map[string][]Term{},
+		inverses:        map[string][]Term{},
+		sameAs:          map[string][]Term{},
+		symmetric:       map[string]bool{},
+		transitive:      map[string]bool{},
+	}
+	index := func(m map[string][]Term, p Term, both bool) {
+		for _, triple := range g.All(nil, p, nil) {
+			m[termKey(triple.Subject)] = append(m[termKey(triple.Subject)], triple.Object)
+			if both {
+				m[termKey(triple.Object)] = append(m[termKey(triple.Object)], triple.Subject)
+			}
+		}
+	}
+	index(v.superClasses, ns.rdfs.Get("subClassOf"), false)
+	index(v.superProperties, ns.rdfs.Get("subPropertyOf"), false)
+	index(v.domains, ns.rdfs.Get("domain"), false)
+	index(v.ranges, ns.rdfs.Get("range"), false)
+	if !owl {
+		return v
+	}
+	index(v.superClasses, ns.owl.Get("equivalentClass"), true)
+	index(v.superProperties, ns.owl.Get("equivalentProperty"), true)
+	index(v.inverses, ns.owl.Get("inverseOf"), true)
+	index(v.sameAs, ns.owl.Get("sameAs"), true)
+	v.symmetric[termKey(ns.owl.Get("sameAs"))] = true
+	for _, triple := range g.All(nil, ns.rdf.Get("type"), ns.owl.Get("SymmetricProperty")) {
+		v.symmetric[termKey(triple.Subject)] = true
+	}
+	for _, triple := range g.All(nil, ns.rdf.Get("type"), ns.owl.Get("TransitiveProperty")) {
+		v.transitive[termKey(triple.Subject)] = true
+	}
+	return v
+}
+
+// apply appends the triples that follow from one triple of the graph
+func (v *vocabulary) apply(g *Graph, t *Triple, inferred []*Triple) []*Triple {
+	s, p, o := t.Subject, t.Predicate, t.Object
+	_, literal := o.(*Literal)
+	add := func(s, p, o Term) {
+		// owl:sameAs substitution would otherwise make everything the same as itself
+		if p.Equal(ns.owl.Get("sameAs")) && s.Equal(o) {
+			return
+		}
+		inferred = append(inferred, NewTriple(s, p, o))
+	}
+	pk, obj := termKey(p), termKey(o)
+
+	for _, q := range v.superProperties[pk] {
+		add(s, q, o)
+	}
+	for _, c := range v.domains[pk] {
+		add(s, ns.rdf.Get("type"), c)
+	}
+	if !literal {
+		for _, c := range v.ranges[pk] {
+			add(o, ns.rdf.Get("type"), c)
+		}
+	}
+	switch {
+	case p.Equal(ns.rdf.Get("type")), p.Equal(ns.rdfs.Get("subClassOf")):
+		for _, c := range v.superClasses[obj] {
+			add(s, p, c)
+		}
+	case p.Equal(ns.rdfs.Get("subPropertyOf")):
+		for _, q := range v.superProperties[obj] {
+			add(s, p, q)
+		}
+	}
+
+	for _, same := range v.sameAs[termKey(s)] {
+		add(same, p, o)
+	}
+	if literal {
+		return inferred
+	}
+	for _, q := range v.inverses[pk] {
+		add(o, q, s)
+	}
+	if v.symmetric[pk] {
+		add(o, p, s)
+	}
+	if v.transitive[pk] {
+		for _, next := range g.All(o, p, nil) {
+			add(s, p, next.Object)
+		}
+	}
+	for _, same := range v.sameAs[obj] {
+		add(s, p, same)
+	}
+	return inferred
+}
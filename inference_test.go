@@ -0,0 +1,68 @@
+package gold
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const inferenceTestTurtle = `@prefix rdfs: <http://www.w3.org/2000/01/rdf-schema#> .
+@prefix owl: <http://www.w3.org/2002/07/owl#> .
+@prefix ex: <http://example.org/> .
+ex:Team rdfs:subClassOf ex:Group .
+ex:Group rdfs:subClassOf ex:Agent .
+ex:leads rdfs:subPropertyOf ex:member ; owl:inverseOf ex:ledBy .
+ex:member rdfs:domain ex:Group ; rdfs:range ex:Person .
+ex:partOf a owl:TransitiveProperty .
+ex:knows a owl:SymmetricProperty .
+<#t> a ex:Team ; ex:leads <#alice> ; ex:partOf <#dept> .
+<#dept> ex:partOf <#org> .
+<#alice> owl:sameAs <#ali> ; ex:knows <#bob> .
+<#ali> ex:name "Ali" .
+`
+
+func TestInferRDFS(t *testing.T) {
+	g := parseTestGraph(inferenceTestTurtle)
+	assert.True(t, g.Infer(RDFSEntailment) > 0)
+	team := NewResource("https://test.org/doc#t")
+	alice := NewResource("https://test.org/doc#alice")
+	ex := NewNS("http://example.org/")
+
+	assert.NotNil(t, g.One(team, ns.rdf.Get("type"), ex.Get("Group")))
+	assert.NotNil(t, g.One(team, ns.rdf.Get("type"), ex.Get("Agent")))
+	assert.NotNil(t, g.One(ex.Get("Team"), ns.rdfs.Get("subClassOf"), ex.Get("Agent")))
+	assert.NotNil(t, g.One(team, ex.Get("member"), alice))
+	assert.NotNil(t, g.One(alice, ns.rdf.Get("type"), ex.Get("Person")))
+
+	// OWL rules are not part of RDFS
+	assert.Nil(t, g.One(alice, ex.Get("ledBy"), team))
+	assert.Nil(t, g.One(alice, ex.Get("name"), nil))
+
+	// inference stops once nothing new follows
+	assert.Equal(t, 0, g.Infer(RDFSEntailment))
+	assert.Equal(t, 0, g.Infer("http://example.org/unknown"))
+}
+
+func TestInferOWL(t *testing.T) {
+	g := parseTestGraph(inferenceTestTurtle)
+	g.Infer(OWLEntailment)
+	team := NewResource("https://test.org/doc#t")
+	alice := NewResource("https://test.org/doc#alice")
+	ali := NewResource("https://test.org/doc#ali")
+	bob := NewResource("https://test.org/doc#bob")
+	ex := NewNS("http://example.org/")
+
+	assert.NotNil(t, g.One(alice, ex.Get("ledBy"), team))
+	assert.NotNil(t, g.One(bob, ex.Get("knows"), alice))
+	assert.NotNil(t, g.One(team, ex.Get("partOf"), NewResource("https://test.org/doc#org")))
+	assert.NotNil(t, g.One(alice, ex.Get("name"), NewLiteral("Ali")))
+	assert.NotNil(t, g.One(ali, ns.owl.Get("sameAs"), alice))
+	assert.NotNil(t, g.One(team, ex.Get("leads"), ali))
+	assert.Nil(t, g.One(alice, ns.owl.Get("sameAs"), alice))
+}
+
+func TestPreferEntailment(t *testing.T) {
+	assert.Equal(t, "", ParsePreferHeader("return=representation").Entailment())
+	assert.Equal(t, RDFSEntailment, ParsePreferHeader(`return=representation; include="`+RDFSEntailment+`"`).Entailment())
+	assert.Equal(t, OWLEntailment, ParsePreferHeader(`return=representation; include="`+RDFSEntailment+` `+OWLEntailment+`"`).Entailment())
+}
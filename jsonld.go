@@ -0,0 +1,605 @@
+package gold
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jsonldExpanded  = "http://www.w3.org/ns/json-ld#expanded"
+	jsonldCompacted = "http://www.w3.org/ns/json-ld#compacted"
+	jsonldFlattened = "http://www.w3.org/ns/json-ld#flattened"
+
+	xsdStringIRI = "http://www.w3.org/2001/XMLSchema#string"
+)
+
+// jsonldDefaultContext is used to compact JSON-LD when neither the client nor
+// the server configuration names a context
+var jsonldDefaultContext = map[string]interface{}{
+	"rdf":   string(ns.rdf),
+	"rdfs":  string(ns.rdfs),
+	"xsd":   string(ns.xsd),
+	"ldp":   string(ns.ldp),
+	"acl":   string(ns.acl),
+	"cert":  string(ns.cert),
+	"foaf":  string(ns.foaf),
+	"stat":  string(ns.stat),
+	"dct":   string(ns.dct),
+	"solid": string(ns.solid),
+}
+
+func (g *Graph) serializeJSONLd() ([]byte, error) {
+	return json.Marshal(jsonldNodes(g))
+}
+
+// serializeJSONLDForm writes the graph in one of the JSON-LD document forms;
+// the compacted and flattened forms are compacted against ctx
+func (g *Graph) serializeJSONLDForm(form string, ctx *jsonldContext) ([]byte, error) {
+	nodes := jsonldNodes(g)
+	if form == jsonldExpanded || ctx == nil {
+		return json.Marshal(nodes)
+	}
+	if form == jsonldCompacted {
+		nodes = jsonldEmbed(nodes)
+	}
+	compacted := make([]interface{}, len(nodes))
+	for i, node := range nodes {
+		compacted[i] = ctx.compactNode(node)
+	}
+	doc := map[string]interface{}{"@context": ctx.src}
+	if form == jsonldCompacted && len(compacted) == 1 {
+		for k, v := range compacted[0].(map[string]interface{}) {
+			doc[k] = v
+		}
+	} else if len(compacted) > 0 {
+		doc["@graph"] = compacted
+	}
+	return json.Marshal(doc)
+}
+
+// jsonldNodes returns the graph as expanded JSON-LD: one node object per
+// subject, with well formed RDF collections written as @list values
+func jsonldNodes(g *Graph) []map[string]interface{} {
+	lists, members := wellFormedLists(g)
+	subjects := map[string]Term{}
+	for triple := range g.IterTriples() {
+		if !members[termKey(triple.Subject)] {
+			subjects[termKey(triple.Subject)] = triple.Subject
+		}
+	}
+
+	r := []map[string]interface{}{}
+	for _, key := range sortedKeys(subjects) {
+		s := subjects[key]
+		one := map[string]interface{}{
+			"@id": jsonldID(s),
+		}
+		triples := g.All(s, nil, nil)
+		sort.Sort(triplesByObject(triples))
+		for _, triple := range triples {
+			p := termValue(triple.Predicate)
+			if triple.Predicate.Equal(ns.rdf.Get("type")) {
+				if _, ok := triple.Object.(*Literal); !ok {
+					types, _ := one["@type"].([]interface{})
+					one["@type"] = append(types, jsonldID(triple.Object))
+					continue
+				}
+			}
+			values, _ := one[p].([]interface{})
+			one[p] = append(values, jsonldValue(triple.Object, lists))
+		}
+		r = append(r, one)
+	}
+	return r
+}
+
+type triplesByObject []*Triple
+
+func (t triplesByObject) Len() int           { return len(t) }
+func (t triplesByObject) Less(i, j int) bool { return termLess(t[i].Object, t[j].Object) }
+func (t triplesByObject) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// jsonldID returns the JSON-LD @id of a resource or blank node
+func jsonldID(t Term) string {
+	if bn, ok := t.(*BlankNode); ok {
+		return "_:" + bn.ID
+	}
+	return termValue(t)
+}
+
+func jsonldValue(o Term, lists map[string][]Term) interface{} {
+	switch o := o.(type) {
+	case *Resource:
+		if o.Equal(ns.rdf.Get("nil")) {
+			return map[string]interface{}{"@list": []interface{}{}}
+		}
+		return map[string]interface{}{"@id": o.URI}
+	case *BlankNode:
+		if items, ok := lists[termKey(o)]; ok {
+			list := make([]interface{}, len(items))
+			for i, item := range items {
+				list[i] = jsonldValue(item, lists)
+			}
+			return map[string]interface{}{"@list": list}
+		}
+		return map[string]interface{}{"@id": jsonldID(o)}
+	case *Literal:
+		v := map[string]interface{}{"@value": o.Value}
+		if len(o.Language) > 0 {
+			v["@language"] = o.Language
+		} else if dt := termValue(o.Datatype); len(dt) > 0 && dt != xsdStringIRI {
+			v["@type"] = dt
+		}
+		return v
+	}
+	return nil
+}
+
+// jsonldEmbed nests the blank nodes that are referenced only once into the
+// node that references them, the way a default frame would
+func jsonldEmbed(nodes []map[string]interface{}) []map[string]interface{} {
+	byID := map[string]map[string]interface{}{}
+	refs := map[string]int{}
+	var count func(v interface{})
+	count = func(v interface{}) {
+		if m, ok := v.(map[string]interface{}); ok {
+			if id, ok := m["@id"].(string); ok && len(m) == 1 {
+				refs[id]++
+			}
+			if list, ok := m["@list"].([]interface{}); ok {
+				for _, item := range list {
+					count(item)
+				}
+			}
+		}
+	}
+	for _, node := range nodes {
+		byID[node["@id"].(string)] = node
+		for key, values := range node {
+			if values, ok := values.([]interface{}); ok && key != "@type" {
+				for _, v := range values {
+					count(v)
+				}
+			}
+		}
+	}
+	embeddable := func(id string) bool {
+		return strings.HasPrefix(id, "_:") && refs[id] == 1 && byID[id] != nil
+	}
+
+	done := map[string]bool{}
+	var embed func(v interface{}) interface{}
+	embed = func(v interface{}) interface{} {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		if list, ok := m["@list"].([]interface{}); ok {
+			for i, item := range list {
+				list[i] = embed(item)
+			}
+			return m
+		}
+		id, ok := m["@id"].(string)
+		if !ok || len(m) != 1 || !embeddable(id) || done[id] {
+			return v
+		}
+		done[id] = true
+		node := byID[id]
+		delete(node, "@id")
+		embedNode(node, embed)
+		return node
+	}
+
+	var top []map[string]interface{}
+	for _, node := range nodes {
+		if id, ok := node["@id"].(string); ok && !embeddable(id) {
+			done[id] = true
+			embedNode(node, embed)
+			top = append(top, node)
+		}
+	}
+	// blank nodes that only reference each other are left at the top
+	for _, node := range nodes {
+		if id, ok := node["@id"].(string); ok && !done[id] {
+			done[id] = true
+			embedNode(node, embed)
+			top = append(top, node)
+		}
+	}
+	return top
+}
+
+func embedNode(node map[string]interface{}, embed func(interface{}) interface{}) {
+	for key, values := range node {
+		if values, ok := values.([]interface{}); ok && key != "@type" {
+			for i, v := range values {
+				values[i] = embed(v)
+			}
+		}
+	}
+}
+
+// jsonldTerm is a term definition of a JSON-LD context
+type jsonldTerm struct {
+	name      string
+	id        string
+	typ       string
+	container string
+	// prefix is set for simple terms that can be used in compact IRIs
+	prefix bool
+}
+
+// jsonldContext holds the term definitions used to compact JSON-LD
+type jsonldContext struct {
+	// src is written as the @context of compacted documents
+	src   interface{}
+	vocab string
+	terms map[string]*jsonldTerm
+	names []string
+}
+
+// newJSONLDContext reads a context object, or a document with a @context
+func newJSONLDContext(v interface{}) (*jsonldContext, error) {
+	if doc, ok := v.(map[string]interface{}); ok {
+		if c, ok := doc["@context"]; ok {
+			v = c
+		}
+	}
+	defs, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("a JSON-LD context must be an object")
+	}
+	ctx := &jsonldContext{src: defs, terms: map[string]*jsonldTerm{}}
+	ctx.vocab, _ = defs["@vocab"].(string)
+
+	raw := map[string]string{}
+	for name, def := range defs {
+		if strings.HasPrefix(name, "@") {
+			continue
+		}
+		t := &jsonldTerm{name: name}
+		switch def := def.(type) {
+		case nil:
+			continue
+		case string:
+			if len(def) == 0 {
+				return nil, fmt.Errorf("the JSON-LD term %q maps to an empty IRI", name)
+			}
+			t.id = def
+			t.prefix = strings.ContainsAny(def[len(def)-1:], ":/?#[]@")
+			raw[name] = def
+		case map[string]interface{}:
+			t.id, _ = def["@id"].(string)
+			t.typ, _ = def["@type"].(string)
+			t.container, _ = def["@container"].(string)
+		default:
+			return nil, fmt.Errorf("invalid definition of the JSON-LD term %q", name)
+		}
+		if len(t.id) == 0 {
+			t.id = name
+		}
+		ctx.terms[name] = t
+		ctx.names = append(ctx.names, name)
+	}
+	sort.Strings(ctx.names)
+
+	expand := func(v string) string {
+		if strings.HasPrefix(v, "@") {
+			return v
+		}
+		i := strings.Index(v, ":")
+		if i < 0 {
+			return ctx.vocab + v
+		}
+		if prefix, ok := raw[v[:i]]; ok && !strings.HasPrefix(v[i+1:], "//") {
+			return prefix + v[i+1:]
+		}
+		return v
+	}
+	for _, t := range ctx.terms {
+		t.id = expand(t.id)
+		if len(t.typ) > 0 {
+			t.typ = expand(t.typ)
+		}
+		if len(t.id) == 0 || t.id == t.name && !strings.Contains(t.id, ":") {
+			return nil, fmt.Errorf("the JSON-LD term %q does not map to an IRI", t.name)
+		}
+	}
+	return ctx, nil
+}
+
+// readJSONLDContextFile reads a context from a local file
+func readJSONLDContextFile(filename string) (*jsonldContext, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return newJSONLDContext(v)
+}
+
+const (
+	// jsonldContextsKept is how many remote contexts are kept at most
+	jsonldContextsKept = 64
+	// jsonldContextAge is how long a remote context is kept once loaded
+	jsonldContextAge = time.Hour
+	// jsonldContextSize is the largest remote context that is loaded
+	jsonldContextSize = 1 << 20
+)
+
+// jsonldClient fetches remote contexts, which must not hold up a response
+// for long
+var jsonldClient = &http.Client{
+	Transport: httpClient.Transport,
+	Timeout:   10 * time.Second,
+}
+
+type jsonldCachedContext struct {
+	uri     string
+	ctx     *jsonldContext
+	expires time.Time
+}
+
+// jsonldContextCache keeps the most recently used remote contexts for a
+// while, so that they are not fetched for every response
+type jsonldContextCache struct {
+	sync.Mutex
+	list *list.List
+	m    map[string]*list.Element
+}
+
+func newJSONLDContextCache() *jsonldContextCache {
+	return &jsonldContextCache{
+		list: list.New(),
+		m:    map[string]*list.Element{},
+	}
+}
+
+// load returns a remote context, fetching it when it is not kept or has
+// been kept for too long
+func (c *jsonldContextCache) load(uri string) (*jsonldContext, error) {
+	c.Lock()
+	if e, ok := c.m[uri]; ok {
+		cached := e.Value.(*jsonldCachedContext)
+		if time.Now().Before(cached.expires) {
+			c.list.MoveToFront(e)
+			c.Unlock()
+			return cached.ctx, nil
+		}
+		c.list.Remove(e)
+		delete(c.m, uri)
+	}
+	c.Unlock()
+
+	ctx, err := fetchJSONLDContext(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.m[uri]; ok {
+		c.list.Remove(e)
+	}
+	c.m[uri] = c.list.PushFront(&jsonldCachedContext{uri: uri, ctx: ctx, expires: time.Now().Add(jsonldContextAge)})
+	for c.list.Len() > jsonldContextsKept {
+		e := c.list.Back()
+		c.list.Remove(e)
+		delete(c.m, e.Value.(*jsonldCachedContext).uri)
+	}
+	return ctx, nil
+}
+
+// fetchJSONLDContext fetches a remote context
+func fetchJSONLDContext(uri string) (*jsonldContext, error) {
+	q, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	q.Header.Set("Accept", "application/ld+json, application/json")
+	r, err := jsonldClient.Do(q)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, fmt.Errorf("Could not fetch JSON-LD context from %s - HTTP %d", uri, r.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, jsonldContextSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > jsonldContextSize {
+		return nil, fmt.Errorf("the JSON-LD context at %s is larger than %d bytes", uri, jsonldContextSize)
+	}
+	var v interface{}
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	ctx, err := newJSONLDContext(v)
+	if err != nil {
+		return nil, err
+	}
+	ctx.src = uri
+	return ctx, nil
+}
+
+// compactIRI returns the shortest form of an IRI under the context: a term,
+// a suffix of @vocab or a compact IRI. Terms and @vocab only apply to
+// properties and types.
+func (ctx *jsonldContext) compactIRI(iri string, vocab bool) string {
+	if vocab {
+		for _, name := range ctx.names {
+			if t := ctx.terms[name]; t.id == iri && len(t.typ) == 0 && len(t.container) == 0 {
+				return name
+			}
+		}
+		if suffix := strings.TrimPrefix(iri, ctx.vocab); len(ctx.vocab) > 0 && len(suffix) < len(iri) && len(suffix) > 0 {
+			if _, ok := ctx.terms[suffix]; !ok && !strings.Contains(suffix, ":") {
+				return suffix
+			}
+		}
+	}
+	best := iri
+	for _, name := range ctx.names {
+		t := ctx.terms[name]
+		if !t.prefix || len(iri) <= len(t.id) || !strings.HasPrefix(iri, t.id) || strings.HasPrefix(iri[len(t.id):], "//") {
+			continue
+		}
+		curie := name + ":" + iri[len(t.id):]
+		if _, ok := ctx.terms[curie]; ok {
+			continue
+		}
+		if len(curie) < len(best) || len(curie) == len(best) && curie < best {
+			best = curie
+		}
+	}
+	return best
+}
+
+// selectTerm picks the term to write a property with: a term whose type or
+// container fits all the values, or else a plain term for the IRI
+func (ctx *jsonldContext) selectTerm(iri string, values []interface{}) *jsonldTerm {
+	var plain *jsonldTerm
+	for _, name := range ctx.names {
+		t := ctx.terms[name]
+		if t.id != iri {
+			continue
+		}
+		if len(t.typ) == 0 && len(t.container) == 0 {
+			if plain == nil {
+				plain = t
+			}
+		} else if t.fits(values) {
+			return t
+		}
+	}
+	return plain
+}
+
+func (t *jsonldTerm) fits(values []interface{}) bool {
+	switch t.container {
+	case "", "@set":
+	case "@list":
+		if len(values) != 1 {
+			return false
+		}
+		list, ok := values[0].(map[string]interface{})["@list"].([]interface{})
+		if !ok {
+			return false
+		}
+		values = list
+	default:
+		return false
+	}
+	for _, value := range values {
+		v := value.(map[string]interface{})
+		if _, ok := v["@list"]; ok {
+			return false
+		}
+		switch t.typ {
+		case "":
+		case "@id", "@vocab":
+			if _, ok := v["@value"]; ok {
+				return false
+			}
+		default:
+			if typ, _ := v["@type"].(string); typ != t.typ {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (ctx *jsonldContext) compactNode(node map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for key, v := range node {
+		switch key {
+		case "@id":
+			out[key] = ctx.compactIRI(v.(string), false)
+		case "@type":
+			types := v.([]interface{})
+			compacted := make([]interface{}, len(types))
+			for i, typ := range types {
+				compacted[i] = ctx.compactIRI(typ.(string), true)
+			}
+			if len(compacted) == 1 {
+				out[key] = compacted[0]
+			} else {
+				out[key] = compacted
+			}
+		default:
+			values := v.([]interface{})
+			t := ctx.selectTerm(key, values)
+			name := ctx.compactIRI(key, true)
+			if t != nil {
+				name = t.name
+			}
+			compacted := make([]interface{}, len(values))
+			for i, value := range values {
+				compacted[i] = ctx.compactValue(value, t)
+			}
+			switch {
+			case t != nil && t.container == "@list":
+				out[name] = compacted[0]
+			case len(compacted) == 1 && (t == nil || t.container != "@set"):
+				out[name] = compacted[0]
+			default:
+				out[name] = compacted
+			}
+		}
+	}
+	return out
+}
+
+func (ctx *jsonldContext) compactValue(value interface{}, t *jsonldTerm) interface{} {
+	v := value.(map[string]interface{})
+	if list, ok := v["@list"].([]interface{}); ok {
+		items := make([]interface{}, len(list))
+		for i, item := range list {
+			items[i] = ctx.compactValue(item, t)
+		}
+		if t != nil && t.container == "@list" {
+			return items
+		}
+		return map[string]interface{}{"@list": items}
+	}
+	if val, ok := v["@value"]; ok {
+		typ, _ := v["@type"].(string)
+		if t != nil && len(typ) > 0 && typ == t.typ || len(v) == 1 {
+			return val
+		}
+		out := map[string]interface{}{}
+		for k, x := range v {
+			out[k] = x
+		}
+		if len(typ) > 0 {
+			out["@type"] = ctx.compactIRI(typ, true)
+		}
+		return out
+	}
+	if id, ok := v["@id"].(string); ok && len(v) == 1 {
+		switch {
+		case t != nil && t.typ == "@id":
+			return ctx.compactIRI(id, false)
+		case t != nil && t.typ == "@vocab":
+			return ctx.compactIRI(id, true)
+		}
+		return map[string]interface{}{"@id": ctx.compactIRI(id, false)}
+	}
+	return ctx.compactNode(v)
+}
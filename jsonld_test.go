@@ -0,0 +1,148 @@
+package gold
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonldTestTurtle = `@prefix foaf: <http://xmlns.com/foaf/0.1/> .
+@prefix ex: <http://example.org/> .
+<#me> a foaf:Person ;
+    foaf:name "Alice", "Alicia"@es ;
+    foaf:age 42 ;
+    foaf:knows [ foaf:name "Bob" ] ;
+    ex:list ( <#a> "b" ) .
+`
+
+func TestSerializeJSONLDExpanded(t *testing.T) {
+	g := NewGraph("https://test.org/doc")
+	g.Parse(strings.NewReader(jsonldTestTurtle), "text/turtle")
+	b, err := g.serializeJSONLd()
+	assert.NoError(t, err)
+
+	var nodes []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &nodes))
+	assert.Equal(t, 2, len(nodes))
+	me := nodes[0]
+	assert.Equal(t, "https://test.org/doc#me", me["@id"])
+	assert.Equal(t, []interface{}{"http://xmlns.com/foaf/0.1/Person"}, me["@type"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"@value": "Alice"},
+		map[string]interface{}{"@value": "Alicia", "@language": "es"},
+	}, me["http://xmlns.com/foaf/0.1/name"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"@value": "42", "@type": xsdInteger},
+	}, me["http://xmlns.com/foaf/0.1/age"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"@list": []interface{}{
+			map[string]interface{}{"@id": "https://test.org/doc#a"},
+			map[string]interface{}{"@value": "b"},
+		}},
+	}, me["http://example.org/list"])
+
+	bob := nodes[1]
+	assert.True(t, strings.HasPrefix(bob["@id"].(string), "_:"))
+	assert.Equal(t, []interface{}{map[string]interface{}{"@id": bob["@id"]}}, me["http://xmlns.com/foaf/0.1/knows"])
+}
+
+func TestSerializeJSONLDCompacted(t *testing.T) {
+	g := NewGraph("https://test.org/doc")
+	g.Parse(strings.NewReader(jsonldTestTurtle), "text/turtle")
+	ctx, err := newJSONLDContext(map[string]interface{}{
+		"@context": map[string]interface{}{
+			"foaf":  "http://xmlns.com/foaf/0.1/",
+			"xsd":   "http://www.w3.org/2001/XMLSchema#",
+			"name":  "foaf:name",
+			"knows": map[string]interface{}{"@id": "foaf:knows", "@type": "@id"},
+			"age":   map[string]interface{}{"@id": "foaf:age", "@type": "xsd:integer"},
+			"list":  map[string]interface{}{"@id": "http://example.org/list", "@container": "@list"},
+		},
+	})
+	assert.NoError(t, err)
+
+	b, err := g.serializeJSONLDForm(jsonldCompacted, ctx)
+	assert.NoError(t, err)
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &doc))
+	assert.NotNil(t, doc["@context"])
+	assert.Equal(t, "https://test.org/doc#me", doc["@id"])
+	assert.Equal(t, "foaf:Person", doc["@type"])
+	assert.Equal(t, "42", doc["age"])
+	assert.Equal(t, []interface{}{"Alice", map[string]interface{}{"@value": "Alicia", "@language": "es"}}, doc["name"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"@id": "https://test.org/doc#a"}, "b"}, doc["list"])
+	// the blank node is only used once, so it is embedded
+	assert.Equal(t, map[string]interface{}{"name": "Bob"}, doc["knows"])
+
+	b, err = g.serializeJSONLDForm(jsonldFlattened, ctx)
+	assert.NoError(t, err)
+	doc = nil
+	assert.NoError(t, json.Unmarshal(b, &doc))
+	assert.Equal(t, 2, len(doc["@graph"].([]interface{})))
+}
+
+func TestJSONLDCompactIRI(t *testing.T) {
+	ctx, err := newJSONLDContext(map[string]interface{}{
+		"@vocab": "http://example.org/",
+		"ex":     "http://example.org/",
+		"exa":    "http://example.org/a/",
+		"name":   "http://xmlns.com/foaf/0.1/name",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "name", ctx.compactIRI("http://xmlns.com/foaf/0.1/name", true))
+	assert.Equal(t, "p", ctx.compactIRI("http://example.org/p", true))
+	assert.Equal(t, "ex:p", ctx.compactIRI("http://example.org/p", false))
+	assert.Equal(t, "exa:b", ctx.compactIRI("http://example.org/a/b", false))
+	assert.Equal(t, "http://other.org/p", ctx.compactIRI("http://other.org/p", true))
+
+	_, err = newJSONLDContext([]interface{}{"http://example.org/context"})
+	assert.Error(t, err)
+	_, err = newJSONLDContext(map[string]interface{}{"name": 1})
+	assert.Error(t, err)
+	_, err = newJSONLDContext(map[string]interface{}{"name": ""})
+	assert.Error(t, err)
+}
+
+func TestJSONLDContextCache(t *testing.T) {
+	fetched := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fetched++
+		if req.URL.Path == "/large" {
+			fmt.Fprint(w, `{"@context": {"x": "`+strings.Repeat("x", jsonldContextSize)+`"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"@context": {"ex": "http://example.org/"}}`)
+	}))
+	defer ts.Close()
+
+	c := newJSONLDContextCache()
+	ctx, err := c.load(ts.URL + "/context")
+	assert.NoError(t, err)
+	assert.Equal(t, ts.URL+"/context", ctx.src)
+	_, err = c.load(ts.URL + "/context")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fetched)
+
+	// contexts are fetched again once they are too old
+	c.m[ts.URL+"/context"].Value.(*jsonldCachedContext).expires = time.Now()
+	_, err = c.load(ts.URL + "/context")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fetched)
+
+	// and only the most recently used are kept
+	for i := 0; i < jsonldContextsKept; i++ {
+		_, err = c.load(fmt.Sprintf("%s/%d", ts.URL, i))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, jsonldContextsKept, c.list.Len())
+	assert.NotContains(t, c.m, ts.URL+"/context")
+
+	_, err = c.load(ts.URL + "/large")
+	assert.Error(t, err)
+}
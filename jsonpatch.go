@@ -0,0 +1,328 @@
+package gold
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+const (
+	// jsonPatchMime is an RFC 6902 JSON Patch
+	jsonPatchMime = "application/json-patch+json"
+	// mergePatchMime is an RFC 7386 JSON Merge Patch
+	mergePatchMime = "application/merge-patch+json"
+	// rdfJSONPatchMime is the subject -> predicate -> objects map understood
+	// by Graph.JSONPatch
+	rdfJSONPatchMime = "application/x-rdf-patch+json"
+)
+
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// decodeJSON parses a JSON document, keeping numbers as they were written
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, newPatchError(400, "unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+func encodeJSON(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+// applyJSONPatch applies the operations of an RFC 6902 JSON Patch to doc. The
+// patch is applied as a whole or not at all: a failed "test" or a path that
+// does not exist gives a 409 patchError, a malformed operation a 422.
+func applyJSONPatch(doc []byte, patch []byte) ([]byte, error) {
+	var ops []jsonPatchOp
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+	target, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, newPatchError(422, "operation %d has no path", i)
+		}
+		path, err := parseJSONPointer(*op.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+		switch op.Op {
+		case "add", "replace", "test":
+			if len(op.Value) == 0 {
+				return nil, newPatchError(422, "operation %d (%s) has no value", i, op.Op)
+			}
+			if value, err = decodeJSON(op.Value); err != nil {
+				return nil, err
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, newPatchError(422, "operation %d (%s) has no from", i, op.Op)
+			}
+			from, err := parseJSONPointer(*op.From)
+			if err != nil {
+				return nil, err
+			}
+			if value, err = jsonGet(target, from); err != nil {
+				return nil, err
+			}
+			if op.Op == "move" {
+				if strings.HasPrefix(*op.Path, *op.From+"/") {
+					return nil, newPatchError(422, "cannot move %q into one of its children", *op.From)
+				}
+				if target, err = jsonRemove(target, from); err != nil {
+					return nil, err
+				}
+			} else {
+				// copy the value so later changes to one don't show in the other
+				b, _ := encodeJSON(value)
+				value, _ = decodeJSON(b)
+			}
+		case "remove":
+		default:
+			return nil, newPatchError(422, "unknown operation %q", op.Op)
+		}
+
+		switch op.Op {
+		case "add", "move", "copy":
+			target, err = jsonAdd(target, path, value)
+		case "remove":
+			target, err = jsonRemove(target, path)
+		case "replace":
+			if _, err = jsonGet(target, path); err == nil {
+				if target, err = jsonRemove(target, path); err == nil {
+					target, err = jsonAdd(target, path, value)
+				}
+			}
+		case "test":
+			var current interface{}
+			if current, err = jsonGet(target, path); err == nil && !jsonEqual(current, value) {
+				err = newPatchError(409, "test failed at %q", *op.Path)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return encodeJSON(target)
+}
+
+// applyMergePatch applies an RFC 7386 JSON Merge Patch to doc; an empty doc
+// is treated as null
+func applyMergePatch(doc []byte, patch []byte) ([]byte, error) {
+	p, err := decodeJSON(patch)
+	if err != nil {
+		return nil, err
+	}
+	var target interface{}
+	if len(bytes.TrimSpace(doc)) > 0 {
+		if target, err = decodeJSON(doc); err != nil {
+			return nil, err
+		}
+	}
+	return encodeJSON(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, newPatchError(422, "invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// jsonIndex returns the array index named by token; end allows the index just
+// past the last element, also written "-"
+func jsonIndex(a []interface{}, token string, end bool) (int, error) {
+	max := len(a) - 1
+	if end {
+		max = len(a)
+		if token == "-" {
+			return len(a), nil
+		}
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, newPatchError(422, "invalid array index %q", token)
+	}
+	if i > max {
+		return 0, newPatchError(409, "array index %d is out of range", i)
+	}
+	return i, nil
+}
+
+func jsonGet(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[token]
+			if !ok {
+				return nil, newPatchError(409, "member %q does not exist", token)
+			}
+			node = v
+		case []interface{}:
+			i, err := jsonIndex(n, token, false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, newPatchError(409, "cannot address %q inside a scalar value", token)
+		}
+	}
+	return node, nil
+}
+
+// jsonUpdate replaces the container holding the last token of path with the
+// result of f, returning the new document
+func jsonUpdate(node interface{}, path []string, f func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return f(node, path[0])
+	}
+	child, err := jsonGet(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = jsonUpdate(child, path[1:], f); err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		n[path[0]] = child
+	case []interface{}:
+		i, _ := jsonIndex(n, path[0], false)
+		n[i] = child
+	}
+	return node, nil
+}
+
+func jsonAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return jsonUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			i, err := jsonIndex(c, token, true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, newPatchError(409, "cannot add %q to a scalar value", token)
+	})
+}
+
+func jsonRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return jsonUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			if _, ok := c[token]; !ok {
+				return nil, newPatchError(409, "member %q does not exist", token)
+			}
+			delete(c, token)
+			return c, nil
+		case []interface{}:
+			i, err := jsonIndex(c, token, false)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, newPatchError(409, "cannot remove %q from a scalar value", token)
+	})
+}
+
+// jsonEqual compares two decoded JSON values, numbers by value
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, err1 := a.Float64()
+		y, err2 := b.Float64()
+		return err1 == nil && err2 == nil && x == y
+	}
+	return a == b
+}
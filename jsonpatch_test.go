@@ -0,0 +1,70 @@
+package gold
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	for _, c := range []struct {
+		doc, patch, expected string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"child":{"grandchild":{}},"foo":"bar"}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"copy","from":"/~1","path":"/a"}]`, `{"/":9,"a":9,"~1":10}`},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{`{"big":12345678901234567890}`, `[{"op":"add","path":"/n","value":null}]`, `{"big":12345678901234567890,"n":null}`},
+	} {
+		out, err := applyJSONPatch([]byte(c.doc), []byte(c.patch))
+		assert.NoError(t, err, c.patch)
+		assert.Equal(t, c.expected+"\n", string(out), c.patch)
+	}
+}
+
+func TestApplyJSONPatchError(t *testing.T) {
+	for patch, status := range map[string]int{
+		`{"op":"add"}`: 400,
+		`[{"op":"add","path":"/baz/bat","value":"qux"}]`:  409,
+		`[{"op":"test","path":"/foo","value":"baz"}]`:     409,
+		`[{"op":"remove","path":"/nope"}]`:                409,
+		`[{"op":"add","path":"/list/5","value":1}]`:       409,
+		`[{"op":"add","path":"/list/01","value":1}]`:      422,
+		`[{"op":"add","path":"/foo"}]`:                    422,
+		`[{"op":"move","from":"/list","path":"/list/0"}]`: 422,
+		`[{"op":"frob","path":"/foo"}]`:                   422,
+		`[{"op":"add","path":"foo","value":1}]`:           422,
+	} {
+		_, err := applyJSONPatch([]byte(`{"foo":"bar","list":[1]}`), []byte(patch))
+		if assert.Error(t, err, patch) {
+			assert.Equal(t, status, patchStatus(err), patch)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	for _, c := range []struct {
+		doc, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{``, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		out, err := applyMergePatch([]byte(c.doc), []byte(c.patch))
+		assert.NoError(t, err, c.patch)
+		assert.Equal(t, c.expected+"\n", string(out), c.patch)
+	}
+}
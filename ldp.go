@@ -5,10 +5,12 @@ import (
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
+	_path "path"
+	"strconv"
 	"strings"
 )
 
@@ -23,8 +25,10 @@ type Linkheaders struct {
 }
 
 type preferheader struct {
-	omit    []string
-	include []string
+	omit       []string
+	include    []string
+	maxTriples int
+	maxKbytes  int
 }
 
 // Preferheaders holds the list of Prefer headers
@@ -58,6 +62,12 @@ func ParsePreferHeader(header string) *Preferheaders {
 						item.include = append(item.include, u)
 					}
 				}
+				if strings.HasPrefix(s, "max-triple-count=") {
+					item.maxTriples, _ = strconv.Atoi(strings.Trim(strings.TrimPrefix(s, "max-triple-count="), "\""))
+				}
+				if strings.HasPrefix(s, "max-kbyte-count=") {
+					item.maxKbytes, _ = strconv.Atoi(strings.Trim(strings.TrimPrefix(s, "max-kbyte-count="), "\""))
+				}
 			}
 			ret.headers = append(ret.headers, item)
 		}
@@ -88,6 +98,43 @@ func (p *Preferheaders) Includes() []string {
 	return ret
 }
 
+// MaxTripleCount returns the number of triples that the client would like a
+// page of a container to hold at most, or 0
+func (p *Preferheaders) MaxTripleCount() int {
+	for _, v := range p.headers {
+		if v.maxTriples > 0 {
+			return v.maxTriples
+		}
+	}
+	return 0
+}
+
+// MaxKbyteCount returns the size in kilobytes that the client would like a
+// page of a container to take at most, or 0
+func (p *Preferheaders) MaxKbyteCount() int {
+	for _, v := range p.headers {
+		if v.maxKbytes > 0 {
+			return v.maxKbytes
+		}
+	}
+	return 0
+}
+
+// Entailment returns the strongest entailment regime the client asked to
+// include, or an empty string
+func (p *Preferheaders) Entailment() string {
+	regime := ""
+	for _, u := range p.Includes() {
+		switch u {
+		case OWLEntailment:
+			return u
+		case RDFSEntailment:
+			regime = u
+		}
+	}
+	return regime
+}
+
 // ParseLinkHeader is a generic Link header parser
 func ParseLinkHeader(header string) *Linkheaders {
 	ret := new(Linkheaders)
@@ -137,6 +184,232 @@ func (l *Linkheaders) MatchURI(uri string) bool {
 	return false
 }
 
+// ContainerType returns the kind of LDP container that the rel="type"
+// links ask for, or an empty string if they name none
+func (l *Linkheaders) ContainerType() string {
+	for _, kind := range []string{"DirectContainer", "IndirectContainer", "BasicContainer"} {
+		for _, v := range l.headers {
+			if v.rel == "type" && v.uri == string(ns.ldp)+kind {
+				return v.uri
+			}
+		}
+	}
+	return ""
+}
+
+// ldpMembership is what the ,meta file of a Direct or Indirect Container
+// says about the membership triples of its members
+type ldpMembership struct {
+	container  string
+	kind       string
+	resource   Term
+	hasMember  Term
+	isMemberOf Term
+	// inserted is nil when the members are the contained resources, as in
+	// Direct Containers
+	inserted Term
+}
+
+// parseMembership reads the membership of a container from its description.
+// It returns nil for containers that are neither Direct nor Indirect, and an
+// error for those that are but are missing a relation.
+func parseMembership(g *Graph, container string) (*ldpMembership, error) {
+	c := NewResource(container)
+	indirect := g.One(c, ns.rdf.Get("type"), ns.ldp.Get("IndirectContainer")) != nil
+	if !indirect && g.One(c, ns.rdf.Get("type"), ns.ldp.Get("DirectContainer")) == nil {
+		return nil, nil
+	}
+	object := func(p Term) Term {
+		if triple := g.One(c, p, nil); triple != nil {
+			return triple.Object
+		}
+		return nil
+	}
+	m := &ldpMembership{
+		container:  container,
+		kind:       string(ns.ldp) + "DirectContainer",
+		resource:   object(ns.ldp.Get("membershipResource")),
+		hasMember:  object(ns.ldp.Get("hasMemberRelation")),
+		isMemberOf: object(ns.ldp.Get("isMemberOfRelation")),
+		inserted:   object(ns.ldp.Get("insertedContentRelation")),
+	}
+	if m.resource == nil {
+		m.resource = c
+	}
+	if (m.hasMember == nil) == (m.isMemberOf == nil) {
+		return nil, errors.New("a membership container needs one of ldp:hasMemberRelation and ldp:isMemberOfRelation")
+	}
+	if _, ok := m.resource.(*Resource); !ok {
+		return nil, errors.New("ldp:membershipResource has to be an IRI")
+	}
+	if indirect {
+		m.kind = string(ns.ldp) + "IndirectContainer"
+	}
+	if indirect && m.inserted == nil {
+		return nil, errors.New("an Indirect Container needs an ldp:insertedContentRelation")
+	}
+	if !indirect || m.inserted.Equal(ns.ldp.Get("MemberSubject")) {
+		m.inserted = nil
+	}
+	return m, nil
+}
+
+// containerMeta turns the body of a request that creates a container of the
+// given kind into the description kept in its ,meta file, in which the
+// container is the subject of every triple. The description of a Direct or
+// Indirect Container has to say what its membership triples are.
+func containerMeta(container, kind string, body io.Reader, mime string) (*Graph, error) {
+	g := NewGraph(container)
+	desc := NewGraph(container)
+	if len(mimeParser[mime]) > 0 {
+		mg := NewGraph(container)
+		if err := mg.parse(body, mime, container); err != nil {
+			return nil, err
+		}
+		for triple := range mg.IterTriples() {
+			g.AddTriple(NewResource("."), triple.Predicate, triple.Object)
+			desc.AddTriple(NewResource(container), triple.Predicate, triple.Object)
+		}
+	}
+	if kind == string(ns.ldp)+"BasicContainer" {
+		return g, nil
+	}
+	g.AddTriple(NewResource("."), ns.rdf.Get("type"), NewResource(kind))
+	desc.AddTriple(NewResource(container), ns.rdf.Get("type"), NewResource(kind))
+	if _, err := parseMembership(desc, container); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// triple returns the membership triple of a member
+func (m *ldpMembership) triple(member Term) *Triple {
+	if m.hasMember != nil {
+		return NewTriple(m.resource, m.hasMember, member)
+	}
+	return NewTriple(member, m.isMemberOf, m.resource)
+}
+
+// isMembership reports whether a triple is a membership triple
+func (m *ldpMembership) isMembership(triple *Triple) bool {
+	if m.hasMember != nil {
+		return triple.Subject.Equal(m.resource) && triple.Predicate.Equal(m.hasMember)
+	}
+	return triple.Object.Equal(m.resource) && triple.Predicate.Equal(m.isMemberOf)
+}
+
+// containerMembership returns the membership of a container, or nil
+func (s *Server) containerMembership(container *pathInfo) *ldpMembership {
+	kb := NewGraph(container.MetaURI)
+	kb.readStorage(s.Storage, container.MetaFile)
+	m, err := parseMembership(kb, container.URI)
+	if err != nil {
+		s.debug.Println("Ignoring the membership of " + container.URI + ": " + err.Error())
+	}
+	return m
+}
+
+// membership returns the membership of the container a resource is in, or
+// nil if the resource is not a member of a Direct or Indirect Container
+func (s *Server) membership(resource *pathInfo) *ldpMembership {
+	path := strings.TrimSuffix(resource.Path, "/")
+	if len(path) == 0 || strings.HasSuffix(path, ACLSuffix) || strings.HasSuffix(path, METASuffix) ||
+		strings.HasSuffix(path, TYPESuffix) {
+		return nil
+	}
+	dir := _path.Dir(path) + "/"
+	if dir == "./" {
+		dir = ""
+	}
+	container, err := s.pathInfo(resource.Base + "/" + dir)
+	if err != nil {
+		return nil
+	}
+	return s.containerMembership(container)
+}
+
+// members returns what a resource makes a member of its container: the
+// resource itself, or the objects of the inserted content relation in the
+// resource, for Indirect Containers
+func (s *Server) members(m *ldpMembership, resource *pathInfo) []Term {
+	if m == nil {
+		return nil
+	}
+	stat, err := s.Storage.Stat(resource.File)
+	if err != nil {
+		return nil
+	}
+	if m.inserted == nil {
+		return []Term{NewResource(resource.URI)}
+	}
+	if stat.IsDir() {
+		return nil
+	}
+	g := NewGraph(resource.URI)
+	g.readStorage(s.Storage, resource.File)
+	var terms []Term
+	for _, triple := range g.All(NewResource(resource.URI), m.inserted, nil) {
+		terms = append(terms, triple.Object)
+	}
+	return terms
+}
+
+// updateMembership keeps the membership triples in the membership resource
+// of a container up to date with a member that was created, changed or
+// deleted, given what it made a member of the container before. Membership
+// resources on other hosts, or that are not RDF, are left alone.
+func (s *Server) updateMembership(m *ldpMembership, resource *pathInfo, before []Term) error {
+	if m == nil {
+		return nil
+	}
+	after := s.members(m, resource)
+	target, err := s.pathInfo(termValue(m.resource))
+	if err != nil || target.Base != resource.Base {
+		return err
+	}
+	file, base := target.File, target.URI
+	if stat, err := s.Storage.Stat(file); err == nil && stat.IsDir() {
+		file, base = target.MetaFile, target.MetaURI
+	} else if err == nil && !isStoredRDF(target.FileType) {
+		return nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if file != resource.File {
+		unlock := lock(file)
+		defer unlock()
+	}
+
+	g := NewGraph(base)
+	g.readStorage(s.Storage, file)
+	changed := false
+	for _, member := range before {
+		if triple := m.triple(member); !containsTerm(after, member) && g.One(triple.Subject, triple.Predicate, triple.Object) != nil {
+			g.Remove(triple)
+			changed = true
+		}
+	}
+	for _, member := range after {
+		if triple := m.triple(member); g.One(triple.Subject, triple.Predicate, triple.Object) == nil {
+			g.Add(triple)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return writeStorageGraph(s.Storage, file, g, "text/turtle")
+}
+
+func containsTerm(terms []Term, term Term) bool {
+	for _, t := range terms {
+		if t.Equal(term) {
+			return true
+		}
+	}
+	return false
+}
+
 func newUUID() (string, error) {
 	uuid := make([]byte, 16)
 	n, err := io.ReadFull(rand.Reader, uuid)
@@ -150,17 +423,22 @@ func newUUID() (string, error) {
 
 // NewETag generates ETag
 func NewETag(path string) (string, error) {
+	return newETag(FileStorage{}, path)
+}
+
+// newETag generates the ETag of a stored file or directory
+func newETag(st Storage, path string) (string, error) {
 	var (
 		hash []byte
 		md5s string
 		err  error
 	)
-	stat, err := os.Stat(path)
+	stat, err := st.Stat(path)
 	if err != nil {
 		return "", err
 	}
 	if stat.IsDir() {
-		if files, err := ioutil.ReadDir(path); err == nil {
+		if files, err := st.ReadDir(path); err == nil {
 			if len(files) == 0 {
 				md5s += stat.ModTime().String()
 			}
@@ -2,8 +2,11 @@ package gold
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/drewolson/testflight"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,6 +50,83 @@ func TestPreferHeaderParser(t *testing.T) {
 	}
 }
 
+func TestContainerType(t *testing.T) {
+	l := ParseLinkHeader("<http://www.w3.org/ns/ldp#Resource>; rel=\"type\", <http://www.w3.org/ns/ldp#BasicContainer>; rel=\"type\", <http://www.w3.org/ns/ldp#DirectContainer>; rel=\"type\"")
+	assert.Equal(t, "http://www.w3.org/ns/ldp#DirectContainer", l.ContainerType())
+	l = ParseLinkHeader("<http://www.w3.org/ns/ldp#Resource>; rel=\"type\"")
+	assert.Equal(t, "", l.ContainerType())
+}
+
+func TestMembershipContainers(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll(config.DataRoot, 0755)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		create := func(method, path, kind, body string) *testflight.Response {
+			request, _ := http.NewRequest(method, path, strings.NewReader(body))
+			request.Header.Add("Content-Type", "text/turtle")
+			if len(kind) > 0 {
+				request.Header.Add("Link", "<http://www.w3.org/ns/ldp#"+kind+">; rel=\"type\"")
+			}
+			return r.Do(request)
+		}
+		get := func(path, prefer string) *testflight.Response {
+			request, _ := http.NewRequest("GET", path, nil)
+			request.Header.Add("Accept", "application/n-triples")
+			if len(prefer) > 0 {
+				request.Header.Add("Prefer", prefer)
+			}
+			return r.Do(request)
+		}
+		base := "http://" + r.Url("")
+
+		// a Direct Container needs a membership relation
+		assert.Equal(t, 400, create("PUT", "/broken/", "DirectContainer", "").StatusCode)
+		assert.Equal(t, 400, create("PUT", "/broken/", "IndirectContainer", "<> <http://www.w3.org/ns/ldp#hasMemberRelation> <http://xmlns.com/foaf/0.1/made> .").StatusCode)
+
+		assert.Equal(t, 201, create("PUT", "/photos", "", "<#album> a <http://xmlns.com/foaf/0.1/Document> .").StatusCode)
+		response := create("PUT", "/albums/", "DirectContainer", "<> <http://www.w3.org/ns/ldp#membershipResource> </photos#album> ; <http://www.w3.org/ns/ldp#hasMemberRelation> <http://purl.org/dc/terms/hasPart> .")
+		assert.Equal(t, 201, response.StatusCode)
+		assert.Contains(t, strings.Join(response.RawResponse.Header["Link"], ", "), "<http://www.w3.org/ns/ldp#DirectContainer>; rel=\"type\"")
+
+		request, _ := http.NewRequest("POST", "/albums/", strings.NewReader("<> <http://purl.org/dc/terms/title> \"Summer\" ."))
+		request.Header.Add("Content-Type", "text/turtle")
+		request.Header.Add("Slug", "summer")
+		assert.Equal(t, 201, r.Do(request).StatusCode)
+		response = get("/photos", "")
+		assert.Contains(t, response.Body, "<"+base+"/photos#album> <http://purl.org/dc/terms/hasPart> <"+base+"/albums/summer> .")
+
+		request, _ = http.NewRequest("DELETE", "/albums/summer", nil)
+		assert.Equal(t, 200, r.Do(request).StatusCode)
+		response = get("/photos", "")
+		assert.NotContains(t, response.Body, "hasPart")
+		assert.Contains(t, response.Body, "Document")
+
+		// the membership triples of an Indirect Container are about what its
+		// members are about, and are kept with the container by default
+		response = create("POST", "/", "IndirectContainer", "<> <http://www.w3.org/ns/ldp#hasMemberRelation> <http://xmlns.com/foaf/0.1/member> ; <http://www.w3.org/ns/ldp#insertedContentRelation> <http://xmlns.com/foaf/0.1/primaryTopic> .")
+		assert.Equal(t, 201, response.StatusCode)
+		team := response.RawResponse.Header.Get("Location")
+		path := strings.TrimPrefix(team, base)
+		assert.Equal(t, 201, create("PUT", path+"alice", "", "<> <http://xmlns.com/foaf/0.1/primaryTopic> <#me> .").StatusCode)
+
+		response = get(path, "")
+		assert.Contains(t, strings.Join(response.RawResponse.Header["Link"], ", "), "<http://www.w3.org/ns/ldp#IndirectContainer>; rel=\"type\"")
+		assert.Contains(t, response.Body, "<"+team+"> <http://xmlns.com/foaf/0.1/member> <"+team+"alice#me> .")
+		response = get(path, "return=representation; omit=\"http://www.w3.org/ns/ldp#PreferMembership\"")
+		assert.NotContains(t, response.Body, "alice#me>")
+		assert.Contains(t, response.Body, "insertedContentRelation")
+
+		create("PUT", path+"alice", "", "<> <http://xmlns.com/foaf/0.1/primaryTopic> <#i> .")
+		response = get(path, "")
+		assert.NotContains(t, response.Body, "alice#me>")
+		assert.Contains(t, response.Body, "<"+team+"> <http://xmlns.com/foaf/0.1/member> <"+team+"alice#i> .")
+	})
+}
+
 func TestNewUUID(t *testing.T) {
 	uuid, err := newUUID()
 	assert.Nil(t, err)
@@ -65,3 +145,73 @@ func BenchmarkNewUUID(b *testing.B) {
 		b.Fail()
 	}
 }
+
+func TestContainerPaging(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	config.PageSize = 2
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll(config.DataRoot+"dir", 0755)
+	for _, name := range []string{"b", "d", "f", "h", "j"} {
+		writeStorageFile(s.Storage, "/pod/dir/"+name, []byte("<#a> <#b> <#c> ."), 0644)
+	}
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		base := "http://" + r.Url("")
+		get := func(path, prefer string) *testflight.Response {
+			request, _ := http.NewRequest("GET", path, nil)
+			request.Header.Add("Accept", "text/turtle")
+			if len(prefer) > 0 {
+				request.Header.Add("Prefer", prefer)
+			}
+			return r.Do(request)
+		}
+		link := func(response *testflight.Response, rel string) string {
+			return ParseLinkHeader(strings.Join(response.RawResponse.Header["Link"], ", ")).MatchRel(rel)
+		}
+
+		// the testflight client does not follow redirects
+		response := get("/dir/", "")
+		assert.Equal(t, 303, response.StatusCode)
+		assert.Equal(t, base+"/dir/?page=first", response.RawResponse.Header.Get("Location"))
+
+		response = get("/dir/?page=first", "")
+		assert.Equal(t, 200, response.StatusCode)
+		assert.True(t, ParseLinkHeader(strings.Join(response.RawResponse.Header["Link"], ", ")).MatchURI("http://www.w3.org/ns/ldp#Page"))
+		assert.Contains(t, response.Body, "<b>")
+		assert.Contains(t, response.Body, "<d>")
+		assert.NotContains(t, response.Body, "<f>")
+		assert.Empty(t, link(response, "prev"))
+		next := link(response, "next")
+		assert.Equal(t, base+"/dir/?after=d", next)
+
+		// a resource created before the cursor does not shift the next page
+		writeStorageFile(s.Storage, "/pod/dir/a", []byte("<#a> <#b> <#c> ."), 0644)
+		response = get(strings.TrimPrefix(next, base), "")
+		assert.Contains(t, response.Body, "<f>")
+		assert.Contains(t, response.Body, "<h>")
+		assert.NotContains(t, response.Body, "<d>")
+		assert.Equal(t, base+"/dir/?before=f", link(response, "prev"))
+		assert.Equal(t, base+"/dir/?after=h", link(response, "next"))
+
+		response = get(strings.TrimPrefix(link(response, "prev"), base), "")
+		assert.Contains(t, response.Body, "<b>")
+		assert.Contains(t, response.Body, "<d>")
+		assert.NotContains(t, response.Body, "<a>")
+
+		response = get(strings.TrimPrefix(link(response, "last"), base), "")
+		assert.Contains(t, response.Body, "<h>")
+		assert.Contains(t, response.Body, "<j>")
+		assert.Empty(t, link(response, "next"))
+
+		// clients can ask for smaller pages than the configured ones
+		s.Config.PageSize = 0
+		assert.Equal(t, 200, get("/dir/", "").StatusCode)
+		response = get("/dir/", "return=representation; max-triple-count=\"6\"")
+		assert.Equal(t, 303, response.StatusCode)
+		response = get("/dir/?page=first", "return=representation; max-triple-count=\"6\"")
+		assert.Contains(t, response.Body, "<a>")
+		assert.NotContains(t, response.Body, "<b>")
+	})
+}
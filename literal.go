@@ -0,0 +1,229 @@
+package gold
+
+import (
+	"encoding/hex"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	xsdDateTime  = "http://www.w3.org/2001/XMLSchema#dateTime"
+	xsdDate      = "http://www.w3.org/2001/XMLSchema#date"
+	xsdHexBinary = "http://www.w3.org/2001/XMLSchema#hexBinary"
+)
+
+var (
+	integerLexical = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	decimalLexical = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	doubleLexical  = regexp.MustCompile(`^([+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?|[+-]?INF|NaN)$`)
+)
+
+// The value spaces of the typed literals compared by value. Literals of
+// different spaces are never equal, but numbers of either space are ordered
+// against each other.
+const (
+	spaceDecimal = iota + 1 // xsd:decimal and the integer types
+	spaceDouble             // xsd:double and xsd:float
+	spaceBoolean
+	spaceDateTime
+	spaceDate
+	spaceHexBinary
+)
+
+// typedValue is the value of a literal of one of the core XSD types
+type typedValue struct {
+	space   int
+	decimal *big.Rat
+	double  float64
+	boolean bool
+	time    time.Time
+	binary  string
+}
+
+// parseTypedLiteral returns the value of a literal of one of the core XSD
+// types. Other literals, and typed ones with an invalid lexical form, have
+// no value and are compared by their lexical form.
+func parseTypedLiteral(l *Literal) (*typedValue, bool) {
+	dt, ok := l.Datatype.(*Resource)
+	if !ok || len(l.Language) > 0 {
+		return nil, false
+	}
+	s := strings.TrimSpace(l.Value)
+	switch {
+	case xsdIntegers[dt.URI], dt.URI == xsdDecimal:
+		if xsdIntegers[dt.URI] && !integerLexical.MatchString(s) || !decimalLexical.MatchString(s) {
+			return nil, false
+		}
+		if strings.HasSuffix(s, ".") {
+			s += "0"
+		}
+		r, ok := new(big.Rat).SetString(s)
+		return &typedValue{space: spaceDecimal, decimal: r}, ok
+	case dt.URI == xsdDouble, dt.URI == xsdFloat:
+		if !doubleLexical.MatchString(s) {
+			return nil, false
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if dt.URI == xsdFloat {
+			f = float64(float32(f))
+		}
+		return &typedValue{space: spaceDouble, double: f}, err == nil
+	case dt.URI == xsdBoolean:
+		switch s {
+		case "true", "1":
+			return &typedValue{space: spaceBoolean, boolean: true}, true
+		case "false", "0":
+			return &typedValue{space: spaceBoolean}, true
+		}
+	case dt.URI == xsdDateTime:
+		// times without a timezone are taken to be in UTC
+		for _, layout := range []string{"2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return &typedValue{space: spaceDateTime, time: t.UTC()}, true
+			}
+		}
+	case dt.URI == xsdDate:
+		for _, layout := range []string{"2006-01-02Z07:00", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return &typedValue{space: spaceDate, time: t.UTC()}, true
+			}
+		}
+	case dt.URI == xsdHexBinary:
+		if b, err := hex.DecodeString(s); err == nil {
+			return &typedValue{space: spaceHexBinary, binary: strings.ToUpper(hex.EncodeToString(b))}, true
+		}
+	}
+	return nil, false
+}
+
+// canonical returns the canonical lexical form of the value
+func (v *typedValue) canonical() string {
+	switch v.space {
+	case spaceDecimal:
+		if v.decimal.IsInt() {
+			return v.decimal.Num().String()
+		}
+		s := v.decimal.FloatString(64)
+		return strings.TrimRight(s, "0")
+	case spaceDouble:
+		switch {
+		case math.IsInf(v.double, 1):
+			return "INF"
+		case math.IsInf(v.double, -1):
+			return "-INF"
+		case math.IsNaN(v.double):
+			return "NaN"
+		}
+		return strconv.FormatFloat(v.double, 'E', -1, 64)
+	case spaceBoolean:
+		return strconv.FormatBool(v.boolean)
+	case spaceDateTime:
+		return v.time.Format("2006-01-02T15:04:05.999999999Z07:00")
+	case spaceDate:
+		return v.time.Format("2006-01-02Z07:00")
+	}
+	return v.binary
+}
+
+// key identifies the value among the values of all spaces
+func (v *typedValue) key() string {
+	return strconv.Itoa(v.space) + ":" + v.canonical()
+}
+
+// valueFamily groups the spaces whose values are ordered against each other
+func valueFamily(v *typedValue) int {
+	if v.space == spaceDouble {
+		return spaceDecimal
+	}
+	return v.space
+}
+
+func (v *typedValue) float() float64 {
+	if v.space == spaceDecimal {
+		f, _ := v.decimal.Float64()
+		return f
+	}
+	return v.double
+}
+
+// compare orders two values of comparable spaces
+func (v *typedValue) compare(w *typedValue) (int, bool) {
+	switch {
+	case v.space == spaceDecimal && w.space == spaceDecimal:
+		return v.decimal.Cmp(w.decimal), true
+	case (v.space == spaceDecimal || v.space == spaceDouble) && (w.space == spaceDecimal || w.space == spaceDouble):
+		x, y := v.float(), w.float()
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		case x == y:
+			return 0, true
+		}
+		// NaN is not ordered
+		return 0, false
+	case v.space != w.space:
+		return 0, false
+	case v.space == spaceBoolean:
+		switch {
+		case v.boolean == w.boolean:
+			return 0, true
+		case w.boolean:
+			return -1, true
+		}
+		return 1, true
+	case v.space == spaceDateTime, v.space == spaceDate:
+		switch {
+		case v.time.Before(w.time):
+			return -1, true
+		case v.time.After(w.time):
+			return 1, true
+		}
+		return 0, true
+	}
+	return strings.Compare(v.binary, w.binary), true
+}
+
+// SameValue reports whether two terms are equal, with the literals of the
+// core XSD types compared by value, so "01"^^xsd:int equals
+// "1"^^xsd:integer. Other terms are compared as RDF terms.
+func SameValue(a, b Term) bool {
+	if la, ok := a.(*Literal); ok {
+		if va, ok := parseTypedLiteral(la); ok {
+			lb, ok := b.(*Literal)
+			if !ok {
+				return false
+			}
+			vb, ok := parseTypedLiteral(lb)
+			return ok && va.key() == vb.key()
+		}
+	}
+	return a.Equal(b)
+}
+
+// CompareLiterals orders two typed literals by value. It reports false when
+// the literals are not of comparable XSD types, or not literals at all.
+func CompareLiterals(a, b Term) (int, bool) {
+	la, ok := a.(*Literal)
+	if !ok {
+		return 0, false
+	}
+	lb, ok := b.(*Literal)
+	if !ok {
+		return 0, false
+	}
+	va, ok := parseTypedLiteral(la)
+	if !ok {
+		return 0, false
+	}
+	vb, ok := parseTypedLiteral(lb)
+	if !ok {
+		return 0, false
+	}
+	return va.compare(vb)
+}
@@ -0,0 +1,200 @@
+package gold
+
+import (
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MemStorage keeps resources in memory, which is mostly useful for tests.
+// The root directory always exists; everything else has to be created, as
+// in a file system.
+type MemStorage struct {
+	mu    sync.RWMutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NewMemStorage returns an empty in-memory storage
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		files: map[string]*memFile{
+			"/": {mode: os.ModeDir | 0755, modTime: time.Now()},
+		},
+	}
+}
+
+func (m *MemStorage) info(key string, f *memFile) os.FileInfo {
+	return &fileInfo{name: path.Base(key), size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+}
+
+// touch updates the modification time of a file and of its directory, as
+// adding, removing or writing files in a directory does on disk
+func (m *MemStorage) touch(key string) {
+	now := time.Now()
+	if f, ok := m.files[key]; ok {
+		f.modTime = now
+	}
+	if dir, ok := m.files[path.Dir(key)]; ok {
+		dir.modTime = now
+	}
+}
+
+// Stat describes a file or directory
+func (m *MemStorage) Stat(name string) (os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key := cleanName(name)
+	f, ok := m.files[key]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return m.info(key, f), nil
+}
+
+// OpenFile opens a file with the flags of os.OpenFile. The writes to a file
+// are seen by readers as soon as they are made.
+func (m *MemStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := cleanName(name)
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	f, ok := m.files[key]
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case ok && f.mode.IsDir():
+		if writable {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		return &dirFile{info: m.info(key, f), list: func() ([]os.FileInfo, error) { return m.ReadDir(key) }}, nil
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		if dir, ok := m.files[path.Dir(key)]; !ok || !dir.mode.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		f = &memFile{mode: perm &^ os.ModeDir}
+		m.files[key] = f
+		m.touch(key)
+	}
+	if writable && flag&os.O_TRUNC != 0 {
+		f.data = nil
+		m.touch(key)
+	}
+	data := make([]byte, len(f.data))
+	copy(data, f.data)
+	return &contentFile{
+		data: data,
+		flag: flag,
+		info: func(size int64) os.FileInfo {
+			m.mu.RLock()
+			defer m.mu.RUnlock()
+			return &fileInfo{name: path.Base(key), size: size, mode: f.mode, modTime: f.modTime}
+		},
+		onWrite: func(data []byte) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			f.data = append(f.data[:0], data...)
+			m.touch(key)
+		},
+	}, nil
+}
+
+// ReadDir lists a directory, sorted by name
+func (m *MemStorage) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key := cleanName(name)
+	if f, ok := m.files[key]; !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	} else if !f.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	var infos []os.FileInfo
+	for k, f := range m.files {
+		if k != key && path.Dir(k) == key {
+			infos = append(infos, m.info(k, f))
+		}
+	}
+	return sortInfos(infos), nil
+}
+
+// Remove deletes a file or an empty directory
+func (m *MemStorage) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := cleanName(name)
+	if _, ok := m.files[key]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if key == "/" {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrInvalid}
+	}
+	for k := range m.files {
+		if k != key && path.Dir(k) == key {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	delete(m.files, key)
+	m.touch(path.Dir(key))
+	return nil
+}
+
+// Rename moves a file or a directory and everything under it. A file in
+// the way is replaced, a directory in the way is an error.
+func (m *MemStorage) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, to := cleanName(oldname), cleanName(newname)
+	if _, ok := m.files[from]; !ok || from == "/" {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if dir, ok := m.files[path.Dir(to)]; !ok || !dir.mode.IsDir() || hasPathPrefix(to, from) && to != from {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrInvalid}
+	}
+	if f, ok := m.files[to]; ok && f.mode.IsDir() && to != from {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	moved := map[string]*memFile{}
+	for k, f := range m.files {
+		if hasPathPrefix(k, from) {
+			moved[to+k[len(from):]] = f
+			delete(m.files, k)
+		}
+	}
+	for k, f := range moved {
+		m.files[k] = f
+	}
+	m.touch(from)
+	m.touch(to)
+	return nil
+}
+
+// MkdirAll creates a directory and any missing parents
+func (m *MemStorage) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var missing []string
+	for key := cleanName(name); ; key = path.Dir(key) {
+		if f, ok := m.files[key]; ok {
+			if !f.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		missing = append(missing, key)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		m.files[missing[i]] = &memFile{mode: os.ModeDir | perm.Perm()}
+		m.touch(missing[i])
+	}
+	return nil
+}
@@ -1,18 +1,54 @@
 package gold
 
 import (
-	crdf "github.com/presbrey/goraptor"
+	"io"
 )
 
 var mimeParser = map[string]string{
 	"application/ld+json":       "jsonld",
-	"application/json":          "internal",
 	"application/sparql-update": "internal",
+	jsonPatchMime:               "internal",
+	mergePatchMime:              "internal",
+	rdfJSONPatchMime:            "internal",
+
+	"text/turtle":           "turtle",
+	"application/x-turtle":  "turtle",
+	"application/trig":      "trig",
+	"text/n3":               "turtle",
+	"application/n-triples": "ntriples",
+	"application/n-quads":   "nquads",
+	"text/x-nquads":         "nquads",
+	"application/rdf+xml":   "rdfxml",
 }
 
 var mimeSerializer = map[string]string{
 	"application/ld+json": "internal",
 	"text/html":           "internal",
+
+	"text/turtle":           "turtle",
+	"application/trig":      "trig",
+	"application/n-triples": "ntriples",
+	"application/n-quads":   "nquads",
+	"text/x-nquads":         "nquads",
+	"application/rdf+xml":   "rdfxml",
+}
+
+// rdfParsers holds the parser implementation for each parser name used in mimeParser
+var rdfParsers = map[string]func(*Graph, io.Reader, string) error{
+	"turtle":   parseTurtle,
+	"trig":     parseTriG,
+	"ntriples": parseNTriples,
+	"nquads":   parseNQuads,
+	"rdfxml":   parseRDFXML,
+}
+
+// rdfSerializers holds the serializer implementation for each serializer name used in mimeSerializer
+var rdfSerializers = map[string]func(io.Writer, *Graph) error{
+	"turtle":   serializeTurtle,
+	"trig":     serializeTurtle,
+	"ntriples": serializeNTriples,
+	"nquads":   serializeNTriples,
+	"rdfxml":   serializeRDFXML,
 }
 
 var mimeTypes = map[string]string{
@@ -129,27 +165,6 @@ var (
 )
 
 func init() {
-	for _, syntax := range crdf.ParserSyntax {
-		switch syntax.MimeType {
-		case "", "text/html":
-			continue
-		}
-		mimeParser[syntax.MimeType] = syntax.Name
-	}
-	mimeParser["text/n3"] = mimeParser["text/turtle"]
-
-	for name, syntax := range crdf.SerializerSyntax {
-		switch name {
-		case "json-triples":
-			// only activate: json
-			continue
-		case "rdfxml-xmp", "rdfxml":
-			// only activate: rdfxml-abbrev
-			continue
-		}
-		mimeSerializer[syntax.MimeType] = syntax.Name
-	}
-
 	for mime := range mimeSerializer {
 		switch mime {
 		case "application/xhtml+xml":
@@ -0,0 +1,36 @@
+//go:build raptor
+// +build raptor
+
+package gold
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	mimeRaptorParserExpect = map[string]string{
+		"application/rss":    "rss-tag-soup",
+		"application/x-trig": "trig",
+	}
+	mimeRaptorSerializerExpect = map[string]string{
+		"application/atom+xml":  "atom",
+		"application/json":      "json",
+		"application/rss+xml":   "rss-1.0",
+		"application/xhtml+xml": "html",
+		"text/x-graphviz":       "dot",
+	}
+)
+
+func TestMimeRaptorParserExpect(t *testing.T) {
+	for k, v := range mimeRaptorParserExpect {
+		assert.Equal(t, v, mimeParser[k])
+	}
+}
+
+func TestMimeRaptorSerializerExpect(t *testing.T) {
+	for k, v := range mimeRaptorSerializerExpect {
+		assert.Equal(t, v, mimeSerializer[k])
+	}
+}
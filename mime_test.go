@@ -11,39 +11,42 @@ var (
 		// "application/json":          "internal",
 		"application/sparql-update": "internal",
 
-		"application/ld+json": "jsonld",
-		"application/rdf+xml": "rdfxml",
-		"application/rss":     "rss-tag-soup",
-		"application/x-trig":  "trig",
-		"text/n3":             "turtle",
-		"text/turtle":         "turtle",
-		"text/x-nquads":       "nquads",
-		// "application/n-triples": "ntriples",
+		"application/ld+json":   "jsonld",
+		"application/rdf+xml":   "rdfxml",
+		"text/n3":               "turtle",
+		"text/turtle":           "turtle",
+		"application/trig":      "trig",
+		"text/x-nquads":         "nquads",
+		"application/n-quads":   "nquads",
+		"application/n-triples": "ntriples",
 	}
 	mimeSerializerExpect = map[string]string{
 		"application/ld+json": "internal",
 		"text/html":           "internal",
 
-		"application/atom+xml":  "atom",
-		"application/json":      "json",
-		"application/rdf+xml":   "rdfxml-abbrev",
-		"application/rss+xml":   "rss-1.0",
-		"application/xhtml+xml": "html",
+		"application/rdf+xml":   "rdfxml",
 		"text/turtle":           "turtle",
-		"text/x-graphviz":       "dot",
+		"application/trig":      "trig",
 		"text/x-nquads":         "nquads",
-		// "application/n-triples": "ntriples",
+		"application/n-quads":   "nquads",
+		"application/n-triples": "ntriples",
 	}
 )
 
 func TestMimeParserExpect(t *testing.T) {
 	for k, v := range mimeParserExpect {
 		assert.Equal(t, v, mimeParser[k])
+		if v != "internal" && v != "jsonld" {
+			assert.NotNil(t, rdfParsers[v], k)
+		}
 	}
 }
 
 func TestMimeSerializerExpect(t *testing.T) {
 	for k, v := range mimeSerializerExpect {
 		assert.Equal(t, v, mimeSerializer[k])
+		if v != "internal" {
+			assert.NotNil(t, rdfSerializers[v], k)
+		}
 	}
 }
@@ -0,0 +1,214 @@
+package gold
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// patchError is raised by a patch that is well formed but cannot be applied,
+// and carries the HTTP status describing why
+type patchError struct {
+	status int
+	s      string
+}
+
+func (e *patchError) Error() string {
+	return e.s
+}
+
+func newPatchError(status int, format string, a ...interface{}) error {
+	return &patchError{status: status, s: fmt.Sprintf(format, a...)}
+}
+
+// patchStatus returns the HTTP status for an error returned while parsing or
+// applying a patch; plain errors are syntax errors
+func patchStatus(err error) int {
+	if e, ok := err.(*patchError); ok {
+		return e.status
+	}
+	return 400
+}
+
+// N3Patch is a Solid N3 Patch: the triples to delete and insert, for the
+// single solution of its where clause
+type N3Patch struct {
+	baseURI string
+
+	where   []*Triple
+	inserts []*Triple
+	deletes []*Triple
+}
+
+// NewN3Patch creates a new N3 Patch object
+func NewN3Patch(baseURI string) *N3Patch {
+	return &N3Patch{baseURI: baseURI}
+}
+
+// n3Parser reads the subset of N3 used by patches: Turtle with variables and
+// formulae in object position
+type n3Parser struct {
+	*turtleParser
+	triples  []*Triple
+	formulae map[string][]*Triple
+}
+
+func newN3Parser(src string, base string) *n3Parser {
+	p := &n3Parser{
+		turtleParser: newTurtleParser(src, base, nil),
+		formulae:     map[string][]*Triple{},
+	}
+	p.syntax = "n3"
+	p.vars = true
+	p.emit = func(s, pr, o Term) {
+		p.triples = append(p.triples, NewTriple(s, pr, o))
+	}
+	p.formula = p.parseFormula
+	return p
+}
+
+// parseFormula reads a { ... } formula and returns the blank node that
+// stands for it in the enclosing graph
+func (p *n3Parser) parseFormula() (Term, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	outer := p.triples
+	p.triples = nil
+	for {
+		p.skipWS()
+		switch c := p.peek(); c {
+		case 0:
+			return nil, p.errorf("expected '}', found end of input")
+		case '}':
+			p.pos++
+			node := NewAnonNode()
+			p.formulae[node.(*BlankNode).ID] = p.triples
+			p.triples = outer
+			return node, nil
+		case '.':
+			p.pos++
+			continue
+		}
+		if err := p.turtleParser.triples(); err != nil {
+			return nil, err
+		}
+		p.skipWS()
+		if c := p.peek(); c != '.' && c != '}' {
+			return nil, p.errorf("expected '.' or '}', found '%c'", c)
+		}
+	}
+}
+
+// Parse reads an N3 Patch document. Syntax errors are returned as is, while
+// documents that are not a valid patch give a 422 patchError.
+func (patch *N3Patch) Parse(src io.Reader) error {
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	p := newN3Parser(string(b), patch.baseURI)
+	if err = p.parse(); err != nil {
+		return err
+	}
+
+	var subject Term
+	for _, t := range p.triples {
+		if t.Predicate.Equal(ns.rdf.Get("type")) && t.Object.Equal(ns.solid.Get("InsertDeletePatch")) {
+			if subject != nil && !subject.Equal(t.Subject) {
+				return newPatchError(422, "the document contains more than one patch")
+			}
+			subject = t.Subject
+		}
+	}
+	if subject == nil {
+		return newPatchError(422, "the document does not contain a solid:InsertDeletePatch")
+	}
+
+	clauses := map[string][]*Triple{}
+	for _, t := range p.triples {
+		pred, ok := t.Predicate.(*Resource)
+		if !ok || !t.Subject.Equal(subject) || !strings.HasPrefix(pred.URI, string(ns.solid)) {
+			continue
+		}
+		name := pred.URI[len(ns.solid):]
+		switch name {
+		case "where", "inserts", "deletes":
+		default:
+			continue
+		}
+		if _, ok := clauses[name]; ok {
+			return newPatchError(422, "the patch has more than one solid:%s", name)
+		}
+		if bn, ok := t.Object.(*BlankNode); ok {
+			if formula, ok := p.formulae[bn.ID]; ok {
+				clauses[name] = formula
+				continue
+			}
+		}
+		return newPatchError(422, "the object of solid:%s must be a formula", name)
+	}
+	patch.where, patch.inserts, patch.deletes = clauses["where"], clauses["inserts"], clauses["deletes"]
+
+	for _, clause := range []struct {
+		name    string
+		triples []*Triple
+	}{{"where", patch.where}, {"deletes", patch.deletes}, {"inserts", patch.inserts}} {
+		for _, t := range clause.triples {
+			for _, term := range [3]Term{t.Subject, t.Predicate, t.Object} {
+				switch term := term.(type) {
+				case *BlankNode:
+					if clause.name != "inserts" {
+						return newPatchError(422, "blank nodes are not allowed in solid:%s", clause.name)
+					}
+				case *Variable:
+					if clause.name != "where" && !mentions(patch.where, term) {
+						return newPatchError(422, "%s in solid:%s does not occur in solid:where", term, clause.name)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mentions reports whether the term occurs in any of the triples
+func mentions(triples []*Triple, term Term) bool {
+	for _, t := range triples {
+		if t.Subject.Equal(term) || t.Predicate.Equal(term) || t.Object.Equal(term) {
+			return true
+		}
+	}
+	return false
+}
+
+// N3Patch applies a patch to the graph. The where clause must match exactly
+// once and every triple to delete must exist, otherwise the graph is left
+// untouched and a 409 patchError is returned.
+func (g *Graph) N3Patch(patch *N3Patch) error {
+	solutions := g.solve([]binding{{}}, patch.where)
+	if len(solutions) != 1 {
+		return newPatchError(409, "solid:where matched %d times, expected exactly once", len(solutions))
+	}
+	solution := solutions[0]
+
+	deletes := make([]*Triple, 0, len(patch.deletes))
+	for _, pattern := range patch.deletes {
+		triple := solution.instantiate(pattern, nil)
+		if triple == nil || g.One(triple.Subject, triple.Predicate, triple.Object) == nil {
+			return newPatchError(409, "the triple to delete %s %s %s does not exist", pattern.Subject, pattern.Predicate, pattern.Object)
+		}
+		deletes = append(deletes, triple)
+	}
+	for _, triple := range deletes {
+		g.Remove(triple)
+	}
+	bnodes := map[string]Term{}
+	for _, pattern := range patch.inserts {
+		if triple := solution.instantiate(pattern, bnodes); triple != nil {
+			g.Add(triple)
+		}
+	}
+	return nil
+}
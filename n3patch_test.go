@@ -0,0 +1,80 @@
+package gold
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const n3PatchPrefixes = `@prefix solid: <http://www.w3.org/ns/solid/terms#> .
+@prefix ex: <http://example.org/> .
+`
+
+func TestN3PatchParse(t *testing.T) {
+	patch := NewN3Patch("https://test/doc")
+	err := patch.Parse(strings.NewReader(n3PatchPrefixes + `
+<#rename> a solid:InsertDeletePatch ;
+    solid:where { ?person ex:familyName "Garcia" . } ;
+    solid:inserts { ?person ex:givenName "Alex" . [] ex:note ( 1 2 ) } ;
+    solid:deletes { ?person ex:givenName "Claudia" . } .
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(patch.where))
+	assert.Equal(t, 6, len(patch.inserts))
+	assert.Equal(t, 1, len(patch.deletes))
+	assert.Equal(t, NewVariable("person"), patch.where[0].Subject)
+	assert.Equal(t, NewResource("http://example.org/givenName"), patch.deletes[0].Predicate)
+}
+
+func TestN3PatchParseError(t *testing.T) {
+	for src, status := range map[string]int{
+		`_:p a solid:InsertDeletePatch ; solid:inserts { ex:a ex:b ex:c `:                                 400,
+		`_:p solid:inserts { ex:a ex:b ex:c } .`:                                                          422,
+		`_:p a solid:InsertDeletePatch . _:q a solid:InsertDeletePatch .`:                                 422,
+		`_:p a solid:InsertDeletePatch ; solid:inserts { ex:a ex:b ex:c }, { ex:a ex:b ex:d } .`:          422,
+		`_:p a solid:InsertDeletePatch ; solid:inserts ex:a .`:                                            422,
+		`_:p a solid:InsertDeletePatch ; solid:deletes { [] ex:b ex:c } .`:                                422,
+		`_:p a solid:InsertDeletePatch ; solid:where { _:x ex:b ex:c } .`:                                 422,
+		`_:p a solid:InsertDeletePatch ; solid:where { ?x ex:b ex:c } ; solid:inserts { ?y ex:b ex:d } .`: 422,
+	} {
+		err := NewN3Patch("https://test/").Parse(strings.NewReader(n3PatchPrefixes + src))
+		if assert.Error(t, err, src) {
+			assert.Equal(t, status, patchStatus(err), src)
+		}
+	}
+}
+
+func TestGraphN3Patch(t *testing.T) {
+	g := NewGraph("https://test/")
+	g.Parse(strings.NewReader(`@prefix ex: <http://example.org/> .
+<a> ex:familyName "Garcia" ; ex:givenName "Claudia" .
+<b> ex:familyName "Smith" ; ex:givenName "Claudia" .
+`), "text/turtle")
+
+	patch := NewN3Patch("https://test/")
+	assert.NoError(t, patch.Parse(strings.NewReader(n3PatchPrefixes+`
+_:rename a solid:InsertDeletePatch ;
+    solid:where { ?person ex:familyName "Garcia" } ;
+    solid:inserts { ?person ex:givenName "Alex" } ;
+    solid:deletes { ?person ex:givenName "Claudia" } .
+`)))
+	assert.NoError(t, g.N3Patch(patch))
+	assert.NotNil(t, g.One(NewResource("https://test/a"), nil, NewLiteral("Alex")))
+	assert.Nil(t, g.One(NewResource("https://test/a"), nil, NewLiteral("Claudia")))
+	assert.NotNil(t, g.One(NewResource("https://test/b"), nil, NewLiteral("Claudia")))
+
+	// the triple to delete is gone now
+	err := g.N3Patch(patch)
+	assert.Error(t, err)
+	assert.Equal(t, 409, patchStatus(err))
+	assert.Equal(t, 4, g.Len())
+
+	patch = NewN3Patch("https://test/")
+	assert.NoError(t, patch.Parse(strings.NewReader(n3PatchPrefixes+`
+_:p a solid:InsertDeletePatch ; solid:where { ?x ex:familyName ?n } ; solid:inserts { ?x ex:seen true } .
+`)))
+	err = g.N3Patch(patch)
+	assert.Equal(t, 409, patchStatus(err))
+	assert.Nil(t, g.One(nil, NewResource("http://example.org/seen"), nil))
+}
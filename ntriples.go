@@ -0,0 +1,127 @@
+package gold
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ntriplesReader parses N-Triples and N-Quads one line at a time, so that
+// documents of any size can be read without holding them in memory
+type ntriplesReader struct {
+	scanner *bufio.Scanner
+	quads   bool
+	line    int
+}
+
+func newNTriplesReader(r io.Reader, quads bool) *ntriplesReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &ntriplesReader{scanner: scanner, quads: quads}
+}
+
+// next returns the next statement in the document, with a nil graph for the
+// default graph, or io.EOF once the input is exhausted
+func (nr *ntriplesReader) next() (triple *Triple, graph Term, err error) {
+	for nr.scanner.Scan() {
+		nr.line++
+		p := newTurtleParser(nr.scanner.Text(), "", nil)
+		p.line = nr.line
+		p.skipWS()
+		if p.eof() {
+			continue
+		}
+		triple, graph, err = nr.statement(p)
+		return
+	}
+	if err = nr.scanner.Err(); err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+func (nr *ntriplesReader) statement(p *turtleParser) (*Triple, Term, error) {
+	var (
+		s, pr, o, g Term
+		err         error
+	)
+	if p.hasPrefix("_:") {
+		s, err = p.blankNodeLabel()
+	} else {
+		s, err = p.iri()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if pr, err = p.iri(); err != nil {
+		return nil, nil, err
+	}
+	p.skipWS()
+	switch c := p.peek(); {
+	case c == '"':
+		o, err = p.rdfLiteral()
+	case p.hasPrefix("_:"):
+		o, err = p.blankNodeLabel()
+	default:
+		o, err = p.iri()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	p.skipWS()
+	if nr.quads && p.peek() != '.' {
+		if p.hasPrefix("_:") {
+			g, err = p.blankNodeLabel()
+		} else {
+			g, err = p.iri()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if err = p.expect('.'); err != nil {
+		return nil, nil, err
+	}
+	p.skipWS()
+	if !p.eof() {
+		return nil, nil, p.errorf("unexpected content after statement")
+	}
+	return NewTriple(s, pr, o), g, nil
+}
+
+func parseNTriples(g *Graph, r io.Reader, base string) error {
+	return readNTriples(g, newNTriplesReader(r, false))
+}
+
+func parseNQuads(g *Graph, r io.Reader, base string) error {
+	return readNTriples(g, newNTriplesReader(r, true))
+}
+
+func readNTriples(g *Graph, nr *ntriplesReader) error {
+	for {
+		triple, _, err := nr.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		g.Add(triple)
+	}
+}
+
+func serializeNTriples(w io.Writer, g *Graph) error {
+	lines := make([]string, 0, g.Len())
+	for triple := range g.IterTriples() {
+		lines = append(lines, triple.String())
+	}
+	sort.Strings(lines)
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(bw, line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,115 @@
+package gold
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+)
+
+const (
+	// pageMemberTriples and pageMemberBytes are about how much of the
+	// listing of a container one contained resource takes, to turn the page
+	// size hints of a Prefer header into a number of resources
+	pageMemberTriples = 6
+	pageMemberBytes   = 512
+)
+
+// containerPage is one page of the listing of a container, in the sense of
+// LDP Paging. The pages are cut at names rather than offsets, so that
+// resources created or deleted between two requests do not shift the pages
+// that follow.
+type containerPage struct {
+	infos []os.FileInfo
+	// prev and next are the queries of the pages around this one, or empty
+	// strings if it is the first or the last page
+	prev string
+	next string
+}
+
+// pageSize returns the number of contained resources to list on a page of a
+// container: as many as fit the size hints of the Prefer header, or the
+// configured page size
+func (s *Server) pageSize(pref *Preferheaders) int {
+	size, hinted := s.Config.PageSize, false
+	if n := pref.MaxTripleCount(); n > 0 {
+		size, hinted = n/pageMemberTriples, true
+	}
+	if n := pref.MaxKbyteCount(); n > 0 && (!hinted || n*1024/pageMemberBytes < size) {
+		size, hinted = n*1024/pageMemberBytes, true
+	}
+	if hinted && size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// isPageQuery reports whether a query names a page of a container
+func isPageQuery(q url.Values) bool {
+	_, page := q["page"]
+	_, after := q["after"]
+	_, before := q["before"]
+	return page || after || before
+}
+
+// listPage returns the page of a listing that a query names: page=first,
+// page=last, after=<name> for the resources that follow a name, or
+// before=<name> for the ones that precede it
+func listPage(infos []os.FileInfo, q url.Values, size int) *containerPage {
+	sort.Sort(infosByName(infos))
+	start, end := 0, len(infos)
+	switch {
+	case len(q.Get("after")) > 0:
+		after := q.Get("after")
+		start = sort.Search(len(infos), func(i int) bool { return infos[i].Name() > after })
+		end = start + size
+	case len(q.Get("before")) > 0:
+		before := q.Get("before")
+		end = sort.Search(len(infos), func(i int) bool { return infos[i].Name() >= before })
+		start = end - size
+	case q.Get("page") == "last":
+		start = end - size
+	default:
+		end = size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(infos) {
+		end = len(infos)
+	}
+	if start > end {
+		start = end
+	}
+
+	p := &containerPage{infos: infos[start:end]}
+	if start > 0 {
+		if start < end {
+			p.prev = url.Values{"before": {infos[start].Name()}}.Encode()
+		} else {
+			p.prev = "page=last"
+		}
+	}
+	if end < len(infos) {
+		if start < end {
+			p.next = url.Values{"after": {infos[end-1].Name()}}.Encode()
+		} else {
+			p.next = "page=first"
+		}
+	}
+	return p
+}
+
+// pageLinks sets the LDP Paging headers of a page of a container
+func pageLinks(w http.ResponseWriter, container *pathInfo, p *containerPage) {
+	w.Header().Add("Link", brack("http://www.w3.org/ns/ldp#Page")+"; rel=\"type\"")
+	w.Header().Add("Link", brack(container.URI+"?page=first")+"; rel=\"first\"")
+	w.Header().Add("Link", brack(container.URI+"?page=last")+"; rel=\"last\"")
+	if len(p.prev) > 0 {
+		w.Header().Add("Link", brack(container.URI+"?"+p.prev)+"; rel=\"prev\"")
+	}
+	if len(p.next) > 0 {
+		w.Header().Add("Link", brack(container.URI+"?"+p.next)+"; rel=\"next\"")
+	}
+	w.Header().Add("Vary", "Prefer")
+}
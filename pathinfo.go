@@ -20,7 +20,11 @@ type pathInfo struct {
 	AclFile  string
 	MetaURI  string
 	MetaFile string
+	TypeFile string
 	Exists   bool
+	// Version names the past version of the resource that is served in
+	// its place, if any
+	Version string
 }
 
 func (s *Server) pathInfo(path string) (*pathInfo, error) {
@@ -61,17 +65,21 @@ func (s *Server) pathInfo(path string) (*pathInfo, error) {
 
 	res.Exists = true
 	// check if file exits first
-	if stat, err := os.Stat(res.Root + p.Path); os.IsNotExist(err) {
+	if stat, err := s.Storage.Stat(res.Root + p.Path); os.IsNotExist(err) {
 		res.Exists = false
 	} else {
 		// Add missing trailing slashes for dirs
 		if stat.IsDir() && !strings.HasSuffix(p.Path, "/") && len(p.Path) > 1 {
 			p.Path += "/"
 		}
-		// get filetype
-		res.FileType, err = magic.TypeByFile(res.Root + p.Path)
-		if err != nil {
-			s.debug.Println(err)
+		// get filetype, preferring the one declared when the file was written
+		if ctype := s.readTypeFile(res.Root + p.Path + TYPESuffix); len(ctype) > 0 && !stat.IsDir() {
+			res.FileType = ctype
+		} else {
+			res.FileType, err = s.TypeDetector.TypeByFile(res.Root + p.Path)
+			if err != nil {
+				s.debug.Println(err)
+			}
 		}
 	}
 
@@ -90,6 +98,8 @@ func (s *Server) pathInfo(path string) (*pathInfo, error) {
 		res.File = s.Config.DataRoot + p.Path
 	}
 
+	res.TypeFile = res.File + TYPESuffix
+
 	if strings.HasSuffix(p.Path, ",acl") {
 		res.AclURI = res.URI
 		res.AclFile = res.File
@@ -110,3 +120,42 @@ func (s *Server) pathInfo(path string) (*pathInfo, error) {
 
 	return res, nil
 }
+
+// isTypeFile reports whether a file is the type sidecar of another, which
+// is not a resource of its own
+func isTypeFile(name string) bool {
+	return strings.HasSuffix(name, TYPESuffix)
+}
+
+// mimeBase returns a media type without its parameters
+func mimeBase(ctype string) string {
+	return strings.TrimSpace(strings.Split(ctype, ";")[0])
+}
+
+// readTypeFile returns the media type stored in a type sidecar, if any
+func (s *Server) readTypeFile(path string) string {
+	data, err := readStorageFile(s.Storage, path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeTypeFile stores ctype in a type sidecar, or removes the sidecar when
+// ctype is empty or is what the file it describes would be detected as
+func (s *Server) writeTypeFile(path string, ctype string) error {
+	if len(ctype) > 0 {
+		detected, err := s.TypeDetector.TypeByFile(strings.TrimSuffix(path, TYPESuffix))
+		if err == nil && (ctype == detected || !strings.Contains(ctype, ";") && ctype == mimeBase(detected)) {
+			ctype = ""
+		}
+	}
+	if len(ctype) == 0 {
+		err := s.Storage.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return writeStorageFile(s.Storage, path, []byte(ctype+"\n"), 0644)
+}
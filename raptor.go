@@ -0,0 +1,127 @@
+//go:build raptor
+// +build raptor
+
+package gold
+
+import (
+	"io"
+	"log"
+
+	crdf "github.com/presbrey/goraptor"
+)
+
+// Building with the raptor tag adds the libraptor2 parsers and serializers
+// for the syntaxes that have no native implementation (RSS, Atom, TriG, ...)
+func init() {
+	for _, syntax := range crdf.ParserSyntax {
+		switch syntax.MimeType {
+		case "", "text/html":
+			continue
+		}
+		if _, ok := mimeParser[syntax.MimeType]; ok {
+			continue
+		}
+		mimeParser[syntax.MimeType] = syntax.Name
+		if _, ok := rdfParsers[syntax.Name]; !ok {
+			rdfParsers[syntax.Name] = raptorParser(syntax.Name)
+		}
+	}
+
+	for name, syntax := range crdf.SerializerSyntax {
+		switch name {
+		case "json-triples":
+			// only activate: json
+			continue
+		case "rdfxml-xmp", "rdfxml":
+			// only activate: rdfxml-abbrev
+			continue
+		}
+		if _, ok := mimeSerializer[syntax.MimeType]; ok {
+			continue
+		}
+		mimeSerializer[syntax.MimeType] = syntax.Name
+		if _, ok := rdfSerializers[syntax.Name]; !ok {
+			rdfSerializers[syntax.Name] = raptorSerializer(syntax.Name)
+		}
+		if syntax.MimeType != "application/xhtml+xml" {
+			serializerMimes = append(serializerMimes, syntax.MimeType)
+		}
+	}
+}
+
+func raptorParser(name string) func(*Graph, io.Reader, string) error {
+	return func(g *Graph, r io.Reader, base string) error {
+		parser := crdf.NewParser(name)
+		parser.SetLogHandler(func(level int, message string) {
+			log.Println(message)
+		})
+		defer parser.Free()
+		for s := range parser.Parse(r, base) {
+			g.AddTriple(term2term(s.Subject), term2term(s.Predicate), term2term(s.Object))
+		}
+		return nil
+	}
+}
+
+func raptorSerializer(name string) func(io.Writer, *Graph) error {
+	return func(w io.Writer, g *Graph) error {
+		serializer := crdf.NewSerializer(name)
+		defer serializer.Free()
+
+		ch := make(chan *crdf.Statement, 1024)
+		go func() {
+			for triple := range g.IterTriples() {
+				ch <- &crdf.Statement{
+					Subject:   term2C(triple.Subject),
+					Predicate: term2C(triple.Predicate),
+					Object:    term2C(triple.Object),
+				}
+			}
+			close(ch)
+		}()
+		str, err := serializer.Serialize(ch, g.uri)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, str)
+		return err
+	}
+}
+
+func term2term(term crdf.Term) Term {
+	switch term := term.(type) {
+	case *crdf.Blank:
+		return NewBlankNode(term.String())
+	case *crdf.Literal:
+		if len(term.Datatype) > 0 {
+			return NewLiteralWithLanguageAndDatatype(term.Value, term.Lang, NewResource(term.Datatype))
+		}
+		return NewLiteral(term.Value)
+	case *crdf.Uri:
+		return NewResource(term.String())
+	}
+	return nil
+}
+
+func term2C(t Term) crdf.Term {
+	switch t := t.(type) {
+	case *BlankNode:
+		node := crdf.Blank(t.ID)
+		return &node
+	case *Resource:
+		node := crdf.Uri(t.URI)
+		return &node
+	case *Literal:
+		dt := ""
+		if t.Datatype != nil {
+			dt = t.Datatype.(*Resource).URI
+		}
+		node := crdf.Literal{
+			Value:    t.Value,
+			Datatype: dt,
+			Lang:     t.Language,
+		}
+		return &node
+	}
+	return nil
+}
@@ -6,18 +6,42 @@ import (
 
 var (
 	ns = struct {
-		rdf, rdfs, acl, cert, foaf, stat, dct NS
+		rdf, rdfs, owl, xsd, ldp, sh, acl, cert, foaf, stat, dct, solid NS
 	}{
-		rdf:  NewNS("http://www.w3.org/1999/02/22-rdf-syntax-ns#"),
-		rdfs: NewNS("http://www.w3.org/2000/01/rdf-schema#"),
-		acl:  NewNS("http://www.w3.org/ns/auth/acl#"),
-		cert: NewNS("http://www.w3.org/ns/auth/cert#"),
-		foaf: NewNS("http://xmlns.com/foaf/0.1/"),
-		stat: NewNS("http://www.w3.org/ns/posix/stat#"),
-		dct:  NewNS("http://purl.org/dc/terms/"),
+		rdf:   NewNS("http://www.w3.org/1999/02/22-rdf-syntax-ns#"),
+		rdfs:  NewNS("http://www.w3.org/2000/01/rdf-schema#"),
+		owl:   NewNS("http://www.w3.org/2002/07/owl#"),
+		xsd:   NewNS("http://www.w3.org/2001/XMLSchema#"),
+		ldp:   NewNS("http://www.w3.org/ns/ldp#"),
+		sh:    NewNS("http://www.w3.org/ns/shacl#"),
+		acl:   NewNS("http://www.w3.org/ns/auth/acl#"),
+		cert:  NewNS("http://www.w3.org/ns/auth/cert#"),
+		foaf:  NewNS("http://xmlns.com/foaf/0.1/"),
+		stat:  NewNS("http://www.w3.org/ns/posix/stat#"),
+		dct:   NewNS("http://purl.org/dc/terms/"),
+		solid: NewNS("http://www.w3.org/ns/solid/terms#"),
 	}
 )
 
+// wellKnownPrefixes returns the prefixes of the namespaces above, which are
+// used to abbreviate Turtle output unless configured otherwise
+func wellKnownPrefixes() map[string]string {
+	return map[string]string{
+		"rdf":   string(ns.rdf),
+		"rdfs":  string(ns.rdfs),
+		"owl":   string(ns.owl),
+		"xsd":   string(ns.xsd),
+		"ldp":   string(ns.ldp),
+		"sh":    string(ns.sh),
+		"acl":   string(ns.acl),
+		"cert":  string(ns.cert),
+		"foaf":  string(ns.foaf),
+		"stat":  string(ns.stat),
+		"dct":   string(ns.dct),
+		"solid": string(ns.solid),
+	}
+}
+
 // NS is a generic namespace type
 type NS string
 
@@ -31,6 +55,20 @@ func (ns NS) Get(name string) (term Term) {
 	return NewResource(string(ns) + name)
 }
 
+// termValue returns the lexical value of a literal, the URI of a resource or
+// the ID of a blank node
+func termValue(t Term) string {
+	switch t := t.(type) {
+	case *Literal:
+		return t.Value
+	case *Resource:
+		return t.URI
+	case *BlankNode:
+		return t.ID
+	}
+	return ""
+}
+
 func brack(s string) string {
 	if len(s) > 0 && s[0] == '<' {
 		return s
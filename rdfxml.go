@@ -0,0 +1,405 @@
+package gold
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	xmlNS         = "http://www.w3.org/XML/1998/namespace"
+	rdfXMLLiteral = "http://www.w3.org/1999/02/22-rdf-syntax-ns#XMLLiteral"
+)
+
+// xmlNode is a minimal element tree built from an RDF/XML document
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     string
+	inner    string
+}
+
+func readXMLTree(src []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(src))
+	var (
+		root  *xmlNode
+		stack []*xmlNode
+		start []int64
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: tok.Name, attrs: tok.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+			start = append(start, d.InputOffset())
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			end := int64(bytes.LastIndex(src[:d.InputOffset()], []byte("</")))
+			if s := start[len(start)-1]; end >= s {
+				n.inner = string(src[s:end])
+			}
+			stack = stack[:len(stack)-1]
+			start = start[:len(start)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(tok)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("rdfxml: empty document")
+	}
+	return root, nil
+}
+
+type rdfxmlParser struct {
+	emit func(s, p, o Term)
+}
+
+func parseRDFXML(g *Graph, r io.Reader, base string) error {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	root, err := readXMLTree(src)
+	if err != nil {
+		return err
+	}
+	p := &rdfxmlParser{emit: g.AddTriple}
+	return p.parse(root, base)
+}
+
+func (p *rdfxmlParser) parse(root *xmlNode, base string) error {
+	base, lang := p.scope(root, base, "")
+	if root.name.Space == string(ns.rdf) && root.name.Local == "RDF" {
+		for _, child := range root.children {
+			if _, err := p.nodeElement(child, base, lang); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	_, err := p.nodeElement(root, base, lang)
+	return err
+}
+
+// scope applies xml:base and xml:lang from an element
+func (p *rdfxmlParser) scope(n *xmlNode, base, lang string) (string, string) {
+	for _, a := range n.attrs {
+		if a.Name.Space != xmlNS {
+			continue
+		}
+		switch a.Name.Local {
+		case "base":
+			base = resolveIRI(base, a.Value)
+		case "lang":
+			lang = a.Value
+		}
+	}
+	return base, lang
+}
+
+func resolveIRI(base, iri string) string {
+	ref, err := url.Parse(iri)
+	if err != nil || ref.IsAbs() || len(base) == 0 {
+		return iri
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return iri
+	}
+	return resolveReference(b, ref, iri)
+}
+
+// resolveReference resolves ref, parsed from iri, against base. Unlike
+// url.URL.String, it keeps an empty fragment: <#> is not the document.
+func resolveReference(base, ref *url.URL, iri string) string {
+	resolved := base.ResolveReference(ref).String()
+	if strings.HasSuffix(iri, "#") && !strings.HasSuffix(resolved, "#") {
+		resolved += "#"
+	}
+	return resolved
+}
+
+func isRDFAttr(a xml.Attr, local string) bool {
+	return a.Name.Space == string(ns.rdf) && a.Name.Local == local
+}
+
+func isSyntaxAttr(a xml.Attr) bool {
+	return a.Name.Space == xmlNS || a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns")
+}
+
+func (p *rdfxmlParser) nodeElement(n *xmlNode, base, lang string) (Term, error) {
+	base, lang = p.scope(n, base, lang)
+	var subject Term
+	for _, a := range n.attrs {
+		switch {
+		case isRDFAttr(a, "about"):
+			subject = NewResource(resolveIRI(base, a.Value))
+		case isRDFAttr(a, "ID"):
+			subject = NewResource(resolveIRI(base, "#"+a.Value))
+		case isRDFAttr(a, "nodeID"):
+			subject = NewBlankNode(a.Value)
+		}
+	}
+	if subject == nil {
+		subject = NewAnonNode()
+	}
+	if n.name.Space != string(ns.rdf) || n.name.Local != "Description" {
+		p.emit(subject, ns.rdf.Get("type"), NewResource(n.name.Space+n.name.Local))
+	}
+	for _, a := range n.attrs {
+		switch {
+		case isSyntaxAttr(a), isRDFAttr(a, "about"), isRDFAttr(a, "ID"), isRDFAttr(a, "nodeID"):
+		case isRDFAttr(a, "type"):
+			p.emit(subject, ns.rdf.Get("type"), NewResource(resolveIRI(base, a.Value)))
+		default:
+			p.emit(subject, NewResource(a.Name.Space+a.Name.Local), p.literal(a.Value, lang, ""))
+		}
+	}
+	li := 0
+	for _, child := range n.children {
+		if err := p.propertyElement(child, subject, base, lang, &li); err != nil {
+			return nil, err
+		}
+	}
+	return subject, nil
+}
+
+func (p *rdfxmlParser) literal(value, lang, datatype string) Term {
+	if len(datatype) > 0 {
+		return NewLiteralWithDatatype(value, NewResource(datatype))
+	}
+	if len(lang) > 0 {
+		return NewLiteralWithLanguage(value, lang)
+	}
+	return NewLiteral(value)
+}
+
+func (p *rdfxmlParser) propertyElement(n *xmlNode, subject Term, base, lang string, li *int) error {
+	base, lang = p.scope(n, base, lang)
+	predicate := NewResource(n.name.Space + n.name.Local)
+	if n.name.Space == string(ns.rdf) && n.name.Local == "li" {
+		*li++
+		predicate = ns.rdf.Get(fmt.Sprintf("_%d", *li))
+	}
+
+	var (
+		object    Term
+		datatype  string
+		parseType string
+		propAttrs []xml.Attr
+	)
+	for _, a := range n.attrs {
+		switch {
+		case isSyntaxAttr(a), isRDFAttr(a, "ID"):
+		case isRDFAttr(a, "resource"):
+			object = NewResource(resolveIRI(base, a.Value))
+		case isRDFAttr(a, "nodeID"):
+			object = NewBlankNode(a.Value)
+		case isRDFAttr(a, "datatype"):
+			datatype = resolveIRI(base, a.Value)
+		case isRDFAttr(a, "parseType"):
+			parseType = a.Value
+		default:
+			propAttrs = append(propAttrs, a)
+		}
+	}
+
+	switch parseType {
+	case "":
+	case "Literal":
+		p.emit(subject, predicate, NewLiteralWithDatatype(n.inner, NewResource(rdfXMLLiteral)))
+		return nil
+	case "Collection":
+		var head, last Term
+		for _, child := range n.children {
+			item, err := p.nodeElement(child, base, lang)
+			if err != nil {
+				return err
+			}
+			node := NewAnonNode()
+			if head == nil {
+				head = node
+			} else {
+				p.emit(last, ns.rdf.Get("rest"), node)
+			}
+			p.emit(node, ns.rdf.Get("first"), item)
+			last = node
+		}
+		if head == nil {
+			head = ns.rdf.Get("nil")
+		} else {
+			p.emit(last, ns.rdf.Get("rest"), ns.rdf.Get("nil"))
+		}
+		p.emit(subject, predicate, head)
+		return nil
+	default: // "Resource" and unknown parse types
+		node := NewAnonNode()
+		p.emit(subject, predicate, node)
+		nli := 0
+		for _, child := range n.children {
+			if err := p.propertyElement(child, node, base, lang, &nli); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(n.children) > 0 {
+		if len(n.children) > 1 {
+			return fmt.Errorf("rdfxml: property <%s%s> has more than one node element", n.name.Space, n.name.Local)
+		}
+		o, err := p.nodeElement(n.children[0], base, lang)
+		if err != nil {
+			return err
+		}
+		p.emit(subject, predicate, o)
+		return nil
+	}
+
+	if object != nil || len(propAttrs) > 0 {
+		if object == nil {
+			object = NewAnonNode()
+		}
+		for _, a := range propAttrs {
+			if isRDFAttr(a, "type") {
+				p.emit(object, ns.rdf.Get("type"), NewResource(resolveIRI(base, a.Value)))
+				continue
+			}
+			p.emit(object, NewResource(a.Name.Space+a.Name.Local), p.literal(a.Value, lang, ""))
+		}
+		p.emit(subject, predicate, object)
+		return nil
+	}
+
+	p.emit(subject, predicate, p.literal(n.text, lang, datatype))
+	return nil
+}
+
+// serializeRDFXML writes a graph as RDF/XML, one rdf:Description per subject
+func serializeRDFXML(w io.Writer, g *Graph) error {
+	prefixes := map[string]string{string(ns.rdf): "rdf"}
+	var namespaces []string
+
+	subjects := map[string]Term{}
+	for triple := range g.IterTriples() {
+		subjects[termKey(triple.Subject)] = triple.Subject
+		pred, ok := triple.Predicate.(*Resource)
+		if !ok {
+			return errors.New("rdfxml: predicates must be IRIs")
+		}
+		space, _, err := splitQName(pred.URI)
+		if err != nil {
+			return err
+		}
+		if _, ok := prefixes[space]; !ok {
+			prefixes[space] = fmt.Sprintf("ns%d", len(namespaces))
+			namespaces = append(namespaces, space)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	bw.WriteString("<rdf:RDF xmlns:rdf=\"" + xmlEscape(string(ns.rdf)) + "\"")
+	for _, space := range namespaces {
+		bw.WriteString("\n    xmlns:" + prefixes[space] + "=\"" + xmlEscape(space) + "\"")
+	}
+	bw.WriteString(">\n")
+
+	for _, key := range sortedKeys(subjects) {
+		s := subjects[key]
+		switch s := s.(type) {
+		case *Resource:
+			bw.WriteString("  <rdf:Description rdf:about=\"" + xmlEscape(s.URI) + "\">\n")
+		case *BlankNode:
+			bw.WriteString("  <rdf:Description rdf:nodeID=\"" + xmlEscape(blankLabel(s.ID)) + "\">\n")
+		default:
+			return errors.New("rdfxml: literals cannot be used as subjects")
+		}
+		triples := g.All(s, nil, nil)
+		sort.Sort(triplesByKey(triples))
+		for _, triple := range triples {
+			space, local, _ := splitQName(triple.Predicate.(*Resource).URI)
+			qname := prefixes[space] + ":" + local
+			switch o := triple.Object.(type) {
+			case *Resource:
+				bw.WriteString("    <" + qname + " rdf:resource=\"" + xmlEscape(o.URI) + "\"/>\n")
+			case *BlankNode:
+				bw.WriteString("    <" + qname + " rdf:nodeID=\"" + xmlEscape(blankLabel(o.ID)) + "\"/>\n")
+			case *Literal:
+				bw.WriteString("    <" + qname)
+				if len(o.Language) > 0 {
+					bw.WriteString(" xml:lang=\"" + xmlEscape(o.Language) + "\"")
+				} else if o.Datatype != nil {
+					bw.WriteString(" rdf:datatype=\"" + xmlEscape(debrack(o.Datatype.String())) + "\"")
+				}
+				bw.WriteString(">" + xmlEscape(o.Value) + "</" + qname + ">\n")
+			}
+		}
+		bw.WriteString("  </rdf:Description>\n")
+	}
+	bw.WriteString("</rdf:RDF>\n")
+	return bw.Flush()
+}
+
+// splitQName splits an IRI into a namespace and an XML local name
+func splitQName(iri string) (string, string, error) {
+	i := strings.LastIndexAny(iri, "#/") + 1
+	for i < len(iri) {
+		r := rune(iri[i])
+		if r == '_' || unicode.IsLetter(r) {
+			break
+		}
+		i++
+	}
+	local := iri[i:]
+	if len(local) == 0 {
+		return "", "", fmt.Errorf("rdfxml: cannot split <%s> into a QName", iri)
+	}
+	for _, r := range local {
+		if !isNameChar(r) {
+			return "", "", fmt.Errorf("rdfxml: cannot split <%s> into a QName", iri)
+		}
+	}
+	return iri[:i], local, nil
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+type triplesByKey []*Triple
+
+func (t triplesByKey) Len() int      { return len(t) }
+func (t triplesByKey) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t triplesByKey) Less(i, j int) bool {
+	if !t[i].Predicate.Equal(t[j].Predicate) {
+		return termLess(t[i].Predicate, t[j].Predicate)
+	}
+	return termLess(t[i].Object, t[j].Object)
+}
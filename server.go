@@ -1,8 +1,9 @@
 package gold
 
 import (
-	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -14,9 +15,9 @@ import (
 	_path "path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/gorilla/securecookie"
-	"github.com/presbrey/magicmime"
 	"golang.org/x/net/webdav"
 )
 
@@ -27,6 +28,10 @@ const (
 	METASuffix = ",meta"
 	// ACLSuffix is the generic name for the acl corresponding to a given resource
 	ACLSuffix = ",acl"
+	// TYPESuffix is the generic name for the declared Content-Type of a given resource
+	TYPESuffix = ",type"
+	// SPARQLSuffix is the generic name for the SPARQL query endpoint of a given resource
+	SPARQLSuffix = ",sparql"
 	// SystemPrefix is the generic name for the system-reserved namespace (e.g. APIs)
 	SystemPrefix = ",system"
 	// ProxyPath provides CORS proxy (empty to disable)
@@ -34,30 +39,17 @@ const (
 )
 
 var (
-	// Streaming (stream data or not)
-	Streaming = false // experimental
-
 	debugFlags  = log.Flags() | log.Lshortfile
 	debugPrefix = "[debug] "
 
-	magic *magicmime.Magic
-
 	methodsAll = []string{
 		"OPTIONS", "HEAD", "GET",
 		"PATCH", "POST", "PUT", "MKCOL", "DELETE",
 		"COPY", "MOVE", "LOCK", "UNLOCK",
+		"PROPFIND", "PROPPATCH",
 	}
 )
 
-func init() {
-	var err error
-
-	magic, err = magicmime.New()
-	if err != nil {
-		panic(err)
-	}
-}
-
 type errorString struct {
 	s string
 }
@@ -147,24 +139,36 @@ func handleStatusText(status int, err error) string {
 type Server struct {
 	http.Handler
 
-	Config     *ServerConfig
+	Config *ServerConfig
+	// TypeDetector guesses the media type of stored files
+	TypeDetector TypeDetector
+	// Storage holds the resources, in the local file system by default
+	Storage Storage
+
 	cookie     *securecookie.SecureCookie
 	cookieSalt []byte
 	debug      *log.Logger
-	webdav     *webdav.Handler
+	// webdavLocks holds the WebDAV locks of each data root
+	webdavLocks struct {
+		sync.Mutex
+		m map[string]webdav.LockSystem
+	}
+	// jsonldContext compacts JSON-LD when the client names no context
+	jsonldContext *jsonldContext
+	// jsonldContexts keeps the remote contexts clients have named
+	jsonldContexts *jsonldContextCache
 }
 
 // NewServer is used to create a new Server instance
 func NewServer(config *ServerConfig) *Server {
 	s := &Server{
 		Config:     config,
+		Storage:    FileStorage{},
 		cookie:     securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)),
 		cookieSalt: securecookie.GenerateRandomKey(32),
-		webdav: &webdav.Handler{
-			FileSystem: webdav.Dir(config.DataRoot),
-			LockSystem: webdav.NewMemLS(),
-		},
 	}
+	s.TypeDetector = NewTypeDetector(TypeDetectorFunc(typeByExtension), TypeDetectorFunc(s.typeByContent))
+	s.webdavLocks.m = map[string]webdav.LockSystem{}
 	if config.Debug {
 		s.debug = log.New(os.Stderr, debugPrefix, debugFlags)
 	} else {
@@ -172,9 +176,61 @@ func NewServer(config *ServerConfig) *Server {
 	}
 	s.debug.Println("---- starting server ----")
 	s.debug.Printf("config: %#v\n", s.Config)
+
+	s.jsonldContext, _ = newJSONLDContext(jsonldDefaultContext)
+	s.jsonldContexts = newJSONLDContextCache()
+	if len(config.JSONLDContext) > 0 {
+		ctx, err := readJSONLDContextFile(config.JSONLDContext)
+		if err != nil {
+			log.Println("JSON-LD context " + config.JSONLDContext + ": " + err.Error())
+		} else {
+			s.jsonldContext = ctx
+		}
+	}
 	return s
 }
 
+// jsonldForm works out from the profile of an Accept header which JSON-LD
+// form to answer in, and the context to compact it with. Profile URIs other
+// than the JSON-LD forms name a remote context, which is only fetched when
+// the configuration allows it.
+func (s *Server) jsonldForm(profile string) (form string, ctx *jsonldContext, err error) {
+	form = jsonldExpanded
+	for _, uri := range strings.Fields(strings.Trim(profile, "\"")) {
+		switch {
+		case uri == jsonldExpanded:
+			return jsonldExpanded, nil, nil
+		case uri == jsonldCompacted, uri == jsonldFlattened:
+			form = uri
+		case strings.HasPrefix(uri, "http:"), strings.HasPrefix(uri, "https:"):
+			if !s.allowsJSONLDContext(uri) {
+				return "", nil, errors.New("the JSON-LD context " + uri + " is not one this server uses")
+			}
+			if ctx, err = s.jsonldContexts.load(uri); err != nil {
+				return
+			}
+			if form == jsonldExpanded {
+				form = jsonldCompacted
+			}
+		}
+	}
+	if form != jsonldExpanded && ctx == nil {
+		ctx = s.jsonldContext
+	}
+	return
+}
+
+// allowsJSONLDContext reports whether a remote context is one of those the
+// configuration lets clients name
+func (s *Server) allowsJSONLDContext(uri string) bool {
+	for _, allowed := range s.Config.JSONLDContexts {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
+
 type response struct {
 	status  int
 	headers http.Header
@@ -229,7 +285,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 
 	// CORS
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Expose-Headers", "User, Triples, Location, Link, Vary, Last-Modified, Content-Length")
+	w.Header().Set("Access-Control-Expose-Headers", "User, Triples, Location, Link, Vary, Last-Modified, Content-Length, Memento-Datetime")
 	w.Header().Set("Access-Control-Max-Age", "1728000")
 
 	// RWW
@@ -250,6 +306,9 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 	acl := NewWAC(req, s, w, user)
 
 	// Intercept API requests
+	if trash := "/" + SystemPrefix + "/trash"; (req.URL.Path == trash || strings.HasPrefix(req.URL.Path, trash+"/")) && req.Method != "OPTIONS" {
+		return s.handleTrash(w, req, acl)
+	}
 	if strings.HasPrefix(req.Request.URL.Path, "/"+SystemPrefix) && req.Method != "OPTIONS" {
 		resp := HandleSystem(w, req, s)
 		if resp.Bytes != nil && len(resp.Bytes) > 0 {
@@ -260,16 +319,51 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		return r.respond(resp.Status, resp.Body)
 	}
 
+	// the trash is only reached through the system API
+	if req.URL.Path == "/"+TrashPrefix || strings.HasPrefix(req.URL.Path, "/"+TrashPrefix+"/") {
+		return r.respond(404, Skins["404"])
+	}
+
+	// Intercept SPARQL queries; past versions keep no ACLs of their own, so
+	// they cannot be queried
+	if req.isSPARQLQuery() && req.Method != "OPTIONS" {
+		if req.URL.Path == "/"+VersionsPrefix || strings.HasPrefix(req.URL.Path, "/"+VersionsPrefix+"/") {
+			return r.respond(403, "403 - Forbidden: past versions cannot be queried")
+		}
+		return s.handleSPARQLQuery(w, req, acl)
+	}
+
 	resource, _ := s.pathInfo(req.BaseURI())
 	s.debug.Println(req.RemoteAddr + " requested resource URI: " + resource.URI)
 	s.debug.Println(req.RemoteAddr + " requested resource Path: " + resource.File)
 
+	// type sidecars are kept by the server alone
+	if isTypeFile(strings.TrimSuffix(req.URL.Path, "/")) && req.Method != "OPTIONS" {
+		return r.respond(403, "403 - Forbidden: "+resource.URI+" is kept by the server")
+	}
+
+	// Intercept requests for past versions
+	if req.Method != "OPTIONS" {
+		var resp *response
+		if resource, resp = s.handleVersion(w, req, acl, resource); resp != nil {
+			return resp
+		}
+	}
+
+	// WebDAV properties are read and written in XML, whatever the client
+	// accepts
+	if req.Method == "PROPFIND" || req.Method == "PROPPATCH" {
+		return s.handleProps(w, req, acl, resource)
+	}
+
 	dataMime := req.Header.Get(HCType)
 	dataMime = strings.Split(dataMime, ";")[0]
 	dataHasParser := len(mimeParser[dataMime]) > 0
 	if len(dataMime) > 0 {
 		s.debug.Println("Content-Type: " + dataMime)
-		if dataMime != "multipart/form-data" && !dataHasParser && req.Method != "PUT" && req.Method != "HEAD" && req.Method != "OPTIONS" {
+		// LOCK bodies are WebDAV XML, and POSTed JSON is stored as it is
+		if dataMime != "multipart/form-data" && !dataHasParser && req.Method != "PUT" && req.Method != "HEAD" && req.Method != "OPTIONS" && req.Method != "LOCK" &&
+			!(req.Method == "POST" && dataMime == "application/json") {
 			s.debug.Println("Request contains unsupported Media Type:" + dataMime)
 			return r.respond(415, "HTTP 415 - Unsupported Media Type:", dataMime)
 		}
@@ -277,8 +371,10 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 
 	// Content Negotiation
 	contentType := "text/turtle"
+	acceptAny := true
 	acceptList, _ := req.Accept()
 	if len(acceptList) > 0 && acceptList[0].SubType != "*" {
+		acceptAny = false
 		contentType, err = acceptList.Negotiate(serializerMimes...)
 		if err != nil {
 			s.debug.Println("Accept type not acceptable: " + err.Error())
@@ -290,10 +386,20 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 	w.Header().Set("Link", brack(resource.AclURI)+"; rel=\"acl\", "+brack(resource.MetaURI)+"; rel=\"meta\"")
 
 	// generic headers
-	w.Header().Set("Accept-Patch", "application/json, application/sparql-update")
+	w.Header().Set("Accept-Patch", strings.Join([]string{"application/sparql-update", "text/n3", jsonPatchMime, mergePatchMime, rdfJSONPatchMime}, ", "))
 	w.Header().Set("Accept-Post", "text/turtle, application/json")
 	w.Header().Set("Allow", strings.Join(methodsAll, ", "))
 
+	// the server's own methods respect the locks taken with WebDAV LOCK
+	switch req.Method {
+	case "PATCH", "POST", "PUT", "DELETE", "MKCOL":
+		release, status, err := s.confirmLocks(req, false, resource)
+		if err != nil {
+			return r.respond(status, err.Error())
+		}
+		defer release()
+	}
+
 	switch req.Method {
 	case "OPTIONS":
 		// TODO: WAC
@@ -310,9 +416,10 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		if len(origin) < 1 {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		}
+		w.Header().Set("DAV", "1, 2")
 
 		// set LDP Link headers
-		stat, err := os.Stat(resource.File)
+		stat, err := s.Storage.Stat(resource.File)
 		if err == nil && stat.IsDir() {
 			w.Header().Add("Link", brack("http://www.w3.org/ns/ldp#BasicContainer")+"; rel=\"type\"")
 		}
@@ -324,6 +431,9 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		w.Header().Add("Link", brack(resource.Base+"/"+SystemPrefix+"/accountRecovery")+"; rel=\"http://example.org/services#accountRecovery\"")
 		w.Header().Add("Link", brack(resource.Base+"/"+SystemPrefix+"/newAccount")+"; rel=\"http://example.org/services#newAccount\"")
 		w.Header().Add("Link", brack(resource.Base+"/"+SystemPrefix+"/accountInfo")+"; rel=\"http://example.org/services#accountInfo\"")
+		if s.Config.TrashAge > 0 {
+			w.Header().Add("Link", brack(resource.Base+"/"+SystemPrefix+"/trash")+"; rel=\"http://example.org/services#trash\"")
+		}
 
 		return r.respond(200)
 
@@ -355,9 +465,10 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 
 		// overwrite ACL Link header
 		w.Header().Set("Link", brack(resource.AclURI)+"; rel=\"acl\", "+brack(resource.MetaURI)+"; rel=\"meta\"")
+		s.versionLinks(w, resource)
 
 		// check if resource exists and set LDP Link headers
-		stat, err := os.Stat(resource.File)
+		stat, err := s.Storage.Stat(resource.File)
 		if err != nil {
 			// redirect to skin
 			if s.Config.Vhosts && resource.Base == strings.TrimRight(req.BaseURI(), "/") && contentType == "text/html" && req.Method != "HEAD" {
@@ -373,6 +484,9 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 
 		if stat.IsDir() {
 			w.Header().Add("Link", brack("http://www.w3.org/ns/ldp#BasicContainer")+"; rel=\"type\"")
+			if m := s.containerMembership(resource); m != nil {
+				w.Header().Add("Link", brack(m.kind)+"; rel=\"type\"")
+			}
 		}
 		if req.Method == "HEAD" && stat != nil {
 			w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size()))
@@ -388,7 +502,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		unlock := lock(resource.File)
 		defer unlock()
 
-		etag, err = NewETag(resource.File)
+		etag, err = newETag(s.Storage, resource.File)
 		if err != nil {
 			return r.respond(500, err)
 		}
@@ -403,6 +517,9 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		}
 
 		g := NewGraph(resource.URI)
+		g.UsePrefixes(s.Config.Prefixes)
+		// ds keeps the contained documents of a container in their own graphs
+		var ds *Dataset
 
 		switch {
 		case stat.IsDir():
@@ -410,7 +527,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 				magicType = "text/html"
 				maybeRDF = false
 				for _, dirIndex := range s.Config.DirIndex {
-					_, xerr := os.Stat(resource.File + dirIndex)
+					_, xerr := s.Storage.Stat(resource.File + dirIndex)
 					status = 200
 					if xerr == nil {
 						resource, err = s.pathInfo(resource.Base + "/" + resource.Path + dirIndex)
@@ -435,13 +552,23 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 				g.AddTriple(root, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/ldp#Container"))
 				g.AddTriple(root, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/ldp#BasicContainer"))
 
-				g.AddTriple(root, NewResource("http://www.w3.org/ns/posix/stat#mtime"), NewLiteral(fmt.Sprintf("%d", stat.ModTime().Unix())))
-				g.AddTriple(root, NewResource("http://www.w3.org/ns/posix/stat#size"), NewLiteral(fmt.Sprintf("%d", stat.Size())))
+				g.AddTriple(root, NewResource("http://www.w3.org/ns/posix/stat#mtime"), NewLiteralWithDatatype(fmt.Sprintf("%d", stat.ModTime().Unix()), ns.xsd.Get("integer")))
+				g.AddTriple(root, NewResource("http://www.w3.org/ns/posix/stat#size"), NewLiteralWithDatatype(fmt.Sprintf("%d", stat.Size()), ns.xsd.Get("integer")))
 
 				kb := NewGraph(resource.MetaURI)
-				kb.ReadFile(resource.MetaFile)
+				kb.readStorage(s.Storage, resource.MetaFile)
+				// membership triples are left out when the client prefers so
+				var membership *ldpMembership
+				for _, omit := range ParsePreferHeader(req.Header.Get("Prefer")).Omits() {
+					if omit == "http://www.w3.org/ns/ldp#PreferMembership" {
+						membership, _ = parseMembership(kb, resource.URI)
+					}
+				}
 				if kb.Len() > 0 {
 					for triple := range kb.IterTriples() {
+						if membership != nil && membership.isMembership(triple) {
+							continue
+						}
 						var subject Term
 						if kb.One(NewResource(resource.MetaURI), nil, nil) != nil {
 							subject = NewResource(resource.URI)
@@ -453,21 +580,21 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 				}
 
 				if glob {
-					matches, err := filepath.Glob(globPath)
+					matches, err := globStorage(s.Storage, globPath)
 					if err == nil {
 						for _, file := range matches {
-							stat, serr := os.Stat(file)
-							if !stat.IsDir() && serr == nil {
+							stat, serr := s.Storage.Stat(file)
+							if serr == nil && !stat.IsDir() && !isTypeFile(file) {
 								// TODO: check acls
-								guessType, _ := magic.TypeByFile(file)
-								if guessType == "text/plain" {
+								guessType, _ := s.TypeDetector.TypeByFile(file)
+								if isStoredRDF(guessType) {
 									res, err := s.pathInfo(resource.Base + "/" + filepath.Dir(resource.Path) + "/" + filepath.Base(file))
 									if err != nil {
 										return r.respond(500, err)
 									}
 									aclStatus, err = acl.AllowRead(resource.URI)
 									if aclStatus == 200 && err == nil {
-										g.AppendFile(res.File, res.URI)
+										g.appendStorage(s.Storage, res.File, res.URI)
 										g.AddTriple(root, NewResource("http://www.w3.org/ns/ldp#contains"), NewResource(res.URI))
 									}
 								}
@@ -475,9 +602,34 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 						}
 					}
 				} else {
+					var listed []os.FileInfo
+					if infos, err := s.Storage.ReadDir(resource.File); err == nil {
+						for _, info := range infos {
+							if info != nil && !isHiddenFile(info.Name()) && !isTypeFile(info.Name()) {
+								listed = append(listed, info)
+							}
+						}
+					}
+
+					// large listings are served a page at a time, starting
+					// with the first page
+					pref := ParsePreferHeader(req.Header.Get("Prefer"))
+					size := s.pageSize(pref)
+					if query := req.URL.Query(); isPageQuery(query) {
+						if size == 0 {
+							size = len(listed)
+						}
+						page := listPage(listed, query, size)
+						pageLinks(w, resource, page)
+						listed = page.infos
+					} else if size > 0 && len(listed) > size {
+						w.Header().Add("Vary", "Prefer")
+						w.Header().Set("Location", resource.URI+"?page=first")
+						return r.respond(303)
+					}
+
 					showContainment := true
 					showEmpty := false
-					pref := ParsePreferHeader(req.Header.Get("Prefer"))
 					if len(pref.headers) > 0 {
 						w.Header().Set("Preference-Applied", "return=representation")
 					}
@@ -498,91 +650,77 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 						}
 					}
 
-					if infos, err := ioutil.ReadDir(resource.File); err == nil {
-						var _s Term
-						for _, info := range infos {
-							if info != nil {
-								res := resource.URI + info.Name()
-								if info.IsDir() {
-									res += "/"
-								}
-								f, err := s.pathInfo(res)
-								if err != nil {
-									r.respond(500, err)
-								}
-								if info.IsDir() {
-									_s = NewResource(f.URI)
-									if !showEmpty {
-										g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/posix/stat#Directory"))
-										g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/ldp#BasicContainer"))
-										g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/ldp#Container"))
+					if isDatasetMime(contentType) {
+						ds = NewDataset(resource.URI)
+						ds.def = g
+					}
+
+					var _s Term
+					for _, info := range listed {
+						res := resource.URI + info.Name()
+						if info.IsDir() {
+							res += "/"
+						}
+						f, err := s.pathInfo(res)
+						if err != nil {
+							r.respond(500, err)
+						}
+						if info.IsDir() {
+							_s = NewResource(f.URI)
+							if !showEmpty {
+								g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/posix/stat#Directory"))
+								g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/ldp#BasicContainer"))
+								g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/ldp#Container"))
+							}
+							kb := NewGraph(f.URI)
+							kb.readStorage(s.Storage, f.MetaFile)
+							if kb.Len() > 0 {
+								for _, st := range kb.All(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), nil) {
+									if st != nil && st.Object != nil {
+										g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), st.Object)
 									}
+								}
+							}
+						} else {
+							_s = NewResource(f.URI)
+							if !showEmpty {
+								g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/posix/stat#File"))
+								// add type if RDF resource
+								//infoUrl, _ := url.Parse(info.Name())
+								if isStoredRDF(f.FileType) {
 									kb := NewGraph(f.URI)
-									kb.ReadFile(f.MetaFile)
-									if kb.Len() > 0 {
-										for _, st := range kb.All(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), nil) {
-											if st != nil && st.Object != nil {
-												g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), st.Object)
-											}
-										}
-									}
-								} else {
-									_s = NewResource(f.URI)
-									if !showEmpty {
-										g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), NewResource("http://www.w3.org/ns/posix/stat#File"))
-										// add type if RDF resource
-										//infoUrl, _ := url.Parse(info.Name())
-										guessType, _ := magic.TypeByFile(f.File)
-
-										if guessType == "text/plain" {
-											// open file and attempt to read the first line
-											// Open an input file, exit on error.
-											fd, err := os.Open(f.File)
-											if err != nil {
-												s.debug.Println("GET find mime type error:" + err.Error())
-											}
-											defer fd.Close()
-
-											scanner := bufio.NewScanner(fd)
-
-											// stop after the first line
-											for scanner.Scan() {
-												if strings.HasPrefix(scanner.Text(), "@prefix") {
-													kb := NewGraph(f.URI)
-													kb.ReadFile(f.File)
-													if kb.Len() > 0 {
-														for _, st := range kb.All(NewResource(f.URI), NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), nil) {
-															if st != nil && st.Object != nil {
-																g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), st.Object)
-															}
-														}
-													}
-												}
-												break
-											}
-											// log potential errors
-											if err := scanner.Err(); err != nil {
-												s.debug.Println("GET scan err: " + scanner.Err().Error())
-											}
+									kb.readStorage(s.Storage, f.File)
+									for _, st := range kb.All(NewResource(f.URI), NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), nil) {
+										if st != nil && st.Object != nil {
+											g.AddTriple(_s, NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"), st.Object)
 										}
 									}
 								}
-								if !showEmpty {
-									g.AddTriple(_s, NewResource("http://www.w3.org/ns/posix/stat#mtime"), NewLiteral(fmt.Sprintf("%d", info.ModTime().Unix())))
-									g.AddTriple(_s, NewResource("http://www.w3.org/ns/posix/stat#size"), NewLiteral(fmt.Sprintf("%d", info.Size())))
-								}
-								if showContainment {
-									g.AddTriple(root, NewResource("http://www.w3.org/ns/ldp#contains"), _s)
-								}
+							}
+						}
+						if !showEmpty {
+							g.AddTriple(_s, NewResource("http://www.w3.org/ns/posix/stat#mtime"), NewLiteralWithDatatype(fmt.Sprintf("%d", info.ModTime().Unix()), ns.xsd.Get("integer")))
+							g.AddTriple(_s, NewResource("http://www.w3.org/ns/posix/stat#size"), NewLiteralWithDatatype(fmt.Sprintf("%d", info.Size()), ns.xsd.Get("integer")))
+						}
+						if showContainment {
+							g.AddTriple(root, NewResource("http://www.w3.org/ns/ldp#contains"), _s)
+						}
+						if ds != nil && !info.IsDir() && isStoredRDF(f.FileType) {
+							if aclStatus, err := acl.AllowRead(f.URI); aclStatus == 200 && err == nil {
+								ds.Graph(NewResource(f.URI)).readStorage(s.Storage, f.File)
 							}
 						}
 					}
+					if ds != nil {
+						// documents we could not read are simply left out
+						w.Header().Del("WWW-Authenticate")
+					}
 				}
 				status = 200
 				maybeRDF = true
 			}
 		default:
-			maybeRDF = magicType == "text/plain"
+			maybeRDF = isStoredRDF(magicType)
 			status = 200
 
 			if req.Method == "GET" && strings.Contains(contentType, "text/html") {
@@ -595,7 +733,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 				}
 				w.Header().Set(HCType, magicType)
 				w.WriteHeader(200)
-				f, err := os.Open(resource.File)
+				f, err := s.Storage.OpenFile(resource.File, os.O_RDONLY, 0)
 				if err == nil {
 					defer func() {
 						if err := f.Close(); err != nil {
@@ -605,8 +743,6 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 					io.Copy(w, f)
 				}
 				return
-			} else if !maybeRDF && !strings.Contains(contentType, "text/html") {
-				maybeRDF = true
 			}
 		}
 
@@ -617,12 +753,28 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		if extn := strings.LastIndex(resource.File, "."); extn >= 0 {
 			if mime, known := mimeTypes[resource.File[extn:]]; known {
 				magicType = mime
-				maybeRDF = false
+				maybeRDF = maybeRDF && isStoredRDF(mime)
 			}
 		}
 
 		if maybeRDF {
-			g.ReadFile(resource.File)
+			// answer in the type the resource was written in, unless asked otherwise
+			if declared := strings.Split(magicType, ";")[0]; acceptAny && len(mimeSerializer[declared]) > 0 {
+				contentType = declared
+			}
+			// files stored as N-Triples are converted as they are read
+			if s.Config.Streaming && req.Method == "GET" && !stat.IsDir() && streamable(magicType, contentType) &&
+				len(ParsePreferHeader(req.Header.Get("Prefer")).Entailment()) == 0 {
+				if s.streamFile(w, resource, contentType) {
+					return
+				}
+			}
+			g.readStorage(s.Storage, resource.File)
+			if regime := ParsePreferHeader(req.Header.Get("Prefer")).Entailment(); len(regime) > 0 && g.Len() > 0 {
+				g.Infer(regime)
+				w.Header().Set("Preference-Applied", "return=representation")
+				w.Header().Add("Vary", "Prefer")
+			}
 			if g.Len() == 0 {
 				maybeRDF = false
 			} else {
@@ -631,8 +783,22 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			}
 		}
 
+		jsonldForm := jsonldExpanded
+		var jsonldCtx *jsonldContext
+		if maybeRDF && ds == nil && contentType == "application/ld+json" {
+			jsonldForm, jsonldCtx, err = s.jsonldForm(acceptList.Params(contentType)["profile"])
+			if err != nil {
+				return r.respond(406, "HTTP 406 - Accept type not acceptable: "+err.Error())
+			}
+			if jsonldForm != jsonldExpanded {
+				w.Header().Set(HCType, contentType+"; profile=\""+jsonldForm+"\"")
+			}
+		}
+
 		if req.Method == "HEAD" {
-			w.Header().Set(HCType, magicType)
+			if !maybeRDF {
+				w.Header().Set(HCType, magicType)
+			}
 			return r.respond(status)
 		}
 
@@ -640,7 +806,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			w.Header().Set(HCType, magicType)
 
 			if status == 200 {
-				f, err := os.Open(resource.File)
+				f, err := s.Storage.OpenFile(resource.File, os.O_RDONLY, 0)
 				if err == nil {
 					defer func() {
 						if err := f.Close(); err != nil {
@@ -656,32 +822,12 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		}
 
 		data := ""
-		if Streaming {
-			errCh := make(chan error, 8)
-			go func() {
-				rf, wf, err := os.Pipe()
-				if err != nil {
-					errCh <- err
-					return
-				}
-				go func() {
-					defer wf.Close()
-					err := g.WriteFile(wf, contentType)
-					if err != nil {
-						errCh <- err
-					}
-				}()
-				go func() {
-					defer rf.Close()
-					_, err := io.Copy(w, rf)
-					if err != nil {
-						errCh <- err
-					} else {
-						errCh <- nil
-					}
-				}()
-			}()
-			err = <-errCh
+		if ds != nil {
+			data, err = ds.Serialize(contentType)
+		} else if jsonldForm != jsonldExpanded {
+			var b []byte
+			b, err = g.serializeJSONLDForm(jsonldForm, jsonldCtx)
+			data = string(b)
 		} else {
 			data, err = g.Serialize(contentType)
 		}
@@ -707,7 +853,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			}
 		}
 
-		etag, _ := NewETag(resource.File)
+		etag, _ := newETag(s.Storage, resource.File)
 		if !req.ifMatch("\"" + etag + "\"") {
 			return r.respond(412, "412 - Precondition Failed")
 		}
@@ -715,36 +861,143 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			return r.respond(412, "412 - Precondition Failed")
 		}
 
-		if dataHasParser {
-			g := NewGraph(resource.URI)
-			g.ReadFile(resource.File)
-
-			switch dataMime {
-			case "application/json":
-				g.JSONPatch(req.Body)
-			case "application/sparql-update":
-				sparql := NewSPARQLUpdate(g.URI())
-				sparql.Parse(req.Body)
-				g.SPARQLUpdate(sparql)
-			default:
-				if dataHasParser {
-					g.Parse(req.Body, dataMime)
+		switch dataMime {
+		case jsonPatchMime, mergePatchMime:
+			// these rewrite the whole document, so appending is not enough
+			aclWrite, err := acl.AllowWrite(resource.URI)
+			if aclWrite > 200 || err != nil {
+				return r.respond(aclWrite, handleStatusText(aclWrite, err))
+			}
+			if stat, err := s.Storage.Stat(resource.File); err == nil && stat.IsDir() {
+				return r.respond(409, "409 - Conflict! Cannot apply a JSON patch to a container.")
+			}
+			doc, err := readStorageFile(s.Storage, resource.File)
+			isNew := os.IsNotExist(err)
+			if err != nil && !isNew {
+				return r.respond(500, err)
+			}
+			if !isNew && !json.Valid(doc) {
+				return r.respond(415, "HTTP 415 - Unsupported Media Type: "+resource.URI+" is not a JSON document")
+			}
+			patch, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return r.respond(500, err)
+			}
+			if dataMime == jsonPatchMime {
+				if isNew {
+					doc = []byte("null")
 				}
+				doc, err = applyJSONPatch(doc, patch)
+			} else {
+				doc, err = applyMergePatch(doc, patch)
 			}
-
-			f, err := os.OpenFile(resource.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 			if err != nil {
-				s.debug.Println("PATCH os.OpenFile err: " + err.Error())
+				return r.respond(patchStatus(err), err.Error())
+			}
+			if err = s.snapshot(resource); err != nil {
+				s.debug.Println("PATCH snapshot err: " + err.Error())
+				return r.respond(500, err)
+			}
+			if err = writeStorageFile(s.Storage, resource.File, doc, 0644); err != nil {
+				s.debug.Println("PATCH writeStorageFile err: " + err.Error())
 				return r.respond(500, err)
 			}
-			defer f.Close()
+			if isNew {
+				if err = s.writeTypeFile(resource.TypeFile, "application/json"); err != nil {
+					s.debug.Println("PATCH writeTypeFile err: " + err.Error())
+				}
+			}
+			onUpdateURI(resource.URI)
+			if isNew {
+				return r.respond(201)
+			}
+			return r.respond(200)
 
-			err = g.WriteFile(f, "text/turtle")
-			if err != nil {
-				s.debug.Println("PATCH g.WriteFile err: " + err.Error())
+		}
+
+		if dataHasParser {
+			// apply changes the graph as the request asks, and returns the
+			// status to answer with if it cannot
+			apply := func(g *Graph) (int, string) {
+				switch dataMime {
+				case rdfJSONPatchMime:
+					if err := g.JSONPatch(req.Body); err != nil {
+						return 400, "400 - " + err.Error()
+					}
+				case "application/sparql-update":
+					sparql := NewSPARQLUpdate(g.URI())
+					if err := sparql.Parse(req.Body); err != nil {
+						return 400, err.Error()
+					}
+					g.SPARQLUpdate(sparql)
+				case "text/n3":
+					patch := NewN3Patch(g.URI())
+					if err := patch.Parse(req.Body); err != nil {
+						return patchStatus(err), err.Error()
+					}
+					// deleting needs more than the append access checked above
+					if len(patch.deletes) > 0 {
+						aclWrite, err := acl.AllowWrite(resource.URI)
+						if aclWrite > 200 || err != nil {
+							return aclWrite, handleStatusText(aclWrite, err)
+						}
+					}
+					// a where clause or deletes reveal what the resource holds
+					// through whether the patch applies
+					if len(patch.where) > 0 || len(patch.deletes) > 0 {
+						aclRead, err := acl.AllowRead(resource.URI)
+						if aclRead > 200 || err != nil {
+							return aclRead, handleStatusText(aclRead, err)
+						}
+					}
+					if err := g.N3Patch(patch); err != nil {
+						return patchStatus(err), err.Error()
+					}
+				default:
+					if err := g.parse(req.Body, dataMime, g.URI()); err != nil {
+						return 400, "400 - " + err.Error()
+					}
+				}
+				return s.validateShapes(w, resource, g)
 			}
 
-			if err != nil {
+			// storages that keep graphs change them in a transaction, unless
+			// a version has to be kept once the change is known to apply
+			if gs, ok := s.Storage.(GraphStorage); ok && !s.Config.Versioning {
+				status, msg, triples := 200, "", 0
+				err := gs.UpdateGraph(resource.File, resource.URI, func(g *Graph) error {
+					g.UsePrefixes(s.Config.Prefixes)
+					if status, msg = apply(g); status != 200 {
+						return errors.New(msg)
+					}
+					triples = g.Len()
+					return nil
+				})
+				if status != 200 {
+					return r.respond(status, msg)
+				}
+				if err != nil {
+					s.debug.Println("PATCH UpdateGraph err: " + err.Error())
+					return r.respond(500, err)
+				}
+				onUpdateURI(resource.URI)
+				w.Header().Set("Triples", fmt.Sprintf("%d", triples))
+				return r.respond(200)
+			}
+
+			g := NewGraph(resource.URI)
+			g.UsePrefixes(s.Config.Prefixes)
+			g.readStorage(s.Storage, resource.File)
+			if status, msg := apply(g); status != 200 {
+				return r.respond(status, msg)
+			}
+			if err = s.snapshot(resource); err != nil {
+				s.debug.Println("PATCH snapshot err: " + err.Error())
+				return r.respond(500, err)
+			}
+
+			if err := writeStorageGraph(s.Storage, resource.File, g, "text/turtle"); err != nil {
+				s.debug.Println("PATCH writeStorageGraph err: " + err.Error())
 				return r.respond(500, err)
 			}
 
@@ -768,7 +1021,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			}
 		}
 
-		etag, _ := NewETag(resource.File)
+		etag, _ := newETag(s.Storage, resource.File)
 		if !req.ifMatch("\"" + etag + "\"") {
 			return r.respond(412, "412 - Precondition Failed")
 		}
@@ -778,9 +1031,9 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 
 		// LDP
 		isNew := false
-		stat, err := os.Stat(resource.File)
+		stat, err := s.Storage.Stat(resource.File)
 		if err == nil && stat.IsDir() && dataMime != "multipart/form-data" {
-			link := ParseLinkHeader(req.Header.Get("Link")).MatchRel("type")
+			link := ParseLinkHeader(req.Header.Get("Link")).ContainerType()
 			slug := req.Header.Get("Slug")
 
 			uuid, err := newUUID()
@@ -801,7 +1054,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 				if strings.HasSuffix(slug, "/") {
 					slug = strings.TrimRight(slug, "/")
 				}
-				st, _ := os.Stat(resource.File + slug)
+				st, _ := s.Storage.Stat(resource.File + slug)
 				if st != nil {
 					s.debug.Println("POST LDP - A resource with the same name already exists: " + resource.Path + slug)
 					return r.respond(409, "409 - Conflict! A resource with the same name already exists.")
@@ -811,7 +1064,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			}
 			resource.Path += slug
 
-			if len(link) > 0 && link == "http://www.w3.org/ns/ldp#BasicContainer" {
+			if len(link) > 0 {
 				if !strings.HasSuffix(resource.Path, "/") {
 					resource.Path += "/"
 				}
@@ -821,41 +1074,40 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 					return r.respond(500, err)
 				}
 
+				//Replace the subject with the dir path instead of the meta file path
+				g, err := containerMeta(resource.URI, link, req.Body, dataMime)
+				if err != nil {
+					s.debug.Println("POST LDPC containerMeta err: " + err.Error())
+					return r.respond(400, "400 - "+err.Error())
+				}
+				g.UsePrefixes(s.Config.Prefixes)
+
 				w.Header().Set("Location", resource.URI)
 				w.Header().Set("Link", brack(resource.MetaURI)+"; rel=\"meta\", "+brack(resource.AclURI)+"; rel=\"acl\"")
 				w.Header().Add("Link", brack("http://www.w3.org/ns/ldp#Resource")+"; rel=\"type\"")
-				w.Header().Add("Link", brack("http://www.w3.org/ns/ldp#BasicContainer")+"; rel=\"type\"")
+				w.Header().Add("Link", brack(link)+"; rel=\"type\"")
 
-				err = os.MkdirAll(resource.File, 0755)
+				err = s.Storage.MkdirAll(resource.File, 0755)
 				if err != nil {
 					s.debug.Println("POST LDPC os.MkdirAll err: " + err.Error())
 					return r.respond(500, err)
 				}
 				s.debug.Println("Created dir " + resource.File)
 
-				//Replace the subject with the dir path instead of the meta file path
-				if dataHasParser {
-					g := NewGraph(resource.URI)
-					mg := NewGraph(resource.URI)
-					mg.Parse(req.Body, dataMime)
-					for triple := range mg.IterTriples() {
-						subject := NewResource(".")
-						g.AddTriple(subject, triple.Predicate, triple.Object)
-					}
-
-					f, err := os.OpenFile(resource.MetaFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+				if dataHasParser || g.Len() > 0 {
+					err = writeStorageAtomic(s.Storage, resource.MetaFile, 0644, func(w io.Writer) error {
+						if g.Len() == 0 {
+							return nil
+						}
+						return g.WriteFile(w, "")
+					})
 					if err != nil {
-						s.debug.Println("POST LDPC os.OpenFile err: " + err.Error())
+						s.debug.Println("POST LDPC writeStorageAtomic err: " + err.Error())
 						return r.respond(500, err)
 					}
-					defer f.Close()
-
-					if g.Len() > 0 {
-						if err = g.WriteFile(f, ""); err != nil {
-							s.debug.Println("POST LDPC g.WriteFile err: " + err.Error())
-							return r.respond(500, err)
-						}
-					}
+				}
+				if err = s.updateMembership(s.membership(resource), resource, nil); err != nil {
+					s.debug.Println("POST LDPC updateMembership err: " + err.Error())
 				}
 				w.Header().Set("Location", resource.URI)
 				onUpdateURI(resource.URI)
@@ -874,7 +1126,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		}
 
 		if stat == nil {
-			err = os.MkdirAll(_path.Dir(resource.File), 0755)
+			err = s.Storage.MkdirAll(_path.Dir(resource.File), 0755)
 			if err != nil {
 				s.debug.Println("POST MkdirAll err: " + err.Error())
 				return r.respond(500, err)
@@ -900,18 +1152,23 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 						newFile := ""
 						if filepath.Base(resource.Path) == files[i].Filename {
 							newFile = resource.File
+							if err = s.snapshot(resource); err != nil {
+								s.debug.Println("POST snapshot err: " + err.Error())
+								return r.respond(500, err)
+							}
 						} else {
 							newFile = resource.File + files[i].Filename
 						}
-						dst, err := os.OpenFile(newFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-						defer dst.Close()
+						err = writeStorageAtomic(s.Storage, newFile, 0644, func(w io.Writer) error {
+							_, err := io.Copy(w, file)
+							return err
+						})
 						if err != nil {
-							s.debug.Println("POST multipart/form os.Create err: " + err.Error())
+							s.debug.Println("POST multipart/form writeStorageAtomic err: " + err.Error())
 							return r.respond(500, err)
 						}
-						if _, err := io.Copy(dst, file); err != nil {
-							s.debug.Println("POST multipart/form io.Copy err: " + err.Error())
-							return r.respond(500, err)
+						if err := s.writeTypeFile(newFile+TYPESuffix, files[i].Header.Get(HCType)); err != nil {
+							s.debug.Println("POST multipart/form writeTypeFile err: " + err.Error())
 						}
 						w.Header().Add("Location", resource.URI+files[i].Filename)
 					}
@@ -920,55 +1177,82 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 				return r.respond(201)
 			}
 		} else {
-			stat, err = os.Stat(resource.File)
+			stat, err = s.Storage.Stat(resource.File)
 			if os.IsNotExist(err) {
 				isNew = true
 			} else if os.IsExist(err) && stat.IsDir() {
 				resource.File = resource.File + "/" + METASuffix
 			}
+			membership := s.membership(resource)
+			members := s.members(membership, resource)
 
 			if dataHasParser {
 				g := NewGraph(resource.URI)
-				g.ReadFile(resource.File)
+				g.UsePrefixes(s.Config.Prefixes)
+				g.readStorage(s.Storage, resource.File)
 
 				switch dataMime {
-				case "application/json":
-					g.JSONPatch(req.Body)
+				case rdfJSONPatchMime:
+					if err := g.JSONPatch(req.Body); err != nil {
+						return r.respond(400, "400 - "+err.Error())
+					}
 				case "application/sparql-update":
 					sparql := NewSPARQLUpdate(g.URI())
-					sparql.Parse(req.Body)
+					if err := sparql.Parse(req.Body); err != nil {
+						return r.respond(400, err.Error())
+					}
 					g.SPARQLUpdate(sparql)
 				default:
-					g.Parse(req.Body, dataMime)
+					if err := g.parse(req.Body, dataMime, g.URI()); err != nil {
+						s.debug.Println("POST parse err: " + err.Error())
+						return r.respond(400, "400 - "+err.Error())
+					}
 				}
-				f, err := os.OpenFile(resource.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-				if err != nil {
-					s.debug.Println("POST os.OpenFile err: " + err.Error())
-					return r.respond(500, err.Error())
+				if status, report := s.validateShapes(w, resource, g); status != 200 {
+					return r.respond(status, report)
 				}
-				defer f.Close()
-				if g.Len() > 0 {
-					err = g.WriteFile(f, "text/turtle")
-					if err != nil {
-						s.debug.Println("POST g.WriteFile err: " + err.Error())
-					} else {
-						s.debug.Println("Wrote resource file: " + resource.File)
+				if err = s.snapshot(resource); err != nil {
+					s.debug.Println("POST snapshot err: " + err.Error())
+					return r.respond(500, err)
+				}
+				err = writeStorageAtomic(s.Storage, resource.File, 0644, func(w io.Writer) error {
+					if g.Len() == 0 {
+						return nil
 					}
+					return g.WriteFile(w, "text/turtle")
+				})
+				if err != nil {
+					s.debug.Println("POST writeStorageAtomic err: " + err.Error())
+					return r.respond(500, err.Error())
 				}
+				s.debug.Println("Wrote resource file: " + resource.File)
 				w.Header().Set("Triples", fmt.Sprintf("%d", g.Len()))
 			} else {
-				f, err := os.OpenFile(resource.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-				if err != nil {
-					s.debug.Println("POST os.OpenFile err: " + err.Error())
-					return r.respond(500, err.Error())
+				// JSON is only stored as a new resource, never appended
+				if !isNew && dataMime == "application/json" {
+					return r.respond(415, "HTTP 415 - Unsupported Media Type: use PUT to replace a JSON document")
+				}
+				if err = s.snapshot(resource); err != nil {
+					s.debug.Println("POST snapshot err: " + err.Error())
+					return r.respond(500, err)
 				}
-				defer f.Close()
-				_, err = io.Copy(f, req.Body)
+				err = writeStorageAtomic(s.Storage, resource.File, 0644, func(w io.Writer) error {
+					_, err := io.Copy(w, req.Body)
+					return err
+				})
 				if err != nil {
-					s.debug.Println("POST os.OpenFile err: " + err.Error())
+					s.debug.Println("POST writeStorageAtomic err: " + err.Error())
 					return r.respond(500, err.Error())
 				}
 			}
+			if isNew && mimeParser[dataMime] != "internal" {
+				if err = s.writeTypeFile(resource.TypeFile, req.Header.Get(HCType)); err != nil {
+					s.debug.Println("POST writeTypeFile err: " + err.Error())
+				}
+			}
+			if err = s.updateMembership(membership, resource, members); err != nil {
+				s.debug.Println("POST updateMembership err: " + err.Error())
+			}
 
 			onUpdateURI(resource.URI)
 			if isNew {
@@ -994,7 +1278,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			}
 		}
 
-		etag, _ := NewETag(resource.File)
+		etag, _ := newETag(s.Storage, resource.File)
 		if !req.ifMatch("\"" + etag + "\"") {
 			return r.respond(412, "412 - Precondition Failed")
 		}
@@ -1002,10 +1286,19 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			return r.respond(412, "412 - Precondition Failed")
 		}
 
+		membership := s.membership(resource)
+		members := s.members(membership, resource)
+
 		// LDP PUT should be merged with LDP POST into a common LDP "method" switch
-		link := ParseLinkHeader(req.Header.Get("Link")).MatchRel("type")
-		if len(link) > 0 && link == "http://www.w3.org/ns/ldp#BasicContainer" {
-			err := os.MkdirAll(resource.File, 0755)
+		link := ParseLinkHeader(req.Header.Get("Link")).ContainerType()
+		if len(link) > 0 {
+			g, err := containerMeta(resource.URI, link, req.Body, dataMime)
+			if err != nil {
+				s.debug.Println("PUT containerMeta err: " + err.Error())
+				return r.respond(400, "400 - "+err.Error())
+			}
+			g.UsePrefixes(s.Config.Prefixes)
+			err = s.Storage.MkdirAll(resource.File, 0755)
 			if err != nil {
 				s.debug.Println("PUT MkdirAll err: " + err.Error())
 				return r.respond(500, err)
@@ -1015,50 +1308,105 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			w.Header().Set("Link", brack(resource.MetaURI)+"; rel=\"meta\", "+brack(resource.AclURI)+"; rel=\"acl\"")
 			// LDP header
 			w.Header().Add("Link", brack("http://www.w3.org/ns/ldp#Resource")+"; rel=\"type\"")
+			w.Header().Add("Link", brack(link)+"; rel=\"type\"")
+
+			if g.Len() > 0 {
+				if err = writeStorageGraph(s.Storage, resource.MetaFile, g, ""); err != nil {
+					s.debug.Println("PUT writeStorageGraph err: " + err.Error())
+					return r.respond(500, err)
+				}
+			}
+			if err = s.updateMembership(membership, resource, members); err != nil {
+				s.debug.Println("PUT updateMembership err: " + err.Error())
+			}
 
 			onUpdateURI(resource.URI)
 			return r.respond(201)
 		}
-		err = os.MkdirAll(_path.Dir(resource.File), 0755)
+		err = s.Storage.MkdirAll(_path.Dir(resource.File), 0755)
 		if err != nil {
 			s.debug.Println("PUT MkdirAll err: " + err.Error())
 			return r.respond(500, err)
 		}
 
 		isNew := true
-		stat, err := os.Stat(resource.File)
+		stat, err := s.Storage.Stat(resource.File)
 		if os.IsExist(err) {
 			isNew = false
 		}
 
-		f, err := os.OpenFile(resource.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-		if err != nil {
-			s.debug.Println("PUT os.OpenFile err: " + err.Error())
-			if stat.IsDir() {
-				w.Header().Add("Link", brack(resource.URI)+"; rel=\"describedby\"")
-				return r.respond(406, "406 - Cannot use PUT on a directory.")
+		// N-Triples and N-Quads are stored without building a graph, unless
+		// they have to be validated against the container's shapes
+		if s.Config.Streaming && streamable(dataMime, "application/n-triples") && (stat == nil || !stat.IsDir()) {
+			if _, shapes, err := s.containerShapes(resource); err == nil && shapes == nil {
+				n, status, err := s.putStream(resource, req.Body, dataMime)
+				if err != nil {
+					s.debug.Println("PUT streaming err: " + err.Error())
+					return r.respond(status, err)
+				}
+				w.Header().Set("Triples", fmt.Sprintf("%d", n))
+				err = s.writeTypeFile(resource.TypeFile, req.Header.Get(HCType))
+				if err != nil {
+					s.debug.Println("PUT writeTypeFile err: " + err.Error())
+				}
+				if err = s.updateMembership(membership, resource, members); err != nil {
+					s.debug.Println("PUT updateMembership err: " + err.Error())
+				}
+				w.Header().Set("Location", resource.URI)
+
+				onUpdateURI(resource.URI)
+				if isNew {
+					return r.respond(201)
+				}
+				return r.respond(200)
 			}
-			return r.respond(500, err)
 		}
-		defer f.Close()
 
-		if dataHasParser {
-			g := NewGraph(resource.URI)
-			g.Parse(req.Body, dataMime)
-			err = g.WriteFile(f, "text/turtle")
-			if err != nil {
-				s.debug.Println("PUT g.WriteFile err: " + err.Error())
+		// RDF is parsed and checked before the file is truncated
+		var g *Graph
+		if isStoredRDF(dataMime) {
+			g = NewGraph(resource.URI)
+			g.UsePrefixes(s.Config.Prefixes)
+			if err = g.parse(req.Body, dataMime, g.URI()); err != nil {
+				s.debug.Println("PUT parse err: " + err.Error())
+				return r.respond(400, "400 - "+err.Error())
+			}
+			if status, report := s.validateShapes(w, resource, g); status != 200 {
+				return r.respond(status, report)
 			}
-			w.Header().Set("Triples", fmt.Sprintf("%d", g.Len()))
 		}
-		_, err = io.Copy(f, req.Body)
-		if err != nil {
-			s.debug.Println("PUT io.Copy err: " + err.Error())
+
+		if stat != nil && stat.IsDir() {
+			w.Header().Add("Link", brack(resource.URI)+"; rel=\"describedby\"")
+			return r.respond(406, "406 - Cannot use PUT on a directory.")
+		}
+		if err = s.snapshot(resource); err != nil {
+			s.debug.Println("PUT snapshot err: " + err.Error())
+			return r.respond(500, err)
 		}
 
+		err = writeStorageAtomic(s.Storage, resource.File, 0644, func(f io.Writer) error {
+			if g != nil {
+				return g.WriteFile(f, "text/turtle")
+			}
+			_, err := io.Copy(f, req.Body)
+			return err
+		})
 		if err != nil {
+			s.debug.Println("PUT writeStorageAtomic err: " + err.Error())
 			return r.respond(500, err)
 		}
+		if g != nil {
+			w.Header().Set("Triples", fmt.Sprintf("%d", g.Len()))
+		}
+
+		err = s.writeTypeFile(resource.TypeFile, req.Header.Get(HCType))
+		if err != nil {
+			s.debug.Println("PUT writeTypeFile err: " + err.Error())
+		}
+		if err = s.updateMembership(membership, resource, members); err != nil {
+			s.debug.Println("PUT updateMembership err: " + err.Error())
+		}
 
 		w.Header().Set("Location", resource.URI)
 
@@ -1080,16 +1428,45 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		if len(resource.Path) == 0 {
 			return r.respond(500, "500 - Cannot DELETE /")
 		}
-		err = os.Remove(resource.File)
+		stat, err := s.Storage.Stat(resource.File)
 		if err != nil {
 			if os.IsNotExist(err) {
 				return r.respond(404, Skins["404"])
 			}
 			return r.respond(500, err)
 		}
-		_, err = os.Stat(resource.File)
-		if err == nil {
-			return r.respond(409, err)
+		// containers are only deleted with their contents when the client
+		// asks for it, and by those who control them
+		if stat.IsDir() {
+			empty, err := isEmptyContainer(s.Storage, resource.File)
+			if err != nil {
+				return r.respond(500, err)
+			}
+			if !empty && req.Header.Get("Depth") != "infinity" {
+				return r.respond(409, "409 - Conflict! The container is not empty; use Depth: infinity to delete it with its contents.")
+			}
+			if !empty {
+				aclControl, err := acl.AllowControl(resource.URI)
+				if aclControl > 200 || err != nil {
+					return r.respond(aclControl, handleStatusText(aclControl, err))
+				}
+			}
+		}
+		if err = s.snapshot(resource); err != nil {
+			s.debug.Println("DELETE snapshot err: " + err.Error())
+			return r.respond(500, err)
+		}
+		membership := s.membership(resource)
+		members := s.members(membership, resource)
+		if err = s.deleteResource(resource); err != nil {
+			s.debug.Println("DELETE deleteResource err: " + err.Error())
+			if os.IsNotExist(err) {
+				return r.respond(404, Skins["404"])
+			}
+			return r.respond(500, err)
+		}
+		if err = s.updateMembership(membership, resource, members); err != nil {
+			s.debug.Println("DELETE updateMembership err: " + err.Error())
 		}
 		onDeleteURI(resource.URI)
 		return
@@ -1103,7 +1480,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 			return r.respond(aclWrite, handleStatusText(aclWrite, err))
 		}
 
-		err = os.MkdirAll(resource.File, 0755)
+		err = s.Storage.MkdirAll(resource.File, 0755)
 		if err != nil {
 			switch err.(type) {
 			case *os.PathError:
@@ -1112,7 +1489,7 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 				return r.respond(500, err)
 			}
 		} else {
-			_, err := os.Stat(resource.File)
+			_, err := s.Storage.Stat(resource.File)
 			if err != nil {
 				return r.respond(409, err)
 			}
@@ -1120,12 +1497,15 @@ func (s *Server) handle(w http.ResponseWriter, req *httpRequest) (r *response) {
 		onUpdateURI(resource.URI)
 		return r.respond(201)
 
-	case "COPY", "MOVE", "LOCK", "UNLOCK":
+	case "COPY", "MOVE":
+		return s.handleCopyMove(w, req, acl, resource)
+
+	case "LOCK", "UNLOCK":
 		aclWrite, err := acl.AllowWrite(resource.URI)
 		if aclWrite > 200 || err != nil {
 			return r.respond(aclWrite, handleStatusText(aclWrite, err))
 		}
-		s.webdav.ServeHTTP(w, req.Request)
+		s.webdavHandler(resource, acl, false).ServeHTTP(w, req.Request)
 
 	default:
 		return r.respond(405, "405 - Method Not Allowed:", req.Method)
@@ -30,6 +30,15 @@ var (
 	tlsKey  = flag.String("tlsKeyFile", "", "TLS certificate eg. key.pem")
 	vhosts  = flag.Bool("vhosts", false, "run in virtual hosts mode?")
 
+	jsonldContext = flag.String("jsonldContext", "", "JSON-LD context file used to compact JSON-LD responses")
+	jsonldRemote  = flag.String("jsonldContexts", "", "space-separated remote JSON-LD contexts that clients may ask for")
+	inference     = flag.Bool("inference", false, "apply RDFS/OWL inference to ACL and group documents?")
+	streaming     = flag.Bool("streaming", false, "stream N-Triples and N-Quads instead of loading whole graphs?")
+	versioning    = flag.Bool("versioning", false, "keep past versions of resources, served as Mementos?")
+	trashAge      = flag.Int64("trashAge", 0, "keep deleted resources in a trash, restorable for this long (in hours)")
+	pageSize      = flag.Int("pageSize", 1000, "number of resources listed per page of a container (0 to list them all)")
+	boltDB        = flag.String("boltDB", "", "keep RDF resources as triples in this bolt database, instead of a file each")
+
 	tokenT = flag.Int64("tokenAge", 5, "recovery token lifetime (in minutes)")
 
 	emailName     = flag.String("emailName", "", "remote SMTP server account name")
@@ -102,6 +111,13 @@ func main() {
 		config.Vhosts = *vhosts
 		config.Insecure = *insecure
 		config.NoHTTP = *nohttp
+		config.JSONLDContext = *jsonldContext
+		config.JSONLDContexts = strings.Fields(*jsonldRemote)
+		config.Inference = *inference
+		config.Streaming = *streaming
+		config.Versioning = *versioning
+		config.PageSize = *pageSize
+		config.TrashAge = *trashAge
 		if len(*emailName) > 0 && len(*emailAddr) > 0 && len(*emailUser) > 0 &&
 			len(*emailPass) > 0 && len(*emailServ) > 0 && len(*emailPort) > 0 {
 			ep, _ := strconv.Atoi(*emailPort)
@@ -120,6 +136,14 @@ func main() {
 	_, httpsPort, _ = net.SplitHostPort(config.ListenHTTPS)
 
 	handler := gold.NewServer(config)
+	if len(*boltDB) > 0 {
+		st, err := gold.NewBoltStorage(*boltDB, gold.FileStorage{})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer st.Close()
+		handler.Storage = st
+	}
 
 	if os.Getenv("FCGI_ROLE") != "" {
 		err = fcgi.Serve(nil, handler)
@@ -52,6 +52,41 @@ type ServerConfig struct {
 	// SignUpSkin points to the skin/app used for creating new accounts
 	SignUpSkin string
 
+	// JSONLDContext points to a JSON-LD context file used to compact JSON-LD
+	// for clients that do not name a context of their own
+	JSONLDContext string
+
+	// JSONLDContexts lists the remote JSON-LD contexts that clients may name
+	// in the profile of an Accept header; no others are fetched
+	JSONLDContexts []string
+
+	// Prefixes maps well-known namespace prefixes, used to abbreviate Turtle
+	// output when the data does not declare prefixes of its own
+	Prefixes map[string]string
+
+	// Inference applies RDFS and OWL entailment to ACL and group documents,
+	// so that e.g. subclasses of foaf:Group are recognized as groups
+	Inference bool
+
+	// Streaming reads and writes N-Triples and N-Quads one statement at a
+	// time, instead of loading whole graphs, when PUT bodies and stored
+	// files allow it
+	Streaming bool
+
+	// Versioning keeps the state of a resource before every change and
+	// serves the past states as Memento versions
+	Versioning bool
+
+	// TrashAge keeps deleted resources in a trash of each account, from
+	// which they can be restored for this long (in hours); 0 deletes them
+	// right away
+	TrashAge int64
+
+	// PageSize is the number of contained resources listed on a page of a
+	// container; larger containers are paged (0 turns paging off, unless
+	// clients ask for it)
+	PageSize int
+
 	// DirIndex contains the default index file name
 	DirIndex []string
 
@@ -72,7 +107,9 @@ func NewServerConfig() *ServerConfig {
 		DirSkin:    "http://linkeddata.github.io/warp/#list/",
 		SignUpSkin: "http://linkeddata.github.io/signup/?tab=signup&endpointUrl=",
 		DiskLimit:  100000000, // 100MB
+		PageSize:   1000,
 		DataRoot:   serverDefaultRoot(),
+		Prefixes:   wellKnownPrefixes(),
 	}
 }
 
@@ -2,12 +2,14 @@ package gold
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -526,9 +528,9 @@ func TestLDPLinkHeaders(t *testing.T) {
 }
 
 func TestStreaming(t *testing.T) {
-	Streaming = true
+	handler.Config.Streaming = true
 	defer func() {
-		Streaming = false
+		handler.Config.Streaming = false
 	}()
 	testflight.WithServer(handler, func(r *testflight.Requester) {
 		request, _ := http.NewRequest("PUT", "/_test/abc", strings.NewReader("<a> <b> <c> ."))
@@ -540,6 +542,36 @@ func TestStreaming(t *testing.T) {
 		assert.Equal(t, 200, response.StatusCode)
 		assert.Equal(t, "@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .\n\n<a>\n    <b> <c> .\n\n", response.Body)
 
+		base := "http://" + r.Url("/_test/")
+		request, _ = http.NewRequest("PUT", "/_test/abc", strings.NewReader("<"+base+"s> <"+base+"p> \"1\" .\n"+
+			"<"+base+"s> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <"+base+"C> .\n"))
+		request.Header.Add("Content-Type", "application/n-triples")
+		response = r.Do(request)
+		assert.Equal(t, 201, response.StatusCode)
+		assert.Equal(t, "2", response.RawResponse.Header.Get("Triples"))
+
+		request, _ = http.NewRequest("GET", "/_test/abc", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .\n\n<s>\n    <p> \"1\" ;\n    a <C> .\n\n", response.Body)
+
+		response = r.Get("/_test/abc")
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "application/n-triples", response.RawResponse.Header.Get("Content-Type"))
+		assert.Equal(t, 2, strings.Count(response.Body, "\n"))
+
+		// a syntax error leaves the stored document alone
+		request, _ = http.NewRequest("PUT", "/_test/abc", strings.NewReader("<"+base+"s> <"+base+"p> \"2\" .\nnot a triple\n"))
+		request.Header.Add("Content-Type", "application/n-triples")
+		response = r.Do(request)
+		assert.Equal(t, 400, response.StatusCode)
+
+		request, _ = http.NewRequest("GET", "/_test/abc", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Contains(t, response.Body, `<p> "1"`)
+
 		request, _ = http.NewRequest("PUT", "/_test/abc", nil)
 		response = r.Do(request)
 		assert.Equal(t, 201, response.StatusCode)
@@ -585,10 +617,53 @@ func TestPOSTTurtle(t *testing.T) {
 	})
 }
 
+func TestMalformedRDF(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		response := r.Put("/_test/malformed", "text/turtle", "<a> <b> <c> .")
+		assert.Equal(t, 201, response.StatusCode)
+
+		response = r.Put("/_test/malformed", "text/turtle", "<a> <b> ")
+		assert.Equal(t, 400, response.StatusCode)
+		response = r.Post("/_test/malformed", "text/turtle", "<a> <b> <d")
+		assert.Equal(t, 400, response.StatusCode)
+		response = r.Post("/_test/malformed", rdfJSONPatchMime, `{"a":`)
+		assert.Equal(t, 400, response.StatusCode)
+
+		request, _ := http.NewRequest("GET", "/_test/malformed", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "1", response.RawResponse.Header.Get("Triples"))
+
+		assert.Equal(t, 200, r.Delete("/_test/malformed", "", "").StatusCode)
+	})
+}
+
+func TestPOSTJSON(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		request, _ := http.NewRequest("POST", "/_test/", strings.NewReader(`{"a":1}`))
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("Slug", "doc.json")
+		response := r.Do(request)
+		assert.Equal(t, 201, response.StatusCode)
+
+		response = r.Get("/_test/doc.json")
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, `{"a":1}`, response.Body)
+		assert.Equal(t, "application/json", response.RawResponse.Header.Get(HCType))
+
+		response = r.Post("/_test/doc.json", "application/json", `{"b":2}`)
+		assert.Equal(t, 415, response.StatusCode)
+		assert.Equal(t, `{"a":1}`, r.Get("/_test/doc.json").Body)
+
+		assert.Equal(t, 200, r.Delete("/_test/doc.json", "", "").StatusCode)
+	})
+}
+
 func TestPATCHJson(t *testing.T) {
 	testflight.WithServer(handler, func(r *testflight.Requester) {
 		request, _ := http.NewRequest("PATCH", "/_test/abc", strings.NewReader(`{"a":{"b":[{"type":"uri","value":"c"}]}}`))
-		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("Content-Type", rdfJSONPatchMime)
 		response := r.Do(request)
 		assert.Empty(t, response.Body)
 		assert.Equal(t, 200, response.StatusCode)
@@ -602,6 +677,62 @@ func TestPATCHJson(t *testing.T) {
 	})
 }
 
+func TestPATCHJSONDocument(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		response := r.Put("/_test/settings.json", "application/json", `{"theme":"dark","tags":["a","b"],"size":10}`)
+		assert.Equal(t, 201, response.StatusCode)
+
+		patch := func(path, ctype, body string) *testflight.Response {
+			request, _ := http.NewRequest("PATCH", path, strings.NewReader(body))
+			request.Header.Add("Content-Type", ctype)
+			return r.Do(request)
+		}
+		response = patch("/_test/settings.json", jsonPatchMime, `[
+			{"op": "test", "path": "/theme", "value": "dark"},
+			{"op": "replace", "path": "/theme", "value": "light"},
+			{"op": "add", "path": "/tags/-", "value": "c"},
+			{"op": "remove", "path": "/size"}
+		]`)
+		assert.Equal(t, 200, response.StatusCode)
+		response = r.Get("/_test/settings.json")
+		assert.Equal(t, "{\"tags\":[\"a\",\"b\",\"c\"],\"theme\":\"light\"}\n", response.Body)
+
+		// a failed test leaves the document untouched
+		response = patch("/_test/settings.json", jsonPatchMime, `[
+			{"op": "remove", "path": "/tags"},
+			{"op": "test", "path": "/theme", "value": "dark"}
+		]`)
+		assert.Equal(t, 409, response.StatusCode)
+		response = patch("/_test/settings.json", jsonPatchMime, `[{"op": "frobnicate", "path": "/tags"}]`)
+		assert.Equal(t, 422, response.StatusCode)
+		response = patch("/_test/settings.json", jsonPatchMime, `[{"op": "remove"`)
+		assert.Equal(t, 400, response.StatusCode)
+
+		response = patch("/_test/settings.json", mergePatchMime, `{"theme": null, "lang": "nb"}`)
+		assert.Equal(t, 200, response.StatusCode)
+		response = r.Get("/_test/settings.json")
+		assert.Equal(t, "{\"lang\":\"nb\",\"tags\":[\"a\",\"b\",\"c\"]}\n", response.Body)
+
+		response = patch("/_test/new.json", mergePatchMime, `{"a": 1}`)
+		assert.Equal(t, 201, response.StatusCode)
+		response = r.Get("/_test/new.json")
+		assert.Equal(t, "application/json", response.RawResponse.Header.Get(HCType))
+		assert.Equal(t, "{\"a\":1}\n", response.Body)
+
+		// RDF resources are not JSON documents, and plain JSON is ambiguous
+		response = r.Put("/_test/rdf", "text/turtle", "<a> <b> <c> .")
+		assert.Equal(t, 201, response.StatusCode)
+		response = patch("/_test/rdf", mergePatchMime, `{"a": 1}`)
+		assert.Equal(t, 415, response.StatusCode)
+		response = patch("/_test/settings.json", "application/json", `{"a": 1}`)
+		assert.Equal(t, 415, response.StatusCode)
+
+		for _, path := range []string{"/_test/settings.json", "/_test/new.json", "/_test/rdf"} {
+			assert.Equal(t, 200, r.Delete(path, "", "").StatusCode)
+		}
+	})
+}
+
 func TestPATCHSPARQL(t *testing.T) {
 	testflight.WithServer(handler, func(r *testflight.Requester) {
 		sparqlData := `INSERT DATA { <a> <b> <c> . } ; INSERT DATA { <a> <d> "123"^^<http://www.w3.org/2001/XMLSchema#int> . } ;
@@ -626,9 +757,76 @@ func TestPATCHFailParse(t *testing.T) {
 		request, _ := http.NewRequest("PATCH", "/_test/abc", strings.NewReader(sparqlData))
 		request.Header.Add("Content-Type", "application/sparql-update")
 		response := r.Do(request)
-		assert.Empty(t, response.Body)
+		assert.Equal(t, 400, response.StatusCode)
+		assert.Contains(t, response.Body, "unknown update operation")
+	})
+}
+
+func TestPATCHN3(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		response := r.Put("/_test/n3patch", "text/turtle", "<#a> <#name> \"A\" ; <#age> 1 .\n<#b> <#name> \"B\" .")
+		assert.Equal(t, 201, response.StatusCode)
+
+		patch := func(body string) *testflight.Response {
+			request, _ := http.NewRequest("PATCH", "/_test/n3patch", strings.NewReader(body))
+			request.Header.Add("Content-Type", "text/n3")
+			return r.Do(request)
+		}
+		response = patch(`@prefix solid: <http://www.w3.org/ns/solid/terms#> .
+_:p a solid:InsertDeletePatch ;
+    solid:where { ?s <#name> "A" ; <#age> ?age } ;
+    solid:deletes { ?s <#age> ?age } ;
+    solid:inserts { ?s <#age> 2 } .`)
 		assert.Equal(t, 200, response.StatusCode)
-		assert.Equal(t, "0", response.RawResponse.Header.Get("Triples"))
+		assert.Equal(t, "3", response.RawResponse.Header.Get("Triples"))
+
+		response = r.Get("/_test/n3patch")
+		assert.Contains(t, response.Body, `<#age> 2 `)
+
+		// two solutions
+		response = patch(`@prefix solid: <http://www.w3.org/ns/solid/terms#> .
+_:p a solid:InsertDeletePatch ; solid:where { ?s <#name> ?n } ; solid:inserts { ?s <#seen> true } .`)
+		assert.Equal(t, 409, response.StatusCode)
+
+		response = patch(`@prefix solid: <http://www.w3.org/ns/solid/terms#> .
+_:p a solid:InsertDeletePatch ; solid:deletes { <#b> <#age> 1 } .`)
+		assert.Equal(t, 409, response.StatusCode)
+
+		response = patch(`@prefix solid: <http://www.w3.org/ns/solid/terms#> .
+_:p a solid:InsertDeletePatch ; solid:inserts { ?s <#seen> true } .`)
+		assert.Equal(t, 422, response.StatusCode)
+
+		response = patch(`@prefix solid: <http://www.w3.org/ns/solid/terms#> .
+_:p a solid:InsertDeletePatch ; solid:inserts { <#b> <#seen> true `)
+		assert.Equal(t, 400, response.StatusCode)
+
+		response = r.Get("/_test/n3patch")
+		assert.NotContains(t, response.Body, "seen")
+		assert.Equal(t, 200, r.Delete("/_test/n3patch", "", "").StatusCode)
+	})
+}
+
+func TestPATCHN3AppendOnly(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll("/pod/", 0755)
+	writeStorageFile(s.Storage, "/pod/doc", []byte("<#a> <#secret> \"x\" ."), 0644)
+	writeStorageFile(s.Storage, "/pod/doc,acl", []byte(`@prefix acl: <http://www.w3.org/ns/auth/acl#> .
+<#append> acl:accessTo <doc> ; acl:agentClass <http://xmlns.com/foaf/0.1/Agent> ; acl:mode acl:Append .`), 0644)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		patch := func(body string) int {
+			request, _ := http.NewRequest("PATCH", "/doc", strings.NewReader(body))
+			request.Header.Add("Content-Type", "text/n3")
+			return r.Do(request).StatusCode
+		}
+		// whether a where clause matches would tell what the document holds
+		assert.Equal(t, 401, patch(`@prefix solid: <http://www.w3.org/ns/solid/terms#> .
+_:p a solid:InsertDeletePatch ; solid:where { <#a> <#secret> "x" } ; solid:inserts { <#a> <#seen> true } .`))
+		assert.Equal(t, 200, patch(`@prefix solid: <http://www.w3.org/ns/solid/terms#> .
+_:p a solid:InsertDeletePatch ; solid:inserts { <#a> <#seen> true } .`))
 	})
 }
 
@@ -838,6 +1036,155 @@ func TestGetJsonLd(t *testing.T) {
 	})
 }
 
+func TestGetJsonLdCompacted(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		d := "http://" + r.Url("/_test/d")
+		e := "http://" + r.Url("/_test/e")
+		f := "http://" + r.Url("/_test/f")
+
+		request, _ := http.NewRequest("GET", "/_test/abc", nil)
+		request.Header.Add("Accept", `application/ld+json; profile="http://www.w3.org/ns/json-ld#compacted"`)
+		response := r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, `application/ld+json; profile="http://www.w3.org/ns/json-ld#compacted"`, response.RawResponse.Header.Get(HCType))
+		var doc map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(response.Body), &doc))
+		assert.Equal(t, "http://xmlns.com/foaf/0.1/", doc["@context"].(map[string]interface{})["foaf"])
+		assert.Equal(t, d, doc["@id"])
+		assert.Equal(t, map[string]interface{}{"@id": f}, doc[e])
+
+		ctx := "http://" + r.Url("/_test/context.json")
+		response = r.Put("/_test/context.json", "application/json", `{"@context": {"e": {"@id": "`+e+`", "@type": "@id"}}}`)
+		assert.Equal(t, 201, response.StatusCode)
+
+		// only the contexts of the configuration are fetched
+		request, _ = http.NewRequest("GET", "/_test/abc", nil)
+		request.Header.Add("Accept", `application/ld+json;profile="`+ctx+`"`)
+		response = r.Do(request)
+		assert.Equal(t, 406, response.StatusCode)
+
+		missing := "http://" + r.Url("/_test/missing.json")
+		handler.Config.JSONLDContexts = []string{ctx, missing}
+		defer func() { handler.Config.JSONLDContexts = nil }()
+
+		request, _ = http.NewRequest("GET", "/_test/abc", nil)
+		request.Header.Add("Accept", `application/ld+json;profile="`+ctx+`"`)
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, fmt.Sprintf(`{"@context":"%s","@id":"%s","e":"%s"}`, ctx, d, f), response.Body)
+
+		request, _ = http.NewRequest("GET", "/_test/abc", nil)
+		request.Header.Add("Accept", `application/ld+json;profile="`+missing+`"`)
+		response = r.Do(request)
+		assert.Equal(t, 406, response.StatusCode)
+
+		assert.Equal(t, 200, r.Delete("/_test/context.json", "", "").StatusCode)
+	})
+}
+
+func TestGetContainerDataset(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		response := r.Put("/_test/dataset/a", "text/turtle", "<#x> <#p> \"A\" .")
+		assert.Equal(t, 201, response.StatusCode)
+		response = r.Put("/_test/dataset/b", "text/turtle", "<#x> <#p> \"B\" .")
+		assert.Equal(t, 201, response.StatusCode)
+
+		for _, mime := range []string{"application/n-quads", "application/trig"} {
+			request, _ := http.NewRequest("GET", "/_test/dataset/", nil)
+			request.Header.Add("Accept", mime)
+			response = r.Do(request)
+			assert.Equal(t, 200, response.StatusCode)
+			assert.Equal(t, mime, response.RawResponse.Header.Get(HCType))
+
+			base := "http://" + r.Url("/_test/dataset/")
+			ds := NewDataset(base)
+			assert.NoError(t, ds.Parse(strings.NewReader(response.Body), mime))
+			assert.Equal(t, 2, len(ds.Names()))
+			assert.NotNil(t, ds.Default().One(NewResource(base), NewResource("http://www.w3.org/ns/ldp#contains"), NewResource(base+"a")))
+			assert.NotNil(t, ds.Graph(NewResource(base+"a")).One(NewResource(base+"a#x"), NewResource(base+"a#p"), NewLiteral("A")))
+			assert.NotNil(t, ds.Graph(NewResource(base+"b")).One(NewResource(base+"b#x"), NewResource(base+"b#p"), NewLiteral("B")))
+			assert.Nil(t, ds.Graph(NewResource(base+"a")).One(NewResource(base+"b#x"), nil, nil))
+		}
+
+		assert.Equal(t, 200, r.Delete("/_test/dataset/a", "", "").StatusCode)
+		assert.Equal(t, 200, r.Delete("/_test/dataset/b", "", "").StatusCode)
+		assert.Equal(t, 200, r.Delete("/_test/dataset/", "", "").StatusCode)
+	})
+}
+
+func TestGetEntailed(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		response := r.Put("/_test/inferred", "text/turtle", `<#Team> <http://www.w3.org/2000/01/rdf-schema#subClassOf> <http://xmlns.com/foaf/0.1/Group> .
+<#t> a <#Team> .`)
+		assert.Equal(t, 201, response.StatusCode)
+
+		request, _ := http.NewRequest("GET", "/_test/inferred", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "2", response.RawResponse.Header.Get("Triples"))
+
+		request, _ = http.NewRequest("GET", "/_test/inferred", nil)
+		request.Header.Add("Accept", "text/turtle")
+		request.Header.Add("Prefer", `return=representation; include="http://www.w3.org/ns/entailment/RDFS"`)
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "3", response.RawResponse.Header.Get("Triples"))
+		assert.Equal(t, "return=representation", response.RawResponse.Header.Get("Preference-Applied"))
+		g := NewGraph("http://" + r.Url("/_test/inferred"))
+		g.Parse(strings.NewReader(response.Body), "text/turtle")
+		assert.NotNil(t, g.One(NewResource(g.URI()+"#t"), ns.rdf.Get("type"), ns.foaf.Get("Group")))
+
+		assert.Equal(t, 200, r.Delete("/_test/inferred", "", "").StatusCode)
+	})
+}
+
+func TestSHACLConstrainedContainer(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		response := r.Put("/_test/shapes.ttl", "text/turtle", shaclTestShapes)
+		assert.Equal(t, 201, response.StatusCode)
+		response = r.Put("/_test/people/"+METASuffix, "text/turtle", "<> <http://www.w3.org/ns/ldp#constrainedBy> </_test/shapes.ttl> .")
+		assert.Equal(t, 201, response.StatusCode)
+
+		alice := "@prefix foaf: <http://xmlns.com/foaf/0.1/> . <#me> a foaf:Person ; foaf:name \"Alice\" ."
+		response = r.Put("/_test/people/alice", "text/turtle", alice)
+		assert.Equal(t, 201, response.StatusCode)
+
+		response = r.Put("/_test/people/bob", "text/turtle", "@prefix foaf: <http://xmlns.com/foaf/0.1/> . <#me> a foaf:Person .")
+		assert.Equal(t, 422, response.StatusCode)
+		assert.Equal(t, "text/turtle", response.RawResponse.Header.Get(HCType))
+		assert.Contains(t, strings.Join(response.RawResponse.Header["Link"], ", "), "rel=\"http://www.w3.org/ns/ldp#constrainedBy\"")
+		report := NewGraph("http://" + r.Url("/_test/people/bob"))
+		report.Parse(strings.NewReader(response.Body), "text/turtle")
+		assert.NotNil(t, report.One(nil, ns.sh.Get("conforms"), NewLiteralWithDatatype("false", NewResource(xsdBoolean))))
+		assert.NotNil(t, report.One(nil, ns.sh.Get("focusNode"), NewResource(report.URI()+"#me")))
+		assert.Equal(t, 404, r.Get("/_test/people/bob").StatusCode)
+
+		response = r.Post("/_test/people/alice", "text/turtle", "<#me> <http://xmlns.com/foaf/0.1/name> \"Alicia\" .")
+		assert.Equal(t, 422, response.StatusCode)
+
+		request, _ := http.NewRequest("PATCH", "/_test/people/alice", strings.NewReader("INSERT DATA { <#me> <http://xmlns.com/foaf/0.1/age> 42 . }"))
+		request.Header.Add("Content-Type", "application/sparql-update")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+
+		request, _ = http.NewRequest("PATCH", "/_test/people/alice", strings.NewReader("INSERT DATA { <#me> <http://xmlns.com/foaf/0.1/age> -1 . }"))
+		request.Header.Add("Content-Type", "application/sparql-update")
+		response = r.Do(request)
+		assert.Equal(t, 422, response.StatusCode)
+
+		request, _ = http.NewRequest("GET", "/_test/people/alice", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, "3", response.RawResponse.Header.Get("Triples"))
+
+		assert.Equal(t, 200, r.Delete("/_test/people/alice", "", "").StatusCode)
+		assert.Equal(t, 200, r.Delete("/_test/people/"+METASuffix, "", "").StatusCode)
+		assert.Equal(t, 200, r.Delete("/_test/people/", "", "").StatusCode)
+		assert.Equal(t, 200, r.Delete("/_test/shapes.ttl", "", "").StatusCode)
+	})
+}
+
 func TestPOSTForm(t *testing.T) {
 	testflight.WithServer(handler, func(r *testflight.Requester) {
 		request, _ := http.NewRequest("POST", "/_test/abc", nil)
@@ -1026,6 +1373,120 @@ func TestRawContent(t *testing.T) {
 	})
 }
 
+func TestDeclaredContentType(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		response := r.Put("/_test/declared", "application/ld+json", `{"@id": "http://a/s", "http://a/p": "o"}`)
+		assert.Equal(t, 201, response.StatusCode)
+		_, err := os.Stat("_test/declared" + TYPESuffix)
+		assert.NoError(t, err)
+
+		response = r.Get("/_test/declared")
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "application/ld+json", response.RawResponse.Header.Get(HCType))
+
+		request, _ := http.NewRequest("GET", "/_test/declared", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "text/turtle", response.RawResponse.Header.Get(HCType))
+
+		response = r.Put("/_test/notes", "text/x-notes", "@prefix is not Turtle here")
+		assert.Equal(t, 201, response.StatusCode)
+		request, _ = http.NewRequest("HEAD", "/_test/notes", nil)
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "text/x-notes", response.RawResponse.Header.Get(HCType))
+
+		request, _ = http.NewRequest("MOVE", "/_test/notes", nil)
+		request.Header.Add("Destination", "http://"+r.Url("/_test/notes2"))
+		response = r.Do(request)
+		assert.Equal(t, 201, response.StatusCode)
+		_, err = os.Stat("_test/notes" + TYPESuffix)
+		assert.True(t, os.IsNotExist(err))
+		response = r.Get("/_test/notes2")
+		assert.Equal(t, "text/x-notes", response.RawResponse.Header.Get(HCType))
+		assert.Equal(t, "@prefix is not Turtle here", response.Body)
+
+		// type sidecars are neither listed nor served, and only kept when
+		// the type cannot be detected
+		assert.Equal(t, 403, r.Get("/_test/notes2"+TYPESuffix).StatusCode)
+		request, _ = http.NewRequest("GET", "/_test/", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, response.Body, "notes2")
+		assert.NotContains(t, response.Body, TYPESuffix)
+		response = r.Put("/_test/plain.ttl", "text/turtle", "<#a> <#b> <#c> .")
+		assert.Equal(t, 201, response.StatusCode)
+		_, err = os.Stat("_test/plain.ttl" + TYPESuffix)
+		assert.True(t, os.IsNotExist(err))
+		assert.Equal(t, 200, r.Delete("/_test/plain.ttl", "", "").StatusCode)
+
+		assert.Equal(t, 200, r.Delete("/_test/declared", "", "").StatusCode)
+		assert.Equal(t, 200, r.Delete("/_test/notes2", "", "").StatusCode)
+		_, err = os.Stat("_test/declared" + TYPESuffix)
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat("_test/notes2" + TYPESuffix)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestSPARQLQueryEndpoint(t *testing.T) {
+	testflight.WithServer(handler, func(r *testflight.Requester) {
+		response := r.Put("/_test/sparql/a", "text/turtle", "<#a> <http://example.org/name> \"A\" .")
+		assert.Equal(t, 201, response.StatusCode)
+		response = r.Put("/_test/sparql/sub/b", "text/turtle", "<#b> <http://example.org/name> \"B\" .")
+		assert.Equal(t, 201, response.StatusCode)
+		response = r.Put("/_test/sparql/secret", "text/turtle", "<#c> <http://example.org/name> \"C\" .")
+		assert.Equal(t, 201, response.StatusCode)
+		response = r.Put("/_test/sparql/notes.txt", "text/plain", "<#d> <http://example.org/name> \"D\" .")
+		assert.Equal(t, 201, response.StatusCode)
+		response = r.Put("/_test/sparql/secret"+ACLSuffix, "text/turtle", `@prefix acl: <http://www.w3.org/ns/auth/acl#> .
+<#owner> acl:accessTo <secret>, <secret,acl> ; acl:agent <https://example.org/owner#me> ;
+    acl:mode acl:Read, acl:Write, acl:Control .`)
+		assert.Equal(t, 201, response.StatusCode)
+
+		query := "SELECT ?name WHERE { ?s <http://example.org/name> ?name } ORDER BY ?name"
+		response = r.Get("/_test/sparql/?query=" + url.QueryEscape(query))
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "application/sparql-results+json", response.RawResponse.Header.Get(HCType))
+		assert.Contains(t, response.Body, `"vars":["name"]`)
+		assert.Contains(t, response.Body, `{"name":{"type":"literal","value":"A"}},{"name":{"type":"literal","value":"B"}}]`)
+		assert.NotContains(t, response.Body, `"C"`)
+		assert.NotContains(t, response.Body, `"D"`)
+		assert.Empty(t, response.RawResponse.Header.Get("WWW-Authenticate"))
+
+		request, _ := http.NewRequest("GET", "/_test/sparql/sub/,sparql?query="+url.QueryEscape(query), nil)
+		request.Header.Add("Accept", "text/csv")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "name\r\nB\r\n", response.Body)
+
+		request, _ = http.NewRequest("POST", "/_test/sparql/", strings.NewReader("ASK { ?s ?p \"A\" }"))
+		request.Header.Add("Content-Type", "application/sparql-query")
+		request.Header.Add("Accept", "application/sparql-results+xml")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, response.Body, "<boolean>true</boolean>")
+
+		response = r.Post("/_test/sparql/a", "application/x-www-form-urlencoded",
+			"query="+url.QueryEscape("CONSTRUCT { ?s <http://example.org/label> ?n } WHERE { ?s ?p ?n }"))
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, "text/turtle", response.RawResponse.Header.Get(HCType))
+		g := NewGraph("http://" + r.Url("/_test/sparql/a"))
+		g.Parse(strings.NewReader(response.Body), "text/turtle")
+		assert.Equal(t, 1, g.Len())
+		assert.NotNil(t, g.One(nil, NewResource("http://example.org/label"), NewLiteral("A")))
+
+		response = r.Get("/_test/sparql/?query=" + url.QueryEscape("SELECT ?s WHERE { ?s ?p }"))
+		assert.Equal(t, 400, response.StatusCode)
+		response = r.Get("/_test/sparql/,sparql")
+		assert.Equal(t, 400, response.StatusCode)
+
+		os.RemoveAll("_test/sparql")
+	})
+}
+
 func BenchmarkPUT(b *testing.B) {
 	e := 0
 	testflight.WithServer(handler, func(r *testflight.Requester) {
@@ -1063,7 +1524,7 @@ func BenchmarkPATCH(b *testing.B) {
 	testflight.WithServer(handler, func(r *testflight.Requester) {
 		for i := 0; i < b.N; i++ {
 			request, _ := http.NewRequest("PATCH", "/_bench/test", strings.NewReader(`{"a":{"b":[{"type":"literal","value":"`+fmt.Sprintf("%d", b.N)+`"}]}}`))
-			request.Header.Add("Content-Type", "application/json")
+			request.Header.Add("Content-Type", rdfJSONPatchMime)
 			if r := r.Do(request); r.StatusCode != 200 {
 				e++
 			}
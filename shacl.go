@@ -0,0 +1,536 @@
+package gold
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// shaclMaxDepth bounds the nesting of sh:node, sh:not, sh:and, sh:or and
+// sh:xone, so that shapes referring to themselves cannot loop
+const shaclMaxDepth = 32
+
+// shaclValidator checks a data graph against the shapes of a shapes graph.
+// It implements the SHACL Core targets and constraint components, except
+// for the property pair components and paths other than predicates,
+// inverse paths and sequences.
+type shaclValidator struct {
+	shapes *Graph
+	data   *Graph
+	// report collects the validation results; it is nil while checking
+	// whether a value conforms to a nested shape
+	report  *Graph
+	results int
+	depth   int
+}
+
+// ValidateSHACL validates data against the shapes graph. It reports
+// whether the data conforms, along with the SHACL validation report.
+func ValidateSHACL(shapes *Graph, data *Graph) (bool, *Graph) {
+	v := &shaclValidator{shapes: shapes, data: data, report: NewGraph(data.URI())}
+	report := NewAnonNode()
+	v.report.AddTriple(report, ns.rdf.Get("type"), ns.sh.Get("ValidationReport"))
+	for _, shape := range v.shapeNodes() {
+		for _, focus := range v.targets(shape) {
+			v.validate(shape, focus, report)
+		}
+	}
+	conforms := v.results == 0
+	v.report.AddTriple(report, ns.sh.Get("conforms"), NewLiteralWithDatatype(strconv.FormatBool(conforms), NewResource(xsdBoolean)))
+	return conforms, v.report
+}
+
+// shapeNodes returns the shapes that have targets, in a stable order
+func (v *shaclValidator) shapeNodes() []Term {
+	shapes := map[string]Term{}
+	for _, p := range []string{"targetClass", "targetNode", "targetSubjectsOf", "targetObjectsOf"} {
+		for _, triple := range v.shapes.All(nil, ns.sh.Get(p), nil) {
+			shapes[termKey(triple.Subject)] = triple.Subject
+		}
+	}
+	// shapes that are also classes target their own instances
+	for _, class := range []Term{ns.rdfs.Get("Class"), ns.owl.Get("Class")} {
+		for _, triple := range v.shapes.All(nil, ns.rdf.Get("type"), class) {
+			if v.isShape(triple.Subject) {
+				shapes[termKey(triple.Subject)] = triple.Subject
+			}
+		}
+	}
+	var nodes []Term
+	for _, key := range sortedKeys(shapes) {
+		if v.shapes.One(shapes[key], ns.sh.Get("deactivated"), NewLiteralWithDatatype("true", NewResource(xsdBoolean))) == nil {
+			nodes = append(nodes, shapes[key])
+		}
+	}
+	return nodes
+}
+
+func (v *shaclValidator) isShape(t Term) bool {
+	return v.shapes.One(t, ns.rdf.Get("type"), ns.sh.Get("NodeShape")) != nil ||
+		v.shapes.One(t, ns.rdf.Get("type"), ns.sh.Get("PropertyShape")) != nil
+}
+
+// targets returns the focus nodes of a shape in the data graph
+func (v *shaclValidator) targets(shape Term) []Term {
+	focus := map[string]Term{}
+	add := func(t Term) { focus[termKey(t)] = t }
+	for _, t := range v.values(shape, "targetNode") {
+		add(t)
+	}
+	classes := v.values(shape, "targetClass")
+	if v.shapes.One(shape, ns.rdf.Get("type"), ns.rdfs.Get("Class")) != nil ||
+		v.shapes.One(shape, ns.rdf.Get("type"), ns.owl.Get("Class")) != nil {
+		classes = append(classes, shape)
+	}
+	for _, class := range classes {
+		for _, triple := range v.data.All(nil, ns.rdf.Get("type"), nil) {
+			if v.instanceOf(triple.Subject, class) {
+				add(triple.Subject)
+			}
+		}
+	}
+	for _, p := range v.values(shape, "targetSubjectsOf") {
+		for _, triple := range v.data.All(nil, p, nil) {
+			add(triple.Subject)
+		}
+	}
+	for _, p := range v.values(shape, "targetObjectsOf") {
+		for _, triple := range v.data.All(nil, p, nil) {
+			add(triple.Object)
+		}
+	}
+	nodes := make([]Term, 0, len(focus))
+	for _, key := range sortedKeys(focus) {
+		nodes = append(nodes, focus[key])
+	}
+	return nodes
+}
+
+// values returns the objects of a SHACL property of a shape
+func (v *shaclValidator) values(shape Term, name string) []Term {
+	var terms []Term
+	for _, triple := range v.shapes.All(shape, ns.sh.Get(name), nil) {
+		terms = append(terms, triple.Object)
+	}
+	return terms
+}
+
+// list returns the members of an RDF collection in the shapes graph
+func (v *shaclValidator) list(head Term) []Term {
+	var items []Term
+	for i := 0; head != nil && !head.Equal(ns.rdf.Get("nil")) && i < 10000; i++ {
+		first := v.shapes.One(head, ns.rdf.Get("first"), nil)
+		if first == nil {
+			break
+		}
+		items = append(items, first.Object)
+		rest := v.shapes.One(head, ns.rdf.Get("rest"), nil)
+		if rest == nil {
+			break
+		}
+		head = rest.Object
+	}
+	return items
+}
+
+// instanceOf reports whether a node is an instance of a class, following
+// rdfs:subClassOf in the data graph
+func (v *shaclValidator) instanceOf(node Term, class Term) bool {
+	seen := map[string]bool{}
+	var sub func(c Term) bool
+	sub = func(c Term) bool {
+		if c.Equal(class) {
+			return true
+		}
+		if seen[termKey(c)] {
+			return false
+		}
+		seen[termKey(c)] = true
+		for _, triple := range v.data.All(c, ns.rdfs.Get("subClassOf"), nil) {
+			if sub(triple.Object) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, triple := range v.data.All(node, ns.rdf.Get("type"), nil) {
+		if sub(triple.Object) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathValues returns the value nodes reached from focus through a path
+func (v *shaclValidator) pathValues(focus Term, path Term) []Term {
+	if _, ok := path.(*Resource); ok {
+		var values []Term
+		for _, triple := range v.data.All(focus, path, nil) {
+			values = append(values, triple.Object)
+		}
+		return values
+	}
+	if inverse := v.shapes.One(path, ns.sh.Get("inversePath"), nil); inverse != nil {
+		var values []Term
+		for _, triple := range v.data.All(nil, inverse.Object, focus) {
+			values = append(values, triple.Subject)
+		}
+		return values
+	}
+	if steps := v.list(path); len(steps) > 0 {
+		nodes := map[string]Term{termKey(focus): focus}
+		for _, step := range steps {
+			next := map[string]Term{}
+			for _, node := range nodes {
+				for _, value := range v.pathValues(node, step) {
+					next[termKey(value)] = value
+				}
+			}
+			nodes = next
+		}
+		var values []Term
+		for _, key := range sortedKeys(nodes) {
+			values = append(values, nodes[key])
+		}
+		return values
+	}
+	return nil
+}
+
+// validate checks one focus node against a shape, adding a result to the
+// report for every violation, and reports whether the node conforms
+func (v *shaclValidator) validate(shape Term, focus Term, report Term) bool {
+	before := v.results
+	var path Term
+	values := []Term{focus}
+	if p := v.shapes.One(shape, ns.sh.Get("path"), nil); p != nil {
+		path = p.Object
+		values = v.pathValues(focus, path)
+	}
+	fail := func(component string, value Term, message string) {
+		v.results++
+		if v.report != nil {
+			v.addResult(report, shape, focus, path, component, value, message)
+		}
+	}
+
+	for _, param := range v.values(shape, "minCount") {
+		if n, err := strconv.Atoi(termValue(param)); err == nil && len(values) < n {
+			fail("MinCountConstraintComponent", nil, fmt.Sprintf("Less than %d values", n))
+		}
+	}
+	for _, param := range v.values(shape, "maxCount") {
+		if n, err := strconv.Atoi(termValue(param)); err == nil && len(values) > n {
+			fail("MaxCountConstraintComponent", nil, fmt.Sprintf("More than %d values", n))
+		}
+	}
+	for _, param := range v.values(shape, "hasValue") {
+		found := false
+		for _, value := range values {
+			found = found || value.Equal(param)
+		}
+		if !found {
+			fail("HasValueConstraintComponent", nil, "Missing expected value "+param.String())
+		}
+	}
+
+	for _, value := range values {
+		for _, class := range v.values(shape, "class") {
+			if !v.instanceOf(value, class) {
+				fail("ClassConstraintComponent", value, "Value is not an instance of "+class.String())
+			}
+		}
+		for _, datatype := range v.values(shape, "datatype") {
+			if !hasDatatype(value, datatype) {
+				fail("DatatypeConstraintComponent", value, "Value does not have datatype "+datatype.String())
+			}
+		}
+		for _, kind := range v.values(shape, "nodeKind") {
+			if !hasNodeKind(value, kind) {
+				fail("NodeKindConstraintComponent", value, "Value is not of node kind "+kind.String())
+			}
+		}
+		for _, param := range v.values(shape, "minLength") {
+			n, err := strconv.Atoi(termValue(param))
+			if _, bnode := value.(*BlankNode); err == nil && (bnode || utf8.RuneCountInString(termValue(value)) < n) {
+				fail("MinLengthConstraintComponent", value, fmt.Sprintf("Value has less than %d characters", n))
+			}
+		}
+		for _, param := range v.values(shape, "maxLength") {
+			n, err := strconv.Atoi(termValue(param))
+			if _, bnode := value.(*BlankNode); err == nil && (bnode || utf8.RuneCountInString(termValue(value)) > n) {
+				fail("MaxLengthConstraintComponent", value, fmt.Sprintf("Value has more than %d characters", n))
+			}
+		}
+		for _, param := range v.values(shape, "pattern") {
+			re, err := v.pattern(shape, termValue(param))
+			if _, bnode := value.(*BlankNode); err == nil && (bnode || !re.MatchString(termValue(value))) {
+				fail("PatternConstraintComponent", value, "Value does not match pattern \""+termValue(param)+"\"")
+			}
+		}
+		for _, param := range v.values(shape, "in") {
+			found := false
+			for _, item := range v.list(param) {
+				found = found || value.Equal(item)
+			}
+			if !found {
+				fail("InConstraintComponent", value, "Value is not in the list of allowed values")
+			}
+		}
+		for _, c := range []struct {
+			name      string
+			component string
+			ok        func(int) bool
+		}{
+			{"minInclusive", "MinInclusiveConstraintComponent", func(c int) bool { return c >= 0 }},
+			{"maxInclusive", "MaxInclusiveConstraintComponent", func(c int) bool { return c <= 0 }},
+			{"minExclusive", "MinExclusiveConstraintComponent", func(c int) bool { return c > 0 }},
+			{"maxExclusive", "MaxExclusiveConstraintComponent", func(c int) bool { return c < 0 }},
+		} {
+			for _, param := range v.values(shape, c.name) {
+				if cmp, ok := CompareLiterals(value, param); !ok || !c.ok(cmp) {
+					fail(c.component, value, "Value is not "+c.name+" "+termValue(param))
+				}
+			}
+		}
+		for _, node := range v.values(shape, "node") {
+			if !v.conforms(node, value) {
+				fail("NodeConstraintComponent", value, "Value does not conform to shape "+node.String())
+			}
+		}
+		for _, not := range v.values(shape, "not") {
+			if v.conforms(not, value) {
+				fail("NotConstraintComponent", value, "Value conforms to shape "+not.String())
+			}
+		}
+		for _, param := range v.values(shape, "and") {
+			for _, member := range v.list(param) {
+				if !v.conforms(member, value) {
+					fail("AndConstraintComponent", value, "Value does not conform to all shapes")
+					break
+				}
+			}
+		}
+		for _, param := range v.values(shape, "or") {
+			found := false
+			for _, member := range v.list(param) {
+				if v.conforms(member, value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fail("OrConstraintComponent", value, "Value does not conform to any shape")
+			}
+		}
+		for _, param := range v.values(shape, "xone") {
+			n := 0
+			for _, member := range v.list(param) {
+				if v.conforms(member, value) {
+					n++
+				}
+			}
+			if n != 1 {
+				fail("XoneConstraintComponent", value, "Value does not conform to exactly one shape")
+			}
+		}
+		for _, property := range v.values(shape, "property") {
+			v.validate(property, value, report)
+		}
+	}
+
+	if closed := v.shapes.One(shape, ns.sh.Get("closed"), nil); closed != nil && termValue(closed.Object) == "true" {
+		allowed := map[string]bool{}
+		for _, property := range v.values(shape, "property") {
+			if p := v.shapes.One(property, ns.sh.Get("path"), nil); p != nil {
+				allowed[termKey(p.Object)] = true
+			}
+		}
+		for _, param := range v.values(shape, "ignoredProperties") {
+			for _, p := range v.list(param) {
+				allowed[termKey(p)] = true
+			}
+		}
+		for _, value := range values {
+			for _, triple := range v.data.All(value, nil, nil) {
+				if !allowed[termKey(triple.Predicate)] {
+					v.results++
+					if v.report != nil {
+						v.addResult(report, shape, value, triple.Predicate, "ClosedConstraintComponent", triple.Object, "Predicate "+triple.Predicate.String()+" is not allowed")
+					}
+				}
+			}
+		}
+	}
+	return v.results == before
+}
+
+// conforms checks a value against a nested shape without reporting
+func (v *shaclValidator) conforms(shape Term, value Term) bool {
+	if v.depth >= shaclMaxDepth {
+		return true
+	}
+	report, results := v.report, v.results
+	v.report = nil
+	v.depth++
+	ok := v.validate(shape, value, nil)
+	v.depth--
+	v.report, v.results = report, results
+	return ok
+}
+
+func (v *shaclValidator) pattern(shape Term, pattern string) (*regexp.Regexp, error) {
+	if flags := v.shapes.One(shape, ns.sh.Get("flags"), nil); flags != nil {
+		// Go only knows some of the XPath flags
+		f := strings.Map(func(r rune) rune {
+			if strings.ContainsRune("ism", r) {
+				return r
+			}
+			return -1
+		}, termValue(flags.Object))
+		if len(f) > 0 {
+			pattern = "(?" + f + ")" + pattern
+		}
+	}
+	return regexp.Compile(pattern)
+}
+
+func (v *shaclValidator) addResult(report Term, shape Term, focus Term, path Term, component string, value Term, message string) {
+	result := NewAnonNode()
+	v.report.AddTriple(report, ns.sh.Get("result"), result)
+	v.report.AddTriple(result, ns.rdf.Get("type"), ns.sh.Get("ValidationResult"))
+	v.report.AddTriple(result, ns.sh.Get("focusNode"), focus)
+	if _, ok := path.(*Resource); ok {
+		v.report.AddTriple(result, ns.sh.Get("resultPath"), path)
+	} else if path != nil {
+		// copy the inverse path into the report; sequences are left out
+		if inverse := v.shapes.One(path, ns.sh.Get("inversePath"), nil); inverse != nil {
+			p := NewAnonNode()
+			v.report.AddTriple(result, ns.sh.Get("resultPath"), p)
+			v.report.AddTriple(p, ns.sh.Get("inversePath"), inverse.Object)
+		}
+	}
+	if value != nil {
+		v.report.AddTriple(result, ns.sh.Get("value"), value)
+	}
+	v.report.AddTriple(result, ns.sh.Get("sourceShape"), shape)
+	v.report.AddTriple(result, ns.sh.Get("sourceConstraintComponent"), ns.sh.Get(component))
+	severity := ns.sh.Get("Violation")
+	if s := v.shapes.One(shape, ns.sh.Get("severity"), nil); s != nil {
+		severity = s.Object
+	}
+	v.report.AddTriple(result, ns.sh.Get("resultSeverity"), severity)
+	messages := v.values(shape, "message")
+	if len(messages) == 0 {
+		messages = []Term{NewLiteral(message)}
+	}
+	for _, m := range messages {
+		v.report.AddTriple(result, ns.sh.Get("resultMessage"), m)
+	}
+}
+
+// hasDatatype reports whether a value is a literal of the given datatype;
+// plain literals are xsd:string and tagged ones rdf:langString
+func hasDatatype(value Term, datatype Term) bool {
+	l, ok := value.(*Literal)
+	if !ok {
+		return false
+	}
+	switch {
+	case len(l.Language) > 0:
+		return datatype.Equal(ns.rdf.Get("langString"))
+	case l.Datatype == nil:
+		return datatype.Equal(ns.xsd.Get("string"))
+	}
+	return datatype.Equal(l.Datatype)
+}
+
+func hasNodeKind(value Term, kind Term) bool {
+	var k string
+	switch value.(type) {
+	case *Resource:
+		k = "IRI"
+	case *BlankNode:
+		k = "BlankNode"
+	case *Literal:
+		k = "Literal"
+	}
+	name := strings.TrimPrefix(termValue(kind), string(ns.sh))
+	return name == k || strings.HasPrefix(name, k+"Or") || strings.HasSuffix(name, "Or"+k)
+}
+
+// containerShapes loads the shapes that the container of a resource is
+// ldp:constrainedBy, as stated in the container's meta file. It returns
+// the URIs of the shapes documents along with their union.
+func (s *Server) containerShapes(resource *pathInfo) ([]string, *Graph, error) {
+	if strings.HasSuffix(resource.File, ACLSuffix) || strings.HasSuffix(resource.File, METASuffix) {
+		return nil, nil, nil
+	}
+	dir := resource.URI[:strings.LastIndex(strings.TrimSuffix(resource.URI, "/"), "/")+1]
+	container, err := s.pathInfo(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta := NewGraph(container.MetaURI)
+	meta.readStorage(s.Storage, container.MetaFile)
+	var uris []string
+	for _, subject := range []string{container.URI, container.MetaURI} {
+		for _, triple := range meta.All(NewResource(subject), ns.ldp.Get("constrainedBy"), nil) {
+			if r, ok := triple.Object.(*Resource); ok {
+				uris = append(uris, r.URI)
+			}
+		}
+	}
+	if len(uris) == 0 {
+		return nil, nil, nil
+	}
+
+	shapes := NewGraph(container.URI)
+	for _, uri := range uris {
+		g := NewGraph(uri)
+		p, err := s.pathInfo(uri)
+		if err == nil && p.Base == resource.Base && p.Exists {
+			g.readStorage(s.Storage, p.File)
+		} else if err = g.LoadURI(uri); err != nil {
+			return nil, nil, err
+		}
+		if g.Len() == 0 {
+			return nil, nil, errors.New("no shapes found in " + uri)
+		}
+		for triple := range g.IterTriples() {
+			shapes.Add(triple)
+		}
+	}
+	return uris, shapes, nil
+}
+
+// validateShapes checks an RDF write against the shapes of its container.
+// It returns 200 when the graph conforms, and otherwise the status to answer
+// with along with the body, the validation report in Turtle.
+func (s *Server) validateShapes(w http.ResponseWriter, resource *pathInfo, g *Graph) (int, string) {
+	uris, shapes, err := s.containerShapes(resource)
+	if err != nil {
+		s.debug.Println("Cannot load the shapes for " + resource.URI + ": " + err.Error())
+		return 500, "500 - Cannot load the shapes the container is constrained by"
+	}
+	if shapes == nil {
+		return 200, ""
+	}
+	conforms, report := ValidateSHACL(shapes, g)
+	if conforms {
+		return 200, ""
+	}
+	data, err := report.Serialize("text/turtle")
+	if err != nil {
+		return 500, err.Error()
+	}
+	for _, uri := range uris {
+		w.Header().Add("Link", brack(uri)+"; rel=\""+string(ns.ldp)+"constrainedBy\"")
+	}
+	w.Header().Set(HCType, "text/turtle")
+	return 422, data
+}
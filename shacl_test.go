@@ -0,0 +1,108 @@
+package gold
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const shaclTestShapes = `@prefix sh: <http://www.w3.org/ns/shacl#> .
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+@prefix foaf: <http://xmlns.com/foaf/0.1/> .
+<#Person> a sh:NodeShape ;
+    sh:targetClass foaf:Person ;
+    sh:property [
+        sh:path foaf:name ;
+        sh:minCount 1 ;
+        sh:maxCount 1 ;
+        sh:datatype xsd:string ;
+        sh:minLength 2
+    ] , [
+        sh:path foaf:age ;
+        sh:datatype xsd:integer ;
+        sh:minInclusive 0 ;
+        sh:maxExclusive 150
+    ] , [
+        sh:path foaf:knows ;
+        sh:class foaf:Person ;
+        sh:nodeKind sh:IRI
+    ] , [
+        sh:path foaf:gender ;
+        sh:in ( "female" "male" "other" )
+    ] , [
+        sh:path foaf:mbox ;
+        sh:pattern "^mailto:" ;
+        sh:flags "i"
+    ] .
+`
+
+func TestValidateSHACL(t *testing.T) {
+	shapes := parseTestGraph(shaclTestShapes)
+
+	data := parseTestGraph(`@prefix foaf: <http://xmlns.com/foaf/0.1/> .
+<#alice> a foaf:Person ; foaf:name "Alice" ; foaf:age 30 ; foaf:knows <#bob> ; foaf:gender "female" ; foaf:mbox <MAILTO:alice@example.org> .
+<#bob> a foaf:Person ; foaf:name "Bob" .
+<#rex> foaf:name "R" .
+`)
+	conforms, report := ValidateSHACL(shapes, data)
+	assert.True(t, conforms)
+	assert.Equal(t, 2, report.Len())
+
+	data = parseTestGraph(`@prefix foaf: <http://xmlns.com/foaf/0.1/> .
+<#alice> a foaf:Person ; foaf:name "A" ; foaf:age 200 ; foaf:knows <#rex> ; foaf:gender "robot" .
+<#bob> a foaf:Person ; foaf:name "Bob", "Robert" ; foaf:age "old" ; foaf:mbox <http://bob.example.org/> .
+<#carol> a foaf:Person .
+`)
+	conforms, report = ValidateSHACL(shapes, data)
+	assert.False(t, conforms)
+	components := map[string]int{}
+	for _, triple := range report.All(nil, ns.sh.Get("sourceConstraintComponent"), nil) {
+		components[strings.TrimPrefix(termValue(triple.Object), string(ns.sh))]++
+	}
+	assert.Equal(t, map[string]int{
+		"MinLengthConstraintComponent":    1,
+		"MaxExclusiveConstraintComponent": 2,
+		"ClassConstraintComponent":        1,
+		"InConstraintComponent":           1,
+		"MaxCountConstraintComponent":     1,
+		"DatatypeConstraintComponent":     1,
+		"MinInclusiveConstraintComponent": 1,
+		"PatternConstraintComponent":      1,
+		"MinCountConstraintComponent":     1,
+	}, components)
+	result := report.One(nil, ns.sh.Get("sourceConstraintComponent"), ns.sh.Get("MinCountConstraintComponent")).Subject
+	assert.NotNil(t, report.One(result, ns.sh.Get("focusNode"), NewResource("https://test.org/doc#carol")))
+	assert.NotNil(t, report.One(result, ns.sh.Get("resultPath"), ns.foaf.Get("name")))
+	assert.NotNil(t, report.One(result, ns.sh.Get("resultSeverity"), ns.sh.Get("Violation")))
+	assert.NotNil(t, report.One(nil, ns.sh.Get("conforms"), NewLiteralWithDatatype("false", NewResource(xsdBoolean))))
+}
+
+func TestValidateSHACLLogical(t *testing.T) {
+	shapes := parseTestGraph(`@prefix sh: <http://www.w3.org/ns/shacl#> .
+@prefix ex: <http://example.org/> .
+<#Named> sh:property [ sh:path ex:name ; sh:minCount 1 ] .
+<#Doc> a sh:NodeShape ;
+    sh:targetSubjectsOf ex:title ;
+    sh:closed true ;
+    sh:ignoredProperties ( ex:title ) ;
+    sh:property [ sh:path ex:author ; sh:node <#Named> ] , [ sh:path [ sh:inversePath ex:cites ] ; sh:maxCount 1 ] ;
+    sh:or ( [ sh:nodeKind sh:IRI ] [ sh:hasValue ex:anonymous ] ) .
+`)
+	conforms, _ := ValidateSHACL(shapes, parseTestGraph(`@prefix ex: <http://example.org/> .
+<#d> ex:title "T" ; ex:author <#a> .
+<#a> ex:name "A" .
+<#e> ex:cites <#d> .
+`))
+	assert.True(t, conforms)
+
+	conforms, report := ValidateSHACL(shapes, parseTestGraph(`@prefix ex: <http://example.org/> .
+<#d> ex:title "T" ; ex:author <#a> ; ex:extra 1 .
+<#e> ex:cites <#d> . <#f> ex:cites <#d> .
+[] ex:title "U" .
+`))
+	assert.False(t, conforms)
+	for _, c := range []string{"NodeConstraintComponent", "ClosedConstraintComponent", "MaxCountConstraintComponent", "OrConstraintComponent"} {
+		assert.NotNil(t, report.One(nil, ns.sh.Get("sourceConstraintComponent"), ns.sh.Get(c)), c)
+	}
+}
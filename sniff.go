@@ -0,0 +1,167 @@
+package gold
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sniffLen is the number of leading bytes read when sniffing file contents
+const sniffLen = 1024
+
+// TypeDetector guesses the media type of a stored file
+type TypeDetector interface {
+	TypeByFile(path string) (string, error)
+}
+
+// TypeDetectorFunc adapts an ordinary function to the TypeDetector interface
+type TypeDetectorFunc func(path string) (string, error)
+
+// TypeByFile calls f(path)
+func (f TypeDetectorFunc) TypeByFile(path string) (string, error) {
+	return f(path)
+}
+
+// chainDetector asks each detector in turn and returns the first type found
+type chainDetector []TypeDetector
+
+// NewTypeDetector returns a TypeDetector that tries each of the given
+// detectors in order, returning the first non-empty media type
+func NewTypeDetector(detectors ...TypeDetector) TypeDetector {
+	return chainDetector(detectors)
+}
+
+func (c chainDetector) TypeByFile(path string) (string, error) {
+	for _, d := range c {
+		ctype, err := d.TypeByFile(path)
+		if err != nil {
+			return "", err
+		}
+		if len(ctype) > 0 {
+			return ctype, nil
+		}
+	}
+	return "", nil
+}
+
+// DefaultTypeDetector looks up the file extension in mimeTypes first, then
+// falls back to sniffing the contents of the file
+var DefaultTypeDetector = NewTypeDetector(
+	TypeDetectorFunc(typeByExtension),
+	TypeDetectorFunc(typeByContent),
+)
+
+func typeByExtension(path string) (string, error) {
+	if ctype, known := mimeTypes[filepath.Ext(path)]; known {
+		return ctype, nil
+	}
+	return "", nil
+}
+
+func typeByContent(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return typeOfFile(f)
+}
+
+// typeOfFile sniffs the contents of an open file
+func typeOfFile(f File) (string, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if stat.IsDir() {
+		return "inode/directory", nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return sniffType(buf[:n]), nil
+}
+
+// sniffType returns the media type of data, without parameters. Binary
+// formats are recognised by their magic bytes (see http.DetectContentType);
+// text is then checked for the RDF syntaxes the server can parse
+func sniffType(data []byte) string {
+	if len(data) == 0 {
+		return "inode/x-empty"
+	}
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	switch detected {
+	case "text/plain":
+		if rdf := sniffRDF(data); len(rdf) > 0 {
+			return rdf
+		}
+	case "text/xml":
+		if bytes.Contains(data, []byte("http://www.w3.org/1999/02/22-rdf-syntax-ns#")) &&
+			bytes.Contains(data, []byte(":RDF")) {
+			return "application/rdf+xml"
+		}
+	}
+	return detected
+}
+
+var (
+	ntriplesLine = regexp.MustCompile(`^(<[a-zA-Z][\w+.-]*:[^<>"{}|^` + "`" + `\\\s]*>|_:\S+)\s*<[a-zA-Z][\w+.-]*:[^<>\s]*>\s*(<[^<>\s]*>|_:\S+|".*"(@[a-zA-Z-]+|\^\^<[^<>\s]*>)?)\s*\.\s*(#.*)?$`)
+	turtleStart  = regexp.MustCompile(`^(?i:@prefix|@base|prefix\s|base\s)|^(<[^<>"{}|^` + "`" + `\\\s]*>|_:[\w-]+|\[\s*(\]|<|[\w-]*:|a\s))`)
+	jsonLDKey    = regexp.MustCompile(`"@(context|id|graph|type)"\s*:`)
+)
+
+// sniffRDF looks at the start of a text document and returns the RDF media
+// type it appears to be written in, or an empty string
+func sniffRDF(data []byte) string {
+	lines := bytes.Split(data, []byte("\n"))
+	// the last line is usually cut short by the sniffing window
+	if len(data) == sniffLen && len(lines) > 1 {
+		lines = lines[:len(lines)-1]
+	}
+
+	var first []byte
+	ntriples := true
+	for _, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if first == nil {
+			first = line
+		}
+		if !ntriplesLine.Match(line) {
+			ntriples = false
+		}
+	}
+	switch {
+	case first == nil:
+		return ""
+	case (first[0] == '{' || first[0] == '[') && jsonLDKey.Match(data):
+		return "application/ld+json"
+	case first[0] == '{':
+		return ""
+	case ntriples:
+		return "application/n-triples"
+	case turtleStart.Match(first):
+		return "text/turtle"
+	}
+	return ""
+}
+
+// isStoredRDF reports whether a file of type ctype is read back as RDF; the
+// server stores all RDF it receives as Turtle, so any parsable type counts
+func isStoredRDF(ctype string) bool {
+	switch mimeParser[strings.TrimSpace(strings.Split(ctype, ";")[0])] {
+	case "", "internal":
+		return false
+	}
+	return true
+}
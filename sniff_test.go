@@ -0,0 +1,65 @@
+package gold
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffType(t *testing.T) {
+	for data, expected := range map[string]string{
+		"":                            "inode/x-empty",
+		"hello world":                 "text/plain",
+		"<html><body></body></html>":  "text/html",
+		"\x89PNG\x0D\x0A\x1A\x0A\x00": "image/png",
+		"@prefix foaf: <http://xmlns.com/foaf/0.1/> .\n<#me> a foaf:Person .\n": "text/turtle",
+		"# comment\nPREFIX ex: <http://example.org/>\n":                         "text/turtle",
+		"<d> <e> <f> .":                                      "text/turtle",
+		"[ a <#T> ] <http://a/p> 1 .":                        "text/turtle",
+		"<http://a/s> <http://a/p> \"o\"@en .\n":             "application/n-triples",
+		"_:b0 <http://a/p> <http://a/o> . # comment\n":       "application/n-triples",
+		`{"@context": {}, "@id": "http://a/s"}`:              "application/ld+json",
+		`[{"@id": "http://a/s"}]`:                            "application/ld+json",
+		"# gold\n[![Build](https://a/b.svg)](https://a/c)\n": "text/plain",
+		`{"a": 1}`:                               "text/plain",
+		"<?xml version=\"1.0\"?>\n<note></note>": "text/xml",
+		"<?xml version=\"1.0\"?>\n<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\"/>": "application/rdf+xml",
+	} {
+		assert.Equal(t, expected, sniffType([]byte(data)), data)
+	}
+}
+
+func TestTypeDetector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gold-sniff")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	css := filepath.Join(dir, "style.css")
+	ttl := filepath.Join(dir, "card")
+	assert.NoError(t, ioutil.WriteFile(css, []byte("@prefix body {}"), 0644))
+	assert.NoError(t, ioutil.WriteFile(ttl, []byte("<#me> a <#Person> ."), 0644))
+
+	ctype, err := DefaultTypeDetector.TypeByFile(css)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/css; charset=utf-8", ctype)
+
+	ctype, err = DefaultTypeDetector.TypeByFile(ttl)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/turtle", ctype)
+
+	ctype, err = DefaultTypeDetector.TypeByFile(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "inode/directory", ctype)
+
+	custom := NewTypeDetector(TypeDetectorFunc(func(path string) (string, error) {
+		return "", nil
+	}), TypeDetectorFunc(func(path string) (string, error) {
+		return "application/x-custom", nil
+	}))
+	ctype, err = custom.TypeByFile(ttl)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/x-custom", ctype)
+}
@@ -0,0 +1,514 @@
+package gold
+
+import (
+	"strings"
+)
+
+// Variable is a SPARQL query variable.
+type Variable struct {
+	Name string
+}
+
+// NewVariable returns a new variable with the given name.
+func NewVariable(name string) (term Term) {
+	return Term(&Variable{Name: name})
+}
+
+// String returns the SPARQL representation of the variable.
+func (term Variable) String() (str string) {
+	return "?" + term.Name
+}
+
+// Equal returns whether this variable is equal to another.
+func (term Variable) Equal(other Term) bool {
+	if spec, ok := other.(*Variable); ok {
+		return term.Name == spec.Name
+	}
+
+	return false
+}
+
+// binding maps variable names to the terms they are bound to in a solution
+type binding map[string]Term
+
+// resolve returns the term bound to t if it is a variable, nil if that
+// variable is unbound, or t itself otherwise
+func (b binding) resolve(t Term) Term {
+	if v, ok := t.(*Variable); ok {
+		return b[v.Name]
+	}
+	return t
+}
+
+// extend returns a copy of b with the variables of pattern bound to the
+// terms of t, or false if t contradicts a binding made earlier
+func (b binding) extend(pattern *Triple, t *Triple) (binding, bool) {
+	next := make(binding, len(b)+3)
+	for k, v := range b {
+		next[k] = v
+	}
+	for _, pair := range [3][2]Term{
+		{pattern.Subject, t.Subject},
+		{pattern.Predicate, t.Predicate},
+		{pattern.Object, t.Object},
+	} {
+		v, ok := pair[0].(*Variable)
+		if !ok {
+			continue
+		}
+		if bound, ok := next[v.Name]; ok {
+			if !bound.Equal(pair[1]) {
+				return nil, false
+			}
+			continue
+		}
+		next[v.Name] = pair[1]
+	}
+	return next, true
+}
+
+// instantiate fills in a template triple using the solution b. Blank nodes
+// in the template are replaced by the fresh nodes in bnodes, which is
+// extended as needed. It returns nil if a variable is unbound or the result
+// is not a valid RDF triple.
+func (b binding) instantiate(pattern *Triple, bnodes map[string]Term) *Triple {
+	var terms [3]Term
+	for i, t := range [3]Term{pattern.Subject, pattern.Predicate, pattern.Object} {
+		if bn, ok := t.(*BlankNode); ok && bnodes != nil {
+			if _, ok := bnodes[bn.ID]; !ok {
+				bnodes[bn.ID] = NewAnonNode()
+			}
+			t = bnodes[bn.ID]
+		}
+		if terms[i] = b.resolve(t); terms[i] == nil {
+			return nil
+		}
+	}
+	if _, ok := terms[0].(*Literal); ok {
+		return nil
+	}
+	if _, ok := terms[1].(*Resource); !ok {
+		return nil
+	}
+	return NewTriple(terms[0], terms[1], terms[2])
+}
+
+// solve extends each of the given solutions with the matches of a basic
+// graph pattern in the graph
+func (g *Graph) solve(solutions []binding, patterns []*Triple) []binding {
+	remaining := append([]*Triple(nil), patterns...)
+	for len(remaining) > 0 && len(solutions) > 0 {
+		// match the most selective pattern next
+		i := mostBound(remaining, solutions[0])
+		pattern := remaining[i]
+		remaining = append(remaining[:i], remaining[i+1:]...)
+
+		var next []binding
+		for _, b := range solutions {
+			s, p, o := b.resolve(pattern.Subject), b.resolve(pattern.Predicate), b.resolve(pattern.Object)
+			g.triples.match(s, p, o, func(t *Triple) bool {
+				if nb, ok := b.extend(pattern, t); ok {
+					next = append(next, nb)
+				}
+				return true
+			})
+		}
+		solutions = next
+	}
+	return solutions
+}
+
+// mostBound returns the index of the pattern with the most positions that
+// are constant or already bound in b
+func mostBound(patterns []*Triple, b binding) int {
+	best, bestScore := 0, -1
+	for i, pattern := range patterns {
+		score := 0
+		for _, t := range [3]Term{pattern.Subject, pattern.Predicate, pattern.Object} {
+			if b.resolve(t) != nil {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// sparqlParser reads SPARQL syntax, reusing the Turtle parser for terms and
+// triple patterns
+type sparqlParser struct {
+	*turtleParser
+	triples []*Triple
+}
+
+func newSPARQLParser(src string, base string) *sparqlParser {
+	p := &sparqlParser{turtleParser: newTurtleParser(src, base, nil)}
+	p.syntax = "sparql"
+	p.vars = true
+	p.emit = func(s, pr, o Term) {
+		p.triples = append(p.triples, NewTriple(s, pr, o))
+	}
+	return p
+}
+
+// keyword consumes the case-insensitive keyword kw if it comes next
+func (p *sparqlParser) keyword(kw string) bool {
+	p.skipWS()
+	if p.hasKeyword(kw) {
+		p.pos += len(kw)
+		return true
+	}
+	return false
+}
+
+func (p *sparqlParser) prologue() error {
+	for {
+		switch {
+		case p.keyword("PREFIX"):
+			if err := p.prefixID(); err != nil {
+				return err
+			}
+		case p.keyword("BASE"):
+			if err := p.baseDecl(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// graphIRI reads a graph name, which must be the document being queried as
+// named graphs are not supported
+func (p *sparqlParser) graphIRI() error {
+	p.skipWS()
+	t, err := p.iri()
+	if err != nil {
+		return err
+	}
+	if p.base == nil || t.(*Resource).URI != p.base.String() {
+		return p.errorf("named graphs are not supported: %s", t)
+	}
+	return nil
+}
+
+// block parses a '{' ... '}' template of triple patterns, returning the
+// triples and the raw text between the braces
+func (p *sparqlParser) block() ([]*Triple, string, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, "", err
+	}
+	start, first := p.pos, len(p.triples)
+	for {
+		p.skipWS()
+		switch c := p.peek(); {
+		case c == 0:
+			return nil, "", p.errorf("expected '}', found end of input")
+		case c == '}':
+			body := p.src[start:p.pos]
+			p.pos++
+			return append([]*Triple(nil), p.triples[first:]...), body, nil
+		case c == '.':
+			p.pos++
+			continue
+		case p.keyword("GRAPH"):
+			if err := p.graphIRI(); err != nil {
+				return nil, "", err
+			}
+			if _, _, err := p.block(); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		if err := p.turtleParser.triples(); err != nil {
+			return nil, "", err
+		}
+		p.skipWS()
+		if c := p.peek(); c != '.' && c != '}' {
+			return nil, "", p.errorf("expected '.' or '}', found '%c'", c)
+		}
+	}
+}
+
+// sparqlGroup is a group graph pattern. Its elements are joined in order,
+// and its filters apply to the solutions of the whole group.
+type sparqlGroup struct {
+	elements []sparqlElement
+	filters  []*sparqlExpr
+}
+
+// sparqlElement is one part of a group graph pattern, which extends or
+// restricts the solutions found so far
+type sparqlElement interface {
+	eval(g *Graph, in []binding) []binding
+}
+
+func (grp *sparqlGroup) eval(g *Graph, in []binding) []binding {
+	solutions := in
+	for _, e := range grp.elements {
+		solutions = e.eval(g, solutions)
+	}
+	if len(grp.filters) == 0 {
+		return solutions
+	}
+	var out []binding
+	for _, b := range solutions {
+		keep := true
+		for _, f := range grp.filters {
+			if v, ok := ebv(f.eval(b)); !ok || !v {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// bgpPattern is a basic graph pattern
+type bgpPattern []*Triple
+
+func (bgp bgpPattern) eval(g *Graph, in []binding) []binding {
+	return g.solve(in, bgp)
+}
+
+type optionalPattern struct {
+	group *sparqlGroup
+}
+
+func (opt optionalPattern) eval(g *Graph, in []binding) []binding {
+	var out []binding
+	for _, b := range in {
+		if r := opt.group.eval(g, []binding{b}); len(r) > 0 {
+			out = append(out, r...)
+		} else {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+type unionPattern []*sparqlGroup
+
+func (union unionPattern) eval(g *Graph, in []binding) []binding {
+	var out []binding
+	for _, grp := range union {
+		out = append(out, grp.eval(g, in)...)
+	}
+	return out
+}
+
+type minusPattern struct {
+	group *sparqlGroup
+}
+
+func (minus minusPattern) eval(g *Graph, in []binding) []binding {
+	right := minus.group.eval(g, []binding{{}})
+	var out []binding
+	for _, b := range in {
+		removed := false
+		for _, r := range right {
+			if compatible(b, r) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// compatible reports whether two solutions share a variable and agree on
+// every variable they share
+func compatible(a, b binding) bool {
+	shared := false
+	for k, v := range a {
+		if w, ok := b[k]; ok {
+			if !v.Equal(w) {
+				return false
+			}
+			shared = true
+		}
+	}
+	return shared
+}
+
+type bindPattern struct {
+	expr *sparqlExpr
+	name string
+}
+
+func (bind bindPattern) eval(g *Graph, in []binding) []binding {
+	out := make([]binding, 0, len(in))
+	for _, b := range in {
+		v := bind.expr.eval(b)
+		if v == nil {
+			out = append(out, b)
+			continue
+		}
+		nb := make(binding, len(b)+1)
+		for k, t := range b {
+			nb[k] = t
+		}
+		nb[bind.name] = v
+		out = append(out, nb)
+	}
+	return out
+}
+
+// group parses a group graph pattern. Blank nodes become variables, as they
+// only match existing nodes.
+func (p *sparqlParser) group() (*sparqlGroup, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	grp := &sparqlGroup{}
+	for {
+		p.skipWS()
+		switch c := p.peek(); {
+		case c == 0:
+			return nil, p.errorf("expected '}', found end of input")
+		case c == '}':
+			p.pos++
+			return grp, nil
+		case c == '.':
+			p.pos++
+		case c == '{':
+			sub, err := p.group()
+			if err != nil {
+				return nil, err
+			}
+			union := unionPattern{sub}
+			for p.keyword("UNION") {
+				if sub, err = p.group(); err != nil {
+					return nil, err
+				}
+				union = append(union, sub)
+			}
+			if len(union) == 1 {
+				grp.elements = append(grp.elements, sub)
+			} else {
+				grp.elements = append(grp.elements, union)
+			}
+		case p.keyword("OPTIONAL"):
+			sub, err := p.group()
+			if err != nil {
+				return nil, err
+			}
+			grp.elements = append(grp.elements, optionalPattern{sub})
+		case p.keyword("MINUS"):
+			sub, err := p.group()
+			if err != nil {
+				return nil, err
+			}
+			grp.elements = append(grp.elements, minusPattern{sub})
+		case p.keyword("GRAPH"):
+			if err := p.graphIRI(); err != nil {
+				return nil, err
+			}
+			sub, err := p.group()
+			if err != nil {
+				return nil, err
+			}
+			grp.elements = append(grp.elements, sub)
+		case p.keyword("FILTER"):
+			expr, err := p.constraint()
+			if err != nil {
+				return nil, err
+			}
+			grp.filters = append(grp.filters, expr)
+		case p.keyword("BIND"):
+			if err := p.expect('('); err != nil {
+				return nil, err
+			}
+			expr, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			name, err := p.as()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(')'); err != nil {
+				return nil, err
+			}
+			grp.elements = append(grp.elements, bindPattern{expr, name})
+		case p.hasKeyword("VALUES"), p.hasKeyword("SERVICE"):
+			return nil, p.errorf("%s is not supported", sparqlKeywordPrefix(p.src[p.pos:]))
+		default:
+			first := len(p.triples)
+			if err := p.turtleParser.triples(); err != nil {
+				return nil, err
+			}
+			bgp := make(bgpPattern, 0, len(p.triples)-first)
+			for _, t := range p.triples[first:] {
+				bgp = append(bgp, NewTriple(bnodeVar(t.Subject), bnodeVar(t.Predicate), bnodeVar(t.Object)))
+			}
+			if n := len(grp.elements); n > 0 {
+				if prev, ok := grp.elements[n-1].(bgpPattern); ok {
+					grp.elements[n-1] = append(prev, bgp...)
+					continue
+				}
+			}
+			grp.elements = append(grp.elements, bgp)
+		}
+	}
+}
+
+// as reads "AS ?var" and returns the variable name
+func (p *sparqlParser) as() (string, error) {
+	if !p.keyword("AS") {
+		return "", p.errorf("expected AS")
+	}
+	p.skipWS()
+	if c := p.peek(); c != '?' && c != '$' {
+		return "", p.errorf("expected a variable")
+	}
+	v, err := p.variable()
+	if err != nil {
+		return "", err
+	}
+	return v.(*Variable).Name, nil
+}
+
+func bnodeVar(t Term) Term {
+	if bn, ok := t.(*BlankNode); ok {
+		return NewVariable("_:" + bn.ID)
+	}
+	return t
+}
+
+// checkTerms returns an error if the triples contain a variable or a blank
+// node where they are not allowed
+func (p *sparqlParser) checkTerms(triples []*Triple, where string, vars, bnodes bool) error {
+	for _, t := range triples {
+		for _, term := range [3]Term{t.Subject, t.Predicate, t.Object} {
+			switch term.(type) {
+			case *Variable:
+				if !vars {
+					return p.errorf("variables are not allowed in %s", where)
+				}
+			case *BlankNode:
+				if !bnodes {
+					return p.errorf("blank nodes are not allowed in %s", where)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sparqlKeywordPrefix returns the first word of s in upper case
+func sparqlKeywordPrefix(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t\r\n{<"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.ToUpper(s)
+}
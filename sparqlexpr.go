@@ -0,0 +1,669 @@
+package gold
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	xsdString     = "http://www.w3.org/2001/XMLSchema#string"
+	xsdFloat      = "http://www.w3.org/2001/XMLSchema#float"
+	rdfLangString = "http://www.w3.org/1999/02/22-rdf-syntax-ns#langString"
+)
+
+// xsdIntegers are the datatypes derived from xsd:integer
+var xsdIntegers = map[string]bool{
+	xsdInteger:                                            true,
+	"http://www.w3.org/2001/XMLSchema#int":                true,
+	"http://www.w3.org/2001/XMLSchema#long":               true,
+	"http://www.w3.org/2001/XMLSchema#short":              true,
+	"http://www.w3.org/2001/XMLSchema#byte":               true,
+	"http://www.w3.org/2001/XMLSchema#nonNegativeInteger": true,
+	"http://www.w3.org/2001/XMLSchema#nonPositiveInteger": true,
+	"http://www.w3.org/2001/XMLSchema#positiveInteger":    true,
+	"http://www.w3.org/2001/XMLSchema#negativeInteger":    true,
+	"http://www.w3.org/2001/XMLSchema#unsignedInt":        true,
+	"http://www.w3.org/2001/XMLSchema#unsignedLong":       true,
+	"http://www.w3.org/2001/XMLSchema#unsignedShort":      true,
+	"http://www.w3.org/2001/XMLSchema#unsignedByte":       true,
+}
+
+// sparqlBuiltins maps the supported built-in functions to the number of
+// arguments they take, or -1 if it varies
+var sparqlBuiltins = map[string]int{
+	"BOUND":       1,
+	"ISIRI":       1,
+	"ISURI":       1,
+	"ISBLANK":     1,
+	"ISLITERAL":   1,
+	"ISNUMERIC":   1,
+	"STR":         1,
+	"LANG":        1,
+	"DATATYPE":    1,
+	"STRLEN":      1,
+	"LCASE":       1,
+	"UCASE":       1,
+	"LANGMATCHES": 2,
+	"CONTAINS":    2,
+	"STRSTARTS":   2,
+	"STRENDS":     2,
+	"SAMETERM":    2,
+	"REGEX":       -1,
+	"CONCAT":      -1,
+	"COALESCE":    -1,
+	"IF":          3,
+}
+
+// sparqlExpr is a node of a FILTER, BIND or SELECT expression. Leaves have an
+// empty op and hold a constant or a variable in term.
+type sparqlExpr struct {
+	op   string
+	term Term
+	args []*sparqlExpr
+}
+
+// constraint parses the expression that follows FILTER
+func (p *sparqlParser) constraint() (*sparqlExpr, error) {
+	p.skipWS()
+	if p.peek() == '(' {
+		return p.bracketted()
+	}
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if len(expr.op) == 0 {
+		return nil, p.errorf("expected a bracketted expression or a function call")
+	}
+	return expr, nil
+}
+
+func (p *sparqlParser) bracketted() (*sparqlExpr, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return expr, p.expect(')')
+}
+
+func (p *sparqlParser) expression() (*sparqlExpr, error) {
+	left, err := p.andExpression()
+	if err != nil {
+		return nil, err
+	}
+	for p.operator("||") {
+		right, err := p.andExpression()
+		if err != nil {
+			return nil, err
+		}
+		left = &sparqlExpr{op: "||", args: []*sparqlExpr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *sparqlParser) andExpression() (*sparqlExpr, error) {
+	left, err := p.relational()
+	if err != nil {
+		return nil, err
+	}
+	for p.operator("&&") {
+		right, err := p.relational()
+		if err != nil {
+			return nil, err
+		}
+		left = &sparqlExpr{op: "&&", args: []*sparqlExpr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *sparqlParser) relational() (*sparqlExpr, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "!=", "<=", ">=", "<", ">"} {
+		if p.operator(op) {
+			right, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			return &sparqlExpr{op: op, args: []*sparqlExpr{left, right}}, nil
+		}
+	}
+	op := "IN"
+	if p.keyword("NOT") {
+		op = "NOT IN"
+		if !p.hasKeyword("IN") {
+			return nil, p.errorf("expected IN")
+		}
+	}
+	if p.keyword("IN") {
+		args, err := p.argList()
+		if err != nil {
+			return nil, err
+		}
+		return &sparqlExpr{op: op, args: append([]*sparqlExpr{left}, args...)}, nil
+	}
+	return left, nil
+}
+
+func (p *sparqlParser) additive() (*sparqlExpr, error) {
+	left, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		switch {
+		case p.operator("+"):
+			op = "+"
+		case p.operator("-"):
+			op = "-"
+		default:
+			return left, nil
+		}
+		right, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &sparqlExpr{op: op, args: []*sparqlExpr{left, right}}
+	}
+}
+
+func (p *sparqlParser) multiplicative() (*sparqlExpr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		switch {
+		case p.operator("*"):
+			op = "*"
+		case p.operator("/"):
+			op = "/"
+		default:
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &sparqlExpr{op: op, args: []*sparqlExpr{left, right}}
+	}
+}
+
+func (p *sparqlParser) unary() (*sparqlExpr, error) {
+	p.skipWS()
+	op := ""
+	switch {
+	case p.hasPrefix("!") && !p.hasPrefix("!="):
+		op = "!"
+	case p.peek() == '-' && !p.numberFollows():
+		op = "neg"
+	case p.peek() == '+' && !p.numberFollows():
+		op = "pos"
+	default:
+		return p.primary()
+	}
+	p.pos++
+	arg, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &sparqlExpr{op: op, args: []*sparqlExpr{arg}}, nil
+}
+
+// numberFollows reports whether the sign at the current position starts a
+// numeric literal
+func (p *sparqlParser) numberFollows() bool {
+	return p.pos+1 < len(p.src) && (isDigit(p.src[p.pos+1]) || p.src[p.pos+1] == '.')
+}
+
+func (p *sparqlParser) primary() (*sparqlExpr, error) {
+	p.skipWS()
+	switch c := p.peek(); {
+	case c == '(':
+		return p.bracketted()
+	case c == '?' || c == '$':
+		v, err := p.variable()
+		if err != nil {
+			return nil, err
+		}
+		return &sparqlExpr{term: v}, nil
+	case c == '"' || c == '\'':
+		t, err := p.rdfLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return &sparqlExpr{term: t}, nil
+	case c == '+' || c == '-' || c == '.' || isDigit(c):
+		t, err := p.numericLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return &sparqlExpr{term: t}, nil
+	case p.hasKeyword("true"), p.hasKeyword("false"):
+		return &sparqlExpr{term: p.mustObject()}, nil
+	case p.hasKeyword("EXISTS"), p.hasKeyword("NOT"):
+		return nil, p.errorf("EXISTS is not supported")
+	}
+
+	// built-in calls are keywords followed by an argument list
+	start := p.pos
+	for !p.eof() && (isAlnum(p.peek()) || p.peek() == '_') {
+		p.pos++
+	}
+	name := strings.ToUpper(p.src[start:p.pos])
+	if arity, ok := sparqlBuiltins[name]; ok && p.peek() != ':' {
+		args, err := p.argList()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case arity >= 0 && len(args) != arity:
+			return nil, p.errorf("%s expects %d arguments", name, arity)
+		case name == "REGEX" && (len(args) < 2 || len(args) > 3):
+			return nil, p.errorf("REGEX expects 2 or 3 arguments")
+		case name == "BOUND":
+			if _, ok := args[0].term.(*Variable); !ok || len(args[0].op) > 0 {
+				return nil, p.errorf("BOUND expects a variable")
+			}
+		}
+		return &sparqlExpr{op: name, args: args}, nil
+	}
+	p.pos = start
+	t, err := p.iri()
+	if err != nil {
+		return nil, err
+	}
+	p.skipWS()
+	if p.peek() == '(' {
+		return nil, p.errorf("function %s is not supported", t)
+	}
+	return &sparqlExpr{term: t}, nil
+}
+
+// mustObject parses a term that is known to be well formed
+func (p *sparqlParser) mustObject() Term {
+	t, _ := p.object()
+	return t
+}
+
+// argList parses a bracketted, comma separated list of expressions
+func (p *sparqlParser) argList() ([]*sparqlExpr, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	var args []*sparqlExpr
+	p.skipWS()
+	if p.peek() == ')' {
+		p.pos++
+		return args, nil
+	}
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		p.skipWS()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return args, nil
+		default:
+			return nil, p.errorf("expected ',' or ')'")
+		}
+	}
+}
+
+// operator consumes op if it comes next. '<' and '>' are only read as
+// operators where an operator is expected, so IRIs are not mistaken for them.
+func (p *sparqlParser) operator(op string) bool {
+	p.skipWS()
+	if !p.hasPrefix(op) {
+		return false
+	}
+	// don't read the first half of a longer operator
+	if (op == "<" || op == ">") && p.hasPrefix(op+"=") {
+		return false
+	}
+	p.pos += len(op)
+	return true
+}
+
+// eval returns the value of the expression for the solution b, or nil if
+// evaluating it raises an error
+func (e *sparqlExpr) eval(b binding) Term {
+	switch e.op {
+	case "":
+		return b.resolve(e.term)
+	case "BOUND":
+		return sparqlBool(b.resolve(e.args[0].term) != nil)
+	case "||", "&&":
+		// an error on one side is overridden by the other side deciding
+		l, lok := ebv(e.args[0].eval(b))
+		r, rok := ebv(e.args[1].eval(b))
+		decide := e.op == "||"
+		switch {
+		case (lok && l == decide) || (rok && r == decide):
+			return sparqlBool(decide)
+		case lok && rok:
+			return sparqlBool(!decide)
+		}
+		return nil
+	case "COALESCE":
+		for _, arg := range e.args {
+			if v := arg.eval(b); v != nil {
+				return v
+			}
+		}
+		return nil
+	case "IF":
+		cond, ok := ebv(e.args[0].eval(b))
+		if !ok {
+			return nil
+		}
+		if cond {
+			return e.args[1].eval(b)
+		}
+		return e.args[2].eval(b)
+	case "IN", "NOT IN":
+		v := e.args[0].eval(b)
+		if v == nil {
+			return nil
+		}
+		for _, arg := range e.args[1:] {
+			if w := arg.eval(b); w != nil && sparqlEqual(v, w) {
+				return sparqlBool(e.op == "IN")
+			}
+		}
+		return sparqlBool(e.op == "NOT IN")
+	}
+
+	args := make([]Term, len(e.args))
+	for i, arg := range e.args {
+		if args[i] = arg.eval(b); args[i] == nil {
+			return nil
+		}
+	}
+	switch e.op {
+	case "!":
+		v, ok := ebv(args[0])
+		if !ok {
+			return nil
+		}
+		return sparqlBool(!v)
+	case "neg", "pos":
+		if _, ok := numericValue(args[0]); !ok {
+			return nil
+		}
+		if e.op == "pos" {
+			return args[0]
+		}
+		return arithmetic("-", NewLiteralWithDatatype("0", NewResource(xsdInteger)), args[0])
+	case "+", "-", "*", "/":
+		return arithmetic(e.op, args[0], args[1])
+	case "=":
+		return sparqlBool(sparqlEqual(args[0], args[1]))
+	case "!=":
+		return sparqlBool(!sparqlEqual(args[0], args[1]))
+	case "<", ">", "<=", ">=":
+		c, ok := sparqlCompare(args[0], args[1])
+		if !ok {
+			return nil
+		}
+		switch e.op {
+		case "<":
+			return sparqlBool(c < 0)
+		case ">":
+			return sparqlBool(c > 0)
+		case "<=":
+			return sparqlBool(c <= 0)
+		}
+		return sparqlBool(c >= 0)
+	case "ISIRI", "ISURI":
+		_, ok := args[0].(*Resource)
+		return sparqlBool(ok)
+	case "ISBLANK":
+		_, ok := args[0].(*BlankNode)
+		return sparqlBool(ok)
+	case "ISLITERAL":
+		_, ok := args[0].(*Literal)
+		return sparqlBool(ok)
+	case "ISNUMERIC":
+		_, ok := numericValue(args[0])
+		return sparqlBool(ok)
+	case "SAMETERM":
+		return sparqlBool(args[0].Equal(args[1]))
+	case "STR":
+		switch t := args[0].(type) {
+		case *Resource:
+			return NewLiteral(t.URI)
+		case *Literal:
+			return NewLiteral(t.Value)
+		}
+		return nil
+	case "LANG":
+		if l, ok := args[0].(*Literal); ok {
+			return NewLiteral(l.Language)
+		}
+		return nil
+	case "DATATYPE":
+		if l, ok := args[0].(*Literal); ok {
+			return NewResource(literalDatatype(l))
+		}
+		return nil
+	case "LANGMATCHES":
+		tag, ok1 := simpleString(args[0])
+		rng, ok2 := simpleString(args[1])
+		if !ok1 || !ok2 {
+			return nil
+		}
+		if rng == "*" {
+			return sparqlBool(len(tag) > 0)
+		}
+		tag, rng = strings.ToLower(tag), strings.ToLower(rng)
+		return sparqlBool(tag == rng || strings.HasPrefix(tag, rng+"-"))
+	case "STRLEN":
+		s, ok := stringValue(args[0])
+		if !ok {
+			return nil
+		}
+		return NewLiteralWithDatatype(strconv.Itoa(len([]rune(s))), NewResource(xsdInteger))
+	case "LCASE", "UCASE":
+		l, ok := args[0].(*Literal)
+		if _, str := stringValue(args[0]); !ok || !str {
+			return nil
+		}
+		value := strings.ToLower(l.Value)
+		if e.op == "UCASE" {
+			value = strings.ToUpper(l.Value)
+		}
+		return &Literal{Value: value, Language: l.Language, Datatype: l.Datatype}
+	case "CONTAINS", "STRSTARTS", "STRENDS":
+		s, ok1 := stringValue(args[0])
+		sub, ok2 := stringValue(args[1])
+		if !ok1 || !ok2 {
+			return nil
+		}
+		switch e.op {
+		case "CONTAINS":
+			return sparqlBool(strings.Contains(s, sub))
+		case "STRSTARTS":
+			return sparqlBool(strings.HasPrefix(s, sub))
+		}
+		return sparqlBool(strings.HasSuffix(s, sub))
+	case "CONCAT":
+		var buf []string
+		for _, arg := range args {
+			s, ok := stringValue(arg)
+			if !ok {
+				return nil
+			}
+			buf = append(buf, s)
+		}
+		return NewLiteral(strings.Join(buf, ""))
+	case "REGEX":
+		s, ok1 := stringValue(args[0])
+		pattern, ok2 := simpleString(args[1])
+		if !ok1 || !ok2 {
+			return nil
+		}
+		if len(args) == 3 {
+			flags, ok := simpleString(args[2])
+			if !ok || strings.Trim(flags, "ims") != "" {
+				return nil
+			}
+			if len(flags) > 0 {
+				pattern = "(?" + flags + ")" + pattern
+			}
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil
+		}
+		return sparqlBool(re.MatchString(s))
+	}
+	return nil
+}
+
+func sparqlBool(v bool) Term {
+	return NewLiteralWithDatatype(strconv.FormatBool(v), NewResource(xsdBoolean))
+}
+
+// ebv returns the effective boolean value of t, and false if it has none
+func ebv(t Term) (bool, bool) {
+	l, ok := t.(*Literal)
+	if !ok {
+		return false, false
+	}
+	switch dt := literalDatatype(l); {
+	case dt == xsdBoolean:
+		return l.Value == "true" || l.Value == "1", true
+	case dt == xsdString || dt == rdfLangString:
+		return len(l.Value) > 0, true
+	}
+	if v, ok := numericValue(l); ok {
+		return v != 0 && !math.IsNaN(v), true
+	}
+	return false, false
+}
+
+// literalDatatype returns the datatype IRI of l, including the implicit ones
+// of simple and language-tagged literals
+func literalDatatype(l *Literal) string {
+	if dt, ok := l.Datatype.(*Resource); ok {
+		return dt.URI
+	}
+	if len(l.Language) > 0 {
+		return rdfLangString
+	}
+	return xsdString
+}
+
+// numericValue returns the value of a numeric literal
+func numericValue(t Term) (float64, bool) {
+	l, ok := t.(*Literal)
+	if !ok {
+		return 0, false
+	}
+	switch dt := literalDatatype(l); {
+	case xsdIntegers[dt], dt == xsdDecimal, dt == xsdDouble, dt == xsdFloat:
+		v, err := strconv.ParseFloat(strings.TrimSpace(l.Value), 64)
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// stringValue returns the lexical form of a string literal, with or without
+// a language tag
+func stringValue(t Term) (string, bool) {
+	if l, ok := t.(*Literal); ok {
+		if dt := literalDatatype(l); dt == xsdString || dt == rdfLangString {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+// simpleString returns the lexical form of a literal without a language tag
+func simpleString(t Term) (string, bool) {
+	if l, ok := t.(*Literal); ok && literalDatatype(l) == xsdString {
+		return l.Value, true
+	}
+	return "", false
+}
+
+// arithmetic applies a numeric operator, keeping the result an integer when
+// both operands are integers (except for division)
+func arithmetic(op string, a, b Term) Term {
+	x, ok1 := numericValue(a)
+	y, ok2 := numericValue(b)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	var v float64
+	switch op {
+	case "+":
+		v = x + y
+	case "-":
+		v = x - y
+	case "*":
+		v = x * y
+	case "/":
+		if y == 0 {
+			return nil
+		}
+		v = x / y
+	}
+	da, db := literalDatatype(a.(*Literal)), literalDatatype(b.(*Literal))
+	switch {
+	case da == xsdDouble || db == xsdDouble || da == xsdFloat || db == xsdFloat:
+		return NewLiteralWithDatatype(strconv.FormatFloat(v, 'E', -1, 64), NewResource(xsdDouble))
+	case op != "/" && xsdIntegers[da] && xsdIntegers[db]:
+		return NewLiteralWithDatatype(strconv.FormatFloat(v, 'f', 0, 64), NewResource(xsdInteger))
+	}
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return NewLiteralWithDatatype(s, NewResource(xsdDecimal))
+}
+
+// sparqlEqual compares numbers by value, across their types, the other
+// literals of the core XSD types by value, and everything else as RDF terms
+func sparqlEqual(a, b Term) bool {
+	if x, ok := numericValue(a); ok {
+		if y, ok := numericValue(b); ok {
+			return x == y
+		}
+	}
+	return SameValue(a, b)
+}
+
+// sparqlCompare orders two literals of comparable XSD types by value, or two
+// literals of the same string type
+func sparqlCompare(a, b Term) (int, bool) {
+	if c, ok := CompareLiterals(a, b); ok {
+		return c, true
+	}
+	la, ok1 := a.(*Literal)
+	lb, ok2 := b.(*Literal)
+	if !ok1 || !ok2 || literalDatatype(la) != literalDatatype(lb) || la.Language != lb.Language {
+		return 0, false
+	}
+	switch literalDatatype(la) {
+	case xsdString, rdfLangString:
+		return strings.Compare(la.Value, lb.Value), true
+	}
+	return 0, false
+}
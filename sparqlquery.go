@@ -0,0 +1,793 @@
+package gold
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sparqlResultMimes are the formats of SELECT and ASK results, the first
+// being the default
+var sparqlResultMimes = []string{
+	"application/sparql-results+json",
+	"application/sparql-results+xml",
+	"text/csv",
+	"text/tab-separated-values",
+}
+
+// SPARQLQuery is a parsed SPARQL SELECT, ASK, CONSTRUCT or DESCRIBE query
+type SPARQLQuery struct {
+	baseURI string
+
+	form     string
+	distinct bool
+	// vars lists the projected variables, all of them if empty
+	vars     []string
+	exprs    map[string]*sparqlExpr
+	template []*Triple
+	describe []Term
+	where    *sparqlGroup
+
+	order  []sparqlOrder
+	limit  int
+	offset int
+}
+
+type sparqlOrder struct {
+	expr *sparqlExpr
+	desc bool
+}
+
+// NewSPARQLQuery creates a new SPARQL query object
+func NewSPARQLQuery(baseURI string) *SPARQLQuery {
+	return &SPARQLQuery{
+		baseURI: baseURI,
+		exprs:   map[string]*sparqlExpr{},
+		where:   &sparqlGroup{},
+		limit:   -1,
+	}
+}
+
+// Parse parses a SPARQL query from the reader
+func (query *SPARQLQuery) Parse(src io.Reader) error {
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	p := newSPARQLParser(string(b), query.baseURI)
+	if err = p.prologue(); err != nil {
+		return err
+	}
+
+	switch {
+	case p.keyword("SELECT"):
+		query.form = "SELECT"
+		err = p.selectClause(query)
+	case p.keyword("CONSTRUCT"):
+		query.form = "CONSTRUCT"
+		p.skipWS()
+		if p.peek() == '{' {
+			query.template, _, err = p.block()
+			break
+		}
+		// CONSTRUCT WHERE { ... } uses its pattern as the template
+		if !p.keyword("WHERE") {
+			return p.errorf("expected a template or WHERE")
+		}
+		if query.template, _, err = p.block(); err != nil {
+			return err
+		}
+		if err = p.checkTerms(query.template, "CONSTRUCT WHERE", true, false); err != nil {
+			return err
+		}
+		query.where.elements = []sparqlElement{bgpPattern(query.template)}
+		return p.solutionModifiers(query)
+	case p.keyword("DESCRIBE"):
+		query.form = "DESCRIBE"
+		err = p.describeClause(query)
+	case p.keyword("ASK"):
+		query.form = "ASK"
+	default:
+		return p.errorf("unknown query form %q", sparqlKeywordPrefix(p.src[p.pos:]))
+	}
+	if err != nil {
+		return err
+	}
+
+	if p.hasKeyword("FROM") {
+		return p.errorf("FROM is not supported")
+	}
+	p.skipWS()
+	if p.keyword("WHERE") || p.peek() == '{' {
+		if query.where, err = p.group(); err != nil {
+			return err
+		}
+	} else if query.form != "DESCRIBE" {
+		return p.errorf("expected WHERE")
+	}
+	return p.solutionModifiers(query)
+}
+
+func (p *sparqlParser) selectClause(query *SPARQLQuery) error {
+	if p.keyword("DISTINCT") || p.keyword("REDUCED") {
+		query.distinct = true
+	}
+	p.skipWS()
+	if p.peek() == '*' {
+		p.pos++
+		return nil
+	}
+	for {
+		p.skipWS()
+		switch p.peek() {
+		case '?', '$':
+			v, err := p.variable()
+			if err != nil {
+				return err
+			}
+			query.vars = append(query.vars, v.(*Variable).Name)
+		case '(':
+			p.pos++
+			expr, err := p.expression()
+			if err != nil {
+				return err
+			}
+			name, err := p.as()
+			if err != nil {
+				return err
+			}
+			if err = p.expect(')'); err != nil {
+				return err
+			}
+			query.vars = append(query.vars, name)
+			query.exprs[name] = expr
+		default:
+			if len(query.vars) == 0 {
+				return p.errorf("expected '*' or a variable")
+			}
+			return nil
+		}
+	}
+}
+
+func (p *sparqlParser) describeClause(query *SPARQLQuery) error {
+	p.skipWS()
+	if p.peek() == '*' {
+		p.pos++
+		return nil
+	}
+	for {
+		p.skipWS()
+		if c := p.peek(); c == '{' || c == 0 || p.hasKeyword("WHERE") || p.hasKeyword("FROM") ||
+			p.hasKeyword("ORDER") || p.hasKeyword("LIMIT") || p.hasKeyword("OFFSET") {
+			if len(query.describe) == 0 {
+				return p.errorf("expected '*', a variable or an IRI")
+			}
+			return nil
+		}
+		var (
+			t   Term
+			err error
+		)
+		if c := p.peek(); c == '?' || c == '$' {
+			t, err = p.variable()
+		} else {
+			t, err = p.iri()
+		}
+		if err != nil {
+			return err
+		}
+		query.describe = append(query.describe, t)
+	}
+}
+
+func (p *sparqlParser) solutionModifiers(query *SPARQLQuery) error {
+	for _, kw := range []string{"GROUP", "HAVING"} {
+		if p.keyword(kw) {
+			return p.errorf("%s is not supported", kw)
+		}
+	}
+	if p.keyword("ORDER") {
+		if !p.keyword("BY") {
+			return p.errorf("expected BY")
+		}
+	conditions:
+		for {
+			p.skipWS()
+			var (
+				order sparqlOrder
+				err   error
+			)
+			switch c := p.peek(); {
+			case p.hasKeyword("ASC"), p.hasKeyword("DESC"):
+				order.desc = p.keyword("DESC")
+				p.keyword("ASC")
+				order.expr, err = p.bracketted()
+			case c == '?' || c == '$':
+				var v Term
+				v, err = p.variable()
+				order.expr = &sparqlExpr{term: v}
+			case c == '(':
+				order.expr, err = p.bracketted()
+			default:
+				if len(query.order) == 0 {
+					return p.errorf("expected an ordering condition")
+				}
+				break conditions
+			}
+			if err != nil {
+				return err
+			}
+			query.order = append(query.order, order)
+		}
+	}
+	for {
+		var n *int
+		switch {
+		case p.keyword("LIMIT"):
+			n = &query.limit
+		case p.keyword("OFFSET"):
+			n = &query.offset
+		}
+		if n == nil {
+			break
+		}
+		p.skipWS()
+		start := p.pos
+		if p.digits() == 0 {
+			return p.errorf("expected an integer")
+		}
+		*n, _ = strconv.Atoi(p.src[start:p.pos])
+	}
+	p.skipWS()
+	if p.hasKeyword("VALUES") {
+		return p.errorf("VALUES is not supported")
+	}
+	if !p.eof() {
+		return p.errorf("unexpected %q after the query", sparqlKeywordPrefix(p.src[p.pos:]))
+	}
+	return nil
+}
+
+// SPARQLResult holds the outcome of a query: the solutions of a SELECT, the
+// answer to an ASK, or the graph built by a CONSTRUCT or DESCRIBE
+type SPARQLResult struct {
+	form      string
+	vars      []string
+	solutions []binding
+	boolean   bool
+	graph     *Graph
+}
+
+// SPARQLQuery evaluates a query against the graph
+func (g *Graph) SPARQLQuery(query *SPARQLQuery) *SPARQLResult {
+	result := &SPARQLResult{form: query.form}
+	solutions := query.where.eval(g, []binding{{}})
+
+	if query.form == "ASK" {
+		result.boolean = len(solutions) > 0
+		return result
+	}
+
+	if len(query.exprs) > 0 {
+		for _, name := range query.vars {
+			if expr, ok := query.exprs[name]; ok {
+				solutions = bindPattern{expr, name}.eval(g, solutions)
+			}
+		}
+	}
+	if len(query.order) > 0 {
+		sort.Stable(solutionOrder{solutions, query.order})
+	}
+
+	vars := query.vars
+	if len(vars) == 0 && (query.form == "SELECT" || query.form == "DESCRIBE") {
+		vars = query.where.vars(nil)
+	}
+	if query.form == "SELECT" {
+		result.vars = vars
+		solutions = project(solutions, vars, query.distinct)
+	}
+	solutions = slice(solutions, query.offset, query.limit)
+
+	switch query.form {
+	case "SELECT":
+		result.solutions = solutions
+	case "CONSTRUCT":
+		result.graph = NewGraph(g.URI())
+		for _, solution := range solutions {
+			bnodes := map[string]Term{}
+			for _, pattern := range query.template {
+				if triple := solution.instantiate(pattern, bnodes); triple != nil {
+					result.graph.Add(triple)
+				}
+			}
+		}
+	case "DESCRIBE":
+		result.graph = NewGraph(g.URI())
+		described := map[string]bool{}
+		for _, t := range query.describe {
+			if _, ok := t.(*Variable); !ok {
+				g.describe(result.graph, t, described)
+			}
+		}
+		for _, solution := range solutions {
+			for _, name := range vars {
+				if t, ok := solution[name]; ok && (len(query.describe) == 0 || hasVariable(query.describe, name)) {
+					g.describe(result.graph, t, described)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// describe copies the triples about t into out, following blank nodes so
+// that each description is complete
+func (g *Graph) describe(out *Graph, t Term, described map[string]bool) {
+	if _, ok := t.(*Literal); ok || described[t.String()] {
+		return
+	}
+	described[t.String()] = true
+	for _, triple := range g.All(t, nil, nil) {
+		out.Add(triple)
+		if _, ok := triple.Object.(*BlankNode); ok {
+			g.describe(out, triple.Object, described)
+		}
+	}
+}
+
+func hasVariable(terms []Term, name string) bool {
+	for _, t := range terms {
+		if v, ok := t.(*Variable); ok && v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// vars appends the names of the variables used in the group, in the order
+// they first appear, to seen
+func (grp *sparqlGroup) vars(seen []string) []string {
+	add := func(t Term) {
+		v, ok := t.(*Variable)
+		if !ok || strings.HasPrefix(v.Name, "_:") {
+			return
+		}
+		for _, name := range seen {
+			if name == v.Name {
+				return
+			}
+		}
+		seen = append(seen, v.Name)
+	}
+	for _, e := range grp.elements {
+		switch e := e.(type) {
+		case bgpPattern:
+			for _, t := range e {
+				add(t.Subject)
+				add(t.Predicate)
+				add(t.Object)
+			}
+		case *sparqlGroup:
+			seen = e.vars(seen)
+		case optionalPattern:
+			seen = e.group.vars(seen)
+		case unionPattern:
+			for _, sub := range e {
+				seen = sub.vars(seen)
+			}
+		case bindPattern:
+			add(NewVariable(e.name))
+		}
+	}
+	return seen
+}
+
+// project keeps only the given variables of each solution, dropping
+// duplicates if distinct is set
+func project(solutions []binding, vars []string, distinct bool) []binding {
+	seen := map[string]bool{}
+	out := make([]binding, 0, len(solutions))
+	for _, b := range solutions {
+		nb := binding{}
+		key := ""
+		for _, name := range vars {
+			if t, ok := b[name]; ok {
+				nb[name] = t
+				key += t.String()
+			}
+			key += "\x00"
+		}
+		if distinct {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		out = append(out, nb)
+	}
+	return out
+}
+
+func slice(solutions []binding, offset, limit int) []binding {
+	if offset >= len(solutions) {
+		return nil
+	}
+	solutions = solutions[offset:]
+	if limit >= 0 && limit < len(solutions) {
+		solutions = solutions[:limit]
+	}
+	return solutions
+}
+
+type solutionOrder struct {
+	solutions []binding
+	order     []sparqlOrder
+}
+
+func (s solutionOrder) Len() int { return len(s.solutions) }
+func (s solutionOrder) Swap(i, j int) {
+	s.solutions[i], s.solutions[j] = s.solutions[j], s.solutions[i]
+}
+func (s solutionOrder) Less(i, j int) bool {
+	for _, o := range s.order {
+		a, b := o.expr.eval(s.solutions[i]), o.expr.eval(s.solutions[j])
+		c := orderCompare(a, b)
+		if o.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// orderCompare orders terms for ORDER BY: unbound values first, then blank
+// nodes, IRIs and literals
+func orderCompare(a, b Term) int {
+	rank := func(t Term) int {
+		switch t.(type) {
+		case nil:
+			return 0
+		case *BlankNode:
+			return 1
+		case *Resource:
+			return 2
+		}
+		return 3
+	}
+	if ra, rb := rank(a), rank(b); ra != rb || ra == 0 {
+		return ra - rb
+	}
+	if c, ok := sparqlCompare(a, b); ok {
+		return c
+	}
+	switch {
+	case termLess(a, b):
+		return -1
+	case termLess(b, a):
+		return 1
+	}
+	return 0
+}
+
+// Mimes returns the media types the result can be serialized to, the
+// first being the default
+func (result *SPARQLResult) Mimes() []string {
+	switch result.form {
+	case "SELECT":
+		return sparqlResultMimes
+	case "ASK":
+		return sparqlResultMimes[:2]
+	}
+	mimes := []string{"text/turtle"}
+	for _, mime := range serializerMimes {
+		if mime != "text/turtle" && mimeSerializer[mime] != "internal" || mime == "application/ld+json" {
+			mimes = append(mimes, mime)
+		}
+	}
+	return mimes
+}
+
+// Serialize writes the result in the given media type
+func (result *SPARQLResult) Serialize(mime string) (string, error) {
+	if result.graph != nil {
+		return result.graph.Serialize(mime)
+	}
+	buf := new(bytes.Buffer)
+	var err error
+	switch mime {
+	case "application/sparql-results+json":
+		err = result.writeJSON(buf)
+	case "application/sparql-results+xml":
+		err = result.writeXML(buf)
+	case "text/csv", "text/tab-separated-values":
+		if result.form != "SELECT" {
+			return "", errors.New("boolean results cannot be written as " + mime)
+		}
+		if mime == "text/csv" {
+			err = result.writeCSV(buf)
+		} else {
+			result.writeTSV(buf)
+		}
+	default:
+		return "", errors.New("no serializer available for " + mime)
+	}
+	return buf.String(), err
+}
+
+func (result *SPARQLResult) writeJSON(w io.Writer) error {
+	type jsonTerm map[string]string
+	doc := map[string]interface{}{}
+	if result.form == "ASK" {
+		doc["head"] = map[string]interface{}{}
+		doc["boolean"] = result.boolean
+	} else {
+		vars := result.vars
+		if vars == nil {
+			vars = []string{}
+		}
+		bindings := make([]map[string]jsonTerm, 0, len(result.solutions))
+		for _, b := range result.solutions {
+			row := map[string]jsonTerm{}
+			for _, name := range result.vars {
+				switch t := b[name].(type) {
+				case *Resource:
+					row[name] = jsonTerm{"type": "uri", "value": t.URI}
+				case *BlankNode:
+					row[name] = jsonTerm{"type": "bnode", "value": t.ID}
+				case *Literal:
+					jt := jsonTerm{"type": "literal", "value": t.Value}
+					if len(t.Language) > 0 {
+						jt["xml:lang"] = t.Language
+					} else if dt := literalDatatype(t); dt != xsdString {
+						jt["datatype"] = dt
+					}
+					row[name] = jt
+				}
+			}
+			bindings = append(bindings, row)
+		}
+		doc["head"] = map[string]interface{}{"vars": vars}
+		doc["results"] = map[string]interface{}{"bindings": bindings}
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
+
+func (result *SPARQLResult) writeXML(w io.Writer) error {
+	escape := func(s string) string {
+		buf := new(bytes.Buffer)
+		xml.EscapeText(buf, []byte(s))
+		return buf.String()
+	}
+	io.WriteString(w, "<?xml version=\"1.0\"?>\n<sparql xmlns=\"http://www.w3.org/2005/sparql-results#\">\n  <head>\n")
+	for _, name := range result.vars {
+		io.WriteString(w, "    <variable name=\""+escape(name)+"\"/>\n")
+	}
+	io.WriteString(w, "  </head>\n")
+	if result.form == "ASK" {
+		io.WriteString(w, "  <boolean>"+strconv.FormatBool(result.boolean)+"</boolean>\n")
+	} else {
+		io.WriteString(w, "  <results>\n")
+		for _, b := range result.solutions {
+			io.WriteString(w, "    <result>\n")
+			for _, name := range result.vars {
+				var value string
+				switch t := b[name].(type) {
+				case *Resource:
+					value = "<uri>" + escape(t.URI) + "</uri>"
+				case *BlankNode:
+					value = "<bnode>" + escape(t.ID) + "</bnode>"
+				case *Literal:
+					attr := ""
+					if len(t.Language) > 0 {
+						attr = " xml:lang=\"" + escape(t.Language) + "\""
+					} else if dt := literalDatatype(t); dt != xsdString {
+						attr = " datatype=\"" + escape(dt) + "\""
+					}
+					value = "<literal" + attr + ">" + escape(t.Value) + "</literal>"
+				default:
+					continue
+				}
+				io.WriteString(w, "      <binding name=\""+escape(name)+"\">"+value+"</binding>\n")
+			}
+			io.WriteString(w, "    </result>\n")
+		}
+		io.WriteString(w, "  </results>\n")
+	}
+	_, err := io.WriteString(w, "</sparql>\n")
+	return err
+}
+
+func (result *SPARQLResult) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	cw.Write(result.vars)
+	for _, b := range result.solutions {
+		row := make([]string, len(result.vars))
+		for i, name := range result.vars {
+			switch t := b[name].(type) {
+			case *Resource:
+				row[i] = t.URI
+			case *Literal:
+				row[i] = t.Value
+			case *BlankNode:
+				row[i] = "_:" + t.ID
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (result *SPARQLResult) writeTSV(w io.Writer) {
+	header := make([]string, len(result.vars))
+	for i, name := range result.vars {
+		header[i] = "?" + name
+	}
+	io.WriteString(w, strings.Join(header, "\t")+"\n")
+	for _, b := range result.solutions {
+		row := make([]string, len(result.vars))
+		for i, name := range result.vars {
+			if t, ok := b[name]; ok {
+				row[i] = t.String()
+			}
+		}
+		io.WriteString(w, strings.Join(row, "\t")+"\n")
+	}
+}
+
+// isSPARQLQuery reports whether the request is addressed to the SPARQL query
+// endpoint of a container or document
+func (req *httpRequest) isSPARQLQuery() bool {
+	if strings.HasSuffix(req.URL.Path, SPARQLSuffix) {
+		return true
+	}
+	if _, ok := req.URL.Query()["query"]; ok {
+		return req.Method == "GET" || req.Method == "HEAD" || req.Method == "POST"
+	}
+	if req.Method == "POST" {
+		switch strings.TrimSpace(strings.Split(req.Header.Get(HCType), ";")[0]) {
+		case "application/sparql-query":
+			return true
+		case "application/x-www-form-urlencoded":
+			// other forms are still refused as an unsupported media type
+			return len(req.PostFormValue("query")) > 0
+		}
+	}
+	return false
+}
+
+// handleSPARQLQuery evaluates a query over the union of the RDF documents the
+// user may read in the addressed container, or over the addressed document
+func (s *Server) handleSPARQLQuery(w http.ResponseWriter, req *httpRequest, acl *WAC) *response {
+	r := new(response)
+
+	var src string
+	switch req.Method {
+	case "GET", "HEAD":
+		src = req.URL.Query().Get("query")
+	case "POST":
+		if strings.HasPrefix(req.Header.Get(HCType), "application/sparql-query") {
+			b, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return r.respond(500, err)
+			}
+			src = string(b)
+		} else {
+			src = req.FormValue("query")
+		}
+	default:
+		return r.respond(405, "HTTP 405 - Method not allowed")
+	}
+	if len(strings.TrimSpace(src)) == 0 {
+		return r.respond(400, "HTTP 400 - Missing query")
+	}
+
+	resource, err := s.pathInfo(strings.TrimSuffix(req.BaseURI(), SPARQLSuffix))
+	if err != nil {
+		return r.respond(500, err)
+	}
+	if !resource.Exists {
+		return r.respond(404, "HTTP 404 - Not found")
+	}
+	aclStatus, err := acl.AllowRead(resource.URI)
+	if aclStatus > 200 || err != nil {
+		return r.respond(aclStatus, handleStatusText(aclStatus, err))
+	}
+
+	query := NewSPARQLQuery(resource.URI)
+	if err = query.Parse(strings.NewReader(src)); err != nil {
+		return r.respond(400, err.Error())
+	}
+	g := NewGraph(resource.URI)
+	s.loadSPARQLDataset(g, resource, acl)
+	// documents we could not read don't make the answer unauthorized
+	w.Header().Del("WWW-Authenticate")
+	result := g.SPARQLQuery(query)
+
+	mimes := result.Mimes()
+	contentType := mimes[0]
+	acceptList, _ := req.Accept()
+	if len(acceptList) > 0 && acceptList[0].SubType != "*" {
+		contentType, err = acceptList.Negotiate(mimes...)
+		if err != nil {
+			return r.respond(406, "HTTP 406 - Accept type not acceptable: "+err.Error())
+		}
+	}
+	body, err := result.Serialize(contentType)
+	if err != nil {
+		return r.respond(500, err)
+	}
+	w.Header().Set(HCType, contentType)
+	w.Header().Set("Vary", "Accept")
+	if req.Method == "HEAD" {
+		return r.respond(200)
+	}
+	return r.respond(200, body)
+}
+
+// loadSPARQLDataset reads every RDF document under resource that the user is
+// allowed to read into g. ACL files are never part of the dataset.
+func (s *Server) loadSPARQLDataset(g *Graph, resource *pathInfo, acl *WAC) {
+	// past versions and the trash keep no ACLs of their own
+	if isHiddenPath(resource.Path) {
+		return
+	}
+	load := func(f *pathInfo) {
+		if !isStoredRDF(f.FileType) || strings.HasSuffix(f.Path, ACLSuffix) {
+			return
+		}
+		if status, _ := acl.AllowRead(f.URI); status != 200 {
+			return
+		}
+		unlock := lock(f.File)
+		defer unlock()
+		g.appendStorage(s.Storage, f.File, f.URI)
+	}
+
+	stat, err := s.Storage.Stat(resource.File)
+	if err != nil {
+		return
+	}
+	if !stat.IsDir() {
+		load(resource)
+		return
+	}
+	walkStorage(s.Storage, resource.File, func(path string, info os.FileInfo, err error) error {
+		if err == nil && isHiddenFile(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err != nil || info.IsDir() || strings.HasSuffix(path, TYPESuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(resource.File, path)
+		if err != nil {
+			return nil
+		}
+		f, err := s.pathInfo(resource.URI + (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath())
+		if err != nil {
+			s.debug.Println(err)
+			return nil
+		}
+		load(f)
+		return nil
+	})
+}
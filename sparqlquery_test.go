@@ -0,0 +1,128 @@
+package gold
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testQueryGraph() *Graph {
+	g := NewGraph("https://test/")
+	g.Parse(strings.NewReader(`
+@prefix ex: <http://example.org/> .
+<a> ex:name "Alice"@en ; ex:age 42 ; ex:knows <b>, <c> .
+<b> ex:name "Bob" ; ex:age 7 .
+<c> ex:age 30 ; ex:address [ ex:city "Oslo" ] .
+`), "text/turtle")
+	return g
+}
+
+func runQuery(t *testing.T, g *Graph, src string) *SPARQLResult {
+	query := NewSPARQLQuery(g.URI())
+	err := query.Parse(strings.NewReader(src))
+	assert.NoError(t, err, src)
+	if err != nil {
+		return &SPARQLResult{}
+	}
+	return g.SPARQLQuery(query)
+}
+
+func TestSPARQLSelect(t *testing.T) {
+	g := testQueryGraph()
+	result := runQuery(t, g, `PREFIX ex: <http://example.org/>
+SELECT ?s ?name WHERE {
+	?s ex:age ?age .
+	OPTIONAL { ?s ex:name ?name }
+	FILTER (?age > 10 && !isBlank(?s))
+} ORDER BY DESC(?age)`)
+	assert.Equal(t, []string{"s", "name"}, result.vars)
+	assert.Equal(t, 2, len(result.solutions))
+	assert.Equal(t, NewResource("https://test/a"), result.solutions[0]["s"])
+	assert.Equal(t, NewLiteralWithLanguage("Alice", "en"), result.solutions[0]["name"])
+	assert.Nil(t, result.solutions[1]["name"])
+
+	result = runQuery(t, g, `PREFIX ex: <http://example.org/>
+SELECT DISTINCT ?p WHERE { { ?s ex:name ?o } UNION { ?s ex:knows ?o } ?s ?p ?o } ORDER BY ?p LIMIT 2`)
+	assert.Equal(t, 2, len(result.solutions))
+	assert.Equal(t, NewResource("http://example.org/knows"), result.solutions[0]["p"])
+
+	result = runQuery(t, g, `PREFIX ex: <http://example.org/>
+SELECT (STR(?name) AS ?label) ?n WHERE {
+	?s ex:age ?age MINUS { ?s ex:address [] }
+	BIND (?age * 2 AS ?n)
+	OPTIONAL { ?s ex:name ?name }
+	FILTER (REGEX(?name, "^a", "i") || STRLEN(?name) = 3)
+} ORDER BY ?n`)
+	assert.Equal(t, 2, len(result.solutions))
+	assert.Equal(t, NewLiteral("Bob"), result.solutions[0]["label"])
+	assert.Equal(t, NewLiteralWithDatatype("14", NewResource(xsdInteger)), result.solutions[0]["n"])
+	assert.Equal(t, NewLiteral("Alice"), result.solutions[1]["label"])
+
+	result = runQuery(t, g, `SELECT * { ?s <http://example.org/age> ?age FILTER (?age IN (7, 30)) } OFFSET 1`)
+	assert.Equal(t, []string{"s", "age"}, result.vars)
+	assert.Equal(t, 1, len(result.solutions))
+}
+
+func TestSPARQLAskConstructDescribe(t *testing.T) {
+	g := testQueryGraph()
+	assert.True(t, runQuery(t, g, `ASK { <a> <http://example.org/knows> <b> }`).boolean)
+	assert.False(t, runQuery(t, g, `ASK { <b> <http://example.org/knows> ?x }`).boolean)
+
+	result := runQuery(t, g, `CONSTRUCT { ?y <http://example.org/knownBy> ?x } WHERE { ?x <http://example.org/knows> ?y }`)
+	assert.Equal(t, 2, result.graph.Len())
+	assert.NotNil(t, result.graph.One(NewResource("https://test/c"), nil, NewResource("https://test/a")))
+
+	result = runQuery(t, g, `CONSTRUCT WHERE { ?s <http://example.org/name> ?o }`)
+	assert.Equal(t, 2, result.graph.Len())
+
+	result = runQuery(t, g, `DESCRIBE <c>`)
+	assert.Equal(t, 3, result.graph.Len())
+	assert.NotNil(t, result.graph.One(nil, nil, NewLiteral("Oslo")))
+}
+
+func TestSPARQLResultFormats(t *testing.T) {
+	g := testQueryGraph()
+	result := runQuery(t, g, `SELECT ?s ?name WHERE { ?s <http://example.org/age> ?age OPTIONAL { ?s <http://example.org/name> ?name } } ORDER BY ?age`)
+
+	out, err := result.Serialize("application/sparql-results+json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `{"name":{"type":"literal","value":"Bob"},"s":{"type":"uri","value":"https://test/b"}}`)
+	assert.Contains(t, out, `{"s":{"type":"uri","value":"https://test/c"}}`)
+	assert.Contains(t, out, `"xml:lang":"en"`)
+
+	out, err = result.Serialize("application/sparql-results+xml")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `<variable name="s"/>`)
+	assert.Contains(t, out, `<binding name="name"><literal xml:lang="en">Alice</literal></binding>`)
+
+	out, err = result.Serialize("text/csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "s,name\r\nhttps://test/b,Bob\r\nhttps://test/c,\r\nhttps://test/a,Alice\r\n", out)
+
+	out, err = result.Serialize("text/tab-separated-values")
+	assert.NoError(t, err)
+	assert.Equal(t, "?s\t?name\n<https://test/b>\t\"Bob\"\n<https://test/c>\t\n<https://test/a>\t\"Alice\"@en\n", out)
+
+	ask := runQuery(t, g, `ASK {}`)
+	out, err = ask.Serialize("application/sparql-results+json")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"boolean\":true,\"head\":{}}\n", out)
+	_, err = ask.Serialize("text/csv")
+	assert.Error(t, err)
+}
+
+func TestSPARQLQueryParseError(t *testing.T) {
+	for _, src := range []string{
+		"SELECT WHERE { ?s ?p ?o }",
+		"SELECT * FROM <https://other/> WHERE { ?s ?p ?o }",
+		"SELECT ?s WHERE { ?s ?p ?o } GROUP BY ?s",
+		"SELECT * WHERE { ?s ?p ?o FILTER (?o > ) }",
+		"SELECT * WHERE { ?s ?p ?o FILTER <http://x/f>(?o) }",
+		"SELECT * WHERE { ?s ?p ?o } LIMIT x",
+		"ASK { ?s ?p ?o } garbage",
+		"INSERT DATA { <a> <b> <c> }",
+	} {
+		assert.Error(t, NewSPARQLQuery("https://test/").Parse(strings.NewReader(src)), src)
+	}
+}
@@ -1,19 +1,19 @@
 package gold
 
 import (
-	"bytes"
 	"io"
 	"io/ioutil"
-	"strings"
-	"text/scanner"
 )
 
-// SPARQLUpdateQuery contains a verb, the body of the query and the graph
+// SPARQLUpdateQuery is a single update operation: its verb, the body of its
+// first block and the parsed templates and pattern
 type SPARQLUpdateQuery struct {
 	verb string
 	body string
 
-	graph AnyGraph
+	deletes []*Triple
+	inserts []*Triple
+	where   *sparqlGroup
 }
 
 // SPARQLUpdate contains the base URI and a list of queries
@@ -30,69 +30,195 @@ func NewSPARQLUpdate(baseURI string) *SPARQLUpdate {
 	}
 }
 
-// Parse parses a SPARQL query from the reader
+// Parse parses a SPARQL Update request from the reader. Nothing is kept if
+// the request contains a syntax error.
 func (sparql *SPARQLUpdate) Parse(src io.Reader) error {
-	b, _ := ioutil.ReadAll(src)
-	s := new(scanner.Scanner).Init(bytes.NewReader(b))
-	s.Mode = scanner.ScanIdents | scanner.ScanStrings
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	p := newSPARQLParser(string(b), sparql.baseURI)
+	queries := []SPARQLUpdateQuery{}
+	for {
+		if err = p.prologue(); err != nil {
+			return err
+		}
+		p.skipWS()
+		if p.eof() {
+			break
+		}
+		query, err := p.update()
+		if err != nil {
+			return err
+		}
+		queries = append(queries, query)
+		p.skipWS()
+		if p.eof() {
+			break
+		}
+		if err = p.expect(';'); err != nil {
+			return err
+		}
+	}
+	sparql.queries = queries
+	return nil
+}
 
-	start := 0
-	level := 0
-	verb := ""
-	tok := s.Scan()
-	for tok != scanner.EOF {
-		switch tok {
-		case -2:
-			if level == 0 {
-				if len(verb) > 0 {
-					verb += " "
-				}
-				verb += s.TokenText()
+func (p *sparqlParser) update() (query SPARQLUpdateQuery, err error) {
+	switch {
+	case p.keyword("INSERT"):
+		if p.keyword("DATA") {
+			query.verb = "INSERT DATA"
+			if query.inserts, query.body, err = p.block(); err != nil {
+				return
 			}
+			err = p.checkTerms(query.inserts, "INSERT DATA", false, true)
+			return
+		}
+		return p.modify("INSERT")
 
-		case 123: // {
-			if level == 0 {
-				start = s.Position.Offset
+	case p.keyword("DELETE"):
+		if p.keyword("DATA") {
+			query.verb = "DELETE DATA"
+			if query.deletes, query.body, err = p.block(); err != nil {
+				return
 			}
-			level++
-
-		case 125: // }
-			level--
-			if level == 0 {
-				query := SPARQLUpdateQuery{
-					body:  string(b[start+1 : s.Position.Offset]),
-					graph: NewGraph(sparql.baseURI),
-					verb:  verb,
-				}
-				query.graph.Parse(strings.NewReader(query.body), "text/turtle")
-				sparql.queries = append(sparql.queries, query)
+			err = p.checkTerms(query.deletes, "DELETE DATA", false, false)
+			return
+		}
+		if p.keyword("WHERE") {
+			query.verb = "DELETE WHERE"
+			if query.deletes, query.body, err = p.block(); err != nil {
+				return
 			}
+			query.where = &sparqlGroup{elements: []sparqlElement{bgpPattern(query.deletes)}}
+			err = p.checkTerms(query.deletes, "DELETE WHERE", true, false)
+			return
+		}
+		return p.modify("DELETE")
+
+	case p.keyword("WITH"):
+		if err = p.graphIRI(); err != nil {
+			return
+		}
+		return p.modify("")
 
-		case 59: // ;
-			verb = ""
+	case p.keyword("CLEAR"), p.keyword("DROP"):
+		query.verb = "CLEAR"
+		p.keyword("SILENT")
+		switch {
+		case p.keyword("DEFAULT"), p.keyword("ALL"):
+		case p.keyword("NAMED"):
+			// there are no named graphs to clear
+			query.verb = "CLEAR NAMED"
+		case p.keyword("GRAPH"):
+			err = p.graphIRI()
+		default:
+			err = p.errorf("expected GRAPH, DEFAULT, NAMED or ALL")
 		}
+		return
+	}
 
-		tok = s.Scan()
+	for _, kw := range []string{"LOAD", "CREATE", "ADD", "MOVE", "COPY"} {
+		if p.hasKeyword(kw) {
+			err = p.errorf("%s is not supported", kw)
+			return
+		}
 	}
+	err = p.errorf("unknown update operation %q", sparqlKeywordPrefix(p.src[p.pos:]))
+	return
+}
 
-	return nil
+// modify parses a DELETE/INSERT ... WHERE operation, of which verb is the
+// keyword that has already been read
+func (p *sparqlParser) modify(verb string) (query SPARQLUpdateQuery, err error) {
+	query.verb = "MODIFY"
+	if verb == "" {
+		switch {
+		case p.keyword("DELETE"):
+			verb = "DELETE"
+		case p.keyword("INSERT"):
+			verb = "INSERT"
+		default:
+			err = p.errorf("expected DELETE or INSERT")
+			return
+		}
+	}
+	if verb == "DELETE" {
+		if query.deletes, query.body, err = p.block(); err != nil {
+			return
+		}
+		if err = p.checkTerms(query.deletes, "DELETE", true, false); err != nil {
+			return
+		}
+		verb = ""
+		if p.keyword("INSERT") {
+			verb = "INSERT"
+		}
+	}
+	if verb == "INSERT" {
+		var body string
+		if query.inserts, body, err = p.block(); err != nil {
+			return
+		}
+		if len(query.body) == 0 {
+			query.body = body
+		}
+	}
+	for p.keyword("USING") {
+		p.keyword("NAMED")
+		if err = p.graphIRI(); err != nil {
+			return
+		}
+	}
+	if !p.keyword("WHERE") {
+		err = p.errorf("expected WHERE")
+		return
+	}
+	query.where, err = p.group()
+	return
 }
 
 // SPARQLUpdate is used to update a graph from a SPARQL query
 func (g *Graph) SPARQLUpdate(sparql *SPARQLUpdate) {
 	for _, query := range sparql.queries {
 		switch query.verb {
-		case "INSERT", "INSERT DATA":
-			for triple := range query.graph.IterTriples() {
-				g.Add(triple)
+		case "INSERT DATA":
+			bnodes := map[string]Term{}
+			for _, pattern := range query.inserts {
+				if triple := (binding{}).instantiate(pattern, bnodes); triple != nil {
+					g.Add(triple)
+				}
+			}
+		case "DELETE DATA":
+			for _, triple := range query.deletes {
+				g.Remove(triple)
+			}
+		case "CLEAR":
+			for triple := range g.IterTriples() {
+				g.Remove(triple)
 			}
-		case "DELETE", "DELETE DATA":
-			for pattern := range query.graph.IterTriples() {
-				for _, triple := range g.All(pattern.Subject, pattern.Predicate, nil) {
-					if pattern.Object.Equal(triple.Object) {
-						g.Remove(triple)
+		case "DELETE WHERE", "MODIFY":
+			// find every solution before changing anything
+			var deletes, inserts []*Triple
+			for _, solution := range query.where.eval(g, []binding{{}}) {
+				for _, pattern := range query.deletes {
+					if triple := solution.instantiate(pattern, nil); triple != nil {
+						deletes = append(deletes, triple)
 					}
 				}
+				bnodes := map[string]Term{}
+				for _, pattern := range query.inserts {
+					if triple := solution.instantiate(pattern, bnodes); triple != nil {
+						inserts = append(inserts, triple)
+					}
+				}
+			}
+			for _, triple := range deletes {
+				g.Remove(triple)
+			}
+			for _, triple := range inserts {
+				g.Add(triple)
 			}
 		}
 	}
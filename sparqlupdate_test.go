@@ -54,5 +54,63 @@ func TestSPARQLInsertDeleteLiteralWithDataType(t *testing.T) {
 	}
 	graph := NewGraph("https://test/")
 	graph.SPARQLUpdate(sparql)
-	assert.Empty(t, graph.triples)
+	assert.Equal(t, 0, graph.Len())
+}
+
+func TestSPARQLParseError(t *testing.T) {
+	sparql := NewSPARQLUpdate("https://test/")
+	err := sparql.Parse(strings.NewReader("INSERT DATA { <a> <b> <c> . }; I { <a> <b> <c> . }"))
+	assert.Error(t, err)
+	assert.Empty(t, sparql.queries)
+
+	for _, query := range []string{
+		"INSERT DATA { <a> <b> ?c . }",
+		"DELETE DATA { _:x <b> <c> . }",
+		"DELETE { ?s <b> <c> } WHERE { ?s <b> <c> SERVICE <http://x/> { ?s ?p ?o } }",
+		"INSERT { <a> <b> <c> }",
+		"INSERT DATA { GRAPH <https://other/> { <a> <b> <c> } }",
+		"LOAD <https://other/>",
+	} {
+		assert.Error(t, NewSPARQLUpdate("https://test/").Parse(strings.NewReader(query)), query)
+	}
+}
+
+func TestSPARQLModify(t *testing.T) {
+	graph := NewGraph("https://test/")
+	graph.AddTriple(NewResource("https://test/a"), NewResource("https://test/name"), NewLiteral("A"))
+	graph.AddTriple(NewResource("https://test/b"), NewResource("https://test/name"), NewLiteral("B"))
+	graph.AddTriple(NewResource("https://test/b"), NewResource("https://test/age"), NewLiteral("3"))
+
+	sparql := NewSPARQLUpdate("https://test/")
+	err := sparql.Parse(strings.NewReader(`PREFIX t: <https://test/>
+		DELETE { ?s t:name ?n } INSERT { ?s t:label ?n ; t:seen [ t:by <> ] } WHERE { ?s t:name ?n ; t:age [] }`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(sparql.queries))
+	graph.SPARQLUpdate(sparql)
+
+	assert.Equal(t, 5, graph.Len())
+	assert.Nil(t, graph.One(NewResource("https://test/b"), NewResource("https://test/name"), nil))
+	assert.NotNil(t, graph.One(NewResource("https://test/b"), NewResource("https://test/label"), NewLiteral("B")))
+	assert.NotNil(t, graph.One(NewResource("https://test/a"), NewResource("https://test/name"), NewLiteral("A")))
+	seen := graph.One(NewResource("https://test/b"), NewResource("https://test/seen"), nil)
+	if assert.NotNil(t, seen) {
+		assert.NotNil(t, graph.One(seen.Object, NewResource("https://test/by"), NewResource("https://test/")))
+	}
+}
+
+func TestSPARQLDeleteWhereAndClear(t *testing.T) {
+	graph := NewGraph("https://test/")
+	graph.AddTriple(NewResource("https://test/a"), NewResource("https://test/b"), NewResource("https://test/c"))
+	graph.AddTriple(NewResource("https://test/a"), NewResource("https://test/b"), NewResource("https://test/d"))
+	graph.AddTriple(NewResource("https://test/e"), NewResource("https://test/f"), NewResource("https://test/a"))
+
+	sparql := NewSPARQLUpdate("https://test/")
+	assert.NoError(t, sparql.Parse(strings.NewReader("DELETE WHERE { <a> <b> ?o }")))
+	graph.SPARQLUpdate(sparql)
+	assert.Equal(t, 1, graph.Len())
+
+	sparql = NewSPARQLUpdate("https://test/")
+	assert.NoError(t, sparql.Parse(strings.NewReader("CLEAR SILENT GRAPH <https://test/>")))
+	graph.SPARQLUpdate(sparql)
+	assert.Equal(t, 0, graph.Len())
 }
@@ -0,0 +1,481 @@
+package gold
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// File is an open file of a Storage. It has the methods of *os.File that
+// the server uses, which also makes it a webdav.File.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Readdir(count int) ([]os.FileInfo, error)
+	Stat() (os.FileInfo, error)
+}
+
+// Storage holds the resources of a server. Names are the paths the server
+// derives from Config.DataRoot, with slashes; storages that do not keep a
+// file tree use them as keys. Like the os package, a Storage reports missing
+// files with errors for which os.IsNotExist holds.
+type Storage interface {
+	Stat(name string) (os.FileInfo, error)
+	// OpenFile opens a file for reading, writing or both, with the flags
+	// of os.OpenFile
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	// ReadDir lists a directory, sorted by name
+	ReadDir(name string) ([]os.FileInfo, error)
+	// Remove deletes a file or an empty directory
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	MkdirAll(name string, perm os.FileMode) error
+}
+
+// FileStorage keeps resources in the local file system, which is what a
+// server uses unless told otherwise
+type FileStorage struct{}
+
+// Stat calls os.Stat
+func (FileStorage) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// OpenFile calls os.OpenFile
+func (FileStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ReadDir calls ioutil.ReadDir
+func (FileStorage) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+// Remove calls os.Remove
+func (FileStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Rename calls os.Rename
+func (FileStorage) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+// MkdirAll calls os.MkdirAll
+func (FileStorage) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+// readStorageFile returns the contents of a file, like ioutil.ReadFile
+func readStorageFile(st Storage, name string) ([]byte, error) {
+	f, err := st.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// writeStorageFile replaces the contents of a file, like ioutil.WriteFile
+// but atomically
+func writeStorageFile(st Storage, name string, data []byte, perm os.FileMode) error {
+	return writeStorageAtomic(st, name, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeStorageGraph replaces a file with a graph serialized as mime
+func writeStorageGraph(st Storage, name string, g *Graph, mime string) error {
+	return writeStorageAtomic(st, name, 0644, func(w io.Writer) error {
+		return g.WriteFile(w, mime)
+	})
+}
+
+// tempPrefix starts the names of the files that are being written, before
+// they are renamed into place
+const tempPrefix = ".tmp-"
+
+// isTempFile reports whether a file name is that of a file being written,
+// or of one left behind by a crash
+func isTempFile(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), tempPrefix)
+}
+
+// syncer is a file that can be flushed to stable storage, like *os.File
+type syncer interface {
+	Sync() error
+}
+
+// writeStorageAtomic replaces a file with what fn writes. fn writes to a new
+// file in the same directory, which is synced and renamed over the file once
+// fn succeeds, so that readers and crashes never see half a file. If fn or
+// any step fails the file is left untouched.
+func writeStorageAtomic(st Storage, name string, perm os.FileMode, fn func(w io.Writer) error) error {
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(name), tempPrefix+id)
+	f, err := st.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	err = fn(f)
+	if sf, ok := f.(syncer); ok && err == nil {
+		err = sf.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = st.Rename(tmp, name)
+	}
+	if err != nil {
+		st.Remove(tmp)
+	}
+	return err
+}
+
+// walkStorage calls fn for root and everything under it, like filepath.Walk
+func walkStorage(st Storage, root string, fn filepath.WalkFunc) error {
+	info, err := st.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return walkStorageInfo(st, root, info, fn)
+}
+
+func walkStorageInfo(st Storage, name string, info os.FileInfo, fn filepath.WalkFunc) error {
+	err := fn(name, info, nil)
+	if err != nil {
+		if info.IsDir() && err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	infos, err := st.ReadDir(name)
+	if err != nil {
+		return fn(name, info, err)
+	}
+	for _, child := range infos {
+		err = walkStorageInfo(st, filepath.Join(name, child.Name()), child, fn)
+		if err != nil && err != filepath.SkipDir {
+			return err
+		}
+	}
+	return nil
+}
+
+// globStorage returns the files matching a pattern, like filepath.Glob, for
+// patterns with wildcards in their last element only
+func globStorage(st Storage, pattern string) ([]string, error) {
+	dir, file := filepath.Split(pattern)
+	if _, err := filepath.Match(file, ""); err != nil {
+		return nil, err
+	}
+	infos, err := st.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, nil
+	}
+	var matches []string
+	for _, info := range infos {
+		if ok, _ := filepath.Match(file, info.Name()); ok {
+			matches = append(matches, dir+info.Name())
+		}
+	}
+	return matches, nil
+}
+
+// removeStorageAll deletes a file, or a directory and everything under it
+func removeStorageAll(st Storage, name string) error {
+	info, err := st.Stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		infos, err := st.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, child := range infos {
+			if err = removeStorageAll(st, filepath.Join(name, child.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return st.Remove(name)
+}
+
+// typeByContent sniffs the contents of a stored file
+func (s *Server) typeByContent(name string) (string, error) {
+	f, err := s.Storage.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return typeOfFile(f)
+}
+
+// webdavFS serves the server's storage to the WebDAV handler. WebDAV names
+// are the URL paths of the resources, below the data root of the host.
+type webdavFS struct {
+	s    *Server
+	root string
+	// listing leaves the ,acl, ,meta and ,type files and the hidden files
+	// out of directory listings, and the resources that acl does not let
+	// the user read
+	listing bool
+	acl     *WAC
+	base    string
+}
+
+func (fs webdavFS) resolve(name string) string {
+	root := fs.root
+	if len(root) == 0 {
+		root = "."
+	}
+	return filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+func (fs webdavFS) isRoot(name string) bool {
+	return fs.resolve(name) == filepath.Clean(fs.resolve("/"))
+}
+
+func (fs webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	file := fs.resolve(name)
+	if _, err := fs.s.Storage.Stat(file); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if info, err := fs.s.Storage.Stat(filepath.Dir(file)); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrInvalid}
+	}
+	return fs.s.Storage.MkdirAll(file, perm)
+}
+
+func (fs webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := fs.s.Storage.OpenFile(fs.resolve(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &webdavFile{File: f, fs: fs, name: name}, nil
+}
+
+func (fs webdavFS) RemoveAll(ctx context.Context, name string) error {
+	if fs.isRoot(name) {
+		return os.ErrInvalid
+	}
+	return removeStorageAll(fs.s.Storage, fs.resolve(name))
+}
+
+func (fs webdavFS) Rename(ctx context.Context, oldName, newName string) error {
+	if fs.isRoot(oldName) || fs.isRoot(newName) {
+		return os.ErrInvalid
+	}
+	return fs.s.Storage.Rename(fs.resolve(oldName), fs.resolve(newName))
+}
+
+func (fs webdavFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := fs.s.Storage.Stat(fs.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+	return webdavInfo{info, fs, fs.resolve(name)}, nil
+}
+
+// infosByName sorts directory listings
+type infosByName []os.FileInfo
+
+func (s infosByName) Len() int           { return len(s) }
+func (s infosByName) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
+func (s infosByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// fileInfo describes the files of storages without a file system
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+// contentFile is an open regular file of a storage that keeps the contents
+// of a file in memory while it is open. The storage is told of every write
+// and decides what Close does with the contents.
+type contentFile struct {
+	data    []byte
+	off     int64
+	flag    int
+	info    func(size int64) os.FileInfo
+	onWrite func([]byte)
+	onClose func([]byte) error
+	closed  bool
+}
+
+func (f *contentFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, os.ErrPermission
+	}
+	if f.off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *contentFile) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, os.ErrPermission
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.data))
+	}
+	if end := f.off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	copy(f.data[f.off:], p)
+	f.off += int64(len(p))
+	if f.onWrite != nil {
+		f.onWrite(f.data)
+	}
+	return len(p), nil
+}
+
+func (f *contentFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *contentFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *contentFile) Stat() (os.FileInfo, error) {
+	return f.info(int64(len(f.data))), nil
+}
+
+func (f *contentFile) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	if f.onClose != nil {
+		return f.onClose(f.data)
+	}
+	return nil
+}
+
+// dirFile is an open directory of a storage
+type dirFile struct {
+	info  os.FileInfo
+	list  func() ([]os.FileInfo, error)
+	infos []os.FileInfo
+	seen  int
+}
+
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: d.info.Name(), Err: os.ErrInvalid}
+}
+
+func (d *dirFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: d.info.Name(), Err: os.ErrInvalid}
+}
+
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.infos, d.seen = nil, 0
+		return 0, nil
+	}
+	return 0, os.ErrInvalid
+}
+
+func (d *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if d.infos == nil {
+		infos, err := d.list()
+		if err != nil {
+			return nil, err
+		}
+		d.infos = infos
+	}
+	infos := d.infos[d.seen:]
+	if count <= 0 {
+		d.seen += len(infos)
+		return infos, nil
+	}
+	if len(infos) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(infos) {
+		count = len(infos)
+	}
+	d.seen += count
+	return infos[:count], nil
+}
+
+func (d *dirFile) Stat() (os.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+// sortInfos sorts a directory listing by name
+func sortInfos(infos []os.FileInfo) []os.FileInfo {
+	sort.Sort(infosByName(infos))
+	return infos
+}
+
+// cleanName turns the name of a file into the key storages that are not
+// backed by a file system keep it under
+func cleanName(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+// hasPathPrefix reports whether key is dir or lies under it
+func hasPathPrefix(key, dir string) bool {
+	return key == dir || dir == "/" || strings.HasPrefix(key, dir+"/")
+}
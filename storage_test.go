@@ -0,0 +1,184 @@
+package gold
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/drewolson/testflight"
+	"github.com/stretchr/testify/assert"
+)
+
+// mapKV is a KeyValueStore in a map
+type mapKV map[string][]byte
+
+func (kv mapKV) Get(key string) ([]byte, error) {
+	value, ok := kv[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (kv mapKV) Put(key string, value []byte) error {
+	kv[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (kv mapKV) Delete(key string) error {
+	delete(kv, key)
+	return nil
+}
+
+func (kv mapKV) Keys(prefix string) ([]string, error) {
+	var keys []string
+	for key := range kv {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func testStorage(t *testing.T, st Storage, root string) {
+	dir := filepath.Join(root, "a", "b")
+	assert.NoError(t, st.MkdirAll(dir, 0755))
+	info, err := st.Stat(dir)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	_, err = st.Stat(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = st.OpenFile(filepath.Join(root, "c", "d"), os.O_CREATE|os.O_WRONLY, 0644)
+	assert.True(t, os.IsNotExist(err))
+
+	file := filepath.Join(dir, "doc")
+	assert.NoError(t, writeStorageFile(st, file, []byte("hello"), 0644))
+	data, err := readStorageFile(st, file)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	info, err = st.Stat(file)
+	assert.NoError(t, err)
+	assert.False(t, info.IsDir())
+	assert.Equal(t, int64(5), info.Size())
+	assert.Equal(t, "doc", info.Name())
+
+	f, err := st.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	f.Write([]byte(" world"))
+	assert.NoError(t, f.Close())
+	data, _ = readStorageFile(st, file)
+	assert.Equal(t, "hello world", string(data))
+
+	// a failed write leaves the file as it was, and no temporary file behind
+	err = writeStorageAtomic(st, file, 0644, func(w io.Writer) error {
+		w.Write([]byte("garbage"))
+		return errors.New("serialization failed")
+	})
+	assert.EqualError(t, err, "serialization failed")
+	data, _ = readStorageFile(st, file)
+	assert.Equal(t, "hello world", string(data))
+
+	assert.NoError(t, writeStorageFile(st, filepath.Join(dir, "another"), nil, 0644))
+	infos, err := st.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, "another", infos[0].Name())
+		assert.Equal(t, "doc", infos[1].Name())
+	}
+	infos, err = st.ReadDir(filepath.Join(root, "a"))
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 1) {
+		assert.True(t, infos[0].IsDir())
+	}
+
+	f, err = st.OpenFile(dir, os.O_RDONLY, 0)
+	assert.NoError(t, err)
+	infos, err = f.Readdir(1)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+	f.Close()
+
+	assert.Error(t, st.Remove(dir))
+	assert.NoError(t, st.Rename(filepath.Join(root, "a"), filepath.Join(root, "e")))
+	_, err = st.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	data, err = readStorageFile(st, filepath.Join(root, "e", "b", "doc"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	size, err := diskUsage(st, filepath.Join(root, "e", "b"))
+	assert.NoError(t, err)
+	assert.True(t, size >= 11)
+
+	assert.NoError(t, removeStorageAll(st, filepath.Join(root, "e")))
+	_, err = st.Stat(filepath.Join(root, "e"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileStorage(t *testing.T) {
+	root, err := ioutil.TempDir("", "gold")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	testStorage(t, FileStorage{}, root)
+}
+
+func TestMemStorage(t *testing.T) {
+	testStorage(t, NewMemStorage(), "/data")
+}
+
+func TestBlobStorage(t *testing.T) {
+	kv := mapKV{}
+	testStorage(t, NewBlobStorage(kv), "/data")
+	_, ok := kv["/data/"]
+	assert.True(t, ok)
+	assert.Len(t, kv, 1)
+}
+
+func TestServerMemStorage(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	assert.NoError(t, s.Storage.MkdirAll(config.DataRoot, 0755))
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		request, _ := http.NewRequest("PUT", "/dir/doc", strings.NewReader("<#a> <#b> <#c> ."))
+		request.Header.Add("Content-Type", "text/turtle")
+		response := r.Do(request)
+		assert.Equal(t, 201, response.StatusCode)
+
+		request, _ = http.NewRequest("GET", "/dir/doc", nil)
+		request.Header.Add("Accept", "application/n-triples")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, response.Body, "/dir/doc#c> .")
+
+		request, _ = http.NewRequest("GET", "/dir/", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, response.Body, "<doc>")
+
+		request, _ = http.NewRequest("MOVE", "/dir/doc", nil)
+		request.Header.Add("Destination", "http://"+r.Url("/dir/moved"))
+		response = r.Do(request)
+		assert.Equal(t, 201, response.StatusCode)
+
+		request, _ = http.NewRequest("DELETE", "/dir/moved", nil)
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+	})
+	_, err := os.Stat("/pod")
+	assert.True(t, os.IsNotExist(err))
+	infos, err := s.Storage.ReadDir("/pod/dir")
+	assert.NoError(t, err)
+	assert.Empty(t, infos)
+}
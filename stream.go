@@ -0,0 +1,269 @@
+package gold
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TripleReader reads the statements of an RDF document one at a time
+type TripleReader interface {
+	// Read returns the next triple of the document, or io.EOF once the
+	// document is exhausted
+	Read() (*Triple, error)
+}
+
+// TripleWriter writes an RDF document one statement at a time
+type TripleWriter interface {
+	Write(triple *Triple) error
+	// Close completes the document; it does not close the underlying writer
+	Close() error
+}
+
+// tripleReaders holds the parsers that read statement by statement, in
+// constant memory
+var tripleReaders = map[string]func(io.Reader) TripleReader{
+	"ntriples": func(r io.Reader) TripleReader { return newNTriplesReader(r, false) },
+	"nquads":   func(r io.Reader) TripleReader { return newNTriplesReader(r, true) },
+}
+
+// tripleWriters holds the serializers that write statement by statement
+var tripleWriters = map[string]func(io.Writer, string) TripleWriter{
+	"ntriples": newNTriplesWriter,
+	"nquads":   newNTriplesWriter,
+	"turtle":   newTurtleStreamWriter,
+}
+
+func mimeName(mime string, names map[string]string) string {
+	return names[strings.TrimSpace(strings.Split(mime, ";")[0])]
+}
+
+// streamable reports whether documents of type from can be converted to
+// type to one statement at a time
+func streamable(from, to string) bool {
+	_, ok := tripleReaders[mimeName(from, mimeParser)]
+	if !ok {
+		return false
+	}
+	_, ok = tripleWriters[mimeName(to, mimeSerializer)]
+	return ok
+}
+
+// NewTripleReader returns a reader for a document of the given type, with
+// relative IRIs resolved against base. N-Triples and N-Quads are read a line
+// at a time (the graph names of N-Quads are dropped); other formats have to
+// be parsed in full before the first triple is returned.
+func NewTripleReader(r io.Reader, mime string, base string) (TripleReader, error) {
+	if newReader, ok := tripleReaders[mimeName(mime, mimeParser)]; ok {
+		return newReader(r), nil
+	}
+	g := NewGraph(base)
+	if err := g.parse(r, mime, base); err != nil {
+		return nil, err
+	}
+	gr := &graphReader{}
+	for triple := range g.IterTriples() {
+		gr.triples = append(gr.triples, triple)
+	}
+	return gr, nil
+}
+
+// NewTripleWriter returns a writer for a document of the given type, with
+// IRIs made relative to base where the format allows it. N-Triples, N-Quads
+// and Turtle are written as the triples come, without sorting or nesting;
+// other formats are buffered until the writer is closed.
+func NewTripleWriter(w io.Writer, mime string, base string) (TripleWriter, error) {
+	mime = strings.TrimSpace(strings.Split(mime, ";")[0])
+	if newWriter, ok := tripleWriters[mimeSerializer[mime]]; ok {
+		return newWriter(w, base), nil
+	}
+	if _, ok := rdfSerializers[mimeSerializer[mime]]; !ok && mime != "application/ld+json" {
+		return nil, errors.New("no RDF serializer available for " + mime)
+	}
+	return &graphWriter{w: w, mime: mime, g: NewGraph(base)}, nil
+}
+
+// CopyTriples writes every triple read from r to w, until r is exhausted,
+// and returns how many were copied. It does not close w.
+func CopyTriples(w TripleWriter, r TripleReader) (int, error) {
+	n := 0
+	for {
+		triple, err := r.Read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err = w.Write(triple); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func (nr *ntriplesReader) Read() (*Triple, error) {
+	triple, _, err := nr.next()
+	return triple, err
+}
+
+// graphReader returns the triples of a graph parsed in full
+type graphReader struct {
+	triples []*Triple
+}
+
+func (gr *graphReader) Read() (*Triple, error) {
+	if len(gr.triples) == 0 {
+		return nil, io.EOF
+	}
+	triple := gr.triples[0]
+	gr.triples = gr.triples[1:]
+	return triple, nil
+}
+
+// graphWriter collects the triples in a graph and serializes it on Close
+type graphWriter struct {
+	w    io.Writer
+	mime string
+	g    *Graph
+}
+
+func (gw *graphWriter) Write(triple *Triple) error {
+	gw.g.Add(triple)
+	return nil
+}
+
+func (gw *graphWriter) Close() error {
+	return gw.g.serialize(gw.w, gw.mime)
+}
+
+type ntriplesWriter struct {
+	w *bufio.Writer
+}
+
+func newNTriplesWriter(w io.Writer, base string) TripleWriter {
+	return &ntriplesWriter{w: bufio.NewWriter(w)}
+}
+
+func (nw *ntriplesWriter) Write(triple *Triple) error {
+	_, err := fmt.Fprintln(nw.w, triple.String())
+	return err
+}
+
+func (nw *ntriplesWriter) Close() error {
+	return nw.w.Flush()
+}
+
+// turtleStreamWriter writes Turtle as the triples come, grouping the
+// consecutive triples of a subject. Only the rdf prefix is declared, since
+// the declarations have to precede the first statement.
+type turtleStreamWriter struct {
+	tw      *turtleWriter
+	w       *bufio.Writer
+	subject Term
+}
+
+func newTurtleStreamWriter(w io.Writer, base string) TripleWriter {
+	return &turtleStreamWriter{tw: newTurtleWriter(w, base), w: bufio.NewWriter(w)}
+}
+
+func (ts *turtleStreamWriter) Write(triple *Triple) error {
+	switch {
+	case ts.subject == nil:
+		ts.w.WriteString("@prefix rdf: <" + escapeIRI(string(ns.rdf)) + "> .\n\n")
+		ts.w.WriteString(ts.tw.term(triple.Subject))
+	case ts.subject.Equal(triple.Subject):
+		ts.w.WriteString(" ;")
+	default:
+		ts.w.WriteString(" .\n\n" + ts.tw.term(triple.Subject))
+	}
+	ts.subject = triple.Subject
+	ts.w.WriteString("\n    ")
+	if triple.Predicate.Equal(ns.rdf.Get("type")) {
+		ts.w.WriteString("a")
+	} else {
+		ts.w.WriteString(ts.tw.term(triple.Predicate))
+	}
+	_, err := ts.w.WriteString(" " + ts.tw.term(triple.Object))
+	return err
+}
+
+func (ts *turtleStreamWriter) Close() error {
+	if ts.subject == nil {
+		ts.w.WriteString("@prefix rdf: <" + escapeIRI(string(ns.rdf)) + "> .\n\n")
+	} else {
+		ts.w.WriteString(" .\n\n")
+	}
+	return ts.w.Flush()
+}
+
+// streamFile answers a GET for a file stored as N-Triples one statement at a
+// time. It writes nothing and reports false when the file does not start
+// with an N-Triples statement, e.g. when it was stored as Turtle.
+func (s *Server) streamFile(w http.ResponseWriter, resource *pathInfo, mime string) bool {
+	f, err := s.Storage.OpenFile(resource.File, os.O_RDONLY, 0)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	tr, err := NewTripleReader(f, "application/n-triples", resource.URI)
+	if err != nil {
+		return false
+	}
+	first, err := tr.Read()
+	if err != nil {
+		return false
+	}
+	tw, err := NewTripleWriter(w, mime, resource.URI)
+	if err != nil {
+		return false
+	}
+	w.Header().Set(HCType, mime)
+	w.WriteHeader(200)
+	if err = tw.Write(first); err == nil {
+		_, err = CopyTriples(tw, tr)
+	}
+	if err != nil {
+		// the status line is gone, all we can do is cut the document short
+		s.debug.Println("GET streaming err: " + err.Error())
+	}
+	if err = tw.Close(); err != nil {
+		s.debug.Println("GET streaming err: " + err.Error())
+	}
+	return true
+}
+
+// putStream stores an N-Triples or N-Quads body as N-Triples, one statement
+// at a time, and returns the number of triples stored. The file is only
+// replaced once the body has been read in full, so that a syntax error
+// leaves the old content in place.
+func (s *Server) putStream(resource *pathInfo, body io.Reader, mime string) (int, int, error) {
+	tr, err := NewTripleReader(body, mime, resource.URI)
+	if err != nil {
+		return 0, 400, err
+	}
+	n, status := 0, 500
+	err = writeStorageAtomic(s.Storage, resource.File, 0644, func(w io.Writer) error {
+		tw, err := NewTripleWriter(w, "application/n-triples", resource.URI)
+		if err != nil {
+			return err
+		}
+		if n, err = CopyTriples(tw, tr); err != nil {
+			status = 400
+			return err
+		}
+		if err = tw.Close(); err != nil {
+			return err
+		}
+		// the body parsed, so the current state is kept before it is replaced
+		return s.snapshot(resource)
+	})
+	if err != nil {
+		return n, status, err
+	}
+	return n, 200, nil
+}
@@ -0,0 +1,67 @@
+package gold
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTripleReaderWriter(t *testing.T) {
+	r, err := NewTripleReader(strings.NewReader(`<https://test.org/doc#a> <https://test.org/doc#p> "x" .
+
+<https://test.org/doc#a> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <https://test.org/doc#C> .
+_:b0 <https://test.org/doc#p> "1"^^<http://www.w3.org/2001/XMLSchema#integer> <https://test.org/g> .
+`), "application/n-quads", "https://test.org/doc")
+	assert.NoError(t, err)
+	buf := new(bytes.Buffer)
+	w, err := NewTripleWriter(buf, "text/turtle", "https://test.org/doc")
+	assert.NoError(t, err)
+	n, err := CopyTriples(w, r)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 3, n)
+	assert.Equal(t, `@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .
+
+<#a>
+    <#p> "x" ;
+    a <#C> .
+
+_:b0
+    <#p> 1 .
+
+`, buf.String())
+
+	r, err = NewTripleReader(strings.NewReader("<https://test.org/a> <https://test.org/p> \"x\" .\n<https://test.org/a> \"p\" \"y\" .\n"), "application/n-triples", "https://test.org/doc")
+	assert.NoError(t, err)
+	triple, err := r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, NewLiteral("x"), triple.Object)
+	_, err = r.Read()
+	assert.Error(t, err)
+}
+
+func TestTripleReaderWriterBuffered(t *testing.T) {
+	// Turtle is read, and JSON-LD written, in full
+	r, err := NewTripleReader(strings.NewReader(`<#a> <#p> [ <#q> "x" ] .`), "text/turtle", "https://test.org/doc")
+	assert.NoError(t, err)
+	buf := new(bytes.Buffer)
+	w, err := NewTripleWriter(buf, "application/ld+json", "https://test.org/doc")
+	assert.NoError(t, err)
+	n, err := CopyTriples(w, r)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+	assert.Empty(t, buf.String())
+	assert.NoError(t, w.Close())
+
+	g := NewGraph("https://test.org/doc")
+	g.Parse(buf, "application/ld+json")
+	assert.Equal(t, 2, g.Len())
+
+	_, err = NewTripleWriter(buf, "text/plain", "https://test.org/doc")
+	assert.Error(t, err)
+}
@@ -10,7 +10,6 @@ import (
 	"net/http"
 	"os"
 	_path "path"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -86,7 +85,7 @@ func sendRecoveryToken(w http.ResponseWriter, req *httpRequest, s *Server) Syste
 	resource, _ = s.pathInfo(resource.Base)
 	email := ""
 	kb := NewGraph(resource.AclURI)
-	kb.ReadFile(resource.AclFile)
+	kb.readStorage(s.Storage, resource.AclFile)
 	// find the policy containing root acl
 	for range kb.All(nil, ns.acl.Get("accessTo"), NewResource(resource.AclURI)) {
 		for _, t := range kb.All(nil, ns.acl.Get("agent"), nil) {
@@ -194,7 +193,7 @@ func newAccount(w http.ResponseWriter, req *httpRequest, s *Server) SystemReturn
 		}
 
 		s.debug.Println("Checking if account profile <" + resource.File + "> exists...")
-		stat, err := os.Stat(resource.File)
+		stat, err := s.Storage.Stat(resource.File)
 		if err != nil {
 			s.debug.Println("Stat error: " + err.Error())
 		}
@@ -215,22 +214,14 @@ func newAccount(w http.ResponseWriter, req *httpRequest, s *Server) SystemReturn
 		g := NewWebIDProfile(account)
 
 		// create account space
-		err = os.MkdirAll(_path.Dir(resource.File), 0755)
+		err = s.Storage.MkdirAll(_path.Dir(resource.File), 0755)
 		if err != nil {
 			s.debug.Println("MkdirAll error: " + err.Error())
 			return SystemReturn{Status: 500, Body: err.Error()}
 		}
 
-		// open WebID profile file
-		f, err := os.OpenFile(resource.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-		if err != nil {
-			s.debug.Println("Open profile error: " + err.Error())
-			return SystemReturn{Status: 500, Body: err.Error()}
-		}
-		defer f.Close()
-
 		// write WebID profile to disk
-		err = g.WriteFile(f, "text/turtle")
+		err = writeStorageGraph(s.Storage, resource.File, g, "text/turtle")
 		if err != nil {
 			s.debug.Println("Saving profile error: " + err.Error())
 			return SystemReturn{Status: 500, Body: err.Error()}
@@ -251,16 +242,8 @@ func newAccount(w http.ResponseWriter, req *httpRequest, s *Server) SystemReturn
 		g.AddTriple(readAllTerm, ns.acl.Get("accessTo"), NewResource(webidURL))
 		g.AddTriple(readAllTerm, ns.acl.Get("agentClass"), ns.foaf.Get("Agent"))
 		g.AddTriple(readAllTerm, ns.acl.Get("mode"), ns.acl.Get("Read"))
-		// open profile acl file
-		f, err = os.OpenFile(resource.AclFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-		if err != nil {
-			s.debug.Println("Open profile acl error: " + err.Error())
-			return SystemReturn{Status: 500, Body: err.Error()}
-		}
-		defer f.Close()
-
 		// write profile acl to disk
-		err = g.WriteFile(f, "text/turtle")
+		err = writeStorageGraph(s.Storage, resource.AclFile, g, "text/turtle")
 		if err != nil {
 			s.debug.Println("Saving profile acl error: " + err.Error())
 			return SystemReturn{Status: 500, Body: err.Error()}
@@ -268,7 +251,7 @@ func newAccount(w http.ResponseWriter, req *httpRequest, s *Server) SystemReturn
 	} else {
 		// just create account space
 		s.debug.Println("Creating account dir: " + accountRoot)
-		err := os.MkdirAll(accountRoot, 0755)
+		err := s.Storage.MkdirAll(accountRoot, 0755)
 		if err != nil {
 			s.debug.Println("[newAccount] MkdirAll error: " + err.Error())
 			return SystemReturn{Status: 500, Body: err.Error()}
@@ -296,16 +279,8 @@ func newAccount(w http.ResponseWriter, req *httpRequest, s *Server) SystemReturn
 	g.AddTriple(aclTerm, ns.acl.Get("mode"), ns.acl.Get("Read"))
 	g.AddTriple(aclTerm, ns.acl.Get("mode"), ns.acl.Get("Write"))
 	g.AddTriple(aclTerm, ns.acl.Get("mode"), ns.acl.Get("Control"))
-	// open account acl file
-	f, err := os.OpenFile(resource.AclFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-	if err != nil {
-		s.debug.Println("Create account acl error: " + err.Error())
-		return SystemReturn{Status: 500, Body: err.Error()}
-	}
-	defer f.Close()
-
 	// write account acl to disk
-	err = g.WriteFile(f, "text/turtle")
+	err := writeStorageGraph(s.Storage, resource.AclFile, g, "text/turtle")
 	if err != nil {
 		s.debug.Println("Saving account acl error: " + err.Error())
 		return SystemReturn{Status: 500, Body: err.Error()}
@@ -410,7 +385,7 @@ func accountStatus(w http.ResponseWriter, req *httpRequest, s *Server) SystemRet
 	resource, _ = s.pathInfo(accURL)
 
 	s.debug.Println("Checking if account <" + accReq.AccountName + "> exists...")
-	stat, err := os.Stat(resource.File)
+	stat, err := s.Storage.Stat(resource.File)
 	if err != nil {
 		s.debug.Println("Stat error: " + err.Error())
 	}
@@ -438,7 +413,7 @@ func accountStatus(w http.ResponseWriter, req *httpRequest, s *Server) SystemRet
 
 func accountInfo(w http.ResponseWriter, req *httpRequest, s *Server) SystemReturn {
 	resource, _ := s.pathInfo(req.BaseURI())
-	totalSize, err := DiskUsage(resource.Root)
+	totalSize, err := diskUsage(s.Storage, resource.Root)
 	if err != nil {
 		return SystemReturn{Status: 500, Body: err.Error()}
 	}
@@ -456,6 +431,11 @@ func accountInfo(w http.ResponseWriter, req *httpRequest, s *Server) SystemRetur
 
 // DiskUsage returns the total size occupied by dir and contents
 func DiskUsage(dirPath string) (int64, error) {
+	return diskUsage(FileStorage{}, dirPath)
+}
+
+// diskUsage returns the total size occupied by a stored dir and contents
+func diskUsage(st Storage, dirPath string) (int64, error) {
 	var totalSize int64
 	walkpath := func(path string, f os.FileInfo, err error) error {
 		if err == nil && f != nil {
@@ -463,6 +443,6 @@ func DiskUsage(dirPath string) (int64, error) {
 		}
 		return err
 	}
-	err := filepath.Walk(dirPath, walkpath)
+	err := walkStorage(st, dirPath, walkpath)
 	return totalSize, err
 }
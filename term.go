@@ -109,7 +109,9 @@ func (term Literal) String() (str string) {
 	return str
 }
 
-// Equal returns whether this literal is equivalent to another.
+// Equal returns whether this literal is the same RDF term as another, by
+// lexical form, language and datatype, as graphs identify literals.
+// SameValue compares literals by value instead.
 func (term Literal) Equal(other Term) bool {
 	spec, ok := other.(*Literal)
 	if !ok {
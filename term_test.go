@@ -2,6 +2,7 @@ package gold
 
 import (
 	"github.com/stretchr/testify/assert"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -60,3 +61,74 @@ func TestBNodeEqual(t *testing.T) {
 	id3 := NewBlankNode("n2")
 	assert.False(t, id1.Equal(id3))
 }
+
+func TestLiteralValueEqual(t *testing.T) {
+	xsd := func(name string) Term { return NewResource("http://www.w3.org/2001/XMLSchema#" + name) }
+	for _, pair := range [][2]Term{
+		{NewLiteralWithDatatype("1", xsd("int")), NewLiteralWithDatatype("01", xsd("integer"))},
+		{NewLiteralWithDatatype("1.50", xsd("decimal")), NewLiteralWithDatatype("+1.5", xsd("decimal"))},
+		{NewLiteralWithDatatype("2", xsd("integer")), NewLiteralWithDatatype("2.0", xsd("decimal"))},
+		{NewLiteralWithDatatype("1e2", xsd("double")), NewLiteralWithDatatype("100.0", xsd("double"))},
+		{NewLiteralWithDatatype("1", xsd("boolean")), NewLiteralWithDatatype("true", xsd("boolean"))},
+		{NewLiteralWithDatatype("2020-01-01T12:00:00Z", xsd("dateTime")), NewLiteralWithDatatype("2020-01-01T13:00:00+01:00", xsd("dateTime"))},
+		{NewLiteralWithDatatype("2020-01-01", xsd("date")), NewLiteralWithDatatype("2020-01-01Z", xsd("date"))},
+		{NewLiteralWithDatatype("0aff", xsd("hexBinary")), NewLiteralWithDatatype("0AFF", xsd("hexBinary"))},
+	} {
+		assert.True(t, SameValue(pair[0], pair[1]), pair[0].String())
+		assert.True(t, SameValue(pair[1], pair[0]), pair[1].String())
+		// as RDF terms they differ, as they do in graphs
+		assert.False(t, pair[0].Equal(pair[1]), pair[0].String())
+		assert.NotEqual(t, termKey(pair[0]), termKey(pair[1]))
+	}
+	for _, pair := range [][2]Term{
+		{NewLiteralWithDatatype("1", xsd("integer")), NewLiteralWithDatatype("1e0", xsd("double"))},
+		{NewLiteralWithDatatype("1", xsd("integer")), NewLiteralWithDatatype("1", xsd("boolean"))},
+		{NewLiteralWithDatatype("1", xsd("integer")), NewLiteral("1")},
+		{NewLiteralWithDatatype("x", xsd("integer")), NewLiteralWithDatatype("1", xsd("integer"))},
+		{NewLiteralWithDatatype("0aff", xsd("hexBinary")), NewLiteral("0AFF")},
+	} {
+		assert.False(t, SameValue(pair[0], pair[1]), pair[0].String())
+		assert.False(t, SameValue(pair[1], pair[0]), pair[1].String())
+	}
+	// ill-typed literals still equal themselves
+	assert.True(t, SameValue(NewLiteralWithDatatype("x", xsd("integer")), NewLiteralWithDatatype("x", xsd("integer"))))
+
+	// graphs find literals by their lexical form, as Equal compares them
+	g := NewGraph("https://test.org/")
+	k, e := NewResource("#k"), NewResource("#e")
+	g.AddTriple(k, e, NewLiteralWithDatatype("1", xsd("int")))
+	g.AddTriple(k, e, NewLiteralWithDatatype("01", xsd("int")))
+	assert.Equal(t, 2, g.Len())
+	assert.Nil(t, g.One(k, e, NewLiteralWithDatatype("001", xsd("int"))))
+	g.Remove(NewTriple(k, e, NewLiteralWithDatatype("001", xsd("int"))))
+	assert.Equal(t, 2, g.Len())
+	g.Remove(NewTriple(k, e, NewLiteralWithDatatype("01", xsd("int"))))
+	assert.Equal(t, 1, g.Len())
+	for triple := range g.IterTriples() {
+		assert.True(t, triple.Object.Equal(NewLiteralWithDatatype("1", xsd("int"))))
+	}
+	// key values match by value, non-canonical forms included
+	assert.True(t, hasKeyValue(g, k, e, NewLiteralWithDatatype("001", xsd("integer"))))
+	assert.False(t, hasKeyValue(g, k, e, NewLiteralWithDatatype("2", xsd("integer"))))
+}
+
+func TestCompareLiterals(t *testing.T) {
+	xsd := func(name string) Term { return NewResource("http://www.w3.org/2001/XMLSchema#" + name) }
+	c, ok := CompareLiterals(NewLiteralWithDatatype("9", xsd("integer")), NewLiteralWithDatatype("10", xsd("integer")))
+	assert.True(t, ok)
+	assert.Equal(t, -1, c)
+	c, ok = CompareLiterals(NewLiteralWithDatatype("1.5", xsd("decimal")), NewLiteralWithDatatype("1E0", xsd("double")))
+	assert.True(t, ok)
+	assert.Equal(t, 1, c)
+	c, ok = CompareLiterals(NewLiteralWithDatatype("2020-01-01T12:00:00+02:00", xsd("dateTime")), NewLiteralWithDatatype("2020-01-01T11:00:00Z", xsd("dateTime")))
+	assert.True(t, ok)
+	assert.Equal(t, -1, c)
+	_, ok = CompareLiterals(NewLiteralWithDatatype("1", xsd("integer")), NewLiteralWithDatatype("2020-01-01", xsd("date")))
+	assert.False(t, ok)
+	_, ok = CompareLiterals(NewLiteral("1"), NewLiteral("2"))
+	assert.False(t, ok)
+
+	terms := []Term{NewLiteral("a"), NewLiteralWithDatatype("10", xsd("integer")), NewLiteralWithDatatype("9.5", xsd("decimal")), NewLiteralWithDatatype("true", xsd("boolean"))}
+	sort.Sort(termsByKey(terms))
+	assert.Equal(t, []Term{NewLiteralWithDatatype("9.5", xsd("decimal")), NewLiteralWithDatatype("10", xsd("integer")), NewLiteralWithDatatype("true", xsd("boolean")), NewLiteral("a")}, terms)
+}
@@ -0,0 +1,272 @@
+package gold
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	_path "path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrashPrefix is the hidden directory, under the data root of an account,
+// that deleted resources are moved to when the trash is on. Each deletion
+// is kept in a directory of its own, <id>/, next to an <id>.json record of
+// where it came from, until it is restored through the ,system/trash API or
+// has been there for longer than the configured age.
+const TrashPrefix = ",trash"
+
+// trashEntry records a deletion that can still be restored
+type trashEntry struct {
+	ID      string    `json:"id"`
+	URI     string    `json:"uri"`
+	Deleted time.Time `json:"deleted"`
+	Expires time.Time `json:"expires"`
+}
+
+// sidecarSuffixes are the files kept next to a document for its ACL, its
+// metadata and its content type
+var sidecarSuffixes = []string{ACLSuffix, METASuffix, TYPESuffix}
+
+// isEmptyContainer reports whether a directory holds nothing but its own
+// ,acl, ,meta and ,type files, and hidden files
+func isEmptyContainer(st Storage, dir string) (bool, error) {
+	infos, err := st.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, info := range infos {
+		switch name := info.Name(); {
+		case isHiddenFile(name):
+		case name == ACLSuffix || name == METASuffix || name == TYPESuffix:
+		default:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// trashDir is where the trash of the account a resource belongs to is kept
+func trashDir(resource *pathInfo) string {
+	return resource.Root + TrashPrefix
+}
+
+// deleteResource takes a resource out of the tree, with all its contents if
+// it is a container, and with its ,acl, ,meta and ,type files. The resource
+// is moved away first, in a single rename, so that it is never seen with
+// its sidecars gone; the sidecars of a container are inside it and go with
+// it. What was removed is kept in the trash when the trash is on.
+func (s *Server) deleteResource(resource *pathInfo) error {
+	file := strings.TrimSuffix(resource.File, "/")
+	name := _path.Base(file)
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+	stage := resource.Root + tempPrefix + id
+	if s.Config.TrashAge > 0 {
+		stage = trashDir(resource) + "/" + id
+	}
+	if err = s.Storage.MkdirAll(stage, 0755); err != nil {
+		return err
+	}
+	if err = s.Storage.Rename(file, stage+"/"+name); err != nil {
+		removeStorageAll(s.Storage, stage)
+		return err
+	}
+	if !strings.HasSuffix(resource.File, "/") {
+		for _, suffix := range sidecarSuffixes {
+			err = s.Storage.Rename(file+suffix, stage+"/"+name+suffix)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	if s.Config.TrashAge == 0 {
+		return removeStorageAll(s.Storage, stage)
+	}
+	data, err := json.Marshal(trashEntry{ID: id, URI: resource.URI, Deleted: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	if err = writeStorageFile(s.Storage, stage+".json", data, 0644); err != nil {
+		return err
+	}
+	s.purgeTrash(resource)
+	return nil
+}
+
+// trashEntries lists the deletions in the trash of an account, newest first
+func (s *Server) trashEntries(resource *pathInfo) []*trashEntry {
+	infos, err := s.Storage.ReadDir(trashDir(resource))
+	if err != nil {
+		return nil
+	}
+	var entries []*trashEntry
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		if entry := s.trashEntry(resource, strings.TrimSuffix(info.Name(), ".json")); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Deleted.After(entries[j].Deleted)
+	})
+	return entries
+}
+
+// trashEntry returns the record of a deletion in the trash of an account,
+// or nil
+func (s *Server) trashEntry(resource *pathInfo, id string) *trashEntry {
+	if _, err := hex.DecodeString(id); err != nil || len(id) == 0 {
+		return nil
+	}
+	data, err := readStorageFile(s.Storage, trashDir(resource)+"/"+id+".json")
+	if err != nil {
+		return nil
+	}
+	entry := new(trashEntry)
+	if err = json.Unmarshal(data, entry); err != nil || entry.ID != id {
+		return nil
+	}
+	entry.Expires = entry.Deleted.Add(time.Duration(s.Config.TrashAge) * time.Hour)
+	return entry
+}
+
+// removeTrashEntry removes a deletion from the trash, for good
+func (s *Server) removeTrashEntry(resource *pathInfo, id string) error {
+	if err := s.Storage.Remove(trashDir(resource) + "/" + id + ".json"); err != nil {
+		return err
+	}
+	return removeStorageAll(s.Storage, trashDir(resource)+"/"+id)
+}
+
+// purgeTrash removes the deletions that can no longer be restored from the
+// trash of an account
+func (s *Server) purgeTrash(resource *pathInfo) {
+	for _, entry := range s.trashEntries(resource) {
+		if time.Now().After(entry.Expires) {
+			if err := s.removeTrashEntry(resource, entry.ID); err != nil {
+				s.debug.Println("Trash purge err: " + err.Error())
+			}
+		}
+	}
+}
+
+// allowRestore checks that the user may put a deletion back: deleting needed
+// Write, and Control as well for a container that was not empty
+func (s *Server) allowRestore(acl *WAC, resource *pathInfo, entry *trashEntry) (int, error) {
+	aclWrite, err := acl.AllowWrite(entry.URI)
+	if aclWrite > 200 || err != nil {
+		return aclWrite, err
+	}
+	if !strings.HasSuffix(entry.URI, "/") {
+		return 200, nil
+	}
+	dir := trashDir(resource) + "/" + entry.ID + "/"
+	infos, err := s.Storage.ReadDir(dir)
+	if err != nil {
+		return 500, err
+	}
+	if len(infos) != 1 {
+		return 500, errors.New("the trash entry " + entry.ID + " is incomplete")
+	}
+	empty, err := isEmptyContainer(s.Storage, dir+infos[0].Name())
+	if err != nil {
+		return 500, err
+	}
+	if !empty {
+		return acl.AllowControl(entry.URI)
+	}
+	return 200, nil
+}
+
+// handleTrash answers the requests for the trash API: GET lists the
+// deletions in the trash of the account that the user may undo, and a POST
+// with the id of one of them puts the resource back where it was
+func (s *Server) handleTrash(w http.ResponseWriter, req *httpRequest, acl *WAC) *response {
+	r := new(response)
+	if s.Config.TrashAge == 0 {
+		return r.respond(404, Skins["404"])
+	}
+	resource, err := s.pathInfo(req.BaseURI())
+	if err != nil {
+		return r.respond(500, err)
+	}
+	s.purgeTrash(resource)
+
+	switch req.Method {
+	case "GET", "HEAD":
+		entries := []*trashEntry{}
+		for _, entry := range s.trashEntries(resource) {
+			if status, err := s.allowRestore(acl, resource, entry); status == 200 && err == nil {
+				entries = append(entries, entry)
+			}
+		}
+		// the statuses of the ACL checks are not the status of the listing
+		w.Header().Del("WWW-Authenticate")
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return r.respond(500, err)
+		}
+		w.Header().Set(HCType, "application/json")
+		if req.Method == "HEAD" {
+			return r.respond(200)
+		}
+		return r.respond(200, string(data))
+
+	case "POST":
+		entry := s.trashEntry(resource, req.FormValue("id"))
+		if entry == nil {
+			return r.respond(404, Skins["404"])
+		}
+		original, err := s.pathInfo(entry.URI)
+		if err != nil {
+			return r.respond(500, err)
+		}
+		unlock := lock(original.File)
+		defer unlock()
+		status, err := s.allowRestore(acl, resource, entry)
+		if status > 200 || err != nil {
+			return r.respond(status, handleStatusText(status, err))
+		}
+
+		file := strings.TrimSuffix(original.File, "/")
+		name := _path.Base(file)
+		stage := trashDir(resource) + "/" + entry.ID
+		if _, err = s.Storage.Stat(file); err == nil {
+			return r.respond(409, "409 - Conflict! A resource with the same name already exists.")
+		}
+		if err = s.Storage.MkdirAll(_path.Dir(file), 0755); err != nil {
+			s.debug.Println("Trash restore MkdirAll err: " + err.Error())
+			return r.respond(500, err)
+		}
+		for _, suffix := range sidecarSuffixes {
+			// the sidecars go back first, so that the resource never
+			// appears without its ACL
+			err = s.Storage.Rename(stage+"/"+name+suffix, file+suffix)
+			if err != nil && !os.IsNotExist(err) {
+				s.debug.Println("Trash restore Rename err: " + err.Error())
+				return r.respond(500, err)
+			}
+		}
+		if err = s.Storage.Rename(stage+"/"+name, file); err != nil {
+			s.debug.Println("Trash restore Rename err: " + err.Error())
+			return r.respond(500, err)
+		}
+		if err = s.removeTrashEntry(resource, entry.ID); err != nil {
+			s.debug.Println("Trash restore removeTrashEntry err: " + err.Error())
+		}
+		onUpdateURI(original.URI)
+		w.Header().Set("Location", original.URI)
+		return r.respond(201)
+	}
+	w.Header().Set("Allow", "GET, HEAD, POST")
+	return r.respond(405, "405 - Method Not Allowed")
+}
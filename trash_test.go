@@ -0,0 +1,132 @@
+package gold
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewolson/testflight"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecursiveDelete(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll("/pod/dir/sub", 0755)
+	writeStorageFile(s.Storage, "/pod/dir/sub/doc", []byte("<#a> <#b> <#c> ."), 0644)
+	writeStorageFile(s.Storage, "/pod/dir/sub/doc,meta", []byte("<doc> <#b> <#c> ."), 0644)
+	s.Storage.MkdirAll("/pod/empty", 0755)
+	writeStorageFile(s.Storage, "/pod/empty/,meta", []byte("<.> <#b> <#c> ."), 0644)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		request, _ := http.NewRequest("DELETE", "/dir/", nil)
+		assert.Equal(t, 409, r.Do(request).StatusCode)
+		request, _ = http.NewRequest("DELETE", "/dir/sub/doc", nil)
+		assert.Equal(t, 200, r.Do(request).StatusCode)
+		_, err := s.Storage.Stat("/pod/dir/sub/doc,meta")
+		assert.Error(t, err)
+
+		request, _ = http.NewRequest("DELETE", "/empty/", nil)
+		assert.Equal(t, 200, r.Do(request).StatusCode)
+
+		writeStorageFile(s.Storage, "/pod/dir/sub/doc", []byte("<#a> <#b> <#c> ."), 0644)
+		request, _ = http.NewRequest("DELETE", "/dir/", nil)
+		request.Header.Add("Depth", "infinity")
+		assert.Equal(t, 200, r.Do(request).StatusCode)
+		assert.Equal(t, 404, r.Get("/dir/sub/doc").StatusCode)
+		assert.Equal(t, 404, r.Get("/dir/").StatusCode)
+		assert.Equal(t, 404, r.Get("/"+SystemPrefix+"/trash").StatusCode)
+	})
+	infos, err := s.Storage.ReadDir("/pod")
+	assert.NoError(t, err)
+	assert.Empty(t, infos)
+}
+
+func TestTrash(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	config.TrashAge = 1
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll("/pod/dir", 0755)
+	writeStorageFile(s.Storage, "/pod/dir/doc", []byte("<#a> <#b> <#c> ."), 0644)
+	writeStorageFile(s.Storage, "/pod/dir/doc,meta", []byte("<doc> <#b> <#c> ."), 0644)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		entries := func() []trashEntry {
+			var list []trashEntry
+			response := r.Get("/" + SystemPrefix + "/trash")
+			assert.Equal(t, 200, response.StatusCode)
+			assert.NoError(t, json.Unmarshal([]byte(response.Body), &list))
+			return list
+		}
+		restore := func(id string) int {
+			request, _ := http.NewRequest("POST", "/"+SystemPrefix+"/trash", strings.NewReader(url.Values{"id": {id}}.Encode()))
+			request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			return r.Do(request).StatusCode
+		}
+
+		request, _ := http.NewRequest("DELETE", "/dir/doc", nil)
+		assert.Equal(t, 200, r.Do(request).StatusCode)
+		assert.Equal(t, 404, r.Get("/dir/doc").StatusCode)
+		list := entries()
+		if !assert.Len(t, list, 1) {
+			return
+		}
+		assert.Equal(t, "http://"+r.Url("/dir/doc"), list[0].URI)
+		assert.True(t, list[0].Expires.After(time.Now()))
+		assert.Equal(t, 404, r.Get("/"+TrashPrefix+"/"+list[0].ID+"/doc").StatusCode)
+
+		request, _ = http.NewRequest("GET", "/dir/", nil)
+		request.Header.Add("Accept", "text/turtle")
+		assert.NotContains(t, r.Do(request).Body, TrashPrefix)
+
+		assert.Equal(t, 404, restore("0123abcd"))
+		assert.Equal(t, 201, restore(list[0].ID))
+		assert.Equal(t, 200, r.Get("/dir/doc").StatusCode)
+		data, err := readStorageFile(s.Storage, "/pod/dir/doc,meta")
+		assert.NoError(t, err)
+		assert.Equal(t, "<doc> <#b> <#c> .", string(data))
+		assert.Empty(t, entries())
+
+		// restoring does not overwrite what was created since
+		request, _ = http.NewRequest("DELETE", "/dir/doc", nil)
+		assert.Equal(t, 200, r.Do(request).StatusCode)
+		writeStorageFile(s.Storage, "/pod/dir/doc", []byte("<#a> <#b> <#d> ."), 0644)
+		list = entries()
+		if assert.Len(t, list, 1) {
+			assert.Equal(t, 409, restore(list[0].ID))
+			// the trash is not queried either
+			query := "?query=" + url.QueryEscape("SELECT * WHERE { ?s ?p ?o }")
+			assert.Equal(t, 404, r.Get("/"+TrashPrefix+"/"+list[0].ID+"/"+query).StatusCode)
+		}
+		assert.NotEqual(t, "application/json", r.Get("/"+SystemPrefix+"/trashy").RawResponse.Header.Get(HCType))
+
+		// a container deleted with its contents needs Control to come back
+		s.Storage.MkdirAll("/pod/box", 0755)
+		writeStorageFile(s.Storage, "/pod/box/item", []byte("<#a> <#b> <#c> ."), 0644)
+		box, _ := s.pathInfo("http://" + r.Url("/box/"))
+		assert.NoError(t, s.deleteResource(box))
+		writeStorageFile(s.Storage, "/pod/"+ACLSuffix, []byte(`@prefix acl: <http://www.w3.org/ns/auth/acl#> .
+<#rw> acl:accessTo <./> ; acl:defaultForNew <./> ; acl:agentClass <http://xmlns.com/foaf/0.1/Agent> ; acl:mode acl:Read, acl:Write .`), 0644)
+		for _, entry := range s.trashEntries(box) {
+			if entry.URI == box.URI {
+				assert.Equal(t, 401, restore(entry.ID))
+			}
+		}
+		assert.Len(t, entries(), 1)
+		assert.NoError(t, s.Storage.Remove("/pod/"+ACLSuffix))
+
+		// deletions are kept for as long as the configured age
+		old, _ := json.Marshal(trashEntry{ID: "00ff", URI: "http://" + r.Url("/old"), Deleted: time.Now().Add(-2 * time.Hour)})
+		writeStorageFile(s.Storage, "/pod/"+TrashPrefix+"/00ff.json", old, 0644)
+		assert.Len(t, entries(), 2)
+		_, err = s.Storage.Stat("/pod/" + TrashPrefix + "/00ff.json")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,1141 @@
+package gold
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	xsdInteger = "http://www.w3.org/2001/XMLSchema#integer"
+	xsdDecimal = "http://www.w3.org/2001/XMLSchema#decimal"
+	xsdDouble  = "http://www.w3.org/2001/XMLSchema#double"
+	xsdBoolean = "http://www.w3.org/2001/XMLSchema#boolean"
+)
+
+// turtleParser is a recursive descent parser for Turtle documents. The same
+// term syntax is shared by the N-Triples, N-Quads and SPARQL parsers.
+type turtleParser struct {
+	src    string
+	pos    int
+	line   int
+	syntax string
+
+	base     *url.URL
+	prefixes map[string]string
+	// vars allows SPARQL variables (?x, $x) wherever a term is expected
+	vars bool
+	// formula parses an N3 quoted graph in object position, where the
+	// syntax has them
+	formula func() (Term, error)
+
+	emit func(s, p, o Term)
+}
+
+func newTurtleParser(src string, base string, emit func(s, p, o Term)) *turtleParser {
+	p := &turtleParser{
+		src:      src,
+		line:     1,
+		syntax:   "turtle",
+		prefixes: map[string]string{},
+		emit:     emit,
+	}
+	if len(base) > 0 {
+		p.base, _ = url.Parse(base)
+	}
+	return p
+}
+
+func parseTurtle(g *Graph, r io.Reader, base string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	p := newTurtleParser(string(b), base, g.AddTriple)
+	err = p.parse()
+	for prefix, uri := range p.prefixes {
+		g.SetPrefix(prefix, uri)
+	}
+	return err
+}
+
+func (p *turtleParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%s: line %d: %s", p.syntax, p.line, fmt.Sprintf(format, a...))
+}
+
+func (p *turtleParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *turtleParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *turtleParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+// hasKeyword matches a case-insensitive keyword followed by a delimiter
+func (p *turtleParser) hasKeyword(kw string) bool {
+	end := p.pos + len(kw)
+	if end > len(p.src) || !strings.EqualFold(p.src[p.pos:end], kw) {
+		return false
+	}
+	return end == len(p.src) || !isNameChar(rune(p.src[end])) && p.src[end] != ':'
+}
+
+func (p *turtleParser) skipWS() {
+	for !p.eof() {
+		switch c := p.src[p.pos]; c {
+		case '\n':
+			p.line++
+			p.pos++
+		case ' ', '\t', '\r':
+			p.pos++
+		case '#':
+			for !p.eof() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *turtleParser) expect(c byte) error {
+	p.skipWS()
+	if p.peek() != c {
+		if p.eof() {
+			return p.errorf("expected '%c', found end of input", c)
+		}
+		return p.errorf("expected '%c', found '%c'", c, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *turtleParser) parse() error {
+	for {
+		p.skipWS()
+		if p.eof() {
+			return nil
+		}
+		if err := p.statement(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *turtleParser) statement() error {
+	switch {
+	case p.hasPrefix("@prefix"):
+		p.pos += len("@prefix")
+		if err := p.prefixID(); err != nil {
+			return err
+		}
+		return p.expect('.')
+	case p.hasPrefix("@base"):
+		p.pos += len("@base")
+		if err := p.baseDecl(); err != nil {
+			return err
+		}
+		return p.expect('.')
+	case p.hasKeyword("PREFIX"):
+		p.pos += len("PREFIX")
+		return p.prefixID()
+	case p.hasKeyword("BASE"):
+		p.pos += len("BASE")
+		return p.baseDecl()
+	}
+	if err := p.triples(); err != nil {
+		return err
+	}
+	return p.expect('.')
+}
+
+func (p *turtleParser) prefixID() error {
+	p.skipWS()
+	start := p.pos
+	for !p.eof() && p.peek() != ':' && isNameChar(rune(p.peek())) {
+		p.pos++
+	}
+	if p.peek() != ':' {
+		return p.errorf("invalid prefix declaration")
+	}
+	prefix := p.src[start:p.pos]
+	p.pos++
+	p.skipWS()
+	iri, err := p.iriRef()
+	if err != nil {
+		return err
+	}
+	p.prefixes[prefix] = iri
+	return nil
+}
+
+func (p *turtleParser) baseDecl() error {
+	p.skipWS()
+	iri, err := p.iriRef()
+	if err != nil {
+		return err
+	}
+	p.base, err = url.Parse(iri)
+	return err
+}
+
+func (p *turtleParser) triples() error {
+	var (
+		subject Term
+		err     error
+	)
+	p.skipWS()
+	if p.peek() == '[' {
+		subject, err = p.blankNodePropertyList()
+		if err != nil {
+			return err
+		}
+		p.skipWS()
+		if c := p.peek(); c == '.' || c == '}' {
+			return nil
+		}
+	} else {
+		subject, err = p.subject()
+		if err != nil {
+			return err
+		}
+	}
+	return p.predicateObjectList(subject)
+}
+
+func (p *turtleParser) subject() (Term, error) {
+	p.skipWS()
+	switch c := p.peek(); {
+	case p.vars && (c == '?' || c == '$'):
+		return p.variable()
+	case c == '(':
+		return p.collection()
+	case c == '_' && p.hasPrefix("_:"):
+		return p.blankNodeLabel()
+	case c == '"' || c == '\'' || c == '+' || c == '-' || (c >= '0' && c <= '9'):
+		return nil, p.errorf("literals cannot be used as subjects")
+	}
+	return p.iri()
+}
+
+func (p *turtleParser) predicateObjectList(subject Term) error {
+	for {
+		p.skipWS()
+		predicate, err := p.verb()
+		if err != nil {
+			return err
+		}
+		if err = p.objectList(subject, predicate); err != nil {
+			return err
+		}
+		p.skipWS()
+		if p.peek() != ';' {
+			return nil
+		}
+		for p.peek() == ';' {
+			p.pos++
+			p.skipWS()
+		}
+		switch p.peek() {
+		case '.', ']', '}', 0:
+			return nil
+		}
+	}
+}
+
+func (p *turtleParser) verb() (Term, error) {
+	if p.vars && (p.peek() == '?' || p.peek() == '$') {
+		return p.variable()
+	}
+	if p.hasKeyword("a") && p.peek() == 'a' {
+		p.pos++
+		return ns.rdf.Get("type"), nil
+	}
+	return p.iri()
+}
+
+func (p *turtleParser) objectList(subject, predicate Term) error {
+	for {
+		object, err := p.object()
+		if err != nil {
+			return err
+		}
+		p.emit(subject, predicate, object)
+		p.skipWS()
+		if p.peek() != ',' {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *turtleParser) object() (Term, error) {
+	p.skipWS()
+	switch c := p.peek(); {
+	case p.vars && (c == '?' || c == '$'):
+		return p.variable()
+	case c == '[':
+		return p.blankNodePropertyList()
+	case c == '(':
+		return p.collection()
+	case c == '{' && p.formula != nil:
+		return p.formula()
+	case c == '_' && p.hasPrefix("_:"):
+		return p.blankNodeLabel()
+	case c == '"' || c == '\'':
+		return p.rdfLiteral()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.numericLiteral()
+	case p.hasKeyword("true"):
+		p.pos += 4
+		return NewLiteralWithDatatype("true", NewResource(xsdBoolean)), nil
+	case p.hasKeyword("false"):
+		p.pos += 5
+		return NewLiteralWithDatatype("false", NewResource(xsdBoolean)), nil
+	}
+	return p.iri()
+}
+
+func (p *turtleParser) blankNodePropertyList() (Term, error) {
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	node := NewAnonNode()
+	p.skipWS()
+	if p.peek() == ']' {
+		p.pos++
+		return node, nil
+	}
+	if err := p.predicateObjectList(node); err != nil {
+		return nil, err
+	}
+	return node, p.expect(']')
+}
+
+func (p *turtleParser) collection() (Term, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	var head, last Term
+	for {
+		p.skipWS()
+		if p.eof() {
+			return nil, p.errorf("unterminated collection")
+		}
+		if p.peek() == ')' {
+			p.pos++
+			break
+		}
+		item, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		node := NewAnonNode()
+		if head == nil {
+			head = node
+		} else {
+			p.emit(last, ns.rdf.Get("rest"), node)
+		}
+		p.emit(node, ns.rdf.Get("first"), item)
+		last = node
+	}
+	if head == nil {
+		return ns.rdf.Get("nil"), nil
+	}
+	p.emit(last, ns.rdf.Get("rest"), ns.rdf.Get("nil"))
+	return head, nil
+}
+
+func (p *turtleParser) blankNodeLabel() (Term, error) {
+	p.pos += 2
+	start := p.pos
+	for !p.eof() && isNameChar(p.runeAt()) {
+		_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+	}
+	for p.pos > start && p.src[p.pos-1] == '.' {
+		p.pos--
+	}
+	if p.pos == start {
+		return nil, p.errorf("invalid blank node label")
+	}
+	return NewBlankNode(p.src[start:p.pos]), nil
+}
+
+func (p *turtleParser) variable() (Term, error) {
+	p.pos++
+	start := p.pos
+	for !p.eof() && isNameChar(p.runeAt()) && p.peek() != '.' && p.peek() != '-' {
+		_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+	}
+	if p.pos == start {
+		return nil, p.errorf("invalid variable name")
+	}
+	return NewVariable(p.src[start:p.pos]), nil
+}
+
+func (p *turtleParser) runeAt() rune {
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return r
+}
+
+func (p *turtleParser) iri() (Term, error) {
+	p.skipWS()
+	if p.peek() == '<' {
+		iri, err := p.iriRef()
+		if err != nil {
+			return nil, err
+		}
+		return NewResource(iri), nil
+	}
+	return p.prefixedName()
+}
+
+// iriRef reads an <IRI> and resolves it against the current base
+func (p *turtleParser) iriRef() (string, error) {
+	if p.peek() != '<' {
+		return "", p.errorf("expected IRI")
+	}
+	p.pos++
+	var buf []byte
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated IRI")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '>':
+			p.pos++
+			return p.resolve(string(buf)), nil
+		case '\\':
+			r, err := p.unicodeEscape()
+			if err != nil {
+				return "", err
+			}
+			buf = append(buf, string(r)...)
+			continue
+		case ' ', '\n', '"', '{', '}', '|', '^', '`':
+			return "", p.errorf("invalid character in IRI")
+		}
+		buf = append(buf, c)
+		p.pos++
+	}
+}
+
+func (p *turtleParser) resolve(iri string) string {
+	if p.base == nil {
+		return iri
+	}
+	ref, err := url.Parse(iri)
+	if err != nil || ref.IsAbs() {
+		return iri
+	}
+	return resolveReference(p.base, ref, iri)
+}
+
+func (p *turtleParser) prefixedName() (Term, error) {
+	start := p.pos
+	for !p.eof() && p.peek() != ':' && isNameChar(p.runeAt()) {
+		_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+	}
+	if p.peek() != ':' {
+		p.pos = start
+		if p.eof() {
+			return nil, p.errorf("unexpected end of input")
+		}
+		return nil, p.errorf("unexpected character '%c'", p.peek())
+	}
+	prefix := p.src[start:p.pos]
+	ns, ok := p.prefixes[prefix]
+	if !ok {
+		return nil, p.errorf("undefined prefix '%s:'", prefix)
+	}
+	p.pos++
+	var local []byte
+	for !p.eof() {
+		c := p.src[p.pos]
+		if c == '\\' && p.pos+1 < len(p.src) {
+			local = append(local, p.src[p.pos+1])
+			p.pos += 2
+			continue
+		}
+		if c == '%' && p.pos+2 < len(p.src) {
+			local = append(local, p.src[p.pos:p.pos+3]...)
+			p.pos += 3
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !isNameChar(r) && r != ':' {
+			break
+		}
+		local = append(local, p.src[p.pos:p.pos+size]...)
+		p.pos += size
+	}
+	// a trailing dot ends the statement
+	for len(local) > 0 && local[len(local)-1] == '.' {
+		local = local[:len(local)-1]
+		p.pos--
+	}
+	return NewResource(ns + string(local)), nil
+}
+
+func (p *turtleParser) unicodeEscape() (rune, error) {
+	if p.pos+1 >= len(p.src) {
+		return 0, p.errorf("invalid escape sequence")
+	}
+	n := 0
+	switch p.src[p.pos+1] {
+	case 'u':
+		n = 4
+	case 'U':
+		n = 8
+	default:
+		return 0, p.errorf("invalid escape sequence '\\%c'", p.src[p.pos+1])
+	}
+	if p.pos+2+n > len(p.src) {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	v, err := strconv.ParseUint(p.src[p.pos+2:p.pos+2+n], 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	p.pos += 2 + n
+	return rune(v), nil
+}
+
+func (p *turtleParser) rdfLiteral() (Term, error) {
+	value, err := p.quotedString()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == '@' {
+		p.pos++
+		start := p.pos
+		for !p.eof() && (isAlnum(p.peek()) || p.peek() == '-') {
+			p.pos++
+		}
+		if p.pos == start {
+			return nil, p.errorf("invalid language tag")
+		}
+		return NewLiteralWithLanguage(value, p.src[start:p.pos]), nil
+	}
+	if p.hasPrefix("^^") {
+		p.pos += 2
+		datatype, err := p.iri()
+		if err != nil {
+			return nil, err
+		}
+		return NewLiteralWithDatatype(value, datatype), nil
+	}
+	return NewLiteral(value), nil
+}
+
+func (p *turtleParser) quotedString() (string, error) {
+	q := p.peek()
+	long := p.hasPrefix(strings.Repeat(string(q), 3))
+	if long {
+		p.pos += 3
+	} else {
+		p.pos++
+	}
+	var buf []byte
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == q && !long:
+			p.pos++
+			return string(buf), nil
+		case c == q && p.hasPrefix(strings.Repeat(string(q), 3)):
+			p.pos += 3
+			// a long string may end with up to two more quotes
+			for p.peek() == q {
+				buf = append(buf, q)
+				p.pos++
+			}
+			return string(buf), nil
+		case c == '\n' || c == '\r':
+			if !long {
+				return "", p.errorf("line break in short string")
+			}
+			if c == '\n' {
+				p.line++
+			}
+		case c == '\\':
+			if p.pos+1 >= len(p.src) {
+				return "", p.errorf("unterminated string")
+			}
+			var e byte
+			switch p.src[p.pos+1] {
+			case 't':
+				e = '\t'
+			case 'b':
+				e = '\b'
+			case 'n':
+				e = '\n'
+			case 'r':
+				e = '\r'
+			case 'f':
+				e = '\f'
+			case '"', '\'', '\\':
+				e = p.src[p.pos+1]
+			case 'u', 'U':
+				r, err := p.unicodeEscape()
+				if err != nil {
+					return "", err
+				}
+				buf = append(buf, string(r)...)
+				continue
+			default:
+				return "", p.errorf("invalid escape sequence '\\%c'", p.src[p.pos+1])
+			}
+			buf = append(buf, e)
+			p.pos += 2
+			continue
+		}
+		buf = append(buf, c)
+		p.pos++
+	}
+}
+
+func (p *turtleParser) numericLiteral() (Term, error) {
+	start := p.pos
+	if c := p.peek(); c == '+' || c == '-' {
+		p.pos++
+	}
+	datatype := xsdInteger
+	digits := p.digits()
+	if p.peek() == '.' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1]) {
+		p.pos++
+		p.digits()
+		datatype = xsdDecimal
+	} else if digits == 0 && p.peek() != 'e' && p.peek() != 'E' {
+		p.pos = start
+		return nil, p.errorf("invalid numeric literal")
+	}
+	if c := p.peek(); c == 'e' || c == 'E' {
+		p.pos++
+		if c := p.peek(); c == '+' || c == '-' {
+			p.pos++
+		}
+		if p.digits() == 0 {
+			return nil, p.errorf("invalid exponent")
+		}
+		datatype = xsdDouble
+	}
+	return NewLiteralWithDatatype(p.src[start:p.pos], NewResource(datatype)), nil
+}
+
+func (p *turtleParser) digits() int {
+	n := 0
+	for !p.eof() && isDigit(p.peek()) {
+		p.pos++
+		n++
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) || r == 0xB7 || r >= 0x80 && unicode.In(r, unicode.Mn, unicode.Pc)
+}
+
+// turtleWriter serializes a graph the way the Turtle files on disk are laid
+// out: subjects sorted, predicates grouped, IRIs relative to the base or
+// abbreviated with a prefix, and blank nodes nested or given stable labels
+type turtleWriter struct {
+	out  io.Writer
+	body bytes.Buffer
+	w    *bufio.Writer
+	base string
+	dir  string
+	// indent is written before every line, inside TriG graph blocks
+	indent string
+
+	// prefixes maps prefix names to namespaces; the declared ones are
+	// always written out, the others only once used
+	prefixes map[string]string
+	declared map[string]bool
+	used     map[string]bool
+	// labels holds the stable label of each blank node, by original ID
+	labels map[string]string
+
+	// the blank nodes written nested and the collections of the current graph
+	inline  map[string]bool
+	lists   map[string][]Term
+	members map[string]bool
+}
+
+func newTurtleWriter(w io.Writer, base string) *turtleWriter {
+	tw := &turtleWriter{
+		out:      w,
+		base:     defrag(base),
+		prefixes: map[string]string{"rdf": string(ns.rdf)},
+		declared: map[string]bool{"rdf": true},
+		used:     map[string]bool{},
+	}
+	tw.w = bufio.NewWriter(&tw.body)
+	if i := strings.LastIndex(tw.base, "/"); i >= 0 {
+		tw.dir = tw.base[:i+1]
+	}
+	return tw
+}
+
+func serializeTurtle(w io.Writer, g *Graph) error {
+	tw := newTurtleWriter(w, g.uri)
+	tw.usePrefixes(g)
+	tw.label(graphQuads(g, nil))
+	tw.graph(g)
+	return tw.flush()
+}
+
+// usePrefixes takes the declared and well-known prefixes of the graph
+func (tw *turtleWriter) usePrefixes(g *Graph) {
+	for prefix, uri := range g.wellKnown {
+		if len(uri) > 0 && len(tw.prefixes[prefix]) == 0 {
+			tw.prefixes[prefix] = uri
+		}
+	}
+	for prefix, uri := range g.prefixes {
+		tw.prefixes[prefix] = uri
+		tw.declared[prefix] = true
+	}
+}
+
+// label gives the blank nodes their canonical labels, so that they do not
+// change from one write to the next
+func (tw *turtleWriter) label(quads []quad) {
+	labels, err := newCanonicalizer(quads).labels()
+	if err != nil {
+		return
+	}
+	tw.labels = make(map[string]string, len(labels))
+	for id, label := range labels {
+		tw.labels[id] = "b" + strings.TrimPrefix(label, "c14n")
+	}
+}
+
+func (tw *turtleWriter) relabel(t Term) Term {
+	if bn, ok := t.(*BlankNode); ok {
+		if label, ok := tw.labels[bn.ID]; ok {
+			return NewBlankNode(label)
+		}
+	}
+	return t
+}
+
+// flush writes the prefix declarations, followed by the statements
+func (tw *turtleWriter) flush() error {
+	if err := tw.w.Flush(); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(tw.prefixes))
+	for prefix := range tw.prefixes {
+		if tw.declared[prefix] || tw.used[prefix] {
+			names = append(names, prefix)
+		}
+	}
+	sort.Strings(names)
+	out := bufio.NewWriter(tw.out)
+	for _, prefix := range names {
+		out.WriteString("@prefix " + prefix + ": <" + escapeIRI(tw.prefixes[prefix]) + "> .\n")
+	}
+	out.WriteString("\n")
+	out.Write(tw.body.Bytes())
+	return out.Flush()
+}
+
+func (tw *turtleWriter) graph(g *Graph) {
+	if len(tw.labels) > 0 {
+		relabelled := NewGraph(g.uri)
+		for triple := range g.IterTriples() {
+			relabelled.AddTriple(tw.relabel(triple.Subject), triple.Predicate, tw.relabel(triple.Object))
+		}
+		g = relabelled
+	}
+	tw.lists, tw.members = wellFormedLists(g)
+
+	// blank nodes used once are nested where they are used, unless that
+	// would nest them in themselves
+	refs := map[string]int{}
+	subjects := map[string]Term{}
+	for triple := range g.IterTriples() {
+		if _, ok := triple.Object.(*BlankNode); ok {
+			refs[termKey(triple.Object)]++
+		}
+		subjects[termKey(triple.Subject)] = triple.Subject
+	}
+	tw.inline = map[string]bool{}
+	for key := range refs {
+		if refs[key] == 1 && !tw.members[key] {
+			tw.inline[key] = true
+		}
+	}
+	var top []Term
+	for _, key := range sortedKeys(subjects) {
+		if !tw.inline[key] && !tw.members[key] {
+			top = append(top, subjects[key])
+		}
+	}
+	for {
+		reached := map[string]bool{}
+		for _, s := range top {
+			tw.reach(g, s, reached)
+		}
+		var cut Term
+		for _, key := range sortedKeys(subjects) {
+			if tw.inline[key] && !reached[key] {
+				cut = subjects[key]
+				break
+			}
+		}
+		if cut == nil {
+			break
+		}
+		delete(tw.inline, termKey(cut))
+		top = append(top, cut)
+	}
+	sort.Sort(termsByKey(top))
+
+	for _, s := range top {
+		tw.w.WriteString(tw.indent + tw.term(s))
+		tw.predicates(g, s, tw.indent+"    ")
+		tw.w.WriteString(" .\n\n")
+	}
+}
+
+// reach marks the blank nodes nested under s
+func (tw *turtleWriter) reach(g *Graph, s Term, reached map[string]bool) {
+	for _, triple := range g.All(s, nil, nil) {
+		if key := termKey(triple.Object); (tw.inline[key] || tw.members[key]) && !reached[key] {
+			reached[key] = true
+			tw.reach(g, triple.Object, reached)
+		}
+	}
+}
+
+func (tw *turtleWriter) predicates(g *Graph, s Term, indent string) {
+	predicates := map[string][]Term{}
+	terms := map[string]Term{}
+	for _, triple := range g.All(s, nil, nil) {
+		key := termKey(triple.Predicate)
+		terms[key] = triple.Predicate
+		predicates[key] = append(predicates[key], triple.Object)
+	}
+	keys := sortedKeys(terms)
+	for i, key := range keys {
+		tw.w.WriteString("\n" + indent)
+		if terms[key].Equal(ns.rdf.Get("type")) {
+			tw.w.WriteString("a")
+		} else {
+			tw.w.WriteString(tw.term(terms[key]))
+		}
+		objects := predicates[key]
+		sort.Sort(termsByKey(objects))
+		for j, o := range objects {
+			if j > 0 {
+				tw.w.WriteString(",")
+			}
+			tw.w.WriteString(" ")
+			tw.object(g, o, indent)
+		}
+		if i < len(keys)-1 {
+			tw.w.WriteString(" ;")
+		}
+	}
+}
+
+func (tw *turtleWriter) object(g *Graph, o Term, indent string) {
+	key := termKey(o)
+	switch {
+	case o.Equal(ns.rdf.Get("nil")):
+		tw.w.WriteString("()")
+	case tw.lists[key] != nil:
+		tw.w.WriteString("(")
+		for _, item := range tw.lists[key] {
+			tw.w.WriteString(" ")
+			tw.object(g, item, indent)
+		}
+		tw.w.WriteString(" )")
+	case tw.inline[key]:
+		if len(g.All(o, nil, nil)) == 0 {
+			tw.w.WriteString("[]")
+			return
+		}
+		tw.w.WriteString("[")
+		tw.predicates(g, o, indent+"    ")
+		tw.w.WriteString("\n" + indent + "]")
+	default:
+		tw.w.WriteString(tw.term(o))
+	}
+}
+
+func (tw *turtleWriter) term(t Term) string {
+	switch t := t.(type) {
+	case *Resource:
+		if rel := tw.relative(t.URI); rel != t.URI {
+			return "<" + escapeIRI(rel) + ">"
+		}
+		if name, ok := tw.prefixed(t.URI); ok {
+			return name
+		}
+		return "<" + escapeIRI(t.URI) + ">"
+	case *BlankNode:
+		return "_:" + blankLabel(t.ID)
+	case *Literal:
+		if len(t.Language) == 0 && shortLiteral(t) {
+			return t.Value
+		}
+		str := quoteLiteral(t.Value)
+		if len(t.Language) > 0 {
+			str += "@" + t.Language
+		} else if t.Datatype != nil {
+			str += "^^" + tw.term(t.Datatype)
+		}
+		return str
+	}
+	return ""
+}
+
+// shortLiteral reports whether a literal can be written as a bare number or
+// boolean, which reads back with the same datatype
+func shortLiteral(l *Literal) bool {
+	switch termValue(l.Datatype) {
+	case xsdInteger:
+		return integerLexical.MatchString(l.Value)
+	case xsdDecimal:
+		return decimalLexical.MatchString(l.Value) && strings.Contains(l.Value, ".") && !strings.HasSuffix(l.Value, ".")
+	case xsdDouble:
+		return doubleLexical.MatchString(l.Value) && strings.ContainsAny(l.Value, "eE") && !strings.Contains(l.Value, ".e") && !strings.Contains(l.Value, ".E")
+	case xsdBoolean:
+		return l.Value == "true" || l.Value == "false"
+	}
+	return false
+}
+
+// prefixed abbreviates an IRI with the prefix of the longest namespace it
+// starts with, preferring declared prefixes and then shorter names
+func (tw *turtleWriter) prefixed(iri string) (string, bool) {
+	best := ""
+	for prefix, uri := range tw.prefixes {
+		if len(uri) == 0 || !strings.HasPrefix(iri, uri) || !isLocalName(iri[len(uri):]) {
+			continue
+		}
+		if len(best) > 0 {
+			bu := tw.prefixes[best]
+			switch {
+			case len(uri) != len(bu):
+				if len(uri) < len(bu) {
+					continue
+				}
+			case tw.declared[prefix] != tw.declared[best]:
+				if !tw.declared[prefix] {
+					continue
+				}
+			case len(prefix) != len(best):
+				if len(prefix) > len(best) {
+					continue
+				}
+			case prefix > best:
+				continue
+			}
+		}
+		best = prefix
+	}
+	if len(best) == 0 {
+		return "", false
+	}
+	tw.used[best] = true
+	return best + ":" + iri[len(tw.prefixes[best]):], true
+}
+
+// isLocalName reports whether s can be written as the local part of a
+// prefixed name without escapes
+func isLocalName(s string) bool {
+	for i, r := range s {
+		if !isNameChar(r) && r != ':' || i == 0 && (r == '-' || r == '.') {
+			return false
+		}
+	}
+	return !strings.HasSuffix(s, ".")
+}
+
+// relative returns the shortest form of an IRI that resolves to the same IRI
+// against the writer's base, or the IRI itself if no shorter form does
+func (tw *turtleWriter) relative(iri string) string {
+	if rel := tw.shorten(iri); rel != iri && resolveIRI(tw.base, rel) == iri {
+		return rel
+	}
+	return iri
+}
+
+// shorten strips the base, or the directory of the base, from an IRI
+func (tw *turtleWriter) shorten(iri string) string {
+	if len(tw.base) == 0 {
+		return iri
+	}
+	if iri == tw.base {
+		return ""
+	}
+	if strings.HasPrefix(iri, tw.base+"#") {
+		return iri[len(tw.base):]
+	}
+	if len(tw.dir) > 0 && strings.HasPrefix(iri, tw.dir) {
+		rel := iri[len(tw.dir):]
+		if len(rel) == 0 {
+			return "./"
+		}
+		// a colon in the first segment would make it look like a scheme
+		if i := strings.IndexAny(rel, ":/?#"); i >= 0 && rel[i] == ':' {
+			return "./" + rel
+		}
+		if rel[0] == '?' {
+			return iri
+		}
+		return rel
+	}
+	return iri
+}
+
+func escapeIRI(iri string) string {
+	if !strings.ContainsAny(iri, "<>\"{}|^`\\ ") {
+		return iri
+	}
+	buf := make([]byte, 0, len(iri))
+	for _, r := range iri {
+		if strings.ContainsRune("<>\"{}|^`\\ ", r) {
+			buf = append(buf, fmt.Sprintf("\\u%04X", r)...)
+		} else {
+			buf = append(buf, string(r)...)
+		}
+	}
+	return string(buf)
+}
+
+func quoteLiteral(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	s = strings.Replace(s, "\n", "\\n", -1)
+	s = strings.Replace(s, "\r", "\\r", -1)
+	s = strings.Replace(s, "\t", "\\t", -1)
+	return "\"" + s + "\""
+}
+
+// blankLabel makes sure a blank node ID can be written as a label
+func blankLabel(id string) string {
+	valid := len(id) > 0
+	for i, r := range id {
+		if !isNameChar(r) || (i == 0 && (r == '-' || r == '.')) || (i == len(id)-1 && r == '.') {
+			valid = false
+			break
+		}
+	}
+	if valid {
+		return id
+	}
+	buf := make([]byte, 0, len(id)+1)
+	buf = append(buf, 'b')
+	for _, r := range id {
+		if isAlnum(byte(r)) && r < utf8.RuneSelf {
+			buf = append(buf, byte(r))
+		} else {
+			buf = append(buf, fmt.Sprintf("x%X", r)...)
+		}
+	}
+	return string(buf)
+}
+
+// termLess orders terms by kind (resources, literals, blank nodes) and then
+// by value, which is the order serializers write them in
+func termLess(a, b Term) bool {
+	ka, kb := termKind(a), termKind(b)
+	if ka != kb {
+		return ka < kb
+	}
+	switch a := a.(type) {
+	case *Resource:
+		return a.URI < b.(*Resource).URI
+	case *BlankNode:
+		return a.ID < b.(*BlankNode).ID
+	case *Literal:
+		// typed literals come first, ordered by value
+		l := b.(*Literal)
+		va, typedA := parseTypedLiteral(a)
+		vb, typedB := parseTypedLiteral(l)
+		if typedA != typedB {
+			return typedA
+		}
+		if typedA {
+			if fa, fb := valueFamily(va), valueFamily(vb); fa != fb {
+				return fa < fb
+			}
+			if c, ok := va.compare(vb); ok && c != 0 {
+				return c < 0
+			}
+		}
+		if a.Value != l.Value {
+			return a.Value < l.Value
+		}
+		if a.Language != l.Language {
+			return a.Language < l.Language
+		}
+		return termKey(a) < termKey(l)
+	}
+	return false
+}
+
+func termKind(t Term) int {
+	switch t.(type) {
+	case *Resource:
+		return 0
+	case *Literal:
+		return 1
+	}
+	return 2
+}
+
+type termsByKey []Term
+
+func (t termsByKey) Len() int           { return len(t) }
+func (t termsByKey) Less(i, j int) bool { return termLess(t[i], t[j]) }
+func (t termsByKey) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// sortedKeys returns the keys of a term map in term order
+func sortedKeys(m map[string]Term) []string {
+	terms := make([]Term, 0, len(m))
+	for _, t := range m {
+		terms = append(terms, t)
+	}
+	sort.Sort(termsByKey(terms))
+	keys := make([]string, len(terms))
+	for i, t := range terms {
+		keys[i] = termKey(t)
+	}
+	return keys
+}
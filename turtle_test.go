@@ -0,0 +1,193 @@
+package gold
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTurtle(t *testing.T) {
+	g := NewGraph("https://test/dir/doc")
+	g.Parse(strings.NewReader(`
+@prefix foaf: <http://xmlns.com/foaf/0.1/> .
+PREFIX ex: <http://example.org/>
+<#me> a foaf:Person ;
+    foaf:name "Alice"@en, """multi
+line""" ;
+    foaf:age 42 ;
+    foaf:knows [ foaf:name "Bob" ] ;
+    ex:list ( 1 2 ) ;
+    ex:flag true .
+`), "text/turtle")
+	me := NewResource("https://test/dir/doc#me")
+	assert.NotNil(t, g.One(me, ns.rdf.Get("type"), NewResource("http://xmlns.com/foaf/0.1/Person")))
+	assert.NotNil(t, g.One(me, nil, NewLiteralWithLanguage("Alice", "en")))
+	assert.NotNil(t, g.One(me, nil, NewLiteral("multi\nline")))
+	assert.NotNil(t, g.One(me, nil, NewLiteralWithDatatype("42", NewResource(xsdInteger))))
+	assert.NotNil(t, g.One(me, nil, NewLiteralWithDatatype("true", NewResource(xsdBoolean))))
+	assert.NotNil(t, g.One(nil, NewResource("http://xmlns.com/foaf/0.1/name"), NewLiteral("Bob")))
+	assert.Equal(t, 2, len(g.All(nil, ns.rdf.Get("first"), nil)))
+}
+
+func TestParseTurtleError(t *testing.T) {
+	g := NewGraph("https://test/")
+	err := g.parse(strings.NewReader(`<a> <b> "c`), "text/turtle", g.URI())
+	assert.Error(t, err)
+}
+
+func TestTurtleRoundTrip(t *testing.T) {
+	g := NewGraph("https://test/")
+	g.AddTriple(NewResource("https://test/a"), ns.rdf.Get("type"), NewResource("https://test/T"))
+	g.AddTriple(NewResource("https://test/a"), NewResource("https://test/b"), NewLiteral("say \"hi\"\n"))
+	g.AddTriple(NewResource("https://test/a"), NewResource("https://test/b"), NewLiteralWithLanguage("x", "en"))
+	g.AddTriple(NewBlankNode("n0"), NewResource("https://test/c"), NewResource("https://other/d"))
+	buf, err := g.Serialize("text/turtle")
+	assert.Nil(t, err)
+	assert.Contains(t, buf, "<a>\n    a <T> ;\n")
+
+	g2 := NewGraph("https://test/")
+	g2.Parse(strings.NewReader(buf), "text/turtle")
+	assert.Equal(t, g.Len(), g2.Len())
+	assert.NotNil(t, g2.One(NewResource("https://test/a"), nil, NewLiteral("say \"hi\"\n")))
+	assert.NotNil(t, g2.One(nil, NewResource("https://test/c"), NewResource("https://other/d")))
+}
+
+func TestNTriplesRoundTrip(t *testing.T) {
+	src := "<http://a/s> <http://a/p> \"o\"@en .\n_:b0 <http://a/p> <http://a/o> .\n"
+	g := NewGraph("http://a/")
+	g.Parse(strings.NewReader(src), "application/n-triples")
+	assert.Equal(t, 2, g.Len())
+	buf, err := g.Serialize("application/n-triples")
+	assert.Nil(t, err)
+	assert.Equal(t, src, buf)
+}
+
+func TestParseNQuads(t *testing.T) {
+	g := NewGraph("http://a/")
+	g.Parse(strings.NewReader("<http://a/s> <http://a/p> <http://a/o> <http://a/g> .\n"), "application/n-quads")
+	assert.Equal(t, 1, g.Len())
+}
+
+func TestRDFXMLRoundTrip(t *testing.T) {
+	g := NewGraph("http://a/doc")
+	g.Parse(strings.NewReader(`<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:ex="http://example.org/">
+  <ex:Thing rdf:about="#s" ex:name="S">
+    <ex:knows rdf:resource="http://a/o"/>
+    <ex:age rdf:datatype="http://www.w3.org/2001/XMLSchema#integer">3</ex:age>
+    <ex:label xml:lang="en">hello</ex:label>
+  </ex:Thing>
+</rdf:RDF>`), "application/rdf+xml")
+	s := NewResource("http://a/doc#s")
+	assert.Equal(t, 5, g.Len())
+	assert.NotNil(t, g.One(s, ns.rdf.Get("type"), NewResource("http://example.org/Thing")))
+	assert.NotNil(t, g.One(s, nil, NewLiteralWithLanguage("hello", "en")))
+
+	buf, err := g.Serialize("application/rdf+xml")
+	assert.Nil(t, err)
+	g2 := NewGraph("http://a/doc")
+	g2.Parse(strings.NewReader(buf), "application/rdf+xml")
+	assert.Equal(t, g.Len(), g2.Len())
+	assert.NotNil(t, g2.One(s, nil, NewLiteralWithDatatype("3", NewResource(xsdInteger))))
+}
+
+func TestSerializeTurtleStable(t *testing.T) {
+	src := `@prefix ex: <http://example.org/> .
+<#a> ex:knows [ ex:name "B" ; ex:knows [] ] ;
+    ex:list ( "x" [ ex:name "C" ] ) ;
+    ex:shared _:s .
+<#b> ex:shared _:s .
+_:s ex:name "S" .
+`
+	var outs []string
+	for i := 0; i < 2; i++ {
+		g := NewGraph("https://test.org/doc")
+		g.Parse(strings.NewReader(src), "text/turtle")
+		out, err := g.Serialize("text/turtle")
+		assert.NoError(t, err)
+		outs = append(outs, out)
+	}
+	assert.Equal(t, outs[0], outs[1])
+	assert.Equal(t, `@prefix ex: <http://example.org/> .
+@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .
+
+<#a>
+    ex:knows [
+        ex:knows [] ;
+        ex:name "B"
+    ] ;
+    ex:list ( "x" [
+        ex:name "C"
+    ] ) ;
+    ex:shared _:b2 .
+
+<#b>
+    ex:shared _:b2 .
+
+_:b2
+    ex:name "S" .
+
+`, outs[0])
+}
+
+func TestSerializeTurtleRelative(t *testing.T) {
+	g := NewGraph("http://x/profile/card")
+	g.AddTriple(NewResource("http://x/profile/#me"), NewResource("http://x/p"), NewResource("http://x/profile//b"))
+	g.AddTriple(NewResource("http://x/profile/card#me"), NewResource("http://x/p"), NewResource("http://x/profile/other"))
+	g.AddTriple(NewResource("http://x/profile/card#"), NewResource("http://x/p"), NewResource("http://x/profile/card"))
+	out, err := g.Serialize("text/turtle")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "<http://x/profile/#me>")
+	assert.Contains(t, out, "<http://x/profile//b>")
+	assert.Contains(t, out, "<#me>")
+	assert.Contains(t, out, "<other>")
+	assert.Contains(t, out, "<#>")
+
+	g2 := NewGraph("http://x/profile/card")
+	assert.NoError(t, g2.parse(strings.NewReader(out), "text/turtle", g2.URI()))
+	assert.Equal(t, 3, g2.Len())
+	assert.NotNil(t, g2.One(NewResource("http://x/profile/#me"), nil, NewResource("http://x/profile//b")))
+	assert.NotNil(t, g2.One(NewResource("http://x/profile/card#"), nil, NewResource("http://x/profile/card")))
+}
+
+func TestSerializeTurtlePrefixes(t *testing.T) {
+	g := NewGraph("https://test.org/doc")
+	g.AddTriple(NewResource("https://test.org/doc#me"), ns.rdf.Get("type"), ns.foaf.Get("Person"))
+	out, err := g.Serialize("text/turtle")
+	assert.NoError(t, err)
+	assert.Equal(t, "@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .\n\n<#me>\n    a <http://xmlns.com/foaf/0.1/Person> .\n\n", out)
+
+	// well-known prefixes are only declared when used
+	g.UsePrefixes(wellKnownPrefixes())
+	out, err = g.Serialize("text/turtle")
+	assert.NoError(t, err)
+	assert.Equal(t, "@prefix foaf: <http://xmlns.com/foaf/0.1/> .\n@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .\n\n<#me>\n    a foaf:Person .\n\n", out)
+
+	// declared prefixes are kept, and win over well-known ones
+	g.SetPrefix("f", string(ns.foaf))
+	g.SetPrefix("unused", "http://example.org/")
+	out, err = g.Serialize("text/turtle")
+	assert.NoError(t, err)
+	assert.Equal(t, "@prefix f: <http://xmlns.com/foaf/0.1/> .\n@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .\n@prefix unused: <http://example.org/> .\n\n<#me>\n    a f:Person .\n\n", out)
+
+	g = NewGraph("https://test.org/doc")
+	g.Parse(strings.NewReader("@prefix ex: <http://example.org/> .\n<#me> ex:p <http://example.org/a/b> .\n"), "text/turtle")
+	assert.Equal(t, map[string]string{"ex": "http://example.org/"}, g.Prefixes())
+	out, err = g.Serialize("text/turtle")
+	assert.NoError(t, err)
+	assert.Equal(t, "@prefix ex: <http://example.org/> .\n@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .\n\n<#me>\n    ex:p <http://example.org/a/b> .\n\n", out)
+}
+
+func TestSerializeTurtleTypedLiterals(t *testing.T) {
+	g := NewGraph("https://test.org/doc")
+	g.Parse(strings.NewReader(`<#a> <#p> 10, 9, 1.5, -2.0E3, true, "1."^^<http://www.w3.org/2001/XMLSchema#decimal>, "x"^^<http://www.w3.org/2001/XMLSchema#integer> .`), "text/turtle")
+	out, err := g.Serialize("text/turtle")
+	assert.NoError(t, err)
+	assert.Equal(t, `@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .
+
+<#a>
+    <#p> -2.0E3, "1."^^<http://www.w3.org/2001/XMLSchema#decimal>, 1.5, 9, 10, true, "x"^^<http://www.w3.org/2001/XMLSchema#integer> .
+
+`, out)
+}
@@ -0,0 +1,298 @@
+package gold
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	_path "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionsPrefix is the hidden directory, under the data root, in which the
+// past versions of resources are kept when versioning is on. Its URIs are
+// those of the TimeMaps (<base>/,versions/<path>) and of the mementos
+// (<base>/,versions/<path>/<datetime>) of RFC 7089.
+const VersionsPrefix = ",versions"
+
+// linkFormatMime is the media type of TimeMaps
+const linkFormatMime = "application/link-format"
+
+// isHiddenFile reports whether a file is kept out of container listings and
+// queries: the versions area, the trash, and files that are still being
+// written
+func isHiddenFile(name string) bool {
+	return name == VersionsPrefix || name == TrashPrefix || isTempFile(name)
+}
+
+// isHiddenPath reports whether a path lies in one of the hidden areas, or is
+// one of them
+func isHiddenPath(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if isHiddenFile(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionName names a version after the time it was last modified at, so
+// that the names sort by time
+func versionName(t time.Time) string {
+	t = t.UTC()
+	return t.Format("20060102T150405") + fmt.Sprintf("%09d", t.Nanosecond()) + "Z"
+}
+
+// parseVersionName returns the time a version was last modified at
+func parseVersionName(name string) (time.Time, bool) {
+	if len(name) != 25 || name[24] != 'Z' {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("20060102T150405", name[:15])
+	if err != nil {
+		return time.Time{}, false
+	}
+	ns, err := strconv.Atoi(name[15:24])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.Add(time.Duration(ns)), true
+}
+
+// versionsDir is where the versions of a resource are kept
+func (s *Server) versionsDir(resource *pathInfo) string {
+	return resource.Root + VersionsPrefix + "/" + strings.TrimSuffix(resource.Path, "/")
+}
+
+// timeMapURI is the URI of the TimeMap of a resource
+func timeMapURI(resource *pathInfo) string {
+	return resource.Base + "/" + VersionsPrefix + "/" + strings.TrimSuffix(resource.Path, "/")
+}
+
+// versions lists the names of the kept versions of a resource, oldest first
+func (s *Server) versions(resource *pathInfo) []string {
+	infos, err := s.Storage.ReadDir(s.versionsDir(resource))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, info := range infos {
+		if _, ok := parseVersionName(info.Name()); ok && !info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// snapshot keeps the current state of a resource as a version, once it is
+// known to be changed or deleted. Containers and missing resources have nothing to keep.
+func (s *Server) snapshot(resource *pathInfo) error {
+	if !s.Config.Versioning || len(resource.Path) == 0 {
+		return nil
+	}
+	stat, err := s.Storage.Stat(resource.File)
+	if os.IsNotExist(err) || (err == nil && stat.IsDir()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	dir := s.versionsDir(resource)
+	if err = s.Storage.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// writes within the clock's resolution leave the same time, so a later
+	// version is named a nanosecond after the one it would replace
+	t := stat.ModTime()
+	version := dir + "/" + versionName(t)
+	for {
+		if _, err = s.Storage.Stat(version); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+		t = t.Add(time.Nanosecond)
+		version = dir + "/" + versionName(t)
+	}
+	if err = s.copyFile(resource.File, version); err != nil {
+		return err
+	}
+	return s.writeTypeFile(version+TYPESuffix, resource.FileType)
+}
+
+// copyFile replaces the file to with a copy of from
+func (s *Server) copyFile(from, to string) error {
+	src, err := s.Storage.OpenFile(from, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return writeStorageAtomic(s.Storage, to, 0644, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+}
+
+// memento returns a version of a resource to serve in place of the resource
+func (s *Server) memento(resource *pathInfo, name string) *pathInfo {
+	m := *resource
+	m.File = s.versionsDir(resource) + "/" + name
+	m.TypeFile = m.File + TYPESuffix
+	m.Version = name
+	m.FileType = s.readTypeFile(m.TypeFile)
+	if len(m.FileType) == 0 {
+		m.FileType, _ = s.TypeDetector.TypeByFile(m.File)
+	}
+	return &m
+}
+
+// versionLinks sets the Memento headers of a resource, or of one of its
+// versions
+func (s *Server) versionLinks(w http.ResponseWriter, resource *pathInfo) {
+	if !s.Config.Versioning || len(resource.Path) == 0 || strings.HasSuffix(resource.Path, "/") {
+		return
+	}
+	w.Header().Add("Link", brack(resource.URI)+"; rel=\"original timegate\"")
+	w.Header().Add("Link", brack(timeMapURI(resource))+"; rel=\"timemap\"; type=\""+linkFormatMime+"\"")
+	w.Header().Add("Vary", "Accept-Datetime")
+	if t, ok := parseVersionName(resource.Version); ok {
+		w.Header().Set("Memento-Datetime", t.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Location", timeMapURI(resource)+"/"+resource.Version)
+	}
+}
+
+// timeMap lists the versions of a resource in the link format of RFC 7089
+func (s *Server) timeMap(resource *pathInfo, names []string) string {
+	links := []string{
+		brack(resource.URI) + ";rel=\"original timegate\"",
+		brack(timeMapURI(resource)) + ";rel=\"self\";type=\"" + linkFormatMime + "\"",
+	}
+	for i, name := range names {
+		t, _ := parseVersionName(name)
+		var rel []string
+		if i == 0 {
+			rel = append(rel, "first")
+		}
+		if i == len(names)-1 {
+			rel = append(rel, "last")
+		}
+		rel = append(rel, "memento")
+		links = append(links, brack(timeMapURI(resource)+"/"+name)+";rel=\""+strings.Join(rel, " ")+"\";datetime=\""+t.UTC().Format(http.TimeFormat)+"\"")
+	}
+	return strings.Join(links, ",\n") + "\n"
+}
+
+// negotiateVersion picks the version of a resource that was current at the
+// time asked for in an Accept-Datetime header. The resource itself is
+// returned when it is still current at that time or has no versions, and the
+// oldest version for times before it.
+func (s *Server) negotiateVersion(resource *pathInfo, at time.Time) *pathInfo {
+	if stat, err := s.Storage.Stat(resource.File); err == nil && !stat.ModTime().Truncate(time.Second).After(at) {
+		return resource
+	}
+	names := s.versions(resource)
+	if len(names) == 0 {
+		return resource
+	}
+	i := sort.Search(len(names), func(i int) bool {
+		t, _ := parseVersionName(names[i])
+		return t.Truncate(time.Second).After(at)
+	})
+	if i > 0 {
+		i--
+	}
+	return s.memento(resource, names[i])
+}
+
+// handleVersion answers the requests for the URIs of the versions area,
+// and those that carry an Accept-Datetime header. It returns the resource
+// that a GET or HEAD should serve, or the response to give instead.
+func (s *Server) handleVersion(w http.ResponseWriter, req *httpRequest, acl *WAC, resource *pathInfo) (*pathInfo, *response) {
+	r := new(response)
+	rest := strings.TrimPrefix(req.URL.Path, "/"+VersionsPrefix)
+	if len(rest) == len(req.URL.Path) || (len(rest) > 0 && rest[0] != '/') {
+		if datetime := req.Header.Get("Accept-Datetime"); len(datetime) > 0 && s.Config.Versioning &&
+			(req.Method == "GET" || req.Method == "HEAD") {
+			at, err := http.ParseTime(datetime)
+			if err != nil {
+				return nil, r.respond(400, "400 - Invalid Accept-Datetime: "+datetime)
+			}
+			return s.negotiateVersion(resource, at), nil
+		}
+		return resource, nil
+	}
+	if !s.Config.Versioning {
+		return nil, r.respond(404, Skins["404"])
+	}
+
+	rest = strings.Trim(rest, "/")
+	name := ""
+	if _, ok := parseVersionName(_path.Base(rest)); ok {
+		rest, name = _path.Dir(rest), _path.Base(rest)
+	}
+	original, err := s.pathInfo(resource.Base + "/" + rest)
+	if err != nil || len(rest) == 0 || rest == "." {
+		return nil, r.respond(404, Skins["404"])
+	}
+	names := s.versions(original)
+	if len(name) > 0 {
+		found := false
+		for _, n := range names {
+			found = found || n == name
+		}
+		if !found {
+			return nil, r.respond(404, Skins["404"])
+		}
+	}
+
+	switch {
+	case req.Method == "GET" || req.Method == "HEAD":
+		if len(name) > 0 {
+			return s.memento(original, name), nil
+		}
+		if len(names) == 0 {
+			return nil, r.respond(404, Skins["404"])
+		}
+		aclStatus, err := acl.AllowRead(original.URI)
+		if aclStatus > 200 || err != nil {
+			return nil, r.respond(aclStatus, handleStatusText(aclStatus, err))
+		}
+		w.Header().Set(HCType, linkFormatMime)
+		if req.Method == "HEAD" {
+			return nil, r.respond(200)
+		}
+		return nil, r.respond(200, s.timeMap(original, names))
+
+	case req.Method == "POST" && len(name) > 0:
+		// restore the version as the current state of the resource
+		unlock := lock(original.File)
+		defer unlock()
+		aclWrite, err := acl.AllowWrite(original.URI)
+		if aclWrite > 200 || err != nil {
+			return nil, r.respond(aclWrite, handleStatusText(aclWrite, err))
+		}
+		if stat, err := s.Storage.Stat(original.File); err == nil && stat.IsDir() {
+			return nil, r.respond(409, "409 - Conflict! A container now has the path of "+original.URI)
+		}
+		if err = s.snapshot(original); err != nil {
+			s.debug.Println("Restore snapshot err: " + err.Error())
+			return nil, r.respond(500, err)
+		}
+		version := s.memento(original, name)
+		if err = s.copyFile(version.File, original.File); err != nil {
+			s.debug.Println("Restore copyFile err: " + err.Error())
+			return nil, r.respond(500, err)
+		}
+		if err = s.writeTypeFile(original.TypeFile, version.FileType); err != nil {
+			s.debug.Println("Restore writeTypeFile err: " + err.Error())
+		}
+		onUpdateURI(original.URI)
+		w.Header().Set("Location", original.URI)
+		return nil, r.respond(200)
+	}
+	w.Header().Set("Allow", "GET, HEAD, POST")
+	return nil, r.respond(405, "405 - Method Not Allowed")
+}
@@ -0,0 +1,156 @@
+package gold
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewolson/testflight"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionName(t *testing.T) {
+	now := time.Date(2024, 2, 29, 13, 4, 5, 6007, time.UTC)
+	name := versionName(now)
+	assert.Equal(t, "20240229T130405000006007Z", name)
+	parsed, ok := parseVersionName(name)
+	assert.True(t, ok)
+	assert.True(t, now.Equal(parsed))
+	_, ok = parseVersionName("doc")
+	assert.False(t, ok)
+
+	assert.True(t, isHiddenPath(VersionsPrefix+"/doc"))
+	assert.True(t, isHiddenPath("dir/"+TrashPrefix))
+	assert.False(t, isHiddenPath("dir/,versionsX/doc"))
+}
+
+func TestVersioning(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	config.Versioning = true
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll(config.DataRoot, 0755)
+	mementos := regexp.MustCompile(`<([^>]+)>;rel="[a-z ]*memento"`)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		put := func(body string) int {
+			request, _ := http.NewRequest("PUT", "/doc", strings.NewReader(body))
+			request.Header.Add("Content-Type", "text/turtle")
+			return r.Do(request).StatusCode
+		}
+		versions := func() []string {
+			var paths []string
+			response := r.Get("/" + VersionsPrefix + "/doc")
+			for _, m := range mementos.FindAllStringSubmatch(response.Body, -1) {
+				u, _ := url.Parse(m[1])
+				paths = append(paths, u.Path)
+			}
+			return paths
+		}
+
+		assert.Equal(t, 201, put("<#a> <#b> \"one\" ."))
+		assert.Equal(t, 404, r.Get("/"+VersionsPrefix+"/doc").StatusCode)
+		assert.Equal(t, 201, put("<#a> <#b> \"two\" ."))
+		// a rejected change keeps no version
+		assert.Equal(t, 400, put("<#a> <#b> "))
+
+		response := r.Get("/doc")
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, strings.Join(response.RawResponse.Header["Link"], ", "), "/"+VersionsPrefix+"/doc>; rel=\"timemap\"")
+
+		response = r.Get("/" + VersionsPrefix + "/doc")
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Equal(t, linkFormatMime, response.RawResponse.Header.Get(HCType))
+		assert.Contains(t, response.Body, ";rel=\"original timegate\"")
+		assert.Contains(t, response.Body, ";rel=\"first last memento\";datetime=")
+		paths := versions()
+		if !assert.Len(t, paths, 1) {
+			return
+		}
+
+		request, _ := http.NewRequest("GET", paths[0], nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, response.Body, "\"one\"")
+
+		// versions are only read through the resource's ACL, never queried
+		query := "?query=" + url.QueryEscape("SELECT * WHERE { ?s ?p ?o }")
+		assert.Equal(t, 403, r.Get("/"+VersionsPrefix+"/doc/"+query).StatusCode)
+		assert.Equal(t, 403, r.Get("/"+VersionsPrefix+"/"+query).StatusCode)
+		g := NewGraph("http://" + r.Url("/"))
+		root, _ := s.pathInfo("http://" + r.Url("/"+VersionsPrefix+"/"))
+		s.loadSPARQLDataset(g, root, nil)
+		assert.Equal(t, 0, g.Len())
+		assert.NotEmpty(t, response.RawResponse.Header.Get("Memento-Datetime"))
+
+		// the resource is its own TimeGate
+		at := func(datetime string) *testflight.Response {
+			request, _ := http.NewRequest("GET", "/doc", nil)
+			request.Header.Add("Accept", "text/turtle")
+			request.Header.Add("Accept-Datetime", datetime)
+			return r.Do(request)
+		}
+		response = at("Thu, 01 Jan 1970 00:00:00 GMT")
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Contains(t, response.Body, "\"one\"")
+		assert.Equal(t, "http://"+r.Url(paths[0]), response.RawResponse.Header.Get("Content-Location"))
+		response = at(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		assert.Contains(t, response.Body, "\"two\"")
+		assert.Empty(t, response.RawResponse.Header.Get("Memento-Datetime"))
+		assert.Equal(t, 400, at("yesterday").StatusCode)
+
+		// restoring keeps the state it replaces
+		request, _ = http.NewRequest("POST", paths[0], nil)
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		request, _ = http.NewRequest("GET", "/doc", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Contains(t, response.Body, "\"one\"")
+		assert.Len(t, versions(), 2)
+
+		request, _ = http.NewRequest("DELETE", "/doc", nil)
+		assert.Equal(t, 200, r.Do(request).StatusCode)
+		assert.Equal(t, 404, r.Get("/doc").StatusCode)
+		assert.Len(t, versions(), 3)
+
+		request, _ = http.NewRequest("PUT", paths[0], strings.NewReader("<#a> <#b> \"three\" ."))
+		request.Header.Add("Content-Type", "text/turtle")
+		assert.Equal(t, 405, r.Do(request).StatusCode)
+		assert.Equal(t, 404, r.Get("/"+VersionsPrefix+"/doc/20000101T000000000000000Z").StatusCode)
+
+		request, _ = http.NewRequest("GET", "/", nil)
+		request.Header.Add("Accept", "text/turtle")
+		response = r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.NotContains(t, response.Body, VersionsPrefix)
+	})
+}
+
+func TestSnapshotUniqueNames(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	config.Versioning = true
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll(config.DataRoot, 0755)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		writeStorageFile(s.Storage, "/pod/doc", []byte("<#a> <#b> \"one\" ."), 0644)
+		resource, err := s.pathInfo("http://" + r.Url("/doc"))
+		assert.NoError(t, err)
+
+		// both versions share the modification time of the file
+		assert.NoError(t, s.snapshot(resource))
+		assert.NoError(t, s.snapshot(resource))
+		names := s.versions(resource)
+		if assert.Len(t, names, 2) {
+			assert.NotEqual(t, names[0], names[1])
+		}
+	})
+}
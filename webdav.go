@@ -0,0 +1,368 @@
+package gold
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// webdavBase is the base that the ,meta files are read and written against
+// by the WebDAV handler, which knows paths but not hosts. Since the files
+// are written with relative IRIs, the base never shows in them.
+const webdavBase = "http://gold.invalid"
+
+// webdavFile is a file opened by the WebDAV handler. It keeps the dead
+// properties of its resource as RDF in the resource's ,meta file: each one
+// is a literal, named by the IRI made of the namespace and the local name
+// of the property.
+type webdavFile struct {
+	File
+	fs   webdavFS
+	name string
+}
+
+// webdavInfo gives the WebDAV handler the content type and ETag that the
+// server itself reports for a file
+type webdavInfo struct {
+	os.FileInfo
+	fs   webdavFS
+	file string
+}
+
+// ContentType returns the declared or detected type of a file
+func (fi webdavInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.IsDir() {
+		return "", webdav.ErrNotImplemented
+	}
+	if ctype := fi.fs.s.readTypeFile(fi.file + TYPESuffix); len(ctype) > 0 {
+		return ctype, nil
+	}
+	return fi.fs.s.TypeDetector.TypeByFile(fi.file)
+}
+
+// ETag returns the ETag that GET responses carry
+func (fi webdavInfo) ETag(ctx context.Context) (string, error) {
+	etag, err := newETag(fi.fs.s.Storage, fi.file)
+	if err != nil {
+		return "", err
+	}
+	return "\"" + etag + "\"", nil
+}
+
+// Stat describes the file with its content type and ETag
+func (f *webdavFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return webdavInfo{info, f.fs, f.fs.resolve(f.name)}, nil
+}
+
+// Readdir lists a directory, without the ,acl, ,meta and ,type files and
+// the hidden files when the file system serves listings
+func (f *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	if err != nil {
+		return infos, err
+	}
+	listed := infos[:0]
+	for _, info := range infos {
+		if f.fs.listing && (isHiddenFile(info.Name()) || isSidecar(info.Name()) || !f.fs.readable(path.Join(f.name, info.Name()), info.IsDir())) {
+			continue
+		}
+		listed = append(listed, webdavInfo{info, f.fs, path.Join(f.fs.resolve(f.name), info.Name())})
+	}
+	return listed, nil
+}
+
+// readable reports whether the user may read the resource with a name
+func (fs webdavFS) readable(name string, dir bool) bool {
+	if fs.acl == nil {
+		return true
+	}
+	uri := fs.base + (&url.URL{Path: path.Clean("/" + name)}).EscapedPath()
+	if dir {
+		uri += "/"
+	}
+	status, err := fs.acl.AllowRead(uri)
+	return status == 200 && err == nil
+}
+
+// isSidecar reports whether a file holds the ACL, metadata or content type
+// of another
+func isSidecar(name string) bool {
+	for _, suffix := range sidecarSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// metaFile returns the name of the ,meta file of the resource, and the URI
+// of the resource
+func (f *webdavFile) metaFile() (string, string, error) {
+	file := f.fs.resolve(f.name)
+	info, err := f.fs.s.Storage.Stat(file)
+	if err != nil {
+		return "", "", err
+	}
+	uri := webdavBase + (&url.URL{Path: path.Clean("/" + f.name)}).EscapedPath()
+	if info.IsDir() {
+		return file + "/" + METASuffix, strings.TrimSuffix(uri, "/") + "/", nil
+	}
+	return file + METASuffix, uri, nil
+}
+
+// meta reads the ,meta file of the resource
+func (f *webdavFile) meta(file, uri string) *Graph {
+	g := NewGraph(uri + METASuffix)
+	g.readStorage(f.fs.s.Storage, file)
+	return g
+}
+
+// propertyName returns the name of the dead property that a predicate
+// holds, splitting the IRI after its last '/', '#' or ':'
+func propertyName(predicate string) (xml.Name, bool) {
+	i := strings.LastIndexAny(predicate, "/#:")
+	if i < 0 || i == len(predicate)-1 {
+		return xml.Name{}, false
+	}
+	return xml.Name{Space: predicate[:i+1], Local: predicate[i+1:]}, true
+}
+
+// DeadProps returns the literals that the ,meta file says about the resource
+func (f *webdavFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	file, uri, err := f.metaFile()
+	if err != nil {
+		return nil, err
+	}
+	g, subject := f.meta(file, uri), NewResource(uri)
+	props := map[xml.Name]webdav.Property{}
+	for _, triple := range g.All(subject, nil, nil) {
+		literal, ok := triple.Object.(*Literal)
+		if !ok {
+			continue
+		}
+		name, ok := propertyName(termValue(triple.Predicate))
+		if !ok {
+			continue
+		}
+		prop := webdav.Property{XMLName: name, Lang: literal.Language}
+		if literal.Datatype != nil && termValue(literal.Datatype) == rdfXMLLiteral {
+			prop.InnerXML = []byte(literal.Value)
+		} else {
+			var buf bytes.Buffer
+			xml.EscapeText(&buf, []byte(literal.Value))
+			prop.InnerXML = buf.Bytes()
+		}
+		props[name] = prop
+	}
+	return props, nil
+}
+
+// Patch sets and removes dead properties in the ,meta file of the resource,
+// all at once. Properties without a namespace have no IRI and cannot be set.
+func (f *webdavFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	forbidden := webdav.Propstat{Status: http.StatusForbidden}
+	failed := webdav.Propstat{Status: webdav.StatusFailedDependency}
+	done := webdav.Propstat{Status: http.StatusOK}
+	for _, patch := range patches {
+		for _, prop := range patch.Props {
+			if len(prop.XMLName.Space) == 0 {
+				forbidden.Props = append(forbidden.Props, webdav.Property{XMLName: prop.XMLName})
+			} else {
+				failed.Props = append(failed.Props, webdav.Property{XMLName: prop.XMLName})
+				done.Props = append(done.Props, webdav.Property{XMLName: prop.XMLName})
+			}
+		}
+	}
+	if len(forbidden.Props) > 0 {
+		if len(failed.Props) == 0 {
+			return []webdav.Propstat{forbidden}, nil
+		}
+		return []webdav.Propstat{forbidden, failed}, nil
+	}
+
+	file, uri, err := f.metaFile()
+	if err != nil {
+		return nil, err
+	}
+	unlock := lock(file)
+	defer unlock()
+	g, subject := f.meta(file, uri), NewResource(uri)
+	for _, patch := range patches {
+		for _, prop := range patch.Props {
+			predicate := NewResource(prop.XMLName.Space + prop.XMLName.Local)
+			for _, triple := range g.All(subject, predicate, nil) {
+				g.Remove(triple)
+			}
+			if patch.Remove {
+				continue
+			}
+			if len(prop.Lang) > 0 {
+				g.AddTriple(subject, predicate, NewLiteralWithLanguage(string(prop.InnerXML), prop.Lang))
+			} else {
+				g.AddTriple(subject, predicate, NewLiteralWithDatatype(string(prop.InnerXML), NewResource(rdfXMLLiteral)))
+			}
+		}
+	}
+	if err = writeStorageGraph(f.fs.s.Storage, file, g, "text/turtle"); err != nil {
+		return nil, err
+	}
+	return []webdav.Propstat{done}, nil
+}
+
+// webdavName is the name of a resource for the WebDAV handler and its lock
+// system: its URL path
+func webdavName(resource *pathInfo) string {
+	return path.Clean("/" + resource.Path)
+}
+
+// lockSystem returns the WebDAV locks of a data root, so that the same paths
+// on two hosts are not locked together
+func (s *Server) lockSystem(root string) webdav.LockSystem {
+	s.webdavLocks.Lock()
+	defer s.webdavLocks.Unlock()
+	ls, ok := s.webdavLocks.m[root]
+	if !ok {
+		ls = webdav.NewMemLS()
+		s.webdavLocks.m[root] = ls
+	}
+	return ls
+}
+
+// webdavHandler serves WebDAV requests from the data root of a resource.
+// Listings leave out what acl does not let the user read.
+func (s *Server) webdavHandler(resource *pathInfo, acl *WAC, listing bool) *webdav.Handler {
+	fs := webdavFS{s: s, root: resource.Root, base: resource.Base, listing: listing}
+	if listing {
+		fs.acl = acl
+	}
+	return &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: s.lockSystem(resource.Root),
+	}
+}
+
+// lockFiles takes the locks of the lock() map for a few files, in order so
+// that two requests cannot each wait for the other
+func lockFiles(files ...string) func() {
+	sort.Strings(files)
+	var unlocks []func()
+	for i, file := range files {
+		if len(file) > 0 && (i == 0 || file != files[i-1]) {
+			unlocks = append(unlocks, lock(file))
+		}
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// confirmLocks checks that a request that changes resources is not kept
+// out by WebDAV locks: either the resources are not locked, in which case
+// they are locked until the returned function is called, or the If header
+// of the request holds the tokens of the locks. deep resources are locked
+// with everything in them. It returns the status to respond with
+// otherwise.
+func (s *Server) confirmLocks(req *httpRequest, deep bool, resources ...*pathInfo) (func(), int, error) {
+	ls := s.lockSystem(resources[0].Root)
+	now := time.Now()
+	names := make([]string, 2)
+	for i, resource := range resources {
+		names[i] = webdavName(resource)
+	}
+	header := req.Header.Get("If")
+	if len(header) == 0 {
+		var tokens []string
+		release := func() {
+			for _, token := range tokens {
+				ls.Unlock(now, token)
+			}
+		}
+		for _, name := range names[:len(resources)] {
+			token, err := ls.Create(now, webdav.LockDetails{Root: name, Duration: -1, ZeroDepth: !deep})
+			if err != nil {
+				release()
+				if err == webdav.ErrLocked {
+					return nil, webdav.StatusLocked, errors.New("423 - Locked")
+				}
+				return nil, http.StatusInternalServerError, err
+			}
+			tokens = append(tokens, token)
+		}
+		return release, 0, nil
+	}
+	for _, list := range ifLists(header) {
+		if release, err := ls.Confirm(now, names[0], names[1], list...); err == nil {
+			return release, 0, nil
+		}
+	}
+	return nil, http.StatusPreconditionFailed, errors.New("412 - Precondition Failed")
+}
+
+// ifLists returns the lists of conditions of an If header. Each list is
+// enough to confirm a lock; the resource tags in front of them are ignored.
+func ifLists(header string) [][]webdav.Condition {
+	var lists [][]webdav.Condition
+	for {
+		start := strings.Index(header, "(")
+		end := strings.Index(header, ")")
+		if start < 0 || end < start {
+			return lists
+		}
+		var list []webdav.Condition
+		not := false
+		for _, field := range strings.Fields(strings.NewReplacer("<", " <", "[", " [").Replace(header[start+1 : end])) {
+			switch {
+			case field == "Not":
+				not = true
+				continue
+			case strings.HasPrefix(field, "<") && strings.HasSuffix(field, ">"):
+				list = append(list, webdav.Condition{Not: not, Token: field[1 : len(field)-1]})
+			case strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]"):
+				list = append(list, webdav.Condition{Not: not, ETag: field[1 : len(field)-1]})
+			}
+			not = false
+		}
+		lists = append(lists, list)
+		header = header[end+1:]
+	}
+}
+
+// handleProps answers PROPFIND and PROPPATCH requests, with the WAC checks
+// of GET and PATCH. PROPFIND goes no deeper than the children of a
+// container, and lists only those the user may read.
+func (s *Server) handleProps(w http.ResponseWriter, req *httpRequest, acl *WAC, resource *pathInfo) *response {
+	r := new(response)
+	if req.Method == "PROPFIND" {
+		aclStatus, err := acl.AllowRead(resource.URI)
+		if aclStatus > 200 || err != nil {
+			return r.respond(aclStatus, handleStatusText(aclStatus, err))
+		}
+		if depth := req.Header.Get("Depth"); depth != "0" && depth != "1" {
+			w.Header().Set(HCType, "application/xml; charset=utf-8")
+			return r.respond(403, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+`<D:error xmlns:D="DAV:"><D:propfind-finite-depth/></D:error>`)
+		}
+	} else {
+		aclWrite, err := acl.AllowWrite(resource.URI)
+		if aclWrite > 200 || err != nil {
+			return r.respond(aclWrite, handleStatusText(aclWrite, err))
+		}
+	}
+	s.webdavHandler(resource, acl, true).ServeHTTP(w, req.Request)
+	return r
+}
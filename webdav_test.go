@@ -0,0 +1,169 @@
+package gold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/drewolson/testflight"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIfLists(t *testing.T) {
+	lists := ifLists(`<http://example.org/doc> (<urn:uuid:1> ["etag"]) (Not <urn:uuid:2>)`)
+	if assert.Len(t, lists, 2) {
+		assert.Len(t, lists[0], 2)
+		assert.Equal(t, "urn:uuid:1", lists[0][0].Token)
+		assert.Equal(t, `"etag"`, lists[0][1].ETag)
+		assert.True(t, lists[1][0].Not)
+		assert.Equal(t, "urn:uuid:2", lists[1][0].Token)
+	}
+}
+
+func TestWebDAVProperties(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll("/pod/dir", 0755)
+	writeStorageFile(s.Storage, "/pod/dir/doc", []byte("<#a> <#b> <#c> ."), 0644)
+	writeStorageFile(s.Storage, "/pod/dir/doc,type", []byte("text/turtle"), 0644)
+	writeStorageFile(s.Storage, "/pod/dir/doc,meta", []byte("<doc> <http://purl.org/dc/terms/title> \"Notes\" ."), 0644)
+	writeStorageFile(s.Storage, "/pod/dir/private", []byte("<#a> <#b> <#c> ."), 0644)
+	writeStorageFile(s.Storage, "/pod/dir/private,acl", []byte(`@prefix acl: <http://www.w3.org/ns/auth/acl#> .
+<#owner> acl:accessTo <private> ; acl:agent <https://example.org/profile#me> ; acl:mode acl:Read, acl:Write, acl:Control .`), 0644)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		propfind := func(path, depth string) *testflight.Response {
+			request, _ := http.NewRequest("PROPFIND", path, strings.NewReader(`<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`))
+			request.Header.Add("Content-Type", "application/xml")
+			request.Header.Add("Accept", "text/xml")
+			if len(depth) > 0 {
+				request.Header.Add("Depth", depth)
+			}
+			return r.Do(request)
+		}
+
+		response := propfind("/dir/", "1")
+		assert.Equal(t, 207, response.StatusCode)
+		assert.Contains(t, response.Body, "<D:href>/dir/doc</D:href>")
+		assert.NotContains(t, response.Body, ",meta")
+		assert.NotContains(t, response.Body, "private")
+		assert.Contains(t, response.Body, "<D:getcontenttype>text/turtle</D:getcontenttype>")
+		assert.Contains(t, response.Body, `<title xmlns="http://purl.org/dc/terms/">Notes</title>`)
+		assert.Equal(t, 403, propfind("/dir/", "").StatusCode)
+
+		request, _ := http.NewRequest("PROPPATCH", "/dir/doc", strings.NewReader(`<?xml version="1.0"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://example.org/props/">
+  <D:set><D:prop><Z:color>blue</Z:color></D:prop></D:set>
+  <D:remove><D:prop><title xmlns="http://purl.org/dc/terms/"/></D:prop></D:remove>
+</D:propertyupdate>`))
+		request.Header.Add("Content-Type", "application/xml")
+		response = r.Do(request)
+		assert.Equal(t, 207, response.StatusCode)
+		assert.Contains(t, response.Body, "200 OK")
+
+		data, err := readStorageFile(s.Storage, "/pod/dir/doc,meta")
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "<http://example.org/props/color>")
+		assert.NotContains(t, string(data), "Notes")
+		response = propfind("/dir/doc", "0")
+		assert.Contains(t, response.Body, `<color xmlns="http://example.org/props/">blue</color>`)
+
+		request, _ = http.NewRequest("PROPPATCH", "/dir/doc", strings.NewReader(`<?xml version="1.0"?>
+<D:propertyupdate xmlns:D="DAV:"><D:set><D:prop><D:getetag>x</D:getetag></D:prop></D:set></D:propertyupdate>`))
+		request.Header.Add("Content-Type", "application/xml")
+		assert.Contains(t, r.Do(request).Body, "403 Forbidden")
+	})
+}
+
+func TestWebDAVLocks(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	s.Storage.MkdirAll("/pod/", 0755)
+	writeStorageFile(s.Storage, "/pod/doc", []byte("<#a> <#b> <#c> ."), 0644)
+
+	testflight.WithServer(s, func(r *testflight.Requester) {
+		put := func(ifHeader string) int {
+			request, _ := http.NewRequest("PUT", "/doc", strings.NewReader("<#a> <#b> <#d> ."))
+			request.Header.Add("Content-Type", "text/turtle")
+			if len(ifHeader) > 0 {
+				request.Header.Add("If", ifHeader)
+			}
+			return r.Do(request).StatusCode
+		}
+
+		request, _ := http.NewRequest("LOCK", "/doc", strings.NewReader(`<?xml version="1.0"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`))
+		request.Header.Add("Content-Type", "application/xml")
+		request.Header.Add("Timeout", "Second-60")
+		response := r.Do(request)
+		assert.Equal(t, 200, response.StatusCode)
+		token := response.RawResponse.Header.Get("Lock-Token")
+		assert.NotEmpty(t, token)
+
+		assert.Equal(t, 423, put(""))
+		assert.Equal(t, 412, put("(<urn:wrong>)"))
+		assert.Equal(t, 201, put("("+token+")"))
+		request, _ = http.NewRequest("DELETE", "/doc", nil)
+		assert.Equal(t, 423, r.Do(request).StatusCode)
+
+		request, _ = http.NewRequest("UNLOCK", "/doc", nil)
+		request.Header.Add("Lock-Token", token)
+		assert.Equal(t, 204, r.Do(request).StatusCode)
+		request, _ = http.NewRequest("DELETE", "/doc", nil)
+		assert.Equal(t, 200, r.Do(request).StatusCode)
+	})
+}
+
+func TestWebDAVVhosts(t *testing.T) {
+	config := NewServerConfig()
+	config.DataRoot = "/pod/"
+	config.Vhosts = true
+	s := NewServer(config)
+	s.Storage = NewMemStorage()
+	for _, host := range []string{"a.example", "b.example", "victim.example"} {
+		s.Storage.MkdirAll("/pod/"+host, 0755)
+		writeStorageFile(s.Storage, "/pod/"+host+"/doc", []byte("<#a> <#b> <#c> ."), 0644)
+	}
+	writeStorageFile(s.Storage, "/pod/victim.example/secret", []byte("<#a> <#b> <#c> ."), 0644)
+
+	do := func(method, host, path, body string, headers ...string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "http://"+host+path, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			request.Header.Add(headers[i], headers[i+1])
+		}
+		response := httptest.NewRecorder()
+		s.ServeHTTP(response, request)
+		return response
+	}
+
+	// the WebDAV handler only sees the data root of the host
+	response := do("PROPFIND", "a.example", "/victim.example/", `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`,
+		"Content-Type", "application/xml", "Depth", "1")
+	assert.NotContains(t, response.Body.String(), "secret")
+	response = do("PROPFIND", "a.example", "/", `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`,
+		"Content-Type", "application/xml", "Depth", "1")
+	assert.Equal(t, 207, response.Code)
+	assert.Contains(t, response.Body.String(), "<D:href>/doc</D:href>")
+	assert.NotContains(t, response.Body.String(), "victim")
+	do("PROPPATCH", "a.example", "/victim.example/secret", `<?xml version="1.0"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://example.org/props/"><D:set><D:prop><Z:color>blue</Z:color></D:prop></D:set></D:propertyupdate>`,
+		"Content-Type", "application/xml")
+	_, err := s.Storage.Stat("/pod/victim.example/secret" + METASuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	// locks are named by URL path, apart for each host
+	response = do("LOCK", "a.example", "/doc", `<?xml version="1.0"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`,
+		"Content-Type", "application/xml", "Timeout", "Second-60")
+	assert.Equal(t, 200, response.Code)
+	token := response.Header().Get("Lock-Token")
+	assert.Equal(t, 423, do("PUT", "a.example", "/doc", "<#a> <#b> <#d> .", "Content-Type", "text/turtle").Code)
+	assert.Equal(t, 201, do("PUT", "b.example", "/doc", "<#a> <#b> <#d> .", "Content-Type", "text/turtle").Code)
+	assert.Equal(t, 201, do("PUT", "a.example", "/doc", "<#a> <#b> <#d> .", "Content-Type", "text/turtle", "If", "("+token+")").Code)
+}
@@ -100,7 +100,7 @@ func WebIDDigestAuth(req *httpRequest) (string, error) {
 	for _, keyT := range g.All(NewResource(webid), ns.cert.Get("key"), nil) {
 		for range g.All(keyT.Object, ns.rdf.Get("type"), ns.cert.Get("RSAPublicKey")) {
 			for _, pubP := range g.All(keyT.Object, ns.cert.Get("pem"), nil) {
-				keyP := term2C(pubP.Object).String()
+				keyP := termValue(pubP.Object)
 				// loop through all the PEM keys
 				parser, err := ParseRSAPublicPEMKey([]byte(keyP))
 				if err == nil {
@@ -112,9 +112,9 @@ func WebIDDigestAuth(req *httpRequest) (string, error) {
 			}
 			// also loop through modulus/exp
 			for _, pubN := range g.All(keyT.Object, ns.cert.Get("modulus"), nil) {
-				keyN := term2C(pubN.Object).String()
+				keyN := termValue(pubN.Object)
 				for _, pubE := range g.All(keyT.Object, ns.cert.Get("exponent"), nil) {
-					keyE := term2C(pubE.Object).String()
+					keyE := termValue(pubE.Object)
 					// println(keyN, keyE)
 					parser, err := ParseRSAPublicKeyNE("RSAPublicKey", keyN, keyE)
 					if err == nil {
@@ -191,36 +191,38 @@ func WebIDTLSAuth(tls *tls.ConnectionState) (uri string, err error) {
 
 		for _, keyT := range g.All(NewResource(claim), ns.cert.Get("key"), nil) {
 			// found pkey in the profile
-			for range g.All(keyT.Object, ns.rdf.Get("type"), ns.cert.Get(t)) {
-				for range g.All(keyT.Object, ns.cert.Get("modulus"), NewLiteral(n)) {
-					goto matchModulus
-				}
-				for range g.All(keyT.Object, ns.cert.Get("modulus"), NewLiteralWithDatatype(n, NewResource("http://www.w3.org/2001/XMLSchema#hexBinary"))) {
-					goto matchModulus
-				}
-			matchModulus:
-				// found a matching modulus in the profile
-				for range g.All(keyT.Object, ns.cert.Get("exponent"), NewLiteral(e)) {
-					goto matchExponent
-				}
-				for range g.All(keyT.Object, ns.cert.Get("exponent"), NewLiteralWithDatatype(e, NewResource("http://www.w3.org/2001/XMLSchema#int"))) {
-					goto matchExponent
-				}
-			matchExponent:
-				// found a matching exponent in the profile
-				uri = claim
-				webidL.Lock()
-				pkeyURI[pkeyk] = uri
-				webidL.Unlock()
-				return
+			if g.One(keyT.Object, ns.rdf.Get("type"), ns.cert.Get(t)) == nil {
+				continue
+			}
+			// typed literals match by value, whatever their case or integer type
+			if !hasKeyValue(g, keyT.Object, ns.cert.Get("modulus"), NewLiteralWithDatatype(n, ns.xsd.Get("hexBinary"))) ||
+				!hasKeyValue(g, keyT.Object, ns.cert.Get("exponent"), NewLiteralWithDatatype(e, ns.xsd.Get("integer"))) {
+				// could not find a certificate in the profile
+				continue
 			}
-			// could not find a certificate in the profile
+			uri = claim
+			webidL.Lock()
+			pkeyURI[pkeyk] = uri
+			webidL.Unlock()
+			return
 		}
 		// could not find a certificate pkey in the profile
 	}
 	return
 }
 
+// hasKeyValue reports whether a key in a profile has a property equal by
+// value to the given one, typed or, as in older profiles, untyped
+func hasKeyValue(g *Graph, key Term, p Term, value Term) bool {
+	untyped := NewLiteral(termValue(value))
+	for _, triple := range g.All(key, p, nil) {
+		if SameValue(triple.Object, value) || triple.Object.Equal(untyped) {
+			return true
+		}
+	}
+	return false
+}
+
 // WebIDFromCert returns subjectAltName string from x509 []byte
 func WebIDFromCert(cert []byte) (string, error) {
 	parsed, err := x509.ParseCertificate(cert)